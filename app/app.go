@@ -1,6 +1,7 @@
 package app
 
 import (
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -11,8 +12,9 @@ import (
 )
 
 var (
-	db     *sqlx.DB
-	logger *zap.SugaredLogger
+	db        *sqlx.DB
+	logger    *zap.SugaredLogger
+	closeOnce sync.Once
 )
 
 func Init() {
@@ -60,7 +62,11 @@ func GetDB() *sqlx.DB {
 	return db
 }
 
+// Close closes the database pool and flushes the logger. The servers close
+// it when they shut down, it is safe to call again.
 func Close() {
-	logger.Sync()
-	db.Close()
+	closeOnce.Do(func() {
+		db.Close()
+		logger.Sync()
+	})
 }
@@ -0,0 +1,139 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+var (
+	ErrWrongMultiplex         = errors.New("err: not a multiplex you work at")
+	ErrOutsideAdmissionWindow = errors.New("err: show is not admitting")
+)
+
+// admissionWindow is when ticket holders of a show starting at start are let
+// in.
+func admissionWindow(start time.Time) (opens time.Time, closes time.Time) {
+	opens = start.Add(-minutes(config.Show().AdmissionOpensMins()))
+	closes = start.Add(minutes(config.Show().AdmissionClosesMins()))
+	return
+}
+
+func (b *bookingService) CheckIn(ctx context.Context, staffEmail string, c CheckIn) (resp CheckInResponse, err error) {
+	claims, err := ParseTicketToken(c.Ticket)
+	if err != nil {
+		return
+	}
+
+	staff, err := b.store.GetUserByEmail(ctx, staffEmail)
+	if err != nil {
+		b.logger.Errorf("Err: Check in by %v: %v", staffEmail, err.Error())
+		return
+	}
+	// staff admit at the multiplex they are assigned to, whatever they say
+	multiplex_id, err := staffMultiplex(staff, c.Multiplex_id)
+	if err != nil {
+		return
+	}
+	if multiplex_id == 0 {
+		multiplex_id = claims.Multiplex_id
+	}
+	if claims.Multiplex_id != multiplex_id {
+		err = ErrWrongMultiplex
+		return
+	}
+
+	// the ticket only proves which booking it is for, everything else comes
+	// from the db in case the show was moved after the ticket was issued
+	bk, err := b.store.GetBookingByID(ctx, claims.Booking_id)
+	if err != nil {
+		if err == db.ErrBookingNotFound {
+			err = ErrInvalidTicket
+		}
+		return
+	}
+	if bk.Show_id != claims.Show_id || bk.Multiplex_id != multiplex_id {
+		err = ErrInvalidTicket
+		return
+	}
+
+	resp = newCheckInResponse(bk)
+	if bk.Checked_in_at != nil {
+		resp.Checked_in_at = bk.Checked_in_at.Format(time.RFC3339)
+		err = db.ErrAlreadyCheckedIn
+		return
+	}
+	if bk.Status != db.BookingConfirmed || bk.Show_status == db.ShowCancelled {
+		err = ErrTicketUnavailable
+		return
+	}
+
+	now := time.Now()
+	opens, closes := admissionWindow(bk.Start_time)
+	if now.Before(opens) || now.After(closes) {
+		err = ErrOutsideAdmissionWindow
+		return
+	}
+
+	checked_in_at, err := b.store.CheckInBooking(ctx, bk.Booking_id, staff.User_id)
+	if err == db.ErrAlreadyCheckedIn {
+		// someone else got there first, or the booking changed under us
+		latest, e := b.store.GetBookingByID(ctx, bk.Booking_id)
+		if e != nil {
+			b.logger.Errorf("Err: Getting booking %v: %v", bk.Booking_id, e.Error())
+			return resp, e
+		}
+		if latest.Checked_in_at == nil {
+			return resp, ErrTicketUnavailable
+		}
+		resp.Checked_in_at = latest.Checked_in_at.Format(time.RFC3339)
+		return
+	}
+	if err != nil {
+		b.logger.Errorf("Err: Checking in booking %v: %v", bk.Booking_id, err.Error())
+		return
+	}
+
+	resp.Checked_in_at = checked_in_at.Format(time.RFC3339)
+	b.logger.Infof("Booking %v checked in by %v", bk.Booking_id, staff.User_id)
+	return
+}
+
+func newCheckInResponse(bk db.BookingDetail) CheckInResponse {
+	loc, e := time.LoadLocation(bk.Time_zone)
+	if e != nil {
+		loc = time.UTC
+	}
+	return CheckInResponse{
+		Booking_id: bk.Booking_id,
+		Show_id:    bk.Show_id,
+		Movie:      bk.Title,
+		Start_time: bk.Start_time.In(loc).Format(time.RFC3339),
+		Screen:     bk.Screen_number,
+		Seats:      bk.Seats,
+	}
+}
+
+func (b *bookingService) GetAdmissions(ctx context.Context, show_id int) (a AdmissionCount, err error) {
+	if _, err = b.store.GetShowByID(ctx, show_id); err != nil {
+		return
+	}
+
+	counts, err := b.store.GetAdmissionsOfShow(ctx, show_id)
+	if err != nil {
+		b.logger.Errorf("Err: Counting admissions of show %v: %v", show_id, err.Error())
+		return
+	}
+
+	a = AdmissionCount{
+		Show_id:           show_id,
+		Bookings:          counts.Bookings,
+		Seats:             counts.Seats,
+		Admitted_bookings: counts.Admitted_bookings,
+		Admitted_seats:    counts.Admitted_seats,
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package booking
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+func (b *bookingService) AddCoupon(ctx context.Context, nc NewCoupon) (coupon_id uint, err error) {
+	c := db.Coupon{
+		Code:           strings.ToUpper(strings.TrimSpace(nc.Code)),
+		Kind:           nc.Kind,
+		Value:          nc.Value,
+		Max_discount:   nc.Max_discount,
+		Min_tickets:    nc.Min_tickets,
+		Movie_ids:      nc.Movie_ids,
+		Multiplex_ids:  nc.Multiplex_ids,
+		Days_of_week:   nc.Days_of_week,
+		Per_user_limit: nc.Per_user_limit,
+		Total_limit:    nc.Total_limit,
+	}
+	if c.Min_tickets == 0 {
+		c.Min_tickets = 1
+	}
+
+	if nc.Valid_from != "" {
+		t, e := time.Parse(time.RFC3339, nc.Valid_from)
+		if e != nil {
+			err = ErrInvalidCoupon
+			return
+		}
+		c.Valid_from = &t
+	}
+	if nc.Expires_at != "" {
+		t, e := time.Parse(time.RFC3339, nc.Expires_at)
+		if e != nil {
+			err = ErrInvalidCoupon
+			return
+		}
+		c.Expires_at = &t
+	}
+
+	coupon_id, err = b.store.AddCoupon(ctx, c)
+	if err != nil {
+		b.logger.Errorf("Err: Adding coupon %v: %v", c.Code, err.Error())
+		return
+	}
+
+	b.logger.Infof("Coupon ID  %v", coupon_id)
+	return
+}
+
+func (b *bookingService) ListCoupons(ctx context.Context) (coupons []CouponResponse, err error) {
+	rows, err := b.store.GetCoupons(ctx)
+	if err != nil {
+		b.logger.Errorf("Err: Listing coupons: %v", err.Error())
+		return
+	}
+
+	coupons = make([]CouponResponse, 0, len(rows))
+	for _, c := range rows {
+		cr := CouponResponse{
+			Coupon_id:      c.Coupon_id,
+			Code:           c.Code,
+			Kind:           c.Kind,
+			Value:          c.Value,
+			Max_discount:   c.Max_discount,
+			Min_tickets:    c.Min_tickets,
+			Movie_ids:      c.Movie_ids,
+			Multiplex_ids:  c.Multiplex_ids,
+			Days_of_week:   c.Days_of_week,
+			Per_user_limit: c.Per_user_limit,
+			Total_limit:    c.Total_limit,
+			Redeemed_count: c.Redeemed_count,
+			Active:         c.Active,
+		}
+		if c.Valid_from != nil {
+			cr.Valid_from = c.Valid_from.Format(time.RFC3339)
+		}
+		if c.Expires_at != nil {
+			cr.Expires_at = c.Expires_at.Format(time.RFC3339)
+		}
+		coupons = append(coupons, cr)
+	}
+	return
+}
+
+func (b *bookingService) DeactivateCoupon(ctx context.Context, coupon_id int) (err error) {
+	err = b.store.DeactivateCoupon(ctx, coupon_id)
+	if err != nil {
+		b.logger.Errorf("Err: Deactivating coupon %v: %v", coupon_id, err.Error())
+		return
+	}
+	return
+}
@@ -1,6 +1,8 @@
 package booking
 
 import (
+	"time"
+
 	"github.com/golang-jwt/jwt"
 )
 
@@ -10,6 +12,12 @@ type NewUser struct {
 	Password     string `json:"password"`
 	Phone_number string `json:"phone_number"`
 	Role         string `json:"role"`
+	Multiplex_id int    `json:"multiplex_id,omitempty"` // where staff work, staff only
+}
+
+type StaffAssignment struct {
+	Email        string `json:"email"`
+	Multiplex_id int    `json:"multiplex_id"`
 }
 
 type NewUserResponse struct {
@@ -36,11 +44,11 @@ type LoginResp struct {
 }
 
 type NewMovie struct {
-	Title        string  `json:"title"`
-	Language     string  `json:"language"`
-	Release_date string  `json:"release_date"`
-	Genre        string  `json:"genre"`
-	Duration     float64 `json:"duration"`
+	Title        string `json:"title"`
+	Language     string `json:"language"`
+	Release_date string `json:"release_date"`
+	Genre        string `json:"genre"`
+	Duration     int    `json:"duration"` // minutes
 }
 
 type NewScreen struct {
@@ -49,6 +57,8 @@ type NewScreen struct {
 	Sound_system     string `json:"sound_system"`
 	Screen_dimension string `json:"screen_dimension"`
 	Multiplex_id     int    `json:"muliplex_id"`
+	Trailer_buffer   *int   `json:"trailer_buffer_mins"`  // left out for the default
+	Cleaning_buffer  *int   `json:"cleaning_buffer_mins"` // left out for the default
 }
 
 type NewMultiplex struct {
@@ -60,6 +70,9 @@ type NewMultiplex struct {
 	State         string `json:"state"`
 	Pincode       int    `json:"pincode"`
 	Location_id   int    `json:"location_id"`
+	Opens_at      string `json:"opens_at"`
+	Closes_at     string `json:"closes_at"`
+	Time_zone     string `json:"time_zone"`
 }
 
 type NewLocation struct {
@@ -69,12 +82,557 @@ type NewLocation struct {
 }
 
 type NewShow struct {
-	Date         string `json:"show_date"`
-	Start_time   string `json:"start_time"`
-	End_time     string `json:"end_time"`
+	Start_time   string `json:"start_time"` // ISO 8601 with offset
 	Movie        string `json:"movie"`
 	Screen       int    `json:"screen"`
 	Screen_id    int    `json:"screen_id"`
 	Movie_id     int    `json:"movie_id"`
 	Multiplex_id int    `json:"multiplex_id"`
 }
+
+type ShowFilter struct {
+	From         time.Time
+	To           time.Time
+	Multiplex_id int
+}
+
+type ShowResponse struct {
+	Show_id      int    `json:"show_id"`
+	Status       string `json:"status"`
+	Show_date    string `json:"show_date"`
+	Start_time   string `json:"start_time"`
+	End_time     string `json:"end_time"`
+	Time_zone    string `json:"time_zone"`
+	Movie        string `json:"movie"`
+	Screen       int    `json:"screen"`
+	Multiplex_id int    `json:"multiplex_id"`
+	Multiplex    string `json:"multiplex"`
+}
+
+type ShowCancellation struct {
+	Reason           string `json:"reason"`
+	Refund_to_wallet bool   `json:"refund_to_wallet"` // instead of how customers paid
+}
+
+type BookingCancellation struct {
+	Booking_id      int     `json:"booking_id"`
+	User_id         int     `json:"user_id,omitempty"`
+	Seats           []int64 `json:"seats"`
+	Status          string  `json:"status"`
+	Refund_id       int     `json:"refund_id,omitempty"`
+	Refund_amount   int     `json:"refund_amount"`
+	Refund_status   string  `json:"refund_status,omitempty"`
+	Refund_to       string  `json:"refund_to,omitempty"` // original or wallet
+	Points_reversed int     `json:"points_reversed,omitempty"`
+	Points_refunded int     `json:"points_refunded,omitempty"`
+	Notified        bool    `json:"notified"`
+}
+
+type CancellationReport struct {
+	Show_id      int                   `json:"show_id"`
+	Status       string                `json:"status"`
+	Total_refund int                   `json:"total_refund"`
+	Bookings     []BookingCancellation `json:"bookings"`
+}
+
+type ShowReschedule struct {
+	Screen     int    `json:"screen"`     // defaults to the current screen
+	Start_time string `json:"start_time"` // ISO 8601 with offset, defaults to the current start
+}
+
+type BookingMigration struct {
+	Booking_id      int     `json:"booking_id"`
+	User_id         int     `json:"user_id,omitempty"`
+	Seats           []int64 `json:"seats"`
+	Status          string  `json:"status"`
+	Action_required bool    `json:"action_required"`
+	Notified        bool    `json:"notified"`
+}
+
+type RescheduleReport struct {
+	Show     ShowResponse       `json:"show"`
+	Bookings []BookingMigration `json:"bookings"`
+}
+
+type Profile struct {
+	User_id      int    `json:"user_id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Phone_number string `json:"phone_number"`
+	Role         string `json:"role"`
+}
+
+type ProfileUpdate struct {
+	Name         string `json:"name"`
+	Phone_number string `json:"phone_number"`
+}
+
+type PasswordChange struct {
+	Current_password string `json:"current_password"`
+	New_password     string `json:"new_password"`
+}
+
+type BookingShow struct {
+	Show_id    int    `json:"show_id"`
+	Status     string `json:"status"`
+	Show_date  string `json:"show_date"`
+	Start_time string `json:"start_time"`
+	End_time   string `json:"end_time"`
+	Screen     int    `json:"screen"`
+}
+
+type BookingMovie struct {
+	Movie_id int    `json:"movie_id"`
+	Title    string `json:"title"`
+	Language string `json:"language"`
+	Genre    string `json:"genre"`
+	Duration int    `json:"duration"`
+}
+
+type BookingMultiplex struct {
+	Multiplex_id int    `json:"multiplex_id"`
+	Name         string `json:"name"`
+	Locality     string `json:"locality"`
+	City         string `json:"city"`
+	State        string `json:"state"`
+	Time_zone    string `json:"time_zone"`
+}
+
+type MyBooking struct {
+	Booking_id int              `json:"booking_id"`
+	Status     string           `json:"status"`
+	Amount     int              `json:"amount"`
+	Currency   string           `json:"currency"`
+	Booked_at  string           `json:"booked_at"`
+	Seats      []int64          `json:"seats"`
+	Show       BookingShow      `json:"show"`
+	Movie      BookingMovie     `json:"movie"`
+	Multiplex  BookingMultiplex `json:"multiplex"`
+}
+
+type CheckIn struct {
+	Ticket       string `json:"ticket"`
+	Multiplex_id int    `json:"multiplex_id,omitempty"` // admins only, staff check in at their own
+}
+
+type CheckInResponse struct {
+	Booking_id    int     `json:"booking_id"`
+	Show_id       int     `json:"show_id"`
+	Movie         string  `json:"movie"`
+	Start_time    string  `json:"start_time"`
+	Screen        int     `json:"screen"`
+	Seats         []int64 `json:"seats"`
+	Checked_in_at string  `json:"checked_in_at"`
+}
+
+type AdmissionCount struct {
+	Show_id           int `json:"show_id"`
+	Bookings          int `json:"bookings"`
+	Seats             int `json:"seats"`
+	Admitted_bookings int `json:"admitted_bookings"`
+	Admitted_seats    int `json:"admitted_seats"`
+}
+
+type ShiftOpening struct {
+	Multiplex_id  int `json:"multiplex_id"`
+	Opening_float int `json:"opening_float"` // minor units
+}
+
+type ShiftClosing struct {
+	Counted_cash int `json:"counted_cash"` // minor units
+}
+
+type DrawerReport struct {
+	Shift_id      int    `json:"shift_id"`
+	Staff_id      int    `json:"staff_id"`
+	Multiplex_id  int    `json:"multiplex_id"`
+	Status        string `json:"status"`
+	Opened_at     string `json:"opened_at"`
+	Closed_at     string `json:"closed_at,omitempty"`
+	Currency      string `json:"currency"`
+	Opening_float int    `json:"opening_float"`
+	Cash_sales    int    `json:"cash_sales"`
+	Card_sales    int    `json:"card_sales"`
+	Bookings      int    `json:"bookings"`
+	Tickets       int    `json:"tickets"`
+	Expected_cash int    `json:"expected_cash"`
+	Counted_cash  *int   `json:"counted_cash,omitempty"`
+	Discrepancy   *int   `json:"discrepancy,omitempty"`
+}
+
+type PosBooking struct {
+	Seats          []int64 `json:"seats"`
+	Customer_phone string  `json:"customer_phone"` // optional
+	Payment_method string  `json:"payment_method"` // cash or card
+}
+
+type PosBookingResponse struct {
+	Booking_id     int            `json:"booking_id"`
+	Show_id        int            `json:"show_id"`
+	Seats          []int64        `json:"seats"`
+	Amount         int            `json:"amount"`
+	Price          PriceBreakdown `json:"price"`
+	Payment_method string         `json:"payment_method"`
+	Shift_id       int            `json:"shift_id"`
+	Ticket         string         `json:"ticket,omitempty"` // reprint from /pos/bookings/{id}/ticket when empty
+}
+
+type BookingRequest struct {
+	Seats          []int64        `json:"seats"`
+	Coupon_code    string         `json:"coupon_code"`
+	Fnb            []FnbSelection `json:"fnb"`
+	Fnb_fulfilment string         `json:"fnb_fulfilment"` // pickup or seat
+	Fnb_time       string         `json:"fnb_time"`       // ISO 8601 with offset, defaults to the show's start
+	Loyalty_points int            `json:"loyalty_points"` // points to spend on the tickets
+	Payment_method string         `json:"payment_method"` // wallet or gift_card, left out to pay at the gateway
+	Gift_card_code string         `json:"gift_card_code"`
+}
+
+type FnbSelection struct {
+	Item_id  int `json:"item_id"`
+	Quantity int `json:"quantity"`
+}
+
+// PriceBreakdown amounts are in minor units of the currency, 100 paise to
+// the rupee.
+type PriceBreakdown struct {
+	Currency string      `json:"currency"`
+	Subtotal int         `json:"subtotal"`
+	Discount int         `json:"discount"`
+	Fnb      int         `json:"fnb"`
+	Fees     int         `json:"fees"`
+	Taxes    int         `json:"taxes"`
+	Total    int         `json:"total"`
+	Coupon   string      `json:"coupon,omitempty"`
+	Items    []PriceItem `json:"items"`
+
+	Points_redeemed int `json:"points_redeemed,omitempty"`
+	Points_value    int `json:"points_value,omitempty"`
+	Points_earned   int `json:"points_earned,omitempty"`
+}
+
+type PriceItem struct {
+	Kind        string `json:"kind"` // ticket, discount, loyalty, fnb, fee or tax
+	Label       string `json:"label"`
+	Quantity    int    `json:"quantity"`
+	Unit_amount int    `json:"unit_amount"`
+	Amount      int    `json:"amount"`
+}
+
+type QuoteResponse struct {
+	Show_id int            `json:"show_id"`
+	Seats   []int64        `json:"seats"`
+	Price   PriceBreakdown `json:"price"`
+}
+
+type BookingResponse struct {
+	Booking_id     int            `json:"booking_id"`
+	Fnb_order_id   int            `json:"fnb_order_id,omitempty"`
+	Show_id        int            `json:"show_id"`
+	Seats          []int64        `json:"seats"`
+	Status         string         `json:"status"`
+	Payment_method string         `json:"payment_method,omitempty"`
+	Price          PriceBreakdown `json:"price"`
+}
+
+type Invoice struct {
+	Invoice_number string           `json:"invoice_number"`
+	Booking_id     int              `json:"booking_id"`
+	Status         string           `json:"status"`
+	Issued_at      string           `json:"issued_at"`
+	Movie          string           `json:"movie"`
+	Show_start     string           `json:"show_start"`
+	Screen         int              `json:"screen"`
+	Seats          []int64          `json:"seats"`
+	Multiplex      BookingMultiplex `json:"multiplex"`
+	Price          PriceBreakdown   `json:"price"`
+}
+
+type TaxRateEntry struct {
+	Name       string `json:"name"`       // e.g. CGST
+	Rate_bps   int    `json:"rate_bps"`   // basis points, 900 is 9%
+	Applies_to string `json:"applies_to"` // tickets, fees or fnb
+}
+
+type TaxRateResponse struct {
+	State      string `json:"state"`
+	Name       string `json:"name"`
+	Rate_bps   int    `json:"rate_bps"`
+	Applies_to string `json:"applies_to"`
+}
+
+type NewPricingRule struct {
+	Name               string `json:"name"`
+	Show_id            *int   `json:"show_id"`      // optional scope
+	Movie_id           *int   `json:"movie_id"`     // optional scope
+	Multiplex_id       *int   `json:"multiplex_id"` // optional scope
+	Min_occupancy_pct  int    `json:"min_occupancy_pct"`
+	Starts_within_mins *int   `json:"starts_within_mins"`
+	Adjust_bps         int    `json:"adjust_bps"`    // 1500 raises prices by 15%
+	Floor_price        *int   `json:"floor_price"`   // minor units
+	Ceiling_price      *int   `json:"ceiling_price"` // minor units
+}
+
+type PricingRuleResponse struct {
+	Rule_id            int    `json:"rule_id"`
+	Name               string `json:"name"`
+	Show_id            *int   `json:"show_id,omitempty"`
+	Movie_id           *int   `json:"movie_id,omitempty"`
+	Multiplex_id       *int   `json:"multiplex_id,omitempty"`
+	Min_occupancy_pct  int    `json:"min_occupancy_pct"`
+	Starts_within_mins *int   `json:"starts_within_mins,omitempty"`
+	Adjust_bps         int    `json:"adjust_bps"`
+	Floor_price        *int   `json:"floor_price,omitempty"`
+	Ceiling_price      *int   `json:"ceiling_price,omitempty"`
+	Active             bool   `json:"active"`
+	Created_at         string `json:"created_at"`
+}
+
+type PriceChangeEntry struct {
+	Seat_number   int    `json:"seat_number"`
+	Old_price     int    `json:"old_price"`
+	New_price     int    `json:"new_price"`
+	Rule_id       int    `json:"rule_id,omitempty"`
+	Occupancy_pct int    `json:"occupancy_pct"`
+	Changed_at    string `json:"changed_at"`
+}
+
+type LoyaltyTierInfo struct {
+	Name                   string `json:"name"`
+	Min_points             int    `json:"min_points"`
+	Earn_multiplier_bps    int    `json:"earn_multiplier_bps"`
+	Waives_convenience_fee bool   `json:"waives_convenience_fee"`
+}
+
+type LoyaltyEntryResponse struct {
+	Kind       string `json:"kind"`
+	Points     int    `json:"points"`
+	Booking_id int    `json:"booking_id,omitempty"`
+	Expires_at string `json:"expires_at,omitempty"`
+	Created_at string `json:"created_at"`
+}
+
+type LoyaltyStatement struct {
+	Balance             int                    `json:"balance"`
+	Balance_value       int                    `json:"balance_value"` // minor units
+	Currency            string                 `json:"currency"`
+	Earned_last_year    int                    `json:"earned_last_year"`
+	Expiring_soon       int                    `json:"expiring_soon"` // within 30 days
+	Tier                LoyaltyTierInfo        `json:"tier"`
+	Next_tier           *LoyaltyTierInfo       `json:"next_tier,omitempty"`
+	Points_to_next_tier int                    `json:"points_to_next_tier,omitempty"`
+	Entries             []LoyaltyEntryResponse `json:"entries"`
+}
+
+type NewFnbItem struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Price       int            `json:"price"` // minor units
+	Stock       *int           `json:"stock"` // leave out to not track stock
+	Combo_items []FnbSelection `json:"combo_items"`
+}
+
+type FnbMenuItem struct {
+	Item_id     int            `json:"item_id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Price       int            `json:"price"`
+	Is_combo    bool           `json:"is_combo"`
+	Stock       *int           `json:"stock,omitempty"`
+	Combo_items []FnbSelection `json:"combo_items,omitempty"`
+}
+
+type FnbStockUpdate struct {
+	Stock *int `json:"stock"`
+}
+
+type KitchenOrder struct {
+	Order_id   int                `json:"order_id"`
+	Booking_id int                `json:"booking_id"`
+	Show_id    int                `json:"show_id"`
+	Screen     int                `json:"screen"`
+	Seats      []int64            `json:"seats"`
+	Fulfilment string             `json:"fulfilment"`
+	Deliver_at string             `json:"deliver_at"`
+	Status     string             `json:"status"`
+	Items      []KitchenOrderItem `json:"items"`
+}
+
+type KitchenOrderItem struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+type FnbOrderUpdate struct {
+	Status string `json:"status"`
+}
+
+type SeatMapEntry struct {
+	Seat_number int    `json:"seat_number"`
+	Price       int    `json:"price"`
+	Status      string `json:"status"`
+}
+
+type NewCoupon struct {
+	Code           string  `json:"code"`
+	Kind           string  `json:"kind"`  // percent or flat
+	Value          int     `json:"value"` // percentage, or flat amount off in minor units
+	Max_discount   *int    `json:"max_discount"`
+	Min_tickets    int     `json:"min_tickets"`
+	Movie_ids      []int64 `json:"movie_ids"`
+	Multiplex_ids  []int64 `json:"multiplex_ids"`
+	Days_of_week   []int64 `json:"days_of_week"` // 0 is Sunday
+	Per_user_limit *int    `json:"per_user_limit"`
+	Total_limit    *int    `json:"total_limit"`
+	Valid_from     string  `json:"valid_from"` // ISO 8601 with offset
+	Expires_at     string  `json:"expires_at"` // ISO 8601 with offset
+}
+
+type CouponResponse struct {
+	Coupon_id      int     `json:"coupon_id"`
+	Code           string  `json:"code"`
+	Kind           string  `json:"kind"`
+	Value          int     `json:"value"`
+	Max_discount   *int    `json:"max_discount,omitempty"`
+	Min_tickets    int     `json:"min_tickets"`
+	Movie_ids      []int64 `json:"movie_ids,omitempty"`
+	Multiplex_ids  []int64 `json:"multiplex_ids,omitempty"`
+	Days_of_week   []int64 `json:"days_of_week,omitempty"`
+	Per_user_limit *int    `json:"per_user_limit,omitempty"`
+	Total_limit    *int    `json:"total_limit,omitempty"`
+	Redeemed_count int     `json:"redeemed_count"`
+	Valid_from     string  `json:"valid_from,omitempty"`
+	Expires_at     string  `json:"expires_at,omitempty"`
+	Active         bool    `json:"active"`
+}
+
+type NewGiftCard struct {
+	Code       string `json:"code"`       // generated when left out
+	Amount     int    `json:"amount"`     // in minor units
+	Expires_at string `json:"expires_at"` // ISO 8601 with offset
+}
+
+type GiftCardResponse struct {
+	Gift_card_id   int    `json:"gift_card_id,omitempty"`
+	Code           string `json:"code"`
+	Initial_amount int    `json:"initial_amount,omitempty"`
+	Balance        int    `json:"balance"`
+	Currency       string `json:"currency"`
+	Status         string `json:"status"`
+	Usable         bool   `json:"usable"`
+	Expires_at     string `json:"expires_at,omitempty"`
+	Created_at     string `json:"created_at,omitempty"`
+}
+
+type WalletStatement struct {
+	Balance  int                   `json:"balance"`
+	Currency string                `json:"currency"`
+	Entries  []WalletEntryResponse `json:"entries"`
+}
+
+type WalletEntryResponse struct {
+	Kind       string `json:"kind"` // redeem or refund
+	Amount     int    `json:"amount"`
+	Booking_id int    `json:"booking_id,omitempty"`
+	Memo       string `json:"memo,omitempty"`
+	Created_at string `json:"created_at"`
+}
+
+type WaitlistRequest struct {
+	Seats int `json:"seats"`
+}
+
+type WaitlistStatus struct {
+	Show_id          int     `json:"show_id"`
+	Seats            int     `json:"seats"`
+	Status           string  `json:"status"`             // Waiting or Offered
+	Position         int     `json:"position,omitempty"` // while waiting, 1 is next in line
+	Held_seats       []int64 `json:"held_seats,omitempty"`
+	Offer_expires_at string  `json:"offer_expires_at,omitempty"`
+	Joined_at        string  `json:"joined_at"`
+}
+
+type BookingCancelRequest struct {
+	Reason           string `json:"reason"`
+	Refund_to_wallet bool   `json:"refund_to_wallet"`
+}
+
+// BookingReseatRequest picks new seats for a booking whose show moved to a
+// screen without some of its seats, as many as it had.
+type BookingReseatRequest struct {
+	Seats []int64 `json:"seats"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordReset struct {
+	Token        string `json:"token"`
+	New_password string `json:"new_password"`
+}
+
+type NewWebhook struct {
+	Partner string   `json:"partner"`
+	Url     string   `json:"url"`
+	Events  []string `json:"events"` // event names, or "*" for all
+}
+
+type WebhookResponse struct {
+	Subscription_id int      `json:"subscription_id"`
+	Partner         string   `json:"partner"`
+	Url             string   `json:"url"`
+	Events          []string `json:"events"`
+	Active          bool     `json:"active"`
+	Secret          string   `json:"secret,omitempty"` // only when created
+	Created_at      string   `json:"created_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	Delivery_id     int                      `json:"delivery_id"`
+	Event_id        string                   `json:"event_id"`
+	Event           string                   `json:"event"`
+	Status          string                   `json:"status"` // Pending, Delivered or Dead
+	Attempts        int                      `json:"attempts"`
+	Last_error      string                   `json:"last_error,omitempty"`
+	Next_attempt_at string                   `json:"next_attempt_at,omitempty"`
+	Delivered_at    string                   `json:"delivered_at,omitempty"`
+	Created_at      string                   `json:"created_at"`
+	Log             []WebhookAttemptResponse `json:"log"`
+}
+
+type WebhookAttemptResponse struct {
+	Status_code  int    `json:"status_code,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Duration_ms  int    `json:"duration_ms"`
+	Attempted_at string `json:"attempted_at"`
+}
+
+type NewWaitingRoom struct {
+	Show_id          int    `json:"show_id"` // either a show
+	Movie            string `json:"movie"`   // or every show of a movie, by title
+	Admit_per_minute int    `json:"admit_per_minute"`
+	Admission_mins   int    `json:"admission_mins"` // how long an admitted customer has to book
+}
+
+type WaitingRoomResponse struct {
+	Room_id          int    `json:"room_id"`
+	Show_id          int    `json:"show_id,omitempty"`
+	Movie_id         int    `json:"movie_id,omitempty"`
+	Admit_per_minute int    `json:"admit_per_minute"`
+	Admission_mins   int    `json:"admission_mins"`
+	Active           bool   `json:"active"`
+	Waiting          int    `json:"waiting"`
+	Admitted         int    `json:"admitted"`
+	Created_at       string `json:"created_at"`
+}
+
+type QueueStatus struct {
+	Room_id             int    `json:"room_id"`
+	Token               string `json:"token"`              // sent in the queue token header to book once admitted
+	Status              string `json:"status"`             // Waiting, Admitted or Expired
+	Position            int    `json:"position,omitempty"` // while waiting, 1 is next in line
+	Estimated_wait_mins int    `json:"estimated_wait_mins,omitempty"`
+	Admitted_until      string `json:"admitted_until,omitempty"`
+	Joined_at           string `json:"joined_at"`
+}
@@ -0,0 +1,230 @@
+package booking
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+// pickPricingRule returns the rule that prices a show right now. Of the rules
+// that are triggered the one with the largest adjustment wins, rules don't
+// stack.
+func pickPricingRule(rules []db.PricingRule, occupancy_pct int, starts_in time.Duration) (rule *db.PricingRule) {
+	for i := range rules {
+		r := &rules[i]
+		if occupancy_pct < r.Min_occupancy_pct {
+			continue
+		}
+		if r.Starts_within_mins != nil && starts_in > minutes(*r.Starts_within_mins) {
+			continue
+		}
+		if rule == nil || r.Adjust_bps > rule.Adjust_bps {
+			rule = r
+		}
+	}
+	return
+}
+
+func occupancyPct(o db.Occupancy) int {
+	if o.Total == 0 {
+		return 0
+	}
+	return o.Booked * 100 / o.Total
+}
+
+// showReprice works out how the show's pricing rules price its unsold seats
+// right now. ok is false once the show is no longer on sale, its seats keep
+// the prices they have then.
+func (b *bookingService) showReprice(ctx context.Context, show db.Show) (r db.Reprice, ok bool, err error) {
+	now := time.Now()
+	if show.Status != db.ShowScheduled || !now.Before(show.Start_time) {
+		return
+	}
+
+	rules, err := b.store.GetPricingRulesOfShow(ctx, show)
+	if err != nil {
+		b.logger.Errorf("Err: Getting pricing rules of show %v: %v", show.Show_id, err.Error())
+		return
+	}
+	occupancy, err := b.store.GetOccupancyOfShow(ctx, show.Show_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting occupancy of show %v: %v", show.Show_id, err.Error())
+		return
+	}
+
+	// without a rule seats go back to their base price
+	r = db.Reprice{Occupancy_pct: occupancyPct(occupancy)}
+	if rule := pickPricingRule(rules, r.Occupancy_pct, show.Start_time.Sub(now)); rule != nil {
+		r.Rule_id = rule.Rule_id
+		r.Adjust_bps = rule.Adjust_bps
+		r.Floor_price = rule.Floor_price
+		r.Ceiling_price = rule.Ceiling_price
+	}
+	return r, true, nil
+}
+
+// repricedPrice is what a seat of the given base price costs under r, in
+// whole rupees and within the rule's floor and ceiling. It matches what
+// RepriceSeats stores.
+func repricedPrice(base int, r db.Reprice) (price int) {
+	price = int(math.Round(float64(base)*float64(10000+r.Adjust_bps)/1000000)) * 100
+	floor := 0
+	if r.Floor_price != nil {
+		floor = *r.Floor_price
+	}
+	if price < floor {
+		price = floor
+	}
+	if r.Ceiling_price != nil && price > *r.Ceiling_price {
+		price = *r.Ceiling_price
+	}
+	return
+}
+
+// applyPricingRules shows the unsold seats at what the show's pricing rules make
+// them cost right now, without saving the prices. Seat maps and quotes use
+// it so they are never behind the rules between repricings.
+func (b *bookingService) applyPricingRules(ctx context.Context, show db.Show, seats []db.Seat) (err error) {
+	r, ok, err := b.showReprice(ctx, show)
+	if err != nil || !ok {
+		return
+	}
+	for i := range seats {
+		if seats[i].Status == db.SeatAvailable {
+			seats[i].Price = repricedPrice(seats[i].Base_price, r)
+		}
+	}
+	return
+}
+
+// repriceShow brings the unsold seats of a show in line with its pricing
+// rules. It runs when seats are booked, and on a schedule so the price
+// history follows occupancy and the time left while nobody books. Looking at
+// seats only works the prices out, it never saves them.
+func (b *bookingService) repriceShow(ctx context.Context, show db.Show) (err error) {
+	r, ok, err := b.showReprice(ctx, show)
+	if err != nil || !ok {
+		return
+	}
+
+	changed, err := b.store.RepriceSeats(ctx, show.Show_id, r)
+	if err != nil {
+		b.logger.Errorf("Err: Repricing show %v: %v", show.Show_id, err.Error())
+		return
+	}
+	if changed > 0 {
+		b.logger.Infof("Repriced %v seats of show %v at %v%% occupancy, rule %v", changed, show.Show_id, r.Occupancy_pct, r.Rule_id)
+	}
+	return
+}
+
+// RepriceShows reprices every show still on sale.
+func (b *bookingService) RepriceShows(ctx context.Context) (err error) {
+	shows, err := b.store.GetShowsOnSale(ctx)
+	if err != nil {
+		b.logger.Errorf("Err: Getting shows on sale: %v", err.Error())
+		return
+	}
+	for _, show := range shows {
+		if e := b.repriceShow(ctx, show); e != nil {
+			err = e
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return
+}
+
+func (b *bookingService) AddPricingRule(ctx context.Context, nr NewPricingRule) (rule_id uint, err error) {
+	rule_id, err = b.store.AddPricingRule(ctx, db.PricingRule{
+		Name:               nr.Name,
+		Show_id:            nr.Show_id,
+		Movie_id:           nr.Movie_id,
+		Multiplex_id:       nr.Multiplex_id,
+		Min_occupancy_pct:  nr.Min_occupancy_pct,
+		Starts_within_mins: nr.Starts_within_mins,
+		Adjust_bps:         nr.Adjust_bps,
+		Floor_price:        nr.Floor_price,
+		Ceiling_price:      nr.Ceiling_price,
+	})
+	if err != nil {
+		b.logger.Errorf("Err: Adding pricing rule %v: %v", nr.Name, err.Error())
+		return
+	}
+	return
+}
+
+func (b *bookingService) ListPricingRules(ctx context.Context) (rules []PricingRuleResponse, err error) {
+	all, err := b.store.GetPricingRules(ctx)
+	if err != nil {
+		b.logger.Errorf("Err: Listing pricing rules: %v", err.Error())
+		return
+	}
+
+	rules = make([]PricingRuleResponse, 0, len(all))
+	for _, r := range all {
+		rules = append(rules, PricingRuleResponse{
+			Rule_id:            r.Rule_id,
+			Name:               r.Name,
+			Show_id:            r.Show_id,
+			Movie_id:           r.Movie_id,
+			Multiplex_id:       r.Multiplex_id,
+			Min_occupancy_pct:  r.Min_occupancy_pct,
+			Starts_within_mins: r.Starts_within_mins,
+			Adjust_bps:         r.Adjust_bps,
+			Floor_price:        r.Floor_price,
+			Ceiling_price:      r.Ceiling_price,
+			Active:             r.Active,
+			Created_at:         r.Created_at.Format(time.RFC3339),
+		})
+	}
+	return
+}
+
+// DeactivatePricingRule stops a rule from applying. Seats it priced show their
+// base price, or another rule's price, straight away and are stored at it the
+// next time the show is repriced.
+func (b *bookingService) DeactivatePricingRule(ctx context.Context, rule_id int) (err error) {
+	err = b.store.DeactivatePricingRule(ctx, rule_id)
+	if err != nil && err != db.ErrPricingRuleNotFound {
+		b.logger.Errorf("Err: Deactivating pricing rule %v: %v", rule_id, err.Error())
+	}
+	return
+}
+
+func (b *bookingService) GetPriceHistory(ctx context.Context, show_id int) (changes []PriceChangeEntry, err error) {
+	show, err := b.store.GetShowByID(ctx, show_id)
+	if err != nil {
+		return
+	}
+	mx, err := b.store.GetMultiplexeByID(ctx, show.Multiplex_id)
+	if err != nil {
+		return
+	}
+	loc, e := time.LoadLocation(mx.Time_zone)
+	if e != nil {
+		loc = time.UTC
+	}
+
+	rows, err := b.store.GetPriceChangesOfShow(ctx, show_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting price history of show %v: %v", show_id, err.Error())
+		return
+	}
+
+	changes = make([]PriceChangeEntry, 0, len(rows))
+	for _, c := range rows {
+		changes = append(changes, PriceChangeEntry{
+			Seat_number:   c.Seat_number,
+			Old_price:     c.Old_price,
+			New_price:     c.New_price,
+			Rule_id:       c.Rule_id,
+			Occupancy_pct: c.Occupancy_pct,
+			Changed_at:    c.Changed_at.In(loc).Format(time.RFC3339),
+		})
+	}
+	return
+}
@@ -0,0 +1,80 @@
+package booking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+func TestPickPricingRule(t *testing.T) {
+	hour := 60
+	rules := []db.PricingRule{
+		{Rule_id: 1, Min_occupancy_pct: 50, Adjust_bps: 1000},
+		{Rule_id: 2, Min_occupancy_pct: 80, Adjust_bps: 2500},
+		{Rule_id: 3, Min_occupancy_pct: 0, Starts_within_mins: &hour, Adjust_bps: 1500},
+		{Rule_id: 4, Min_occupancy_pct: 0, Adjust_bps: -500},
+	}
+
+	tests := []struct {
+		name      string
+		occupancy int
+		startsIn  time.Duration
+		rule      int
+	}{
+		{"only the discount applies", 10, 3 * time.Hour, 4},
+		{"half full", 50, 3 * time.Hour, 1},
+		{"nearly full beats half full", 90, 3 * time.Hour, 2},
+		{"starting soon", 10, 30 * time.Minute, 3},
+		{"starting at the edge of the window", 10, time.Hour, 3},
+		{"largest adjustment wins, rules don't stack", 90, 30 * time.Minute, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := pickPricingRule(rules, tt.occupancy, tt.startsIn)
+			if rule == nil || rule.Rule_id != tt.rule {
+				t.Fatalf("rule = %+v, want rule %v", rule, tt.rule)
+			}
+		})
+	}
+
+	if rule := pickPricingRule(rules[:2], 10, time.Hour); rule != nil {
+		t.Fatalf("rule = %+v, want none", rule)
+	}
+}
+
+func TestOccupancyPct(t *testing.T) {
+	if pct := occupancyPct(db.Occupancy{}); pct != 0 {
+		t.Fatalf("empty show: pct = %v, want 0", pct)
+	}
+	if pct := occupancyPct(db.Occupancy{Booked: 2, Total: 3}); pct != 66 {
+		t.Fatalf("pct = %v, want 66", pct)
+	}
+}
+
+func TestRepricedPrice(t *testing.T) {
+	floor, ceiling := 25000, 40000
+	tests := []struct {
+		name string
+		base int
+		r    db.Reprice
+		want int
+	}{
+		{"no rule", 30000, db.Reprice{}, 30000},
+		{"rounded to the rupee", 29999, db.Reprice{}, 30000},
+		{"raised", 30000, db.Reprice{Adjust_bps: 1500}, 34500},
+		{"half a rupee rounds up", 10050, db.Reprice{Adjust_bps: 0}, 10100},
+		{"capped at the ceiling", 38000, db.Reprice{Adjust_bps: 1500, Ceiling_price: &ceiling}, 40000},
+		{"held up by the floor", 28000, db.Reprice{Adjust_bps: -2000, Floor_price: &floor}, 25000},
+		{"never below nothing", 30000, db.Reprice{Adjust_bps: -20000}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := repricedPrice(tt.base, tt.r); got != tt.want {
+				t.Fatalf("repricedPrice(%v) = %v, want %v", tt.base, got, tt.want)
+			}
+		})
+	}
+}
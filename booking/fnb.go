@@ -0,0 +1,205 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+var (
+	ErrInvalidFnbTime       = errors.New("err: food can only be served from when admission opens until the show ends")
+	ErrInvalidFnbTransition = errors.New("err: order can't move to that status")
+	ErrInvalidMultiplex     = errors.New("err: invalid Multiplex id")
+)
+
+// fnbNext lists the statuses the kitchen can move an order on to
+var fnbNext = map[string][]string{
+	db.FnbQueued:    {db.FnbPreparing, db.FnbCancelled},
+	db.FnbPreparing: {db.FnbReady},
+	db.FnbReady:     {db.FnbServed},
+}
+
+// kitchenStatuses are the orders the kitchen still has to deal with
+var kitchenStatuses = []string{db.FnbQueued, db.FnbPreparing, db.FnbReady}
+
+// fnbDelivery works out how and when the food ordered with a booking is
+// handed over. It defaults to pickup when the show starts.
+func fnbDelivery(show db.Show, r BookingRequest) (fulfilment string, at time.Time, err error) {
+	fulfilment = r.Fnb_fulfilment
+	if fulfilment == "" {
+		fulfilment = db.FnbPickup
+	}
+
+	at = show.Start_time
+	if r.Fnb_time != "" {
+		if at, err = parseInstant(r.Fnb_time); err != nil {
+			err = ErrInvalidFnbTime
+			return
+		}
+	}
+
+	opens, _ := admissionWindow(show.Start_time)
+	if at.Before(opens) || at.After(show.End_time) {
+		err = ErrInvalidFnbTime
+	}
+	return
+}
+
+func (b *bookingService) AddFnbItem(ctx context.Context, multiplex_id int, ni NewFnbItem) (item_id uint, err error) {
+	if _, err = b.store.GetMultiplexeByID(ctx, multiplex_id); err != nil {
+		err = ErrInvalidMultiplex
+		return
+	}
+
+	parts := make([]db.FnbComboItem, 0, len(ni.Combo_items))
+	for _, c := range ni.Combo_items {
+		parts = append(parts, db.FnbComboItem{Item_id: c.Item_id, Quantity: c.Quantity})
+	}
+
+	item_id, err = b.store.AddFnbItem(ctx, db.FnbItem{
+		Multiplex_id: multiplex_id,
+		Name:         ni.Name,
+		Description:  ni.Description,
+		Price:        ni.Price,
+		Stock:        ni.Stock,
+	}, parts)
+	if err != nil {
+		b.logger.Errorf("Err: Adding menu item %v at multiplex %v: %v", ni.Name, multiplex_id, err.Error())
+		return
+	}
+	return
+}
+
+func (b *bookingService) GetFnbMenu(ctx context.Context, multiplex_id int) (menu []FnbMenuItem, err error) {
+	items, parts, err := b.store.GetFnbMenu(ctx, multiplex_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting menu of multiplex %v: %v", multiplex_id, err.Error())
+		return
+	}
+
+	combos := map[int][]FnbSelection{}
+	for _, p := range parts {
+		combos[p.Combo_id] = append(combos[p.Combo_id], FnbSelection{Item_id: p.Item_id, Quantity: p.Quantity})
+	}
+
+	menu = make([]FnbMenuItem, 0, len(items))
+	for _, it := range items {
+		menu = append(menu, FnbMenuItem{
+			Item_id:     it.Item_id,
+			Name:        it.Name,
+			Description: it.Description,
+			Price:       it.Price,
+			Is_combo:    it.Is_combo,
+			Stock:       it.Stock,
+			Combo_items: combos[it.Item_id],
+		})
+	}
+	return
+}
+
+// staffOfMultiplex checks staff only act for the multiplex they are assigned
+// to.
+func (b *bookingService) staffOfMultiplex(ctx context.Context, staffEmail string, multiplex_id int) (err error) {
+	staff, err := b.store.GetUserByEmail(ctx, staffEmail)
+	if err != nil {
+		b.logger.Errorf("Err: Getting staff %v: %v", staffEmail, err.Error())
+		return
+	}
+	_, err = staffMultiplex(staff, multiplex_id)
+	return
+}
+
+func (b *bookingService) SetFnbStock(ctx context.Context, staffEmail string, item_id int, stock *int) (err error) {
+	it, err := b.store.GetFnbItemByID(ctx, item_id)
+	if err != nil {
+		return
+	}
+	if err = b.staffOfMultiplex(ctx, staffEmail, it.Multiplex_id); err != nil {
+		return
+	}
+
+	err = b.store.SetFnbStock(ctx, item_id, stock)
+	if err != nil && err != db.ErrFnbItemNotFound {
+		b.logger.Errorf("Err: Setting stock of menu item %v: %v", item_id, err.Error())
+	}
+	return
+}
+
+// GetKitchenQueue lists the open F&B orders of a multiplex in the order they
+// are due, or the orders in one status.
+func (b *bookingService) GetKitchenQueue(ctx context.Context, staffEmail string, multiplex_id int, status string) (queue []KitchenOrder, err error) {
+	if err = b.staffOfMultiplex(ctx, staffEmail, multiplex_id); err != nil {
+		return
+	}
+	mx, err := b.store.GetMultiplexeByID(ctx, multiplex_id)
+	if err != nil {
+		err = ErrInvalidMultiplex
+		return
+	}
+	loc, e := time.LoadLocation(mx.Time_zone)
+	if e != nil {
+		loc = time.UTC
+	}
+
+	statuses := kitchenStatuses
+	if status != "" {
+		statuses = []string{status}
+	}
+	orders, items, err := b.store.GetFnbOrdersOfMultiplex(ctx, multiplex_id, statuses)
+	if err != nil {
+		b.logger.Errorf("Err: Getting kitchen queue of multiplex %v: %v", multiplex_id, err.Error())
+		return
+	}
+
+	byOrder := map[int][]KitchenOrderItem{}
+	for _, it := range items {
+		byOrder[it.Order_id] = append(byOrder[it.Order_id], KitchenOrderItem{Name: it.Name, Quantity: it.Quantity})
+	}
+
+	queue = make([]KitchenOrder, 0, len(orders))
+	for _, o := range orders {
+		queue = append(queue, KitchenOrder{
+			Order_id:   o.Order_id,
+			Booking_id: o.Booking_id,
+			Show_id:    o.Show_id,
+			Screen:     o.Screen_number,
+			Seats:      o.Seats,
+			Fulfilment: o.Fulfilment,
+			Deliver_at: o.Deliver_at.In(loc).Format(time.RFC3339),
+			Status:     o.Status,
+			Items:      byOrder[o.Order_id],
+		})
+	}
+	return
+}
+
+func (b *bookingService) UpdateFnbOrder(ctx context.Context, staffEmail string, order_id int, status string) (err error) {
+	o, err := b.store.GetFnbOrderByID(ctx, order_id)
+	if err != nil {
+		return
+	}
+	if err = b.staffOfMultiplex(ctx, staffEmail, o.Multiplex_id); err != nil {
+		return
+	}
+
+	allowed := false
+	for _, s := range fnbNext[o.Status] {
+		allowed = allowed || s == status
+	}
+	if !allowed {
+		err = ErrInvalidFnbTransition
+		return
+	}
+
+	err = b.store.SetFnbOrderStatus(ctx, order_id, o.Status, status)
+	if err != nil {
+		if err != db.ErrFnbStatusConflict {
+			b.logger.Errorf("Err: Updating order %v to %v: %v", order_id, status, err.Error())
+		}
+		return
+	}
+	b.logger.Infof("Order %v is %v", order_id, status)
+	return
+}
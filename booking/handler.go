@@ -1,8 +1,10 @@
 package booking
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/mail"
@@ -12,10 +14,14 @@ import (
 	"time"
 
 	"github.com/Coderx44/MovieTicketingPortal/app"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var phoneRegexp = regexp.MustCompile(`^\d{10}$`)
+
 func PingHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
@@ -51,8 +57,7 @@ func CreateNewUser(s Service) http.HandlerFunc {
 			return
 		}
 		newUser.Email = strings.Trim(newUser.Email, " ")
-		re := regexp.MustCompile(`^\d{10}$`)
-		if !re.MatchString(newUser.Phone_number) {
+		if !phoneRegexp.MatchString(newUser.Phone_number) {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte("Err: Phone must contain 10 digits"))
 			return
@@ -65,9 +70,19 @@ func CreateNewUser(s Service) http.HandlerFunc {
 
 		newUser.Password = string(hashedPassword)
 		newUser.Role = role
+		if role == "staff" && newUser.Multiplex_id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: Provide the multiplex_id the staff member works at"))
+			return
+		}
 		newResp, err := s.CreateNewUser(r.Context(), newUser)
 
 		if err != nil {
+			if err == ErrInvalidMultiplex {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+				return
+			}
 			if err.Error() == "account exists for the given email" {
 				w.WriteHeader(http.StatusBadRequest)
 				w.Write([]byte("Err: User already exits for given email"))
@@ -149,9 +164,13 @@ func AddMovie(s Service) http.HandlerFunc {
 		// claims := r.Context().Value("claims").(Claims)
 
 		var newM NewMovie
-		json.NewDecoder(r.Body).Decode(&newM)
+		if err := json.NewDecoder(r.Body).Decode(&newM); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: Invalid movie, duration is a number of minutes"))
+			return
+		}
 
-		if newM.Title == "" || newM.Language == "" || newM.Release_date == "" || newM.Genre == "" || newM.Duration == 0.0 {
+		if newM.Title == "" || newM.Language == "" || newM.Release_date == "" || newM.Genre == "" || newM.Duration <= 0 {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte("Provide the required parameters"))
 			return
@@ -204,6 +223,11 @@ func AddScreen(s Service) http.HandlerFunc {
 		log.Println("newsnn", newSn)
 		screen_id, err := s.AddScreen(r.Context(), newSn)
 
+		if err == ErrNegativeBuffer {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte("Err - Internal Server Error - Failed to add screen"))
@@ -284,12 +308,27 @@ func AddShow(s Service) http.HandlerFunc {
 			return
 		}
 
+		if newShow.Start_time == "" || newShow.Movie == "" || newShow.Screen == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+
 		show_id, err := s.AddShow(r.Context(), newShow)
 
 		if err != nil {
 			log.Println(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Err: Internal Server Error - Failed to add show"))
+			switch err {
+			case ErrInvalidShowTime, ErrOutsideOperatingHours, ErrShowInPast:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+			case ErrOverlappingShow:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(err.Error()))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to add show"))
+			}
 			return
 		}
 
@@ -300,3 +339,1795 @@ func AddShow(s Service) http.HandlerFunc {
 	})
 
 }
+
+// the longest range of start times shows can be listed for at once
+const maxShowListRange = 31 * 24 * time.Hour
+
+func ListShows(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f := ShowFilter{From: time.Now()}
+
+		var err error
+		if v := q.Get("from"); v != "" {
+			if f.From, err = time.Parse(time.RFC3339, v); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: from must be ISO 8601 with an offset"))
+				return
+			}
+		}
+
+		// to takes precedence over within, e.g. within=2h for shows starting in
+		// the next two hours
+		f.To = f.From.Add(24 * time.Hour)
+		if v := q.Get("within"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: invalid within duration"))
+				return
+			}
+			f.To = f.From.Add(d)
+		}
+		if v := q.Get("to"); v != "" {
+			if f.To, err = time.Parse(time.RFC3339, v); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: to must be ISO 8601 with an offset"))
+				return
+			}
+		}
+		if !f.To.After(f.From) || f.To.Sub(f.From) > maxShowListRange {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: to must be after from and at most 31 days later"))
+			return
+		}
+
+		if v := q.Get("multiplex_id"); v != "" {
+			if f.Multiplex_id, err = strconv.Atoi(v); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Invalid multiplex id"))
+				return
+			}
+		}
+
+		shows, err := s.ListShows(r.Context(), f)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to list shows"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(shows)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func CancelShow(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		var req ShowCancellation
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.TrimSpace(req.Reason) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide a reason for cancelling the show"))
+			return
+		}
+
+		report, err := s.CancelShow(r.Context(), show_id, req)
+		if err != nil {
+			switch err {
+			case db.ErrShowNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Show doesn't exist"))
+			case db.ErrShowAlreadyCancelled:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte("Err: Show is already cancelled"))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to cancel show"))
+			}
+			return
+		}
+
+		respBytes, _ := json.Marshal(report)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func RescheduleShow(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		var req ShowReschedule
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Screen == 0 && req.Start_time == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide a new screen or start time"))
+			return
+		}
+
+		report, err := s.RescheduleShow(r.Context(), show_id, req)
+		if err != nil {
+			switch err {
+			case db.ErrShowNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Show doesn't exist"))
+			case db.ErrShowAlreadyCancelled:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte("Err: Show is cancelled"))
+			case ErrInvalidShowTime, ErrOutsideOperatingHours, ErrShowInPast:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+			case ErrOverlappingShow, ErrShowStarted:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(err.Error()))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to reschedule show"))
+			}
+			return
+		}
+
+		respBytes, _ := json.Marshal(report)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func GetProfile(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		profile, err := s.GetProfile(r.Context(), claims.Email)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to get profile"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(profile)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func UpdateProfile(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		var up ProfileUpdate
+		json.NewDecoder(r.Body).Decode(&up)
+		up.Name = strings.TrimSpace(up.Name)
+		up.Phone_number = strings.TrimSpace(up.Phone_number)
+
+		if up.Name == "" && up.Phone_number == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+		if up.Phone_number != "" && !phoneRegexp.MatchString(up.Phone_number) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: Phone must contain 10 digits"))
+			return
+		}
+
+		profile, err := s.UpdateProfile(r.Context(), claims.Email, up)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to update profile"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(profile)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func ChangePassword(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		var c PasswordChange
+		json.NewDecoder(r.Body).Decode(&c)
+		if c.Current_password == "" || c.New_password == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+
+		err := s.ChangePassword(r.Context(), claims.Email, c)
+		if err != nil {
+			if err == ErrIncorrectPassword {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to change password"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Password changed"))
+	})
+}
+
+func ListMyBookings(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		when := r.URL.Query().Get("when")
+		if when != "" && when != db.BookingsUpcoming && when != db.BookingsPast {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: when must be upcoming or past"))
+			return
+		}
+
+		bookings, err := s.ListMyBookings(r.Context(), claims.Email, when)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to list bookings"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(bookings)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func DownloadTicket(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		booking_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid booking id"))
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "png"
+		}
+		if format != "png" && format != "pdf" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: format must be png or pdf"))
+			return
+		}
+
+		ticket, err := s.GetTicket(r.Context(), claims.Email, booking_id)
+		if err != nil {
+			switch err {
+			case db.ErrBookingNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Booking doesn't exist"))
+			case ErrTicketUnavailable:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(err.Error()))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to generate ticket"))
+			}
+			return
+		}
+
+		writeTicket(w, ticket, booking_id, format)
+	})
+}
+
+func CheckInTicket(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		var c CheckIn
+		json.NewDecoder(r.Body).Decode(&c)
+		if c.Ticket == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+
+		resp, err := s.CheckIn(r.Context(), claims.Email, c)
+		if err != nil {
+			switch err {
+			case ErrInvalidTicket:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+			case ErrWrongMultiplex:
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(err.Error()))
+			case ErrOutsideAdmissionWindow, ErrTicketUnavailable:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(err.Error()))
+			case db.ErrAlreadyCheckedIn:
+				// the usher needs to know when and for which seats
+				respBytes, _ := json.Marshal(resp)
+				w.Header().Add("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				w.Write(respBytes)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to check in"))
+			}
+			return
+		}
+
+		respBytes, _ := json.Marshal(resp)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func GetAdmissions(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		count, err := s.GetAdmissions(r.Context(), show_id)
+		if err != nil {
+			if err == db.ErrShowNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Show doesn't exist"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to count admissions"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(count)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func writeTicket(w http.ResponseWriter, ticket Ticket, booking_id int, format string) {
+	var body []byte
+	var err error
+	contentType := "image/png"
+	if format == "pdf" {
+		body, err = ticket.PDF()
+		contentType = "application/pdf"
+	} else {
+		body, err = ticket.PNG()
+	}
+	if err != nil {
+		app.GetLogger().Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Err: Internal Server Error - Failed to generate ticket"))
+		return
+	}
+
+	w.Header().Add("Content-Type", contentType)
+	w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=ticket-%d.%s", booking_id, format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// writeBookingError maps errors of the booking flows to responses that can be
+// shown to the customer or staff member as they are.
+func writeBookingError(w http.ResponseWriter, err error, fallback string) {
+	if _, ok := err.(CouponError); ok {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	switch err {
+	case db.ErrInsufficientPoints, db.ErrInsufficientBalance:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case db.ErrShowNotFound, db.ErrBookingNotFound, db.ErrGiftCardNotFound, db.ErrNotWaitlisted, db.ErrNoWaitingRoom, db.ErrNotQueued:
+		w.WriteHeader(http.StatusNotFound)
+	case db.ErrSeatNotFound, db.ErrFnbItemNotFound, ErrInvalidFnbTime, ErrInvalidWaitlistSeats, ErrInvalidMultiplex, ErrReseatCount:
+		w.WriteHeader(http.StatusBadRequest)
+	case ErrWrongMultiplex:
+		w.WriteHeader(http.StatusForbidden)
+	case db.ErrNoOpenShift, db.ErrShiftAlreadyOpen, db.ErrShowNotBookable, db.ErrSeatUnavailable, ErrShowNotOnSale, ErrTicketUnavailable,
+		db.ErrFnbOutOfStock, db.ErrGiftCardUnusable, db.ErrShowNotSoldOut, db.ErrAlreadyWaitlisted, db.ErrNotCancellable,
+		db.ErrNotReseatable:
+		w.WriteHeader(http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(fallback))
+		return
+	}
+	w.Write([]byte("Err: " + err.Error()))
+}
+
+// validFnb checks the food and drinks ordered with a booking.
+func validFnb(r BookingRequest) bool {
+	if r.Fnb_fulfilment != "" && r.Fnb_fulfilment != db.FnbPickup && r.Fnb_fulfilment != db.FnbToSeat {
+		return false
+	}
+	seen := make(map[int]bool, len(r.Fnb))
+	for _, f := range r.Fnb {
+		if f.Quantity <= 0 || seen[f.Item_id] {
+			return false
+		}
+		seen[f.Item_id] = true
+	}
+	return true
+}
+
+// validSeatNumbers checks that seats is a non empty list of distinct seat
+// numbers.
+func validSeatNumbers(seats []int64) bool {
+	if len(seats) == 0 {
+		return false
+	}
+	seen := make(map[int64]bool, len(seats))
+	for _, n := range seats {
+		if n <= 0 || seen[n] {
+			return false
+		}
+		seen[n] = true
+	}
+	return true
+}
+
+func OpenShift(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		var o ShiftOpening
+		json.NewDecoder(r.Body).Decode(&o)
+		if o.Multiplex_id < 0 || o.Opening_float < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+
+		report, err := s.OpenShift(r.Context(), claims.Email, o)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to open shift")
+			return
+		}
+
+		respBytes, _ := json.Marshal(report)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func CurrentShift(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		report, err := s.CurrentShift(r.Context(), claims.Email)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to get shift")
+			return
+		}
+
+		respBytes, _ := json.Marshal(report)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func CloseShift(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		var c ShiftClosing
+		json.NewDecoder(r.Body).Decode(&c)
+		if c.Counted_cash < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: counted cash can't be negative"))
+			return
+		}
+
+		report, err := s.CloseShift(r.Context(), claims.Email, c)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to close shift")
+			return
+		}
+
+		respBytes, _ := json.Marshal(report)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func PosBook(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		var p PosBooking
+		json.NewDecoder(r.Body).Decode(&p)
+		if !validSeatNumbers(p.Seats) || !validPaymentMethod(p.Payment_method) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide distinct seats and a payment method of cash or card"))
+			return
+		}
+		p.Customer_phone = strings.TrimSpace(p.Customer_phone)
+		if p.Customer_phone != "" && !phoneRegexp.MatchString(p.Customer_phone) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: Phone must contain 10 digits"))
+			return
+		}
+
+		resp, err := s.PosBook(r.Context(), claims.Email, show_id, p)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to book seats")
+			return
+		}
+
+		respBytes, _ := json.Marshal(resp)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func PrintPosTicket(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		booking_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid booking id"))
+			return
+		}
+
+		// counter printers take pdf unless asked otherwise
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "pdf"
+		}
+		if format != "png" && format != "pdf" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: format must be png or pdf"))
+			return
+		}
+
+		ticket, err := s.GetPosTicket(r.Context(), claims.Email, booking_id)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to generate ticket")
+			return
+		}
+
+		writeTicket(w, ticket, booking_id, format)
+	})
+}
+
+func GetSeatMap(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		seats, err := s.GetSeatMap(r.Context(), show_id)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to get seats")
+			return
+		}
+
+		respBytes, _ := json.Marshal(seats)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func QuoteBooking(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		var req BookingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !validSeatNumbers(req.Seats) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide distinct seats"))
+			return
+		}
+		if req.Loyalty_points < 0 || !validFnb(req) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: order distinct menu items, fnb_fulfilment must be pickup or seat and loyalty_points can't be negative"))
+			return
+		}
+
+		quote, err := s.QuoteBooking(r.Context(), claims.Email, show_id, req)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to price seats")
+			return
+		}
+
+		respBytes, _ := json.Marshal(quote)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func BookShow(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		var req BookingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !validSeatNumbers(req.Seats) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide distinct seats"))
+			return
+		}
+		if req.Loyalty_points < 0 || !validFnb(req) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: order distinct menu items, fnb_fulfilment must be pickup or seat and loyalty_points can't be negative"))
+			return
+		}
+		if !validLedgerPayment(req) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: payment_method must be wallet or gift_card, paying by gift_card needs its gift_card_code"))
+			return
+		}
+
+		resp, err := s.BookShow(r.Context(), claims.Email, show_id, req)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to book seats")
+			return
+		}
+
+		respBytes, _ := json.Marshal(resp)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func AddCoupon(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var nc NewCoupon
+		json.NewDecoder(r.Body).Decode(&nc)
+
+		if strings.TrimSpace(nc.Code) == "" || nc.Value <= 0 || nc.Min_tickets < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+		if nc.Kind != db.CouponPercent && nc.Kind != db.CouponFlat {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: kind must be percent or flat"))
+			return
+		}
+		if nc.Kind == db.CouponPercent && nc.Value > 100 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: percentage can't be more than 100"))
+			return
+		}
+		for _, d := range nc.Days_of_week {
+			if d < 0 || d > 6 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: days of week go from 0 (Sunday) to 6"))
+				return
+			}
+		}
+
+		coupon_id, err := s.AddCoupon(r.Context(), nc)
+		if err != nil {
+			switch err {
+			case ErrInvalidCoupon:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: valid_from and expires_at must be ISO 8601 with an offset"))
+			case db.ErrCouponExists:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte("Err: Coupon code already exists"))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to add coupon"))
+			}
+			return
+		}
+
+		respBytes, _ := json.Marshal(coupon_id)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func ListCoupons(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		coupons, err := s.ListCoupons(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to list coupons"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(coupons)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func DeactivateCoupon(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		coupon_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid coupon id"))
+			return
+		}
+
+		err = s.DeactivateCoupon(r.Context(), coupon_id)
+		if err != nil {
+			if err == db.ErrCouponNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Coupon doesn't exist"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to deactivate coupon"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Coupon deactivated"))
+	})
+}
+
+func GetInvoice(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		booking_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid booking id"))
+			return
+		}
+
+		inv, err := s.GetInvoice(r.Context(), claims.Email, booking_id)
+		if err != nil {
+			if err == db.ErrBookingNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Booking doesn't exist"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to get invoice"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(inv)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func ListTaxRates(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rates, err := s.ListTaxRates(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to list tax rates"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(rates)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func SetTaxRates(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := strings.TrimSpace(mux.Vars(r)["state"])
+
+		var rates []TaxRateEntry
+		err := json.NewDecoder(r.Body).Decode(&rates)
+		if err != nil || state == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the tax rates of the state"))
+			return
+		}
+		for _, rt := range rates {
+			if strings.TrimSpace(rt.Name) == "" || rt.Rate_bps <= 0 || rt.Rate_bps > 10000 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: every rate needs a name and rate_bps between 1 and 10000"))
+				return
+			}
+			if rt.Applies_to != db.TaxOnTickets && rt.Applies_to != db.TaxOnFees && rt.Applies_to != db.TaxOnFnb {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: applies_to must be tickets, fees or fnb"))
+				return
+			}
+		}
+
+		err = s.SetTaxRates(r.Context(), state, rates)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to set tax rates"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Tax rates updated"))
+	})
+}
+
+func AddPricingRule(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var nr NewPricingRule
+		json.NewDecoder(r.Body).Decode(&nr)
+
+		if strings.TrimSpace(nr.Name) == "" || nr.Adjust_bps == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+		if nr.Adjust_bps <= -10000 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: adjust_bps can't take prices to zero"))
+			return
+		}
+		if nr.Min_occupancy_pct < 0 || nr.Min_occupancy_pct > 100 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: min_occupancy_pct must be between 0 and 100"))
+			return
+		}
+		if nr.Starts_within_mins != nil && *nr.Starts_within_mins <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: starts_within_mins must be positive"))
+			return
+		}
+		if (nr.Floor_price != nil && *nr.Floor_price < 0) || (nr.Ceiling_price != nil && *nr.Ceiling_price <= 0) ||
+			(nr.Floor_price != nil && nr.Ceiling_price != nil && *nr.Floor_price > *nr.Ceiling_price) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: floor_price and ceiling_price must be positive with the floor below the ceiling"))
+			return
+		}
+
+		rule_id, err := s.AddPricingRule(r.Context(), nr)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to add pricing rule"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(rule_id)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func ListPricingRules(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules, err := s.ListPricingRules(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to list pricing rules"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(rules)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func DeactivatePricingRule(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid rule id"))
+			return
+		}
+
+		err = s.DeactivatePricingRule(r.Context(), rule_id)
+		if err != nil {
+			if err == db.ErrPricingRuleNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Pricing rule doesn't exist"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to deactivate pricing rule"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Pricing rule deactivated"))
+	})
+}
+
+func GetPriceHistory(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		changes, err := s.GetPriceHistory(r.Context(), show_id)
+		if err != nil {
+			if err == db.ErrShowNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Show doesn't exist"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to get price history"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(changes)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func AddFnbItem(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		multiplex_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid multiplex id"))
+			return
+		}
+
+		var ni NewFnbItem
+		json.NewDecoder(r.Body).Decode(&ni)
+		if strings.TrimSpace(ni.Name) == "" || ni.Price <= 0 || (ni.Stock != nil && *ni.Stock < 0) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+		if len(ni.Combo_items) > 0 && ni.Stock != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: combos take their stock from their items"))
+			return
+		}
+		for _, c := range ni.Combo_items {
+			if c.Quantity <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: combo items need a quantity"))
+				return
+			}
+		}
+
+		item_id, err := s.AddFnbItem(r.Context(), multiplex_id, ni)
+		if err != nil {
+			switch err {
+			case ErrInvalidMultiplex:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(err.Error()))
+			case db.ErrFnbItemNotFound:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: combo items must be items on this multiplex's menu"))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to add menu item"))
+			}
+			return
+		}
+
+		respBytes, _ := json.Marshal(item_id)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func GetFnbMenu(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		multiplex_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid multiplex id"))
+			return
+		}
+
+		menu, err := s.GetFnbMenu(r.Context(), multiplex_id)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to get menu"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(menu)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func SetFnbStock(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		item_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid item id"))
+			return
+		}
+
+		var u FnbStockUpdate
+		json.NewDecoder(r.Body).Decode(&u)
+		if u.Stock != nil && *u.Stock < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: stock can't be negative"))
+			return
+		}
+
+		err = s.SetFnbStock(r.Context(), claims.Email, item_id, u.Stock)
+		if err != nil {
+			if err == db.ErrFnbItemNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Menu item doesn't exist or is a combo"))
+				return
+			}
+			if err == ErrWrongMultiplex {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to set stock"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Stock updated"))
+	})
+}
+
+func GetKitchenQueue(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		multiplex_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid multiplex id"))
+			return
+		}
+
+		queue, err := s.GetKitchenQueue(r.Context(), claims.Email, multiplex_id, r.URL.Query().Get("status"))
+		if err != nil {
+			if err == ErrInvalidMultiplex {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			if err == ErrWrongMultiplex {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to get orders"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(queue)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func UpdateFnbOrder(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		order_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid order id"))
+			return
+		}
+
+		var u FnbOrderUpdate
+		json.NewDecoder(r.Body).Decode(&u)
+
+		err = s.UpdateFnbOrder(r.Context(), claims.Email, order_id, u.Status)
+		if err != nil {
+			switch err {
+			case db.ErrFnbOrderNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Order doesn't exist"))
+			case ErrWrongMultiplex:
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(err.Error()))
+			case ErrInvalidFnbTransition, db.ErrFnbStatusConflict:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(err.Error()))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to update order"))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Order updated"))
+	})
+}
+
+func GetLoyaltyStatement(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		st, err := s.GetLoyaltyStatement(r.Context(), claims.Email)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to get loyalty statement"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(st)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func IssueGiftCard(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		var ng NewGiftCard
+		json.NewDecoder(r.Body).Decode(&ng)
+		if ng.Amount <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide a positive amount"))
+			return
+		}
+
+		g, err := s.IssueGiftCard(r.Context(), claims.Email, ng)
+		if err != nil {
+			switch err {
+			case ErrInvalidGiftCard:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: expires_at must be ISO 8601 with an offset and in the future"))
+			case db.ErrGiftCardExists:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte("Err: Gift card code already exists"))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to issue gift card"))
+			}
+			return
+		}
+
+		respBytes, _ := json.Marshal(g)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func ListGiftCards(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cards, err := s.ListGiftCards(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to list gift cards"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(cards)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func VoidGiftCard(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		gift_card_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid gift card id"))
+			return
+		}
+
+		g, err := s.VoidGiftCard(r.Context(), claims.Email, gift_card_id)
+		if err != nil {
+			switch err {
+			case db.ErrGiftCardNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Gift card doesn't exist"))
+			case db.ErrGiftCardUnusable:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte("Err: Gift card is already void"))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to void gift card"))
+			}
+			return
+		}
+
+		respBytes, _ := json.Marshal(g)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func GetGiftCardBalance(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g, err := s.GetGiftCardBalance(r.Context(), mux.Vars(r)["code"])
+		if err != nil {
+			if err == db.ErrGiftCardNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Gift card doesn't exist"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to get gift card"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(g)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func GetWallet(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		st, err := s.GetWallet(r.Context(), claims.Email)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to get wallet"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(st)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func JoinWaitlist(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		var req WaitlistRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		st, err := s.JoinWaitlist(r.Context(), claims.Email, show_id, req)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to join waitlist")
+			return
+		}
+
+		respBytes, _ := json.Marshal(st)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func GetWaitlistStatus(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		st, err := s.GetWaitlistStatus(r.Context(), claims.Email, show_id)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to get waitlist status")
+			return
+		}
+
+		respBytes, _ := json.Marshal(st)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func LeaveWaitlist(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		if err = s.LeaveWaitlist(r.Context(), claims.Email, show_id); err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to leave waitlist")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Left the waitlist"))
+	})
+}
+
+func CancelBooking(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		booking_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid booking id"))
+			return
+		}
+
+		var req BookingCancelRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		bc, err := s.CancelBooking(r.Context(), claims.Email, booking_id, req)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to cancel booking")
+			return
+		}
+
+		respBytes, _ := json.Marshal(bc)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func ReseatBooking(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		booking_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid booking id"))
+			return
+		}
+
+		var req BookingReseatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !validSeatNumbers(req.Seats) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+
+		mb, err := s.ReseatBooking(r.Context(), claims.Email, booking_id, req)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to move booking")
+			return
+		}
+
+		respBytes, _ := json.Marshal(mb)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func RequestPasswordReset(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PasswordResetRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if strings.TrimSpace(req.Email) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+
+		if err := s.RequestPasswordReset(r.Context(), req.Email); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to reset password"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("If the email is registered a reset code is on its way"))
+	})
+}
+
+func ResetPassword(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PasswordReset
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Token == "" || req.New_password == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+
+		err := s.ResetPassword(r.Context(), req)
+		if err != nil {
+			if err == db.ErrInvalidResetToken {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: " + err.Error()))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to reset password"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Password changed"))
+	})
+}
+
+func AddWebhook(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var nw NewWebhook
+		json.NewDecoder(r.Body).Decode(&nw)
+
+		wh, err := s.AddWebhook(r.Context(), nw)
+		if err != nil {
+			if err == ErrInvalidWebhook {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: Provide a partner, an http(s) url and known events"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to add webhook"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(wh)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func ListWebhooks(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhooks, err := s.ListWebhooks(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to list webhooks"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(webhooks)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func DeactivateWebhook(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscription_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid webhook id"))
+			return
+		}
+
+		err = s.DeactivateWebhook(r.Context(), subscription_id)
+		if err != nil {
+			if err == db.ErrWebhookNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Webhook doesn't exist"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to deactivate webhook"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Webhook deactivated"))
+	})
+}
+
+func ListWebhookDeliveries(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscription_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid webhook id"))
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", db.WebhookPending, db.WebhookDelivered, db.WebhookDead:
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Status must be Pending, Delivered or Dead"))
+			return
+		}
+
+		deliveries, err := s.ListWebhookDeliveries(r.Context(), subscription_id, status)
+		if err != nil {
+			if err == db.ErrWebhookNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Webhook doesn't exist"))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to list deliveries"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(deliveries)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func RedeliverWebhook(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivery_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid delivery id"))
+			return
+		}
+
+		err = s.RedeliverWebhook(r.Context(), delivery_id)
+		if err != nil {
+			switch err {
+			case db.ErrDeliveryNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: Delivery doesn't exist"))
+			case db.ErrNotDeadLetter:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte("Err: Only dead deliveries can be redelivered"))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to redeliver webhook"))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Delivery queued"))
+	})
+}
+
+func OpenWaitingRoom(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		var nw NewWaitingRoom
+		json.NewDecoder(r.Body).Decode(&nw)
+
+		room, err := s.OpenWaitingRoom(r.Context(), claims.Email, nw)
+		if err != nil {
+			switch err {
+			case ErrInvalidWaitingRoom:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("Err: Provide either a show_id or a movie, and positive admit_per_minute and admission_mins"))
+			case db.ErrShowNotFound, ErrMovieNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: " + err.Error()))
+			case db.ErrWaitingRoomExists:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte("Err: " + err.Error()))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to open waiting room"))
+			}
+			return
+		}
+
+		respBytes, _ := json.Marshal(room)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func ListWaitingRooms(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rooms, err := s.ListWaitingRooms(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to list waiting rooms"))
+			return
+		}
+
+		respBytes, _ := json.Marshal(rooms)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func CloseWaitingRoom(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		room_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid waiting room id"))
+			return
+		}
+
+		err = s.CloseWaitingRoom(r.Context(), room_id)
+		if err != nil {
+			if err == db.ErrWaitingRoomNotFound {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: " + err.Error()))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to close waiting room"))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Waiting room closed"))
+	})
+}
+
+func JoinQueue(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		st, err := s.JoinQueue(r.Context(), claims.Email, show_id)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to join queue")
+			return
+		}
+
+		respBytes, _ := json.Marshal(st)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func GetQueueStatus(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := claimsFromContext(r.Context())
+
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		st, err := s.GetQueueStatus(r.Context(), claims.Email, show_id)
+		if err != nil {
+			writeBookingError(w, err, "Err: Internal Server Error - Failed to get queue status")
+			return
+		}
+
+		respBytes, _ := json.Marshal(st)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+// GetTicketPublicKey hands scanners the key to verify tickets offline with.
+func GetTicketPublicKey() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respBytes, _ := json.Marshal(map[string]string{
+			"alg":        jwt.SigningMethodEdDSA.Alg(),
+			"public_key": base64.StdEncoding.EncodeToString(TicketPublicKey()),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(respBytes)
+	})
+}
+
+func AssignStaff(s Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a StaffAssignment
+		json.NewDecoder(r.Body).Decode(&a)
+		if a.Email == "" || a.Multiplex_id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Provide the required parameters"))
+			return
+		}
+
+		err := s.AssignStaff(r.Context(), a)
+		if err != nil {
+			switch err {
+			case ErrInvalidMultiplex:
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+			case db.ErrStaffNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("Err: " + err.Error()))
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("Err: Internal Server Error - Failed to assign staff"))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Staff assigned"))
+	})
+}
@@ -0,0 +1,105 @@
+package booking
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+// GetInvoice itemises what the customer paid for one of their bookings.
+func (b *bookingService) GetInvoice(ctx context.Context, email string, booking_id int) (inv Invoice, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Getting invoice of %v: %v", email, err.Error())
+		return
+	}
+
+	bk, err := b.store.GetBookingByID(ctx, booking_id)
+	if err != nil {
+		return
+	}
+	if bk.User_id != u.User_id {
+		err = db.ErrBookingNotFound
+		return
+	}
+
+	lines, err := b.store.GetLineItemsOfBooking(ctx, booking_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting line items of booking %v: %v", booking_id, err.Error())
+		return
+	}
+	return newInvoice(bk, lines), nil
+}
+
+func newInvoice(bk db.BookingDetail, lines []db.LineItem) Invoice {
+	mb := newMyBooking(bk)
+
+	subtotal := 0
+	for _, l := range lines {
+		if l.Kind == db.LineTicket {
+			subtotal += l.Amount
+		}
+	}
+
+	return Invoice{
+		Invoice_number: fmt.Sprintf("INV-%s-%06d", bk.Created_at.Format("20060102"), bk.Booking_id),
+		Booking_id:     bk.Booking_id,
+		Status:         bk.Status,
+		Issued_at:      mb.Booked_at,
+		Movie:          bk.Title,
+		Show_start:     mb.Show.Start_time,
+		Screen:         bk.Screen_number,
+		Seats:          bk.Seats,
+		Multiplex:      mb.Multiplex,
+		Price: PriceBreakdown{
+			Currency: bk.Currency,
+			Subtotal: subtotal,
+			Discount: bk.Discount,
+			Fees:     bk.Fee,
+			Taxes:    bk.Tax,
+			Total:    bk.Amount,
+			Items:    newPriceItems(lines),
+		},
+	}
+}
+
+func (b *bookingService) ListTaxRates(ctx context.Context) (rates []TaxRateResponse, err error) {
+	all, err := b.store.GetTaxRates(ctx)
+	if err != nil {
+		b.logger.Errorf("Err: Listing tax rates: %v", err.Error())
+		return
+	}
+
+	rates = make([]TaxRateResponse, 0, len(all))
+	for _, r := range all {
+		rates = append(rates, TaxRateResponse{
+			State:      r.State,
+			Name:       r.Name,
+			Rate_bps:   r.Rate_bps,
+			Applies_to: r.Applies_to,
+		})
+	}
+	return
+}
+
+// SetTaxRates replaces the tax rates of a state. New rates apply to bookings
+// priced from now on, existing bookings keep what they were charged.
+func (b *bookingService) SetTaxRates(ctx context.Context, state string, entries []TaxRateEntry) (err error) {
+	rates := make([]db.TaxRate, 0, len(entries))
+	for _, e := range entries {
+		rates = append(rates, db.TaxRate{
+			Name:       e.Name,
+			Rate_bps:   e.Rate_bps,
+			Applies_to: e.Applies_to,
+		})
+	}
+
+	err = b.store.SetTaxRates(ctx, state, rates)
+	if err != nil {
+		b.logger.Errorf("Err: Setting tax rates of %v: %v", state, err.Error())
+		return
+	}
+	b.logger.Infof("Tax rates of %v set to %v", state, entries)
+	return
+}
@@ -0,0 +1,101 @@
+package booking
+
+import (
+	"context"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+// statementEntries is how much of the ledger /me/loyalty shows
+const statementEntries = 50
+
+func pointsExpireAt(now time.Time) time.Time {
+	return now.AddDate(0, 0, config.Loyalty().ExpiryDays())
+}
+
+// tierFor returns the tier points earned over the last year put a customer
+// in, and the one after it. tiers are ordered by their minimum.
+func tierFor(tiers []db.LoyaltyTier, earned int) (tier db.LoyaltyTier, next *db.LoyaltyTier) {
+	for i, t := range tiers {
+		if earned < t.Min_points {
+			next = &tiers[i]
+			break
+		}
+		tier = t
+	}
+	return
+}
+
+// loyaltyOf works out a customer's point balance and tier.
+func (b *bookingService) loyaltyOf(ctx context.Context, user_id int) (a db.LoyaltyAccount, tier db.LoyaltyTier, next *db.LoyaltyTier, err error) {
+	a, err = b.store.GetLoyaltyAccount(ctx, user_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting loyalty account of %v: %v", user_id, err.Error())
+		return
+	}
+	tiers, err := b.store.GetLoyaltyTiers(ctx)
+	if err != nil {
+		b.logger.Errorf("Err: Getting loyalty tiers: %v", err.Error())
+		return
+	}
+	tier, next = tierFor(tiers, a.Earned_last_year)
+	return
+}
+
+func newLoyaltyTierInfo(t db.LoyaltyTier) LoyaltyTierInfo {
+	return LoyaltyTierInfo{
+		Name:                   t.Name,
+		Min_points:             t.Min_points,
+		Earn_multiplier_bps:    t.Earn_multiplier_bps,
+		Waives_convenience_fee: t.Waives_convenience_fee,
+	}
+}
+
+func (b *bookingService) GetLoyaltyStatement(ctx context.Context, email string) (st LoyaltyStatement, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Getting loyalty statement of %v: %v", email, err.Error())
+		return
+	}
+
+	a, tier, next, err := b.loyaltyOf(ctx, u.User_id)
+	if err != nil {
+		return
+	}
+	entries, err := b.store.GetLoyaltyEntries(ctx, u.User_id, statementEntries)
+	if err != nil {
+		b.logger.Errorf("Err: Getting loyalty entries of %v: %v", email, err.Error())
+		return
+	}
+
+	st = LoyaltyStatement{
+		Balance:          a.Balance,
+		Balance_value:    a.Balance * config.Loyalty().PointValue(),
+		Currency:         config.Pricing().Currency(),
+		Earned_last_year: a.Earned_last_year,
+		Expiring_soon:    a.Expiring_soon,
+		Tier:             newLoyaltyTierInfo(tier),
+		Entries:          make([]LoyaltyEntryResponse, 0, len(entries)),
+	}
+	if next != nil {
+		nt := newLoyaltyTierInfo(*next)
+		st.Next_tier = &nt
+		st.Points_to_next_tier = next.Min_points - a.Earned_last_year
+	}
+
+	for _, e := range entries {
+		er := LoyaltyEntryResponse{
+			Kind:       e.Kind,
+			Points:     e.Points,
+			Booking_id: e.Booking_id,
+			Created_at: e.Created_at.Format(time.RFC3339),
+		}
+		if e.Expires_at != nil {
+			er.Expires_at = e.Expires_at.Format(time.RFC3339)
+		}
+		st.Entries = append(st.Entries, er)
+	}
+	return
+}
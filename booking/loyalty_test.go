@@ -0,0 +1,51 @@
+package booking
+
+import (
+	"testing"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+func TestTierFor(t *testing.T) {
+	tiers := []db.LoyaltyTier{
+		{Tier_id: 1, Name: "Silver", Min_points: 0},
+		{Tier_id: 2, Name: "Gold", Min_points: 1000},
+		{Tier_id: 3, Name: "Platinum", Min_points: 5000},
+	}
+
+	tests := []struct {
+		name   string
+		earned int
+		tier   int
+		next   int
+	}{
+		{"nothing earned", 0, 1, 2},
+		{"just short of gold", 999, 1, 2},
+		{"exactly gold", 1000, 2, 3},
+		{"between gold and platinum", 4200, 2, 3},
+		{"top tier has nothing next", 9000, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tier, next := tierFor(tiers, tt.earned)
+			if tier.Tier_id != tt.tier {
+				t.Fatalf("tier = %v, want %v", tier.Tier_id, tt.tier)
+			}
+			if tt.next == 0 {
+				if next != nil {
+					t.Fatalf("next = %v, want none", next.Tier_id)
+				}
+				return
+			}
+			if next == nil || next.Tier_id != tt.next {
+				t.Fatalf("next = %+v, want %v", next, tt.next)
+			}
+		})
+	}
+
+	// no tiers configured leaves everyone without one
+	if tier, next := tierFor(nil, 100); tier.Tier_id != 0 || next != nil {
+		t.Fatalf("tier = %+v, next = %+v, want none", tier, next)
+	}
+}
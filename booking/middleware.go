@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/Coderx44/MovieTicketingPortal/config"
 	"github.com/Coderx44/MovieTicketingPortal/db"
 	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -31,7 +34,27 @@ func generateJWT(email string, role string) (tokenString string, tokenExpiration
 	return
 }
 
+const claimsKey = "claims"
+
+// ValidateJWT only lets admins through.
 func ValidateJWT(next http.HandlerFunc) http.HandlerFunc {
+	return authorize(next, "admin")
+}
+
+// ValidateUserJWT lets any logged in user through.
+func ValidateUserJWT(next http.HandlerFunc) http.HandlerFunc {
+	return authorize(next)
+}
+
+// ValidateStaffJWT lets multiplex staff and admins through.
+func ValidateStaffJWT(next http.HandlerFunc) http.HandlerFunc {
+	return authorize(next, "staff", "admin")
+}
+
+// authorize checks the token in the Authorization header and, when roles are
+// given, that the token belongs to one of them. The parsed claims are put in
+// the request context.
+func authorize(next http.HandlerFunc, roles ...string) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -40,25 +63,80 @@ func ValidateJWT(next http.HandlerFunc) http.HandlerFunc {
 		}
 		claims := &Claims{}
 		_, err := jwt.ParseWithClaims(authHeader, claims, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
 			return secretKey, nil
 		})
-		if err != nil {
+		// a ticket is no login, whatever it was signed with
+		if err != nil || claims.Subject == ticketSubject {
 			http.Error(w, "Token is invalid", http.StatusUnauthorized)
 			return
 		}
 
-		if claims.Role != "admin" {
+		if len(roles) > 0 && !hasRole(claims.Role, roles) {
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode("Unauthorized")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx := context.WithValue(r.Context(), claimsKey, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 
 	})
 }
 
+// WaitingRoom only lets customers through to book a show whose waiting room
+// is open once its queue has admitted them. It goes inside ValidateUserJWT.
+func WaitingRoom(s Service, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, _ := claimsFromContext(r.Context())
+
+		token := r.Header.Get(config.WaitingRoom().TokenHeader())
+		err = s.CheckAdmission(r.Context(), claims.Email, show_id, token)
+		if err != nil {
+			if err == ErrNotAdmitted {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte("Err: " + err.Error()))
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to check admission"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasRole(role string, roles []string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func claimsFromContext(ctx context.Context) (claims *Claims, ok bool) {
+	claims, ok = ctx.Value(claimsKey).(*Claims)
+	return
+}
+
+// RequestUser is the email of the user a request was validated for, "" when
+// it went through none of the JWT validations.
+func RequestUser(r *http.Request) string {
+	if claims, ok := claimsFromContext(r.Context()); ok {
+		return claims.Email
+	}
+	return ""
+}
+
 // func ValidateJWT(tokenString string) (claims *Claims, err error) {
 // 	claims = &Claims{}
 // 	log.Println(tokenString)
@@ -105,6 +183,33 @@ func getLocationID(ctx context.Context, b *bookingService, city string, state st
 
 }
 
+// staffMultiplex is the multiplex a staff member acts for, the one they are
+// assigned to. Admins act for any, they get the one asked for.
+func staffMultiplex(u db.User, requested int) (multiplex_id int, err error) {
+	if u.Role == "admin" {
+		return requested, nil
+	}
+	if u.Multiplex_id == nil || (requested != 0 && requested != *u.Multiplex_id) {
+		return 0, ErrWrongMultiplex
+	}
+	return *u.Multiplex_id, nil
+}
+
+func (b *bookingService) AssignStaff(ctx context.Context, a StaffAssignment) (err error) {
+	if ok := MultiplexIdExists(b, ctx, a.Multiplex_id); !ok {
+		return ErrInvalidMultiplex
+	}
+	err = b.store.SetStaffMultiplex(ctx, a.Email, a.Multiplex_id)
+	switch err {
+	case nil:
+		b.logger.Infof("Staff %v assigned to multiplex %v", a.Email, a.Multiplex_id)
+	case db.ErrStaffNotFound:
+	default:
+		b.logger.Errorf("Err: Assigning %v to multiplex %v: %v", a.Email, a.Multiplex_id, err.Error())
+	}
+	return
+}
+
 func MultiplexIdExists(b *bookingService, ctx context.Context, multiplex_id int) bool {
 
 	_, err := b.store.GetMultiplexeByID(ctx, multiplex_id)
@@ -119,7 +224,7 @@ func ScreenExists(b *bookingService, ctx context.Context, screen int, multpx_id
 	return s, err == nil
 }
 
-func MovieExists(b *bookingService, ctx context.Context, title string) (int, bool) {
-	movie_id, err := b.store.GetMovieByTitle(ctx, title)
-	return int(movie_id), err == nil
+func MovieExists(b *bookingService, ctx context.Context, title string) (db.Movie, bool) {
+	m, err := b.store.GetMovieByTitle(ctx, title)
+	return m, err == nil
 }
@@ -0,0 +1,55 @@
+package booking
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestPasswordReset queues a one time reset code to the user. It doesn't
+// say whether the email belongs to anyone.
+func (b *bookingService) RequestPasswordReset(ctx context.Context, email string) (err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Infof("Password reset asked for unknown email %v", email)
+		return nil
+	}
+
+	buf := make([]byte, 16)
+	if _, err = rand.Read(buf); err != nil {
+		b.logger.Errorf("Err: Generating password reset token: %v", err.Error())
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	expires_at := time.Now().Add(config.Notify().PasswordResetTTL())
+	if err = b.store.AddPasswordReset(ctx, u.User_id, token, hashResetToken(token), expires_at); err != nil {
+		b.logger.Errorf("Err: Adding password reset of %v: %v", email, err.Error())
+		return
+	}
+	return
+}
+
+func (b *bookingService) ResetPassword(ctx context.Context, r PasswordReset) (err error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(r.New_password), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+
+	err = b.store.ResetPassword(ctx, hashResetToken(r.Token), string(hashedPassword))
+	if err != nil {
+		b.logger.Errorf("Err: Resetting password: %v", err.Error())
+		return
+	}
+	return
+}
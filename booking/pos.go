@@ -0,0 +1,226 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+var ErrShowNotOnSale = errors.New("err: show is no longer on sale")
+
+func newDrawerReport(sh db.Shift, t db.DrawerTotals) DrawerReport {
+	r := DrawerReport{
+		Shift_id:      sh.Shift_id,
+		Staff_id:      sh.Staff_id,
+		Multiplex_id:  sh.Multiplex_id,
+		Status:        sh.Status,
+		Opened_at:     sh.Opened_at.Format(time.RFC3339),
+		Currency:      config.Pricing().Currency(),
+		Opening_float: sh.Opening_float,
+		Cash_sales:    t.Cash_sales,
+		Card_sales:    t.Card_sales,
+		Bookings:      t.Bookings,
+		Tickets:       t.Tickets,
+		Expected_cash: sh.Opening_float + t.Cash_sales,
+	}
+	if sh.Closed_at != nil {
+		r.Closed_at = sh.Closed_at.Format(time.RFC3339)
+	}
+	if sh.Counted_cash != nil {
+		r.Counted_cash = sh.Counted_cash
+		discrepancy := *sh.Counted_cash - r.Expected_cash
+		r.Discrepancy = &discrepancy
+	}
+	return r
+}
+
+func (b *bookingService) OpenShift(ctx context.Context, staffEmail string, o ShiftOpening) (r DrawerReport, err error) {
+	staff, err := b.store.GetUserByEmail(ctx, staffEmail)
+	if err != nil {
+		b.logger.Errorf("Err: Opening shift for %v: %v", staffEmail, err.Error())
+		return
+	}
+
+	// staff open drawers at the multiplex they are assigned to
+	multiplex_id, err := staffMultiplex(staff, o.Multiplex_id)
+	if err != nil {
+		return
+	}
+	if ok := MultiplexIdExists(b, ctx, multiplex_id); !ok {
+		err = ErrInvalidMultiplex
+		return
+	}
+
+	sh, err := b.store.OpenShift(ctx, staff.User_id, multiplex_id, o.Opening_float)
+	if err != nil {
+		b.logger.Errorf("Err: Opening shift for %v: %v", staffEmail, err.Error())
+		return
+	}
+
+	b.logger.Infof("Shift %v opened by %v", sh.Shift_id, staff.User_id)
+	r = newDrawerReport(sh, db.DrawerTotals{})
+	return
+}
+
+func (b *bookingService) CurrentShift(ctx context.Context, staffEmail string) (r DrawerReport, err error) {
+	staff, err := b.store.GetUserByEmail(ctx, staffEmail)
+	if err != nil {
+		b.logger.Errorf("Err: Getting shift of %v: %v", staffEmail, err.Error())
+		return
+	}
+
+	sh, err := b.store.GetOpenShift(ctx, staff.User_id)
+	if err != nil {
+		return
+	}
+
+	t, err := b.store.GetDrawerTotals(ctx, sh.Shift_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting drawer totals of shift %v: %v", sh.Shift_id, err.Error())
+		return
+	}
+	r = newDrawerReport(sh, t)
+	return
+}
+
+// CloseShift closes the staff member's drawer and reconciles the cash they
+// counted against the opening float plus cash sales.
+func (b *bookingService) CloseShift(ctx context.Context, staffEmail string, c ShiftClosing) (r DrawerReport, err error) {
+	staff, err := b.store.GetUserByEmail(ctx, staffEmail)
+	if err != nil {
+		b.logger.Errorf("Err: Closing shift of %v: %v", staffEmail, err.Error())
+		return
+	}
+
+	sh, err := b.store.GetOpenShift(ctx, staff.User_id)
+	if err != nil {
+		return
+	}
+
+	shift_id := sh.Shift_id
+	sh, err = b.store.CloseShift(ctx, shift_id, c.Counted_cash)
+	if err != nil {
+		b.logger.Errorf("Err: Closing shift %v: %v", shift_id, err.Error())
+		return
+	}
+
+	t, err := b.store.GetDrawerTotals(ctx, sh.Shift_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting drawer totals of shift %v: %v", sh.Shift_id, err.Error())
+		return
+	}
+
+	r = newDrawerReport(sh, t)
+	b.logger.Infof("Shift %v closed, discrepancy %v", sh.Shift_id, *r.Discrepancy)
+	return
+}
+
+// PosBook sells seats at the counter. The sale goes into the staff member's
+// open shift at the show's multiplex, and the customer doesn't need an
+// account.
+func (b *bookingService) PosBook(ctx context.Context, staffEmail string, show_id int, p PosBooking) (resp PosBookingResponse, err error) {
+	staff, err := b.store.GetUserByEmail(ctx, staffEmail)
+	if err != nil {
+		b.logger.Errorf("Err: POS booking by %v: %v", staffEmail, err.Error())
+		return
+	}
+
+	sh, err := b.store.GetOpenShift(ctx, staff.User_id)
+	if err != nil {
+		return
+	}
+
+	show, err := b.store.GetShowByID(ctx, show_id)
+	if err != nil {
+		return
+	}
+	if show.Multiplex_id != sh.Multiplex_id {
+		err = ErrWrongMultiplex
+		return
+	}
+	// walk-ins can still buy until latecomers stop being admitted
+	if _, closes := admissionWindow(show.Start_time); time.Now().After(closes) {
+		err = ErrShowNotOnSale
+		return
+	}
+
+	if err = b.repriceShow(ctx, show); err != nil {
+		return
+	}
+
+	pr, err := b.newPricing(ctx, show, db.ChannelPOS, 0, "")
+	if err != nil {
+		b.logger.Errorf("Err: Pricing POS booking for show %v: %v", show_id, err.Error())
+		return
+	}
+
+	booked, err := b.store.BookSeats(ctx, db.NewBooking{
+		Show_id:        show_id,
+		Seat_numbers:   p.Seats,
+		Customer_phone: p.Customer_phone,
+		Channel:        db.ChannelPOS,
+		Sold_by:        staff.User_id,
+		Payment_method: p.Payment_method,
+		Shift_id:       sh.Shift_id,
+		Price:          pr.charge,
+	})
+	if err != nil {
+		b.logger.Errorf("Err: POS booking for show %v: %v", show_id, err.Error())
+		return
+	}
+
+	resp = PosBookingResponse{
+		Booking_id:     booked.Booking_id,
+		Show_id:        show_id,
+		Seats:          p.Seats,
+		Amount:         booked.Charge.Amount,
+		Price:          newPriceBreakdown(pr.quoted),
+		Payment_method: p.Payment_method,
+		Shift_id:       sh.Shift_id,
+	}
+	b.logger.Infof("POS booking %v by %v for %v", booked.Booking_id, staff.User_id, booked.Charge.Amount)
+
+	// the seats are sold, a ticket that fails now is reprinted, not refunded
+	ticket, e := b.posTicket(ctx, booked.Booking_id, sh.Multiplex_id)
+	if e != nil {
+		b.logger.Errorf("Err: Ticket for POS booking %v: %v", booked.Booking_id, e.Error())
+		return
+	}
+	resp.Ticket = ticket.Token
+	return
+}
+
+// GetPosTicket reprints the ticket of a booking at the staff member's
+// multiplex.
+func (b *bookingService) GetPosTicket(ctx context.Context, staffEmail string, booking_id int) (t Ticket, err error) {
+	staff, err := b.store.GetUserByEmail(ctx, staffEmail)
+	if err != nil {
+		b.logger.Errorf("Err: POS ticket by %v: %v", staffEmail, err.Error())
+		return
+	}
+
+	sh, err := b.store.GetOpenShift(ctx, staff.User_id)
+	if err != nil {
+		return
+	}
+	return b.posTicket(ctx, booking_id, sh.Multiplex_id)
+}
+
+func (b *bookingService) posTicket(ctx context.Context, booking_id int, multiplex_id int) (t Ticket, err error) {
+	bk, err := b.store.GetBookingByID(ctx, booking_id)
+	if err != nil {
+		return
+	}
+	if bk.Multiplex_id != multiplex_id {
+		err = db.ErrBookingNotFound
+		return
+	}
+	return ticketFor(bk)
+}
+
+func validPaymentMethod(method string) bool {
+	return method == db.PaymentCash || method == db.PaymentCard
+}
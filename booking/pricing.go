@@ -0,0 +1,500 @@
+package booking
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+// CouponError explains why a promo code can't be applied to a booking.
+type CouponError struct {
+	Reason string
+}
+
+func (e CouponError) Error() string {
+	return "err: coupon rejected - " + e.Reason
+}
+
+// Quote is the price of a set of seats as it moves through the pricing
+// pipeline. Amounts are in minor units of Currency.
+type Quote struct {
+	Seats    []db.Seat
+	Currency string
+	Subtotal int
+	Discount int
+	Fnb      int
+	Fees     int
+	Taxes    int
+	Fnb_tax  int // the part of Taxes charged on Fnb
+	Total    int
+	Coupon   *db.Coupon
+	Lines    []db.LineItem
+
+	Points_redeemed int
+	Points_value    int
+	Points_earned   int
+}
+
+// pricing holds everything the pipeline needs besides the seats. It is
+// loaded before seats are locked so that the steps themselves don't touch
+// the db and can run inside the booking transaction.
+type pricing struct {
+	show      db.Show
+	multiplex db.Multiplexe
+	loc       *time.Location
+	user_id   int
+	channel   string
+	now       time.Time
+
+	currency string
+	fee      int // per ticket
+	taxes    []db.TaxRate
+
+	// customers with an account spend and earn loyalty points
+	tier           *db.LoyaltyTier
+	points_balance int
+	points         int
+
+	// food and drinks ordered with the seats, priced off the menu
+	fnb  []FnbSelection
+	menu map[int]db.FnbItem
+
+	coupon      *db.Coupon
+	coupon_uses int
+
+	// quoted is the quote the last charge was based on
+	quoted Quote
+}
+
+type pricingStep func(p *pricing, q *Quote) error
+
+var pricingPipeline = []pricingStep{
+	priceSeats,
+	applyCoupon,
+	redeemPoints,
+	priceFnb,
+	addFees,
+	addTaxes,
+	totalQuote,
+	earnPoints,
+}
+
+func (p *pricing) quote(seats []db.Seat) (q Quote, err error) {
+	q.Seats = seats
+	q.Currency = p.currency
+	for _, step := range pricingPipeline {
+		if err = step(p, &q); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// charge adapts the pipeline to db.NewBooking.Price.
+func (p *pricing) charge(seats []db.Seat) (c db.Charge, err error) {
+	q, err := p.quote(seats)
+	if err != nil {
+		return
+	}
+	p.quoted = q
+	c = db.Charge{
+		Amount:   q.Total,
+		Discount: q.Discount,
+		Fee:      q.Fees,
+		Tax:      q.Taxes,
+		Fnb_tax:  q.Fnb_tax,
+		Currency: q.Currency,
+		Lines:    q.Lines,
+
+		Points_redeemed:  q.Points_redeemed,
+		Points_earned:    q.Points_earned,
+		Points_expire_at: pointsExpireAt(p.now),
+	}
+	if q.Coupon != nil {
+		c.Coupon_id = q.Coupon.Coupon_id
+	}
+	return
+}
+
+// priceSeats adds a ticket line for every price the seats come at.
+func priceSeats(p *pricing, q *Quote) error {
+	count := map[int]int{}
+	var prices []int
+	for _, s := range q.Seats {
+		if count[s.Price] == 0 {
+			prices = append(prices, s.Price)
+		}
+		count[s.Price]++
+		q.Subtotal += s.Price
+	}
+
+	for _, price := range prices {
+		q.Lines = append(q.Lines, db.LineItem{
+			Kind:        db.LineTicket,
+			Label:       "Ticket",
+			Quantity:    count[price],
+			Unit_amount: price,
+			Amount:      count[price] * price,
+		})
+	}
+	return nil
+}
+
+func applyCoupon(p *pricing, q *Quote) error {
+	c := p.coupon
+	if c == nil {
+		return nil
+	}
+	if err := checkCoupon(p, c, len(q.Seats)); err != nil {
+		return err
+	}
+
+	discount := 0
+	switch c.Kind {
+	case db.CouponPercent:
+		discount = q.Subtotal * c.Value / 100
+		if c.Max_discount != nil && discount > *c.Max_discount {
+			discount = *c.Max_discount
+		}
+	case db.CouponFlat:
+		discount = c.Value
+	}
+	if discount > q.Subtotal {
+		discount = q.Subtotal
+	}
+
+	q.Discount += discount
+	q.Coupon = c
+	q.Lines = append(q.Lines, db.LineItem{
+		Kind:        db.LineDiscount,
+		Label:       "Coupon " + c.Code,
+		Quantity:    1,
+		Unit_amount: -discount,
+		Amount:      -discount,
+	})
+	return nil
+}
+
+// redeemPoints spends the customer's points on the tickets. Customers never
+// spend more points than the tickets are worth after the coupon.
+func redeemPoints(p *pricing, q *Quote) error {
+	if p.points == 0 {
+		return nil
+	}
+	if p.tier == nil || p.points > p.points_balance {
+		return db.ErrInsufficientPoints
+	}
+
+	value := config.Loyalty().PointValue()
+	points := p.points
+	if left := q.Subtotal - q.Discount; points*value > left {
+		points = left / value
+	}
+	if points == 0 {
+		return nil
+	}
+
+	q.Points_redeemed = points
+	q.Points_value = points * value
+	q.Lines = append(q.Lines, db.LineItem{
+		Kind:        db.LineLoyalty,
+		Label:       fmt.Sprintf("%d loyalty points", points),
+		Quantity:    points,
+		Unit_amount: -value,
+		Amount:      -q.Points_value,
+	})
+	return nil
+}
+
+// earnPoints works out what the customer earns on what they pay.
+func earnPoints(p *pricing, q *Quote) error {
+	if p.tier == nil {
+		return nil
+	}
+	rupees := q.Total / 100
+	q.Points_earned = rupees * config.Loyalty().PointsPerRupee() * p.tier.Earn_multiplier_bps / 10000
+	return nil
+}
+
+// priceFnb adds a line for every menu item ordered. Coupons only take money
+// off tickets so this runs after them.
+func priceFnb(p *pricing, q *Quote) error {
+	for _, sel := range p.fnb {
+		it, ok := p.menu[sel.Item_id]
+		if !ok {
+			return db.ErrFnbItemNotFound
+		}
+		if it.Stock != nil && *it.Stock < sel.Quantity {
+			return db.ErrFnbOutOfStock
+		}
+
+		amount := it.Price * sel.Quantity
+		q.Fnb += amount
+		q.Lines = append(q.Lines, db.LineItem{
+			Kind:        db.LineFnb,
+			Label:       it.Name,
+			Quantity:    sel.Quantity,
+			Unit_amount: it.Price,
+			Amount:      amount,
+		})
+	}
+	return nil
+}
+
+// addFees charges the convenience fee on online bookings, the box office
+// doesn't charge it.
+func addFees(p *pricing, q *Quote) error {
+	if p.channel != db.ChannelOnline || p.fee == 0 {
+		return nil
+	}
+	if p.tier != nil && p.tier.Waives_convenience_fee {
+		return nil
+	}
+
+	fees := p.fee * len(q.Seats)
+	q.Fees += fees
+	q.Lines = append(q.Lines, db.LineItem{
+		Kind:        db.LineFee,
+		Label:       "Convenience fee",
+		Quantity:    len(q.Seats),
+		Unit_amount: p.fee,
+		Amount:      fees,
+	})
+	return nil
+}
+
+// addTaxes charges every tax rate of the multiplex's state. Ticket taxes are
+// worked out on the discounted ticket price, the others on what they are
+// charged on.
+func addTaxes(p *pricing, q *Quote) error {
+	for _, r := range p.taxes {
+		base := q.Subtotal - q.Discount - q.Points_value
+		switch r.Applies_to {
+		case db.TaxOnFees:
+			base = q.Fees
+		case db.TaxOnFnb:
+			base = q.Fnb
+		}
+
+		tax := percentOf(base, r.Rate_bps)
+		if tax == 0 {
+			continue
+		}
+		q.Taxes += tax
+		if r.Applies_to == db.TaxOnFnb {
+			q.Fnb_tax += tax
+		}
+		q.Lines = append(q.Lines, db.LineItem{
+			Kind:        db.LineTax,
+			Label:       fmt.Sprintf("%s %s%% on %s", r.Name, formatRate(r.Rate_bps), r.Applies_to),
+			Quantity:    1,
+			Unit_amount: tax,
+			Amount:      tax,
+		})
+	}
+	return nil
+}
+
+func totalQuote(p *pricing, q *Quote) error {
+	q.Total = q.Subtotal - q.Discount - q.Points_value + q.Fnb + q.Fees + q.Taxes
+	return nil
+}
+
+// percentOf works out bps basis points of amount, rounding half up.
+func percentOf(amount int, bps int) int {
+	return (amount*bps + 5000) / 10000
+}
+
+// formatRate turns basis points into a percentage, 250 is "2.5".
+func formatRate(bps int) string {
+	return strconv.FormatFloat(float64(bps)/100, 'f', -1, 64)
+}
+
+// checkCoupon applies the coupon's rules. Usage limits are checked again
+// when the coupon is redeemed, this only gives customers an early answer.
+func checkCoupon(p *pricing, c *db.Coupon, tickets int) error {
+	switch {
+	case !c.Active:
+		return CouponError{"coupon is no longer active"}
+	case c.Valid_from != nil && p.now.Before(*c.Valid_from):
+		return CouponError{"coupon is not valid yet"}
+	case c.Expires_at != nil && !p.now.Before(*c.Expires_at):
+		return CouponError{"coupon has expired"}
+	case tickets < c.Min_tickets:
+		return CouponError{fmt.Sprintf("coupon needs at least %d tickets", c.Min_tickets)}
+	case len(c.Movie_ids) > 0 && !containsID(c.Movie_ids, p.show.Movie_id):
+		return CouponError{"coupon is not valid for this movie"}
+	case len(c.Multiplex_ids) > 0 && !containsID(c.Multiplex_ids, p.show.Multiplex_id):
+		return CouponError{"coupon is not valid at this multiplex"}
+	case c.Total_limit != nil && c.Redeemed_count >= *c.Total_limit:
+		return CouponError{"coupon has been fully redeemed"}
+	case c.Per_user_limit != nil && p.coupon_uses >= *c.Per_user_limit:
+		return CouponError{"coupon already used the maximum number of times"}
+	}
+
+	if len(c.Days_of_week) > 0 {
+		day := p.show.Start_time.In(p.loc).Weekday()
+		if !containsID(c.Days_of_week, int(day)) {
+			return CouponError{fmt.Sprintf("coupon is not valid on %s", day)}
+		}
+	}
+	return nil
+}
+
+func containsID(ids []int64, id int) bool {
+	for _, i := range ids {
+		if i == int64(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// newPricing loads what the pricing pipeline needs for a booking of a show
+// made through the given channel.
+func (b *bookingService) newPricing(ctx context.Context, show db.Show, channel string, user_id int, coupon_code string) (p *pricing, err error) {
+	multiplex, err := b.store.GetMultiplexeByID(ctx, show.Multiplex_id)
+	if err != nil {
+		return
+	}
+	loc, err := time.LoadLocation(multiplex.Time_zone)
+	if err != nil {
+		return
+	}
+	taxes, err := b.store.GetTaxRatesOfMultiplex(ctx, show.Multiplex_id)
+	if err != nil {
+		return
+	}
+
+	p = &pricing{
+		show:      show,
+		multiplex: multiplex,
+		loc:       loc,
+		user_id:   user_id,
+		channel:   channel,
+		now:       time.Now(),
+		currency:  config.Pricing().Currency(),
+		fee:       config.Pricing().ConvenienceFee(),
+		taxes:     taxes,
+	}
+
+	if user_id != 0 {
+		a, tier, _, e := b.loyaltyOf(ctx, user_id)
+		if e != nil {
+			err = e
+			return
+		}
+		p.tier = &tier
+		p.points_balance = a.Balance
+	}
+
+	coupon_code = strings.TrimSpace(coupon_code)
+	if coupon_code == "" {
+		return
+	}
+
+	c, err := b.store.GetCouponByCode(ctx, coupon_code)
+	if err == db.ErrCouponNotFound {
+		err = CouponError{"unknown coupon code"}
+		return
+	}
+	if err != nil {
+		return
+	}
+	p.coupon = &c
+
+	if c.Per_user_limit != nil {
+		if user_id == 0 {
+			err = CouponError{"coupon needs a customer account"}
+			return
+		}
+		if p.coupon_uses, err = b.store.CountCouponUses(ctx, c.Coupon_id, user_id); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func newPriceBreakdown(q Quote) PriceBreakdown {
+	pb := PriceBreakdown{
+		Currency: q.Currency,
+		Subtotal: q.Subtotal,
+		Discount: q.Discount,
+		Fnb:      q.Fnb,
+		Fees:     q.Fees,
+		Taxes:    q.Taxes,
+		Total:    q.Total,
+		Items:    newPriceItems(q.Lines),
+
+		Points_redeemed: q.Points_redeemed,
+		Points_value:    q.Points_value,
+		Points_earned:   q.Points_earned,
+	}
+	if q.Coupon != nil {
+		pb.Coupon = q.Coupon.Code
+	}
+	return pb
+}
+
+func newPriceItems(lines []db.LineItem) []PriceItem {
+	items := make([]PriceItem, 0, len(lines))
+	for _, l := range lines {
+		items = append(items, PriceItem{
+			Kind:        l.Kind,
+			Label:       l.Label,
+			Quantity:    l.Quantity,
+			Unit_amount: l.Unit_amount,
+			Amount:      l.Amount,
+		})
+	}
+	return items
+}
+
+// withFnb loads the menu of the show's multiplex for the food and drinks
+// ordered with the seats.
+func (b *bookingService) withFnb(ctx context.Context, p *pricing, fnb []FnbSelection) (err error) {
+	if len(fnb) == 0 {
+		return
+	}
+
+	items, _, err := b.store.GetFnbMenu(ctx, p.show.Multiplex_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting menu of multiplex %v: %v", p.show.Multiplex_id, err.Error())
+		return
+	}
+	p.menu = make(map[int]db.FnbItem, len(items))
+	for _, it := range items {
+		p.menu[it.Item_id] = it
+	}
+	p.fnb = fnb
+	return
+}
+
+// fnbOrder is the kitchen order for the food and drinks priced with the
+// seats, nil when none were ordered.
+func (p *pricing) fnbOrder(fulfilment string, deliver_at time.Time) *db.NewFnbOrder {
+	if len(p.fnb) == 0 {
+		return nil
+	}
+
+	o := &db.NewFnbOrder{
+		Multiplex_id: p.show.Multiplex_id,
+		Fulfilment:   fulfilment,
+		Deliver_at:   deliver_at,
+	}
+	for _, sel := range p.fnb {
+		it := p.menu[sel.Item_id]
+		o.Items = append(o.Items, db.FnbOrderItem{
+			Item_id:    it.Item_id,
+			Name:       it.Name,
+			Quantity:   sel.Quantity,
+			Unit_price: it.Price,
+		})
+	}
+	return o
+}
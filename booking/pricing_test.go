@@ -0,0 +1,194 @@
+package booking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+func seatsAt(prices ...int) (seats []db.Seat) {
+	for i, p := range prices {
+		seats = append(seats, db.Seat{Seat_number: i + 1, Price: p, Status: db.SeatAvailable})
+	}
+	return
+}
+
+func TestApplyCoupon(t *testing.T) {
+	maxDiscount := 10000
+	tests := []struct {
+		name     string
+		coupon   db.Coupon
+		seats    []db.Seat
+		discount int
+	}{
+		{"percent", db.Coupon{Kind: db.CouponPercent, Value: 10}, seatsAt(30000, 30000), 6000},
+		{"percent capped by max discount", db.Coupon{Kind: db.CouponPercent, Value: 50, Max_discount: &maxDiscount}, seatsAt(30000, 30000), 10000},
+		{"flat", db.Coupon{Kind: db.CouponFlat, Value: 5000}, seatsAt(30000), 5000},
+		{"flat capped at the tickets", db.Coupon{Kind: db.CouponFlat, Value: 50000}, seatsAt(30000), 30000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.coupon.Code, tt.coupon.Active = "SAVE", true
+			p := &pricing{coupon: &tt.coupon, loc: time.UTC}
+			q := &Quote{Seats: tt.seats}
+			if err := priceSeats(p, q); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyCoupon(p, q); err != nil {
+				t.Fatal(err)
+			}
+			if q.Discount != tt.discount {
+				t.Fatalf("discount = %v, want %v", q.Discount, tt.discount)
+			}
+			if last := q.Lines[len(q.Lines)-1]; last.Kind != db.LineDiscount || last.Amount != -tt.discount {
+				t.Fatalf("line = %+v, want a discount of %v", last, tt.discount)
+			}
+		})
+	}
+}
+
+func TestCouponSkipsFnb(t *testing.T) {
+	p := &pricing{
+		coupon: &db.Coupon{Code: "SAVE", Kind: db.CouponFlat, Value: 50000, Active: true},
+		loc:    time.UTC,
+		fnb:    []FnbSelection{{Item_id: 1, Quantity: 2}},
+		menu:   map[int]db.FnbItem{1: {Item_id: 1, Name: "Popcorn", Price: 25000}},
+	}
+	q := &Quote{Seats: seatsAt(30000)}
+	for _, step := range []pricingStep{priceSeats, applyCoupon, priceFnb, totalQuote} {
+		if err := step(p, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the coupon is worth more than the ticket, the food is paid in full
+	if q.Discount != 30000 || q.Fnb != 50000 || q.Total != 50000 {
+		t.Fatalf("discount = %v, fnb = %v, total = %v, want 30000, 50000 and 50000", q.Discount, q.Fnb, q.Total)
+	}
+}
+
+func TestCheckCoupon(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 5, 20, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+	// Saturday evening in UTC is already Sunday at the multiplex
+	show := db.Show{Start_time: time.Date(2023, 5, 20, 20, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name    string
+		coupon  db.Coupon
+		tickets int
+		ok      bool
+	}{
+		{"no rules", db.Coupon{Active: true}, 1, true},
+		{"inactive", db.Coupon{}, 1, false},
+		{"enough tickets", db.Coupon{Active: true, Min_tickets: 2}, 2, true},
+		{"too few tickets", db.Coupon{Active: true, Min_tickets: 2}, 1, false},
+		{"within the window", db.Coupon{Active: true, Valid_from: &before, Expires_at: &after}, 1, true},
+		{"not valid yet", db.Coupon{Active: true, Valid_from: &after}, 1, false},
+		{"expired", db.Coupon{Active: true, Expires_at: &before}, 1, false},
+		{"expires right now", db.Coupon{Active: true, Expires_at: &now}, 1, false},
+		{"valid on the local day", db.Coupon{Active: true, Days_of_week: []int64{int64(time.Sunday)}}, 1, true},
+		{"not valid on the local day", db.Coupon{Active: true, Days_of_week: []int64{int64(time.Saturday)}}, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pricing{show: show, loc: loc, now: now}
+			if err := checkCoupon(p, &tt.coupon, tt.tickets); (err == nil) != tt.ok {
+				t.Fatalf("checkCoupon = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAddFees(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+		tier    *db.LoyaltyTier
+		fees    int
+	}{
+		{"online", db.ChannelOnline, nil, 6000},
+		{"box office", db.ChannelPOS, nil, 0},
+		{"tier that pays the fee", db.ChannelOnline, &db.LoyaltyTier{Name: "Silver"}, 6000},
+		{"tier that waives the fee", db.ChannelOnline, &db.LoyaltyTier{Name: "Gold", Waives_convenience_fee: true}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &pricing{channel: tt.channel, fee: 3000, tier: tt.tier}
+			q := &Quote{Seats: seatsAt(30000, 30000)}
+			if err := addFees(p, q); err != nil {
+				t.Fatal(err)
+			}
+			if q.Fees != tt.fees {
+				t.Fatalf("fees = %v, want %v", q.Fees, tt.fees)
+			}
+			if tt.fees == 0 && len(q.Lines) != 0 {
+				t.Fatalf("lines = %+v, want none", q.Lines)
+			}
+		})
+	}
+}
+
+func TestAddTaxes(t *testing.T) {
+	p := &pricing{taxes: []db.TaxRate{
+		{Name: "GST", Rate_bps: 1800, Applies_to: db.TaxOnTickets},
+		{Name: "GST", Rate_bps: 1800, Applies_to: db.TaxOnFees},
+		{Name: "GST", Rate_bps: 500, Applies_to: db.TaxOnFnb},
+	}}
+	// 600.00 of tickets less a 100.00 coupon and 20.00 of points, with
+	// 60.00 of fees and 250.00 of food
+	q := &Quote{Subtotal: 60000, Discount: 10000, Points_value: 2000, Fees: 6000, Fnb: 25000}
+	if err := addTaxes(p, q); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		label  string
+		amount int
+	}{
+		{"GST 18% on tickets", 8640},
+		{"GST 18% on fees", 1080},
+		{"GST 5% on fnb", 1250},
+	}
+	if len(q.Lines) != len(want) {
+		t.Fatalf("lines = %+v, want %v", q.Lines, len(want))
+	}
+	for i, w := range want {
+		if l := q.Lines[i]; l.Kind != db.LineTax || l.Label != w.label || l.Amount != w.amount {
+			t.Fatalf("line %v = %+v, want %q of %v", i, l, w.label, w.amount)
+		}
+	}
+	if q.Taxes != 10970 || q.Fnb_tax != 1250 {
+		t.Fatalf("taxes = %v with %v on food, want 10970 with 1250", q.Taxes, q.Fnb_tax)
+	}
+}
+
+func TestPercentOf(t *testing.T) {
+	tests := []struct {
+		amount int
+		bps    int
+		want   int
+	}{
+		{10000, 1800, 1800},
+		{0, 1800, 0},
+		// 18% of 25 paise is 4.5, halves round up
+		{25, 1800, 5},
+		{24, 1800, 4},
+		{27, 1850, 5},
+		{50000, 250, 1250},
+	}
+
+	for _, tt := range tests {
+		if got := percentOf(tt.amount, tt.bps); got != tt.want {
+			t.Fatalf("percentOf(%v, %v) = %v, want %v", tt.amount, tt.bps, got, tt.want)
+		}
+	}
+}
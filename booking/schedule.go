@@ -0,0 +1,93 @@
+package booking
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const ClockOnly = "15:04"
+
+var (
+	ErrInvalidShowTime       = errors.New("err: start time must be ISO 8601 with an offset")
+	ErrOutsideOperatingHours = errors.New("err: show exceeds multiplex operating hours")
+	ErrOverlappingShow       = errors.New("err: overlapping show times")
+	ErrShowInPast            = errors.New("err: show must start in the future")
+	ErrShowStarted           = errors.New("err: show has already started")
+)
+
+// parseClock accepts both the 24 hour "15:04" format and time.Kitchen.
+func parseClock(s string) (t time.Time, err error) {
+	s = strings.TrimSpace(s)
+	t, err = time.Parse(ClockOnly, s)
+	if err == nil {
+		return
+	}
+	return time.Parse(time.Kitchen, s)
+}
+
+func atClock(day time.Time, clock time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, day.Location())
+}
+
+// operatingWindow returns the opening and closing instants of a multiplex for
+// the business day starting on day, in day's location. A closing time at or
+// before the opening time means the multiplex closes after midnight.
+func operatingWindow(day time.Time, opensAt string, closesAt string) (open time.Time, close time.Time, err error) {
+	o, err := parseClock(opensAt)
+	if err != nil {
+		return
+	}
+	c, err := parseClock(closesAt)
+	if err != nil {
+		return
+	}
+
+	open = atClock(day, o)
+	close = atClock(day, c)
+	if !close.After(open) {
+		close = close.AddDate(0, 0, 1)
+	}
+	return
+}
+
+// scheduleShow works out the business day a show starting at start belongs
+// to in the multiplex's time zone, when it ends, and checks that it fits
+// inside that day's operating window. Shows starting after midnight but
+// before the opening time belong to the previous business day.
+func scheduleShow(start time.Time, duration time.Duration, loc *time.Location, opensAt string, closesAt string) (day time.Time, end time.Time, err error) {
+	local := start.In(loc)
+	day = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	open, close, err := operatingWindow(day, opensAt, closesAt)
+	if err != nil {
+		return
+	}
+	if local.Before(open) {
+		day = day.AddDate(0, 0, -1)
+		if open, close, err = operatingWindow(day, opensAt, closesAt); err != nil {
+			return
+		}
+	}
+
+	end = start.Add(duration)
+	if local.Before(open) || end.After(close) {
+		err = ErrOutsideOperatingHours
+		return
+	}
+	return
+}
+
+// parseInstant parses an ISO 8601 timestamp. The offset is mandatory so that
+// clients can't accidentally send times in the server's zone.
+func parseInstant(s string) (t time.Time, err error) {
+	t, err = time.Parse(time.RFC3339, strings.TrimSpace(s))
+	if err != nil {
+		err = ErrInvalidShowTime
+	}
+	return
+}
+
+func minutes(m int) time.Duration {
+	return time.Duration(m) * time.Minute
+}
@@ -0,0 +1,61 @@
+package booking
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleShow(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2023, time.March, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name     string
+		start    time.Time
+		duration time.Duration
+		day      time.Time
+		err      error
+	}{
+		{"inside the day", at(10, 18, 0), 3 * time.Hour, at(10, 0, 0), nil},
+		{"ends at closing after midnight", at(10, 22, 0), 3 * time.Hour, at(10, 0, 0), nil},
+		{"after midnight belongs to the previous day", at(11, 0, 15), 30 * time.Minute, at(10, 0, 0), nil},
+		{"runs past closing", at(10, 23, 0), 3 * time.Hour, time.Time{}, ErrOutsideOperatingHours},
+		{"starts before opening", at(10, 8, 30), time.Hour, time.Time{}, ErrOutsideOperatingHours},
+		{"starts at opening", at(10, 9, 0), time.Hour, at(10, 0, 0), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// in UTC, the show still belongs to the multiplex's business day
+			day, end, err := scheduleShow(tt.start.UTC(), tt.duration, loc, "09:00", "01:00")
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !day.Equal(tt.day) {
+				t.Errorf("day = %v, want %v", day, tt.day)
+			}
+			if !end.Equal(tt.start.Add(tt.duration)) {
+				t.Errorf("end = %v, want %v", end, tt.start.Add(tt.duration))
+			}
+		})
+	}
+}
+
+func TestOperatingWindowKitchenClock(t *testing.T) {
+	day := time.Date(2023, time.March, 10, 0, 0, 0, 0, time.UTC)
+	open, close, err := operatingWindow(day, "9:00AM", "11:30PM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open.Hour() != 9 || close.Hour() != 23 || close.Minute() != 30 || close.Day() != 10 {
+		t.Errorf("window = %v - %v", open, close)
+	}
+}
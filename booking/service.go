@@ -5,15 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
+	"github.com/Coderx44/MovieTicketingPortal/config"
 	"github.com/Coderx44/MovieTicketingPortal/db"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var secretKey = []byte("ThisIsMyFistGolangProjecT")
 
+var (
+	ErrIncorrectPassword = errors.New("err: current password is incorrect")
+	ErrInvalidCoupon     = errors.New("err: invalid coupon")
+)
+
 const DateOnly = "2006-01-02"
 
 type Service interface {
@@ -24,6 +30,66 @@ type Service interface {
 	AddMultiplex(ctx context.Context, m NewMultiplex) (multiplex_id uint, err error)
 	AddLocation(ctx context.Context, l NewLocation) (location_id uint, err error)
 	AddShow(ctx context.Context, s NewShow) (show_id uint, err error)
+	ListShows(ctx context.Context, f ShowFilter) (shows []ShowResponse, err error)
+	CancelShow(ctx context.Context, show_id int, c ShowCancellation) (report CancellationReport, err error)
+	RescheduleShow(ctx context.Context, show_id int, r ShowReschedule) (report RescheduleReport, err error)
+	GetProfile(ctx context.Context, email string) (p Profile, err error)
+	UpdateProfile(ctx context.Context, email string, u ProfileUpdate) (p Profile, err error)
+	ChangePassword(ctx context.Context, email string, c PasswordChange) (err error)
+	ListMyBookings(ctx context.Context, email string, when string) (bookings []MyBooking, err error)
+	GetTicket(ctx context.Context, email string, booking_id int) (t Ticket, err error)
+	CheckIn(ctx context.Context, staffEmail string, c CheckIn) (resp CheckInResponse, err error)
+	GetAdmissions(ctx context.Context, show_id int) (a AdmissionCount, err error)
+	OpenShift(ctx context.Context, staffEmail string, o ShiftOpening) (r DrawerReport, err error)
+	CurrentShift(ctx context.Context, staffEmail string) (r DrawerReport, err error)
+	CloseShift(ctx context.Context, staffEmail string, c ShiftClosing) (r DrawerReport, err error)
+	PosBook(ctx context.Context, staffEmail string, show_id int, p PosBooking) (resp PosBookingResponse, err error)
+	GetPosTicket(ctx context.Context, staffEmail string, booking_id int) (t Ticket, err error)
+	GetSeatMap(ctx context.Context, show_id int) (seats []SeatMapEntry, err error)
+	QuoteBooking(ctx context.Context, email string, show_id int, r BookingRequest) (q QuoteResponse, err error)
+	BookShow(ctx context.Context, email string, show_id int, r BookingRequest) (resp BookingResponse, err error)
+	AddCoupon(ctx context.Context, c NewCoupon) (coupon_id uint, err error)
+	ListCoupons(ctx context.Context) (coupons []CouponResponse, err error)
+	DeactivateCoupon(ctx context.Context, coupon_id int) (err error)
+	GetInvoice(ctx context.Context, email string, booking_id int) (inv Invoice, err error)
+	ListTaxRates(ctx context.Context) (rates []TaxRateResponse, err error)
+	SetTaxRates(ctx context.Context, state string, rates []TaxRateEntry) (err error)
+	AddPricingRule(ctx context.Context, r NewPricingRule) (rule_id uint, err error)
+	ListPricingRules(ctx context.Context) (rules []PricingRuleResponse, err error)
+	DeactivatePricingRule(ctx context.Context, rule_id int) (err error)
+	GetPriceHistory(ctx context.Context, show_id int) (changes []PriceChangeEntry, err error)
+	AddFnbItem(ctx context.Context, multiplex_id int, ni NewFnbItem) (item_id uint, err error)
+	GetFnbMenu(ctx context.Context, multiplex_id int) (menu []FnbMenuItem, err error)
+	SetFnbStock(ctx context.Context, staffEmail string, item_id int, stock *int) (err error)
+	GetKitchenQueue(ctx context.Context, staffEmail string, multiplex_id int, status string) (queue []KitchenOrder, err error)
+	GetLoyaltyStatement(ctx context.Context, email string) (st LoyaltyStatement, err error)
+	UpdateFnbOrder(ctx context.Context, staffEmail string, order_id int, status string) (err error)
+	IssueGiftCard(ctx context.Context, adminEmail string, ng NewGiftCard) (g GiftCardResponse, err error)
+	ListGiftCards(ctx context.Context) (cards []GiftCardResponse, err error)
+	VoidGiftCard(ctx context.Context, adminEmail string, gift_card_id int) (g GiftCardResponse, err error)
+	GetGiftCardBalance(ctx context.Context, code string) (g GiftCardResponse, err error)
+	GetWallet(ctx context.Context, email string) (st WalletStatement, err error)
+	JoinWaitlist(ctx context.Context, email string, show_id int, r WaitlistRequest) (st WaitlistStatus, err error)
+	GetWaitlistStatus(ctx context.Context, email string, show_id int) (st WaitlistStatus, err error)
+	LeaveWaitlist(ctx context.Context, email string, show_id int) (err error)
+	CancelBooking(ctx context.Context, email string, booking_id int, r BookingCancelRequest) (bc BookingCancellation, err error)
+	ReseatBooking(ctx context.Context, email string, booking_id int, r BookingReseatRequest) (mb MyBooking, err error)
+	RequestPasswordReset(ctx context.Context, email string) (err error)
+	ResetPassword(ctx context.Context, r PasswordReset) (err error)
+	AddWebhook(ctx context.Context, nw NewWebhook) (w WebhookResponse, err error)
+	ListWebhooks(ctx context.Context) (webhooks []WebhookResponse, err error)
+	DeactivateWebhook(ctx context.Context, subscription_id int) (err error)
+	ListWebhookDeliveries(ctx context.Context, subscription_id int, status string) (deliveries []WebhookDeliveryResponse, err error)
+	RedeliverWebhook(ctx context.Context, delivery_id int) (err error)
+	OpenWaitingRoom(ctx context.Context, email string, nw NewWaitingRoom) (wr WaitingRoomResponse, err error)
+	ListWaitingRooms(ctx context.Context) (rooms []WaitingRoomResponse, err error)
+	CloseWaitingRoom(ctx context.Context, room_id int) (err error)
+	JoinQueue(ctx context.Context, email string, show_id int) (st QueueStatus, err error)
+	GetQueueStatus(ctx context.Context, email string, show_id int) (st QueueStatus, err error)
+	CheckAdmission(ctx context.Context, email string, show_id int, token string) (err error)
+	RepriceShows(ctx context.Context) (err error)
+	SweepWaitlists(ctx context.Context) (err error)
+	AssignStaff(ctx context.Context, a StaffAssignment) (err error)
 }
 
 type bookingService struct {
@@ -47,6 +113,13 @@ func (b *bookingService) CreateNewUser(ctx context.Context, u NewUser) (user_id
 		PhoneNumber: u.Phone_number,
 		Role:        u.Role,
 	}
+	if u.Role == "staff" {
+		if ok := MultiplexIdExists(b, ctx, u.Multiplex_id); !ok {
+			err = ErrInvalidMultiplex
+			return
+		}
+		newU.Multiplex_id = &u.Multiplex_id
+	}
 
 	user_id, err = b.store.CreateUser(ctx, newU)
 	if err != nil {
@@ -111,14 +184,30 @@ func (b *bookingService) AddMovie(ctx context.Context, m NewMovie) (movie_id uin
 
 }
 
+var ErrNegativeBuffer = errors.New("err: buffers can't be negative")
+
 func (b *bookingService) AddScreen(ctx context.Context, s NewScreen) (screen_id uint, err error) {
 
 	newSn := db.Screen{
-		Screen_number:    s.Screen_number,
-		Total_seats:      s.Total_seats,
-		Sound_system:     s.Sound_system,
-		Screen_dimension: s.Screen_dimension,
-		Multiplex_id:     s.Multiplex_id,
+		Screen_number:        s.Screen_number,
+		Total_seats:          s.Total_seats,
+		Sound_system:         s.Sound_system,
+		Screen_dimension:     s.Screen_dimension,
+		Multiplex_id:         s.Multiplex_id,
+		Trailer_buffer_mins:  config.Show().TrailerBufferMins(),
+		Cleaning_buffer_mins: config.Show().CleaningBufferMins(),
+	}
+
+	// a buffer of 0 is a valid choice, only a missing one gets the default
+	if s.Trailer_buffer != nil {
+		newSn.Trailer_buffer_mins = *s.Trailer_buffer
+	}
+	if s.Cleaning_buffer != nil {
+		newSn.Cleaning_buffer_mins = *s.Cleaning_buffer
+	}
+	if newSn.Trailer_buffer_mins < 0 || newSn.Cleaning_buffer_mins < 0 {
+		err = ErrNegativeBuffer
+		return
 	}
 
 	if ok := MultiplexIdExists(b, ctx, newSn.Multiplex_id); !ok {
@@ -171,6 +260,26 @@ func (b *bookingService) AddMultiplex(ctx context.Context, m NewMultiplex) (mult
 		Total_screens: m.Total_screens,
 		Locality:      m.Locality,
 		Location_id:   int(location_id),
+		Opens_at:      m.Opens_at,
+		Closes_at:     m.Closes_at,
+		Time_zone:     m.Time_zone,
+	}
+	if newM.Opens_at == "" {
+		newM.Opens_at = config.Show().OpensAt()
+	}
+	if newM.Closes_at == "" {
+		newM.Closes_at = config.Show().ClosesAt()
+	}
+	if newM.Time_zone == "" {
+		newM.Time_zone = config.Show().TimeZone()
+	}
+	if _, err = time.LoadLocation(newM.Time_zone); err != nil {
+		err = errors.New("err: invalid time zone")
+		return
+	}
+	if _, _, err = operatingWindow(time.Now(), newM.Opens_at, newM.Closes_at); err != nil {
+		err = errors.New("err: invalid operating hours")
+		return
 	}
 
 	multiplex_id, err = b.store.AddMultiplex(ctx, newM)
@@ -185,47 +294,55 @@ func (b *bookingService) AddMultiplex(ctx context.Context, m NewMultiplex) (mult
 }
 
 func (b *bookingService) AddShow(ctx context.Context, s NewShow) (show_id uint, err error) {
-	log.Println("Show", s)
-	if ok := MultiplexIdExists(b, ctx, s.Multiplex_id); !ok {
-		log.Println(err)
+	multiplex, err := b.store.GetMultiplexeByID(ctx, s.Multiplex_id)
+	if err != nil {
 		err = errors.New("err: invalid Multiplex id")
 		return
 	}
-	// var screen db.Screen
 
 	screen, ok := ScreenExists(b, ctx, s.Screen, s.Multiplex_id)
 	if !ok {
-		log.Println(err)
 		err = errors.New("err: invalid screen number")
 		return
 	}
-
 	s.Screen_id = screen.Screen_id
-	movie_id, ok := MovieExists(b, ctx, s.Movie)
+
+	movie, ok := MovieExists(b, ctx, s.Movie)
 	if !ok {
-		log.Println(err)
 		err = errors.New("err: Movie doesn't exist")
 		return
 	}
+	if movie.Duration <= 0 {
+		err = errors.New("err: movie duration is not set")
+		return
+	}
+	s.Movie_id = movie.Movie_id
 
-	s.Movie_id = movie_id
-	rDate, err := time.Parse(DateOnly, s.Date)
+	loc, err := time.LoadLocation(multiplex.Time_zone)
 	if err != nil {
-		err = errors.New("invalid date format")
+		b.logger.Errorf("Err: Loading time zone of multiplex %v: %v", multiplex.Multiplex_id, err.Error())
 		return
 	}
 
-	st_time, err := time.Parse(time.Kitchen, strings.TrimSpace(s.Start_time))
+	st_time, err := parseInstant(s.Start_time)
 	if err != nil {
-		log.Println(err)
+		return
+	}
+	if !st_time.After(time.Now()) {
+		err = ErrShowInPast
+		return
 	}
-	end_time, _ := time.Parse(time.Kitchen, s.End_time)
+
+	// trailers and ads run before the feature, so they count towards the
+	// show's running time
+	running := minutes(screen.Trailer_buffer_mins + movie.Duration)
+	day, end_time, err := scheduleShow(st_time, running, loc, multiplex.Opens_at, multiplex.Closes_at)
 	if err != nil {
-		log.Println(err)
+		return
 	}
 
 	newSh := db.Show{
-		Show_date:    rDate,
+		Show_date:    time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC),
 		Start_time:   st_time,
 		End_time:     end_time,
 		Screen_id:    s.Screen_id,
@@ -233,23 +350,513 @@ func (b *bookingService) AddShow(ctx context.Context, s NewShow) (show_id uint,
 		Multiplex_id: s.Multiplex_id,
 	}
 
-	// log.Println("newsh", newSh)
-	show_id, err = b.store.AddShow(ctx, newSh)
+	show_id, err = b.store.AddShow(ctx, newSh, screen.Cleaning_buffer_mins, screen.Total_seats)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
-			err = errors.New("err : overlapping sow times")
+			err = ErrOverlappingShow
 		}
 		b.logger.Errorf("Err: Adding Show: %v", err.Error())
 		return
 	}
+	b.logger.Infof("Show ID  %v", show_id)
+
+	return
+
+}
 
-	err = b.store.AddSeats(ctx, screen.Total_seats, int(show_id))
+func (b *bookingService) ListShows(ctx context.Context, f ShowFilter) (shows []ShowResponse, err error) {
+	details, err := b.store.GetShowsStartingBetween(ctx, f.From, f.To, f.Multiplex_id)
 	if err != nil {
-		b.logger.Errorf("Err: Adding seats for show: %v", err.Error())
+		b.logger.Errorf("Err: Listing shows: %v", err.Error())
+		return
+	}
+
+	shows = make([]ShowResponse, 0, len(details))
+	for _, d := range details {
+		loc, e := time.LoadLocation(d.Time_zone)
+		if e != nil {
+			loc = time.UTC
+		}
+		shows = append(shows, ShowResponse{
+			Show_id:      d.Show_id,
+			Status:       d.Status,
+			Show_date:    d.Show_date.Format(DateOnly),
+			Start_time:   d.Start_time.In(loc).Format(time.RFC3339),
+			End_time:     d.End_time.In(loc).Format(time.RFC3339),
+			Time_zone:    d.Time_zone,
+			Movie:        d.Movie,
+			Screen:       d.Screen_number,
+			Multiplex_id: d.Multiplex_id,
+			Multiplex:    d.Multiplex,
+		})
+	}
+	return
+}
+
+func (b *bookingService) CancelShow(ctx context.Context, show_id int, sc ShowCancellation) (report CancellationReport, err error) {
+	cancelled, err := b.store.CancelShow(ctx, db.ShowCancel{
+		Show_id:          show_id,
+		Reason:           sc.Reason,
+		Points_expire_at: pointsExpireAt(time.Now()),
+		Refund_to_wallet: sc.Refund_to_wallet,
+	})
+	if err != nil {
+		b.logger.Errorf("Err: Cancelling show %v: %v", show_id, err.Error())
+		return
+	}
+
+	report = CancellationReport{
+		Show_id:  show_id,
+		Status:   db.ShowCancelled,
+		Bookings: make([]BookingCancellation, 0, len(cancelled)),
+	}
+	for _, c := range cancelled {
+		report.Total_refund += c.Amount
+		report.Bookings = append(report.Bookings, newBookingCancellation(c))
+	}
+
+	b.logger.Infof("Show %v cancelled, %v bookings refunded", show_id, len(cancelled))
+	return
+}
+
+func newBookingCancellation(c db.CancelledBooking) BookingCancellation {
+	bc := BookingCancellation{
+		Booking_id:      c.Booking_id,
+		User_id:         c.User_id,
+		Seats:           c.Seats,
+		Status:          db.BookingCancelled,
+		Refund_id:       c.Refund_id,
+		Refund_amount:   c.Amount,
+		Points_reversed: c.Points_reversed,
+		Points_refunded: c.Points_refunded,
+		Notified:        c.Notification_id != 0,
+	}
+	if c.Refund_id != 0 {
+		bc.Refund_status, bc.Refund_to = c.Refund_status, c.Refund_to
+	}
+	return bc
+}
+
+func (b *bookingService) RescheduleShow(ctx context.Context, show_id int, r ShowReschedule) (report RescheduleReport, err error) {
+	sh, err := b.store.GetShowByID(ctx, show_id)
+	if err != nil {
+		return
+	}
+	if sh.Status == db.ShowCancelled {
+		err = db.ErrShowAlreadyCancelled
+		return
+	}
+	// customers already in the show, or done with it, aren't moved
+	if !time.Now().Before(sh.Start_time) {
+		err = ErrShowStarted
+		return
+	}
+
+	multiplex, err := b.store.GetMultiplexeByID(ctx, sh.Multiplex_id)
+	if err != nil {
+		b.logger.Errorf("Err: Rescheduling show %v: %v", show_id, err.Error())
+		return
+	}
+
+	screen, err := b.store.GetScreenByID(ctx, sh.Screen_id)
+	if err != nil {
+		b.logger.Errorf("Err: Rescheduling show %v: %v", show_id, err.Error())
+		return
+	}
+	if r.Screen != 0 && r.Screen != screen.Screen_number {
+		var ok bool
+		if screen, ok = ScreenExists(b, ctx, r.Screen, sh.Multiplex_id); !ok {
+			err = errors.New("err: invalid screen number")
+			return
+		}
+	}
+
+	movie, err := b.store.GetMovieByID(ctx, sh.Movie_id)
+	if err != nil {
+		b.logger.Errorf("Err: Rescheduling show %v: %v", show_id, err.Error())
+		return
+	}
+
+	loc, err := time.LoadLocation(multiplex.Time_zone)
+	if err != nil {
+		b.logger.Errorf("Err: Loading time zone of multiplex %v: %v", multiplex.Multiplex_id, err.Error())
+		return
+	}
+
+	st_time := sh.Start_time
+	if r.Start_time != "" {
+		if st_time, err = parseInstant(r.Start_time); err != nil {
+			return
+		}
+		if !st_time.After(time.Now()) {
+			err = ErrShowInPast
+			return
+		}
+	}
+
+	running := minutes(screen.Trailer_buffer_mins + movie.Duration)
+	day, end_time, err := scheduleShow(st_time, running, loc, multiplex.Opens_at, multiplex.Closes_at)
+	if err != nil {
+		return
+	}
+
+	sh.Show_date = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	sh.Start_time = st_time
+	sh.End_time = end_time
+	sh.Screen_id = screen.Screen_id
+
+	migrated, err := b.store.RescheduleShow(ctx, sh, screen.Cleaning_buffer_mins, screen.Total_seats)
+	if err != nil {
+		if err == db.ErrOverlappingShow {
+			err = ErrOverlappingShow
+		}
+		b.logger.Errorf("Err: Rescheduling show %v: %v", show_id, err.Error())
+		return
+	}
+
+	report = RescheduleReport{
+		Show: ShowResponse{
+			Show_id:      sh.Show_id,
+			Status:       sh.Status,
+			Show_date:    sh.Show_date.Format(DateOnly),
+			Start_time:   sh.Start_time.In(loc).Format(time.RFC3339),
+			End_time:     sh.End_time.In(loc).Format(time.RFC3339),
+			Time_zone:    multiplex.Time_zone,
+			Movie:        movie.Title,
+			Screen:       screen.Screen_number,
+			Multiplex_id: multiplex.Multiplex_id,
+			Multiplex:    multiplex.Name,
+		},
+		Bookings: make([]BookingMigration, 0, len(migrated)),
+	}
+
+	unmapped := 0
+	for _, m := range migrated {
+		if m.Unmapped {
+			unmapped++
+		}
+		report.Bookings = append(report.Bookings, BookingMigration{
+			Booking_id:      m.Booking_id,
+			User_id:         m.User_id,
+			Seats:           m.Seats,
+			Status:          m.Status,
+			Action_required: m.Unmapped,
+			Notified:        m.Notification_id != 0,
+		})
+	}
+
+	b.logger.Infof("Show %v rescheduled, %v of %v bookings need customer action", show_id, unmapped, len(migrated))
+	return
+}
+
+func newProfile(u db.User) Profile {
+	return Profile{
+		User_id:      u.User_id,
+		Name:         u.Name,
+		Email:        u.Email,
+		Phone_number: u.PhoneNumber,
+		Role:         u.Role,
+	}
+}
+
+func (b *bookingService) GetProfile(ctx context.Context, email string) (p Profile, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Getting profile of %v: %v", email, err.Error())
+		return
+	}
+	p = newProfile(u)
+	return
+}
+
+func (b *bookingService) UpdateProfile(ctx context.Context, email string, up ProfileUpdate) (p Profile, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Updating profile of %v: %v", email, err.Error())
+		return
+	}
+
+	if up.Name != "" {
+		u.Name = up.Name
+	}
+	if up.Phone_number != "" {
+		u.PhoneNumber = up.Phone_number
+	}
+
+	err = b.store.UpdateUserProfile(ctx, u.User_id, u.Name, u.PhoneNumber)
+	if err != nil {
+		b.logger.Errorf("Err: Updating profile of %v: %v", email, err.Error())
+		return
+	}
+	p = newProfile(u)
+	return
+}
+
+func (b *bookingService) ChangePassword(ctx context.Context, email string, c PasswordChange) (err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Changing password of %v: %v", email, err.Error())
+		return
+	}
+
+	if !CheckPasswordHash(c.Current_password, u.Password) {
+		err = ErrIncorrectPassword
 		return
 	}
-	b.logger.Infof("Show ID  %v", show_id)
 
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(c.New_password), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+
+	err = b.store.UpdateUserPassword(ctx, u.User_id, string(hashedPassword))
+	if err != nil {
+		b.logger.Errorf("Err: Changing password of %v: %v", email, err.Error())
+		return
+	}
 	return
+}
 
+func newMyBooking(r db.BookingDetail) MyBooking {
+	loc, e := time.LoadLocation(r.Time_zone)
+	if e != nil {
+		loc = time.UTC
+	}
+	return MyBooking{
+		Booking_id: r.Booking_id,
+		Status:     r.Status,
+		Amount:     r.Amount,
+		Currency:   r.Currency,
+		Booked_at:  r.Created_at.In(loc).Format(time.RFC3339),
+		Seats:      r.Seats,
+		Show: BookingShow{
+			Show_id:    r.Show_id,
+			Status:     r.Show_status,
+			Show_date:  r.Show_date.Format(DateOnly),
+			Start_time: r.Start_time.In(loc).Format(time.RFC3339),
+			End_time:   r.End_time.In(loc).Format(time.RFC3339),
+			Screen:     r.Screen_number,
+		},
+		Movie: BookingMovie{
+			Movie_id: r.Movie_id,
+			Title:    r.Title,
+			Language: r.Language,
+			Genre:    r.Genre,
+			Duration: r.Duration,
+		},
+		Multiplex: BookingMultiplex{
+			Multiplex_id: r.Multiplex_id,
+			Name:         r.Multiplex,
+			Locality:     r.Locality,
+			City:         r.City,
+			State:        r.State,
+			Time_zone:    r.Time_zone,
+		},
+	}
+}
+
+func (b *bookingService) ListMyBookings(ctx context.Context, email string, when string) (bookings []MyBooking, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Listing bookings of %v: %v", email, err.Error())
+		return
+	}
+
+	rows, err := b.store.GetBookingsOfUser(ctx, u.User_id, when)
+	if err != nil {
+		b.logger.Errorf("Err: Listing bookings of %v: %v", email, err.Error())
+		return
+	}
+
+	bookings = make([]MyBooking, 0, len(rows))
+	for _, r := range rows {
+		bookings = append(bookings, newMyBooking(r))
+	}
+
+	// most recent first when looking back
+	if when == db.BookingsPast {
+		for i, j := 0, len(bookings)-1; i < j; i, j = i+1, j-1 {
+			bookings[i], bookings[j] = bookings[j], bookings[i]
+		}
+	}
+	return
+}
+
+// bookableShow returns the show if customers can still book it online,
+// which they can until it starts.
+func (b *bookingService) bookableShow(ctx context.Context, show_id int) (show db.Show, err error) {
+	show, err = b.store.GetShowByID(ctx, show_id)
+	if err != nil {
+		return
+	}
+	if show.Status != db.ShowScheduled || !time.Now().Before(show.Start_time) {
+		err = db.ErrShowNotBookable
+		return
+	}
+	return
+}
+
+func (b *bookingService) GetSeatMap(ctx context.Context, show_id int) (seats []SeatMapEntry, err error) {
+	show, err := b.store.GetShowByID(ctx, show_id)
+	if err != nil {
+		return
+	}
+
+	rows, err := b.store.GetSeatsOfShow(ctx, show_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting seats of show %v: %v", show_id, err.Error())
+		return
+	}
+	if err = b.applyPricingRules(ctx, show, rows); err != nil {
+		return
+	}
+
+	seats = make([]SeatMapEntry, 0, len(rows))
+	for _, s := range rows {
+		seats = append(seats, SeatMapEntry{
+			Seat_number: s.Seat_number,
+			Price:       s.Price,
+			Status:      s.Status,
+		})
+	}
+	return
+}
+
+// QuoteBooking prices the seats as they are right now without booking them,
+// so customers can see what a coupon does before committing.
+func (b *bookingService) QuoteBooking(ctx context.Context, email string, show_id int, r BookingRequest) (q QuoteResponse, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Quoting for %v: %v", email, err.Error())
+		return
+	}
+
+	show, err := b.bookableShow(ctx, show_id)
+	if err != nil {
+		return
+	}
+
+	all, err := b.store.GetSeatsOfShow(ctx, show_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting seats of show %v: %v", show_id, err.Error())
+		return
+	}
+	if err = b.applyPricingRules(ctx, show, all); err != nil {
+		return
+	}
+	held_for, err := b.heldFor(ctx, show_id, u.User_id)
+	if err != nil {
+		return
+	}
+	seats, err := pickSeats(all, r.Seats, held_for)
+	if err != nil {
+		return
+	}
+
+	pr, err := b.newPricing(ctx, show, db.ChannelOnline, u.User_id, r.Coupon_code)
+	if err != nil {
+		return
+	}
+	if err = b.withFnb(ctx, pr, r.Fnb); err != nil {
+		return
+	}
+	pr.points = r.Loyalty_points
+	quote, err := pr.quote(seats)
+	if err != nil {
+		return
+	}
+
+	q = QuoteResponse{
+		Show_id: show_id,
+		Seats:   r.Seats,
+		Price:   newPriceBreakdown(quote),
+	}
+	return
+}
+
+func (b *bookingService) BookShow(ctx context.Context, email string, show_id int, r BookingRequest) (resp BookingResponse, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Booking for %v: %v", email, err.Error())
+		return
+	}
+
+	show, err := b.bookableShow(ctx, show_id)
+	if err != nil {
+		return
+	}
+	if err = b.sweepWaitlist(ctx, show); err != nil {
+		return
+	}
+	if err = b.repriceShow(ctx, show); err != nil {
+		return
+	}
+
+	pr, err := b.newPricing(ctx, show, db.ChannelOnline, u.User_id, r.Coupon_code)
+	if err != nil {
+		return
+	}
+	if err = b.withFnb(ctx, pr, r.Fnb); err != nil {
+		return
+	}
+	pr.points = r.Loyalty_points
+	fulfilment, deliver_at, err := fnbDelivery(show, r)
+	if err != nil {
+		return
+	}
+
+	booked, err := b.store.BookSeats(ctx, db.NewBooking{
+		Show_id:        show_id,
+		Seat_numbers:   r.Seats,
+		User_id:        u.User_id,
+		Channel:        db.ChannelOnline,
+		Fnb:            pr.fnbOrder(fulfilment, deliver_at),
+		Payment_method: r.Payment_method,
+		Gift_card_code: normalizeGiftCardCode(r.Gift_card_code),
+		Price:          pr.charge,
+	})
+	if err != nil {
+		switch err {
+		case db.ErrCouponExhausted, db.ErrCouponUserLimit:
+			err = CouponError{err.Error()}
+		}
+		b.logger.Errorf("Err: Booking show %v for %v: %v", show_id, email, err.Error())
+		return
+	}
+
+	resp = BookingResponse{
+		Booking_id:     booked.Booking_id,
+		Fnb_order_id:   booked.Fnb_order_id,
+		Show_id:        show_id,
+		Seats:          r.Seats,
+		Status:         db.BookingConfirmed,
+		Payment_method: r.Payment_method,
+		Price:          newPriceBreakdown(pr.quoted),
+	}
+	b.logger.Infof("Booking ID  %v", booked.Booking_id)
+	return
+}
+
+// pickSeats returns the requested seats of a show, all of which must be
+// available or held for the given waitlist entry.
+func pickSeats(all []db.Seat, numbers []int64, held_for int) (seats []db.Seat, err error) {
+	byNumber := make(map[int64]db.Seat, len(all))
+	for _, s := range all {
+		byNumber[int64(s.Seat_number)] = s
+	}
+
+	for _, n := range numbers {
+		s, ok := byNumber[n]
+		if !ok {
+			err = db.ErrSeatNotFound
+			return
+		}
+		held := s.Status == db.SeatHeld && held_for != 0 && s.Held_for == held_for
+		if s.Status != db.SeatAvailable && !held {
+			err = db.ErrSeatUnavailable
+			return
+		}
+		seats = append(seats, s)
+	}
+	return
 }
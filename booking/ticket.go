@@ -0,0 +1,193 @@
+package booking
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/golang-jwt/jwt"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+)
+
+const ticketSubject = "ticket"
+
+var (
+	ErrTicketUnavailable = errors.New("err: ticket is only available for confirmed bookings")
+	ErrInvalidTicket     = errors.New("err: invalid ticket")
+)
+
+// ticketKey signs tickets. It is apart from the key of login tokens, and
+// being Ed25519 scanners verify tickets offline with only its public half.
+var ticketKey ed25519.PrivateKey
+
+// a show moved by up to this much after its tickets were issued keeps them
+// valid, the admission window is still checked at the gate
+const ticketGrace = 7 * 24 * time.Hour
+
+// LoadTicketKey reads the ticket signing key from the config. Every replica
+// has to sign with the same key, so it is only made up in dev mode.
+func LoadTicketKey(l *zap.SugaredLogger) (err error) {
+	return loadTicketKey(config.Ticket().SigningKey(), config.DevMode(), l)
+}
+
+func loadTicketKey(seed string, dev bool, l *zap.SugaredLogger) (err error) {
+	if seed == "" {
+		if !dev {
+			return errors.New("TICKET_SIGNING_KEY must be set, or APP_ENV=dev to make one up")
+		}
+		_, ticketKey, err = ed25519.GenerateKey(rand.Reader)
+		l.Warnf("TICKET_SIGNING_KEY is not set, tickets issued before a restart won't verify")
+		return
+	}
+
+	b, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil || len(b) != ed25519.SeedSize {
+		return fmt.Errorf("TICKET_SIGNING_KEY must be a base64 %v byte seed", ed25519.SeedSize)
+	}
+	ticketKey = ed25519.NewKeyFromSeed(b)
+	return
+}
+
+// TicketPublicKey is what scanners verify tickets with.
+func TicketPublicKey() ed25519.PublicKey {
+	return ticketKey.Public().(ed25519.PublicKey)
+}
+
+// TicketClaims is the payload of the QR code on a ticket.
+type TicketClaims struct {
+	Booking_id   int     `json:"bid"`
+	Show_id      int     `json:"sid"`
+	Multiplex_id int     `json:"mid"`
+	Seats        []int64 `json:"seats"`
+	jwt.StandardClaims
+}
+
+type Ticket struct {
+	Token   string
+	Booking MyBooking
+}
+
+func generateTicketToken(b db.BookingDetail) (tokenString string, err error) {
+	claims := &TicketClaims{
+		Booking_id:   b.Booking_id,
+		Show_id:      b.Show_id,
+		Multiplex_id: b.Multiplex_id,
+		Seats:        b.Seats,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   ticketSubject,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: b.End_time.Add(ticketGrace).Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	tokenString, err = token.SignedString(ticketKey)
+	if err != nil {
+		err = fmt.Errorf("error generating ticket, err: %v", err)
+		return
+	}
+	return
+}
+
+// ParseTicketToken verifies the signature of a scanned ticket.
+func ParseTicketToken(tokenString string) (claims *TicketClaims, err error) {
+	claims = &TicketClaims{}
+	_, err = jwt.ParseWithClaims(strings.TrimSpace(tokenString), claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+			return nil, ErrInvalidTicket
+		}
+		return TicketPublicKey(), nil
+	})
+	if err != nil || claims.Subject != ticketSubject {
+		err = ErrInvalidTicket
+		return
+	}
+	return
+}
+
+func (b *bookingService) GetTicket(ctx context.Context, email string, booking_id int) (t Ticket, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Getting ticket of %v: %v", email, err.Error())
+		return
+	}
+
+	bk, err := b.store.GetBookingByID(ctx, booking_id)
+	if err != nil {
+		return
+	}
+	// don't tell customers about other people's bookings
+	if bk.User_id != u.User_id {
+		err = db.ErrBookingNotFound
+		return
+	}
+	return ticketFor(bk)
+}
+
+func ticketFor(bk db.BookingDetail) (t Ticket, err error) {
+	if bk.Status != db.BookingConfirmed || bk.Show_status == db.ShowCancelled {
+		err = ErrTicketUnavailable
+		return
+	}
+
+	t.Token, err = generateTicketToken(bk)
+	if err != nil {
+		return
+	}
+	t.Booking = newMyBooking(bk)
+	return
+}
+
+func (t Ticket) PNG() ([]byte, error) {
+	return qrcode.Encode(t.Token, qrcode.Medium, 512)
+}
+
+func (t Ticket) PDF() (pdfBytes []byte, err error) {
+	qr, err := t.PNG()
+	if err != nil {
+		return
+	}
+
+	bk := t.Booking
+	start, _ := time.Parse(time.RFC3339, bk.Show.Start_time)
+	seats := make([]string, 0, len(bk.Seats))
+	for _, s := range bk.Seats {
+		seats = append(seats, fmt.Sprint(s))
+	}
+
+	pdf := gofpdf.New("P", "mm", "A6", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, bk.Movie.Title, "", 1, "C", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	lines := []string{
+		fmt.Sprintf("%s, %s", bk.Multiplex.Name, bk.Multiplex.City),
+		start.Format("Mon 02 Jan 2006, 3:04 PM MST"),
+		fmt.Sprintf("Screen %d  Seats %s", bk.Show.Screen, strings.Join(seats, ", ")),
+		fmt.Sprintf("Booking #%d", bk.Booking_id),
+	}
+	for _, l := range lines {
+		pdf.CellFormat(0, 6, l, "", 1, "C", false, 0, "")
+	}
+
+	opts := gofpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader("qr", opts, bytes.NewReader(qr))
+	pdf.ImageOptions("qr", 19, pdf.GetY()+4, 67, 67, false, opts, 0, "")
+
+	var buf bytes.Buffer
+	if err = pdf.Output(&buf); err != nil {
+		return
+	}
+	pdfBytes = buf.Bytes()
+	return
+}
@@ -0,0 +1,104 @@
+package booking
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+)
+
+func testTicket(t *testing.T, end time.Time) string {
+	if err := loadTicketKey("", true, zap.NewNop().Sugar()); err != nil {
+		t.Fatal(err)
+	}
+	token, err := generateTicketToken(db.BookingDetail{
+		Booking_id:   7,
+		Show_id:      3,
+		Multiplex_id: 1,
+		Seats:        []int64{4, 5},
+		End_time:     end,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestLoadTicketKey(t *testing.T) {
+	l := zap.NewNop().Sugar()
+	if err := loadTicketKey("", false, l); err == nil {
+		t.Fatal("started without a signing key outside dev mode")
+	}
+	if err := loadTicketKey("bm90IGEgc2VlZA==", false, l); err == nil {
+		t.Fatal("took a seed of the wrong size")
+	}
+
+	seed := "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+	if err := loadTicketKey(seed, false, l); err != nil {
+		t.Fatal(err)
+	}
+	first := TicketPublicKey()
+	// replicas with the same seed verify each other's tickets
+	if err := loadTicketKey(seed, false, l); err != nil || !first.Equal(TicketPublicKey()) {
+		t.Fatalf("same seed gave a different key: %v", err)
+	}
+}
+
+func TestTicketRoundTrip(t *testing.T) {
+	token := testTicket(t, time.Now().Add(time.Hour))
+
+	claims, err := ParseTicketToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Booking_id != 7 || claims.Multiplex_id != 1 || len(claims.Seats) != 2 {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestTicketExpires(t *testing.T) {
+	token := testTicket(t, time.Now().Add(-ticketGrace-time.Hour))
+
+	if _, err := ParseTicketToken(token); err != ErrInvalidTicket {
+		t.Errorf("err = %v, want %v", err, ErrInvalidTicket)
+	}
+}
+
+func TestTicketSignedWithLoginKey(t *testing.T) {
+	claims := &TicketClaims{Booking_id: 7, StandardClaims: jwt.StandardClaims{Subject: ticketSubject}}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseTicketToken(token); err != ErrInvalidTicket {
+		t.Errorf("err = %v, want %v", err, ErrInvalidTicket)
+	}
+}
+
+func TestTicketIsNoLogin(t *testing.T) {
+	reached := false
+	h := ValidateUserJWT(func(w http.ResponseWriter, r *http.Request) { reached = true })
+
+	// neither a ticket nor a login token signed like one gets through
+	ticketLike, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		Email:          "a@b.c",
+		StandardClaims: jwt.StandardClaims{Subject: ticketSubject},
+	}).SignedString(secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{testTicket(t, time.Now().Add(time.Hour)), ticketLike} {
+		r := httptest.NewRequest(http.MethodGet, "/me", nil)
+		r.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		h(w, r)
+		if w.Code != http.StatusUnauthorized || reached {
+			t.Errorf("code = %v, reached = %v", w.Code, reached)
+		}
+	}
+}
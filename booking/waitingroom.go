@@ -0,0 +1,209 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+var (
+	ErrInvalidWaitingRoom = errors.New("err: invalid waiting room")
+	ErrMovieNotFound      = errors.New("movie doesn't exist")
+	ErrNotAdmitted        = errors.New("not admitted from the waiting room yet, join its queue and wait for your turn")
+)
+
+func newWaitingRoomResponse(w db.WaitingRoom) WaitingRoomResponse {
+	return WaitingRoomResponse{
+		Room_id:          w.Room_id,
+		Show_id:          w.Show_id,
+		Movie_id:         w.Movie_id,
+		Admit_per_minute: w.Admit_per_minute,
+		Admission_mins:   w.Admission_mins,
+		Active:           w.Active,
+		Waiting:          w.Waiting,
+		Admitted:         w.Admitted,
+		Created_at:       w.Created_at.Format(time.RFC3339),
+	}
+}
+
+// newQueueStatus estimates the wait from the customer's place in the queue
+// and the rate the room admits at.
+func newQueueStatus(w db.WaitingRoom, q db.QueueToken) QueueStatus {
+	st := QueueStatus{
+		Room_id:   q.Room_id,
+		Token:     q.Token,
+		Status:    q.Status,
+		Position:  q.Position,
+		Joined_at: q.Joined_at.Format(time.RFC3339),
+	}
+	if q.Status == db.QueueWaiting {
+		st.Estimated_wait_mins = (q.Position + w.Admit_per_minute - 1) / w.Admit_per_minute
+	}
+	if q.Status == db.QueueAdmitted && q.Expires_at != nil {
+		st.Admitted_until = q.Expires_at.Format(time.RFC3339)
+		// joining again puts them at the back of the queue
+		if !time.Now().Before(*q.Expires_at) {
+			st.Status = db.QueueExpired
+		}
+	}
+	return st
+}
+
+func (b *bookingService) OpenWaitingRoom(ctx context.Context, email string, nw NewWaitingRoom) (wr WaitingRoomResponse, err error) {
+	nw.Movie = strings.TrimSpace(nw.Movie)
+	if (nw.Show_id == 0) == (nw.Movie == "") || nw.Admit_per_minute <= 0 || nw.Admission_mins <= 0 {
+		err = ErrInvalidWaitingRoom
+		return
+	}
+
+	admin, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Opening waiting room for %v: %v", email, err.Error())
+		return
+	}
+	w := db.WaitingRoom{
+		Show_id:          nw.Show_id,
+		Admit_per_minute: nw.Admit_per_minute,
+		Admission_mins:   nw.Admission_mins,
+		Created_by:       admin.User_id,
+	}
+	if nw.Show_id != 0 {
+		if _, err = b.store.GetShowByID(ctx, nw.Show_id); err != nil {
+			return
+		}
+	} else {
+		movie, ok := MovieExists(b, ctx, nw.Movie)
+		if !ok {
+			err = ErrMovieNotFound
+			return
+		}
+		w.Movie_id = movie.Movie_id
+	}
+
+	room_id, err := b.store.OpenWaitingRoom(ctx, w)
+	if err != nil {
+		if err != db.ErrWaitingRoomExists {
+			b.logger.Errorf("Err: Opening waiting room: %v", err.Error())
+		}
+		return
+	}
+
+	w, err = b.store.GetWaitingRoom(ctx, room_id)
+	if err != nil {
+		b.logger.Errorf("Err: Getting waiting room %v: %v", room_id, err.Error())
+		return
+	}
+	b.logger.Infof("Waiting room %v opened by %v", room_id, email)
+	return newWaitingRoomResponse(w), nil
+}
+
+func (b *bookingService) ListWaitingRooms(ctx context.Context) (rooms []WaitingRoomResponse, err error) {
+	ws, err := b.store.GetActiveWaitingRooms(ctx)
+	if err != nil {
+		b.logger.Errorf("Err: Listing waiting rooms: %v", err.Error())
+		return
+	}
+
+	rooms = make([]WaitingRoomResponse, 0, len(ws))
+	for _, w := range ws {
+		rooms = append(rooms, newWaitingRoomResponse(w))
+	}
+	return
+}
+
+func (b *bookingService) CloseWaitingRoom(ctx context.Context, room_id int) (err error) {
+	err = b.store.CloseWaitingRoom(ctx, room_id)
+	switch err {
+	case nil:
+		b.logger.Infof("Waiting room %v closed", room_id)
+	case db.ErrWaitingRoomNotFound:
+	default:
+		b.logger.Errorf("Err: Closing waiting room %v: %v", room_id, err.Error())
+	}
+	return
+}
+
+func (b *bookingService) JoinQueue(ctx context.Context, email string, show_id int) (st QueueStatus, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Joining queue for %v: %v", email, err.Error())
+		return
+	}
+	w, err := b.store.GetWaitingRoomOfShow(ctx, show_id)
+	if err != nil {
+		if err != db.ErrNoWaitingRoom {
+			b.logger.Errorf("Err: Getting waiting room of show %v: %v", show_id, err.Error())
+		}
+		return
+	}
+
+	token, err := randomHex(16)
+	if err != nil {
+		b.logger.Errorf("Err: Generating queue token: %v", err.Error())
+		return
+	}
+	q, err := b.store.JoinQueue(ctx, w.Room_id, u.User_id, token)
+	if err != nil {
+		b.logger.Errorf("Err: Joining queue of waiting room %v for %v: %v", w.Room_id, email, err.Error())
+		return
+	}
+	return newQueueStatus(w, q), nil
+}
+
+func (b *bookingService) GetQueueStatus(ctx context.Context, email string, show_id int) (st QueueStatus, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Getting queue status for %v: %v", email, err.Error())
+		return
+	}
+	w, err := b.store.GetWaitingRoomOfShow(ctx, show_id)
+	if err != nil {
+		if err != db.ErrNoWaitingRoom {
+			b.logger.Errorf("Err: Getting waiting room of show %v: %v", show_id, err.Error())
+		}
+		return
+	}
+
+	q, err := b.store.GetQueueToken(ctx, w.Room_id, u.User_id)
+	if err != nil {
+		if err != db.ErrNotQueued {
+			b.logger.Errorf("Err: Getting queue token of %v for waiting room %v: %v", email, w.Room_id, err.Error())
+		}
+		return
+	}
+	return newQueueStatus(w, q), nil
+}
+
+// CheckAdmission lets the customer through to book a show when it has no
+// waiting room open, or when token admits them from its queue.
+func (b *bookingService) CheckAdmission(ctx context.Context, email string, show_id int, token string) (err error) {
+	w, err := b.store.GetWaitingRoomOfShow(ctx, show_id)
+	if err == db.ErrNoWaitingRoom {
+		return nil
+	}
+	if err != nil {
+		b.logger.Errorf("Err: Getting waiting room of show %v: %v", show_id, err.Error())
+		return
+	}
+	if token == "" {
+		return ErrNotAdmitted
+	}
+
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Checking admission for %v: %v", email, err.Error())
+		return
+	}
+	admitted, err := b.store.IsAdmitted(ctx, w.Room_id, u.User_id, token)
+	if err != nil {
+		b.logger.Errorf("Err: Checking admission of %v to waiting room %v: %v", email, w.Room_id, err.Error())
+		return
+	}
+	if !admitted {
+		return ErrNotAdmitted
+	}
+	return
+}
@@ -0,0 +1,252 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+var (
+	ErrInvalidWaitlistSeats = errors.New("err: invalid number of seats to wait for")
+	ErrReseatCount          = errors.New("err: pick as many seats as the booking has")
+)
+
+const defaultCancelReason = "Cancelled by customer"
+
+func holdUntil(now time.Time) time.Time {
+	return now.Add(time.Duration(config.Waitlist().HoldMins()) * time.Minute)
+}
+
+func (b *bookingService) logOffers(show_id int, offers []db.WaitlistOffer) {
+	for _, o := range offers {
+		b.logger.Infof("Seats %v of show %v held for user %v until %v", o.Seats, show_id, o.User_id, o.Expires_at.Format(time.RFC3339))
+	}
+}
+
+// sweepWaitlist rolls offers nobody claimed in time over to the next in
+// line. There is nothing to do once a show can't be booked anymore.
+func (b *bookingService) sweepWaitlist(ctx context.Context, show db.Show) (err error) {
+	if show.Status != db.ShowScheduled || !time.Now().Before(show.Start_time) {
+		return
+	}
+
+	offers, err := b.store.ExpireWaitlistOffers(ctx, show.Show_id, holdUntil(time.Now()))
+	if err != nil {
+		b.logger.Errorf("Err: Expiring waitlist offers of show %v: %v", show.Show_id, err.Error())
+		return
+	}
+	b.logOffers(show.Show_id, offers)
+	return
+}
+
+// SweepWaitlists rolls over the lapsed offers of every show on sale.
+func (b *bookingService) SweepWaitlists(ctx context.Context) (err error) {
+	shows, err := b.store.GetShowsWithLapsedOffers(ctx)
+	if err != nil {
+		b.logger.Errorf("Err: Getting shows with lapsed waitlist offers: %v", err.Error())
+		return
+	}
+	for _, show := range shows {
+		if e := b.sweepWaitlist(ctx, show); e != nil {
+			err = e
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return
+}
+
+// heldFor returns the waitlist entry the customer holds seats of a show
+// through, 0 when they don't.
+func (b *bookingService) heldFor(ctx context.Context, show_id int, user_id int) (entry_id int, err error) {
+	e, err := b.store.GetWaitlistEntry(ctx, show_id, user_id)
+	if err == db.ErrNotWaitlisted {
+		return 0, nil
+	}
+	if err != nil {
+		b.logger.Errorf("Err: Getting waitlist entry of %v for show %v: %v", user_id, show_id, err.Error())
+		return
+	}
+	if e.Status == db.WaitlistOffered {
+		entry_id = e.Entry_id
+	}
+	return
+}
+
+func newWaitlistStatus(e db.WaitlistEntry) WaitlistStatus {
+	st := WaitlistStatus{
+		Show_id:    e.Show_id,
+		Seats:      e.Seats,
+		Status:     e.Status,
+		Position:   e.Position,
+		Held_seats: e.Held_seats,
+		Joined_at:  e.Created_at.Format(time.RFC3339),
+	}
+	if e.Status == db.WaitlistOffered && e.Offer_expires_at != nil {
+		st.Offer_expires_at = e.Offer_expires_at.Format(time.RFC3339)
+	}
+	return st
+}
+
+func (b *bookingService) JoinWaitlist(ctx context.Context, email string, show_id int, r WaitlistRequest) (st WaitlistStatus, err error) {
+	if r.Seats <= 0 || r.Seats > config.Waitlist().MaxSeats() {
+		err = ErrInvalidWaitlistSeats
+		return
+	}
+
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Joining waitlist for %v: %v", email, err.Error())
+		return
+	}
+	show, err := b.bookableShow(ctx, show_id)
+	if err != nil {
+		return
+	}
+	if err = b.sweepWaitlist(ctx, show); err != nil {
+		return
+	}
+
+	if _, err = b.store.JoinWaitlist(ctx, show_id, u.User_id, r.Seats); err != nil {
+		b.logger.Errorf("Err: Joining waitlist of show %v for %v: %v", show_id, email, err.Error())
+		return
+	}
+	return b.GetWaitlistStatus(ctx, email, show_id)
+}
+
+func (b *bookingService) GetWaitlistStatus(ctx context.Context, email string, show_id int) (st WaitlistStatus, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Getting waitlist status for %v: %v", email, err.Error())
+		return
+	}
+	if _, err = b.store.GetShowByID(ctx, show_id); err != nil {
+		return
+	}
+
+	e, err := b.store.GetWaitlistEntry(ctx, show_id, u.User_id)
+	if err != nil {
+		if err != db.ErrNotWaitlisted {
+			b.logger.Errorf("Err: Getting waitlist entry of %v for show %v: %v", email, show_id, err.Error())
+		}
+		return
+	}
+	return newWaitlistStatus(e), nil
+}
+
+func (b *bookingService) LeaveWaitlist(ctx context.Context, email string, show_id int) (err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Leaving waitlist for %v: %v", email, err.Error())
+		return
+	}
+
+	offers, err := b.store.LeaveWaitlist(ctx, show_id, u.User_id, holdUntil(time.Now()))
+	if err != nil {
+		if err != db.ErrNotWaitlisted {
+			b.logger.Errorf("Err: Leaving waitlist of show %v for %v: %v", show_id, email, err.Error())
+		}
+		return
+	}
+	b.logOffers(show_id, offers)
+	return
+}
+
+// CancelBooking lets customers give up a booking until the show starts. Its
+// seats go to the show's waitlist first.
+func (b *bookingService) CancelBooking(ctx context.Context, email string, booking_id int, r BookingCancelRequest) (bc BookingCancellation, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Cancelling booking for %v: %v", email, err.Error())
+		return
+	}
+
+	d, err := b.store.GetBookingByID(ctx, booking_id)
+	if err != nil {
+		return
+	}
+	if d.User_id != u.User_id {
+		err = db.ErrBookingNotFound
+		return
+	}
+	if d.Show_status != db.ShowScheduled || !time.Now().Before(d.Start_time) {
+		err = db.ErrNotCancellable
+		return
+	}
+
+	if r.Reason == "" {
+		r.Reason = defaultCancelReason
+	}
+	now := time.Now()
+	c, offers, err := b.store.CancelBooking(ctx, db.BookingCancel{
+		Booking_id:       booking_id,
+		User_id:          u.User_id,
+		Reason:           r.Reason,
+		Points_expire_at: pointsExpireAt(now),
+		Refund_to_wallet: r.Refund_to_wallet,
+		Hold_until:       holdUntil(now),
+	})
+	if err != nil {
+		b.logger.Errorf("Err: Cancelling booking %v: %v", booking_id, err.Error())
+		return
+	}
+
+	b.logger.Infof("Booking %v cancelled by %v", booking_id, email)
+	b.logOffers(d.Show_id, offers)
+	return newBookingCancellation(c), nil
+}
+
+// ReseatBooking confirms a booking flagged by a reschedule again on seats the
+// customer picks.
+func (b *bookingService) ReseatBooking(ctx context.Context, email string, booking_id int, r BookingReseatRequest) (mb MyBooking, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Reseating booking for %v: %v", email, err.Error())
+		return
+	}
+
+	d, err := b.store.GetBookingByID(ctx, booking_id)
+	if err != nil {
+		return
+	}
+	if d.User_id != u.User_id {
+		err = db.ErrBookingNotFound
+		return
+	}
+	if d.Status != db.BookingActionRequired {
+		err = db.ErrNotReseatable
+		return
+	}
+	if !time.Now().Before(d.Start_time) {
+		err = db.ErrShowNotBookable
+		return
+	}
+	if len(r.Seats) != len(d.Seats) {
+		err = ErrReseatCount
+		return
+	}
+
+	offers, err := b.store.ReseatBooking(ctx, db.BookingReseat{
+		Booking_id:   booking_id,
+		User_id:      u.User_id,
+		Show_id:      d.Show_id,
+		Seat_numbers: r.Seats,
+		Hold_until:   holdUntil(time.Now()),
+	})
+	if err != nil {
+		b.logger.Errorf("Err: Reseating booking %v: %v", booking_id, err.Error())
+		return
+	}
+	b.logger.Infof("Booking %v moved to seats %v by %v", booking_id, r.Seats, email)
+	b.logOffers(d.Show_id, offers)
+
+	if d, err = b.store.GetBookingByID(ctx, booking_id); err != nil {
+		b.logger.Errorf("Err: Getting booking %v: %v", booking_id, err.Error())
+		return
+	}
+	return newMyBooking(d), nil
+}
@@ -0,0 +1,183 @@
+package booking
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+var ErrInvalidGiftCard = errors.New("err: invalid gift card")
+
+// giftCardAlphabet leaves out letters and digits that read alike
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newGiftCardCode returns a random code like 7KQX-M2PA-ZR9D-WC4T.
+func newGiftCardCode() (code string, err error) {
+	buf := make([]byte, 16)
+	if _, err = rand.Read(buf); err != nil {
+		return
+	}
+
+	var sb strings.Builder
+	for i, c := range buf {
+		if i > 0 && i%4 == 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(giftCardAlphabet[int(c)%len(giftCardAlphabet)])
+	}
+	return sb.String(), nil
+}
+
+func normalizeGiftCardCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// validLedgerPayment checks how a customer wants to pay for a booking.
+func validLedgerPayment(r BookingRequest) bool {
+	switch r.Payment_method {
+	case "", db.PaymentWallet:
+		return true
+	case db.PaymentGiftCard:
+		return strings.TrimSpace(r.Gift_card_code) != ""
+	}
+	return false
+}
+
+func newGiftCardResponse(g db.GiftCard) GiftCardResponse {
+	gr := GiftCardResponse{
+		Gift_card_id:   g.Gift_card_id,
+		Code:           g.Code,
+		Initial_amount: g.Initial_amount,
+		Balance:        g.Balance,
+		Currency:       g.Currency,
+		Status:         g.Status,
+		Usable:         g.Usable(time.Now()),
+		Created_at:     g.Created_at.Format(time.RFC3339),
+	}
+	if g.Expires_at != nil {
+		gr.Expires_at = g.Expires_at.Format(time.RFC3339)
+	}
+	return gr
+}
+
+func (b *bookingService) IssueGiftCard(ctx context.Context, adminEmail string, ng NewGiftCard) (g GiftCardResponse, err error) {
+	admin, err := b.store.GetUserByEmail(ctx, adminEmail)
+	if err != nil {
+		b.logger.Errorf("Err: Issuing gift card by %v: %v", adminEmail, err.Error())
+		return
+	}
+
+	var expires_at *time.Time
+	if ng.Expires_at != "" {
+		t, e := time.Parse(time.RFC3339, ng.Expires_at)
+		if e != nil || !t.After(time.Now()) {
+			err = ErrInvalidGiftCard
+			return
+		}
+		expires_at = &t
+	}
+
+	code := normalizeGiftCardCode(ng.Code)
+	if code == "" {
+		if code, err = newGiftCardCode(); err != nil {
+			b.logger.Errorf("Err: Generating gift card code: %v", err.Error())
+			return
+		}
+	}
+
+	card, err := b.store.IssueGiftCard(ctx, code, ng.Amount, expires_at, admin.User_id)
+	if err != nil {
+		b.logger.Errorf("Err: Issuing gift card: %v", err.Error())
+		return
+	}
+	b.logger.Infof("Gift card %v issued for %v by %v", card.Gift_card_id, card.Initial_amount, adminEmail)
+	return newGiftCardResponse(card), nil
+}
+
+func (b *bookingService) ListGiftCards(ctx context.Context) (cards []GiftCardResponse, err error) {
+	rows, err := b.store.GetGiftCards(ctx)
+	if err != nil {
+		b.logger.Errorf("Err: Listing gift cards: %v", err.Error())
+		return
+	}
+
+	cards = make([]GiftCardResponse, 0, len(rows))
+	for _, g := range rows {
+		cards = append(cards, newGiftCardResponse(g))
+	}
+	return
+}
+
+func (b *bookingService) VoidGiftCard(ctx context.Context, adminEmail string, gift_card_id int) (g GiftCardResponse, err error) {
+	admin, err := b.store.GetUserByEmail(ctx, adminEmail)
+	if err != nil {
+		b.logger.Errorf("Err: Voiding gift card by %v: %v", adminEmail, err.Error())
+		return
+	}
+
+	card, err := b.store.VoidGiftCard(ctx, gift_card_id, admin.User_id)
+	if err != nil {
+		b.logger.Errorf("Err: Voiding gift card %v: %v", gift_card_id, err.Error())
+		return
+	}
+	b.logger.Infof("Gift card %v voided by %v", gift_card_id, adminEmail)
+	return newGiftCardResponse(card), nil
+}
+
+// GetGiftCardBalance is what a customer sees of a card they hold, without
+// the card's id or history.
+func (b *bookingService) GetGiftCardBalance(ctx context.Context, code string) (g GiftCardResponse, err error) {
+	card, err := b.store.GetGiftCardByCode(ctx, normalizeGiftCardCode(code))
+	if err != nil {
+		if err != db.ErrGiftCardNotFound {
+			b.logger.Errorf("Err: Getting gift card: %v", err.Error())
+		}
+		return
+	}
+
+	g = GiftCardResponse{
+		Code:     card.Code,
+		Balance:  card.Balance,
+		Currency: card.Currency,
+		Status:   card.Status,
+		Usable:   card.Usable(time.Now()),
+	}
+	if card.Expires_at != nil {
+		g.Expires_at = card.Expires_at.Format(time.RFC3339)
+	}
+	return
+}
+
+func (b *bookingService) GetWallet(ctx context.Context, email string) (st WalletStatement, err error) {
+	u, err := b.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		b.logger.Errorf("Err: Getting wallet of %v: %v", email, err.Error())
+		return
+	}
+
+	a, entries, err := b.store.GetWallet(ctx, u.User_id, statementEntries)
+	if err != nil {
+		b.logger.Errorf("Err: Getting wallet of %v: %v", email, err.Error())
+		return
+	}
+
+	st = WalletStatement{
+		Balance:  a.Balance,
+		Currency: a.Currency,
+		Entries:  make([]WalletEntryResponse, 0, len(entries)),
+	}
+	for _, e := range entries {
+		st.Entries = append(st.Entries, WalletEntryResponse{
+			Kind:       e.Kind,
+			Amount:     e.Amount,
+			Booking_id: e.Booking_id,
+			Memo:       e.Memo,
+			Created_at: e.Created_at.Format(time.RFC3339),
+		})
+	}
+	return
+}
@@ -0,0 +1,169 @@
+package booking
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/Coderx44/MovieTicketingPortal/webhook"
+)
+
+var ErrInvalidWebhook = errors.New("err: invalid webhook")
+
+// how many deliveries the delivery log shows
+const deliveryLogLimit = 100
+
+// randomHex returns n random bytes as hex.
+func randomHex(n int) (s string, err error) {
+	buf := make([]byte, n)
+	if _, err = rand.Read(buf); err != nil {
+		return
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func validWebhook(nw NewWebhook) bool {
+	if strings.TrimSpace(nw.Partner) == "" || len(nw.Events) == 0 {
+		return false
+	}
+	u, err := url.Parse(nw.Url)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return false
+	}
+	for _, e := range nw.Events {
+		if !webhook.KnownEvent(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func newWebhookResponse(w db.WebhookSubscription) WebhookResponse {
+	return WebhookResponse{
+		Subscription_id: w.Subscription_id,
+		Partner:         w.Partner,
+		Url:             w.Url,
+		Events:          w.Events,
+		Active:          w.Active,
+		Created_at:      w.Created_at.Format(time.RFC3339),
+	}
+}
+
+func (b *bookingService) AddWebhook(ctx context.Context, nw NewWebhook) (w WebhookResponse, err error) {
+	if !validWebhook(nw) {
+		err = ErrInvalidWebhook
+		return
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		b.logger.Errorf("Err: Generating webhook secret: %v", err.Error())
+		return
+	}
+	sub := db.WebhookSubscription{
+		Partner: strings.TrimSpace(nw.Partner),
+		Url:     nw.Url,
+		Secret:  "whsec_" + secret,
+		Events:  nw.Events,
+	}
+
+	id, err := b.store.AddWebhookSubscription(ctx, sub)
+	if err != nil {
+		b.logger.Errorf("Err: Adding webhook for %v: %v", sub.Partner, err.Error())
+		return
+	}
+
+	sub, err = b.store.GetWebhookSubscription(ctx, id)
+	if err != nil {
+		b.logger.Errorf("Err: Adding webhook for %v: %v", sub.Partner, err.Error())
+		return
+	}
+
+	// the secret is shown this once, the partner needs it to verify
+	// signatures
+	w = newWebhookResponse(sub)
+	w.Secret = sub.Secret
+	b.logger.Infof("Webhook %v added for %v", id, sub.Partner)
+	return
+}
+
+func (b *bookingService) ListWebhooks(ctx context.Context) (webhooks []WebhookResponse, err error) {
+	subs, err := b.store.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		b.logger.Errorf("Err: Listing webhooks: %v", err.Error())
+		return
+	}
+
+	webhooks = make([]WebhookResponse, 0, len(subs))
+	for _, s := range subs {
+		webhooks = append(webhooks, newWebhookResponse(s))
+	}
+	return
+}
+
+func (b *bookingService) DeactivateWebhook(ctx context.Context, subscription_id int) (err error) {
+	err = b.store.DeactivateWebhookSubscription(ctx, subscription_id)
+	if err != nil && err != db.ErrWebhookNotFound {
+		b.logger.Errorf("Err: Deactivating webhook %v: %v", subscription_id, err.Error())
+	}
+	return
+}
+
+func (b *bookingService) ListWebhookDeliveries(ctx context.Context, subscription_id int, status string) (deliveries []WebhookDeliveryResponse, err error) {
+	if _, err = b.store.GetWebhookSubscription(ctx, subscription_id); err != nil {
+		return
+	}
+
+	ds, err := b.store.GetWebhookDeliveries(ctx, subscription_id, status, deliveryLogLimit)
+	if err != nil {
+		b.logger.Errorf("Err: Listing deliveries of webhook %v: %v", subscription_id, err.Error())
+		return
+	}
+
+	deliveries = make([]WebhookDeliveryResponse, 0, len(ds))
+	for _, d := range ds {
+		dr := WebhookDeliveryResponse{
+			Delivery_id: d.Delivery_id,
+			Event_id:    d.Event_id,
+			Event:       d.Event,
+			Status:      d.Status,
+			Attempts:    d.Attempts,
+			Last_error:  d.Last_error,
+			Created_at:  d.Created_at.Format(time.RFC3339),
+			Log:         make([]WebhookAttemptResponse, 0, len(d.Log)),
+		}
+		if d.Status == db.WebhookPending {
+			dr.Next_attempt_at = d.Next_attempt_at.Format(time.RFC3339)
+		}
+		if d.Delivered_at != nil {
+			dr.Delivered_at = d.Delivered_at.Format(time.RFC3339)
+		}
+		for _, a := range d.Log {
+			dr.Log = append(dr.Log, WebhookAttemptResponse{
+				Status_code:  a.Status_code,
+				Error:        a.Error,
+				Duration_ms:  a.Duration_ms,
+				Attempted_at: a.Attempted_at.Format(time.RFC3339),
+			})
+		}
+		deliveries = append(deliveries, dr)
+	}
+	return
+}
+
+func (b *bookingService) RedeliverWebhook(ctx context.Context, delivery_id int) (err error) {
+	err = b.store.RedeliverWebhook(ctx, delivery_id)
+	switch err {
+	case nil:
+		b.logger.Infof("Webhook delivery %v queued again", delivery_id)
+	case db.ErrDeliveryNotFound, db.ErrNotDeadLetter:
+	default:
+		b.logger.Errorf("Err: Redelivering webhook %v: %v", delivery_id, err.Error())
+	}
+	return
+}
@@ -10,8 +10,23 @@ import (
 type config struct {
 	appName       string
 	appPort       int
+	appEnv        string
 	migrationPath string
 	db            databaseConfig
+	show          showConfig
+	pricing       pricingConfig
+	loyalty       loyaltyConfig
+	waitlist      waitlistConfig
+	notify        notifyConfig
+	scheduler     schedulerConfig
+	webhook       webhookConfig
+	events        eventsConfig
+	seatFeed      seatFeedConfig
+	waitingRoom   waitingRoomConfig
+	rateLimit     rateLimitConfig
+	idempotency   idempotencyConfig
+	server        serverConfig
+	ticket        ticketConfig
 }
 
 var appConfig config
@@ -19,7 +34,74 @@ var appConfig config
 func Load() {
 	viper.SetDefault("APP_NAME", "Movie_ticketing_system")
 	viper.SetDefault("APP_PORT", 3000)
+	viper.SetDefault("APP_ENV", "production")
 	viper.SetDefault("MIGRATION_PATH", "./migrations")
+	viper.SetDefault("SHOW_TRAILER_BUFFER_MINS", 15)
+	viper.SetDefault("SHOW_CLEANING_BUFFER_MINS", 15)
+	viper.SetDefault("MULTIPLEX_OPENS_AT", "09:00")
+	viper.SetDefault("MULTIPLEX_CLOSES_AT", "01:00")
+	viper.SetDefault("MULTIPLEX_TIME_ZONE", "Asia/Kolkata")
+	viper.SetDefault("ADMISSION_OPENS_MINS", 45)
+	viper.SetDefault("ADMISSION_CLOSES_MINS", 30)
+	viper.SetDefault("CURRENCY", "INR")
+	viper.SetDefault("CONVENIENCE_FEE", 3000)
+	viper.SetDefault("PRICING_REPRICE_INTERVAL_SECS", 60)
+	viper.SetDefault("LOYALTY_POINTS_PER_RUPEE", 1)
+	viper.SetDefault("LOYALTY_POINT_VALUE", 25)
+	viper.SetDefault("LOYALTY_EXPIRY_DAYS", 365)
+	viper.SetDefault("WAITLIST_HOLD_MINS", 15)
+	viper.SetDefault("WAITLIST_MAX_SEATS", 10)
+	viper.SetDefault("NOTIFY_CHANNELS", "log")
+	viper.SetDefault("NOTIFY_FILE_PATH", "./notifications.log")
+	viper.SetDefault("NOTIFY_POLL_INTERVAL_SECS", 5)
+	viper.SetDefault("NOTIFY_BATCH_SIZE", 50)
+	viper.SetDefault("NOTIFY_MAX_ATTEMPTS", 8)
+	viper.SetDefault("SMTP_HOST", "")
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("SMTP_USERNAME", "")
+	viper.SetDefault("SMTP_PASSWORD", "")
+	viper.SetDefault("SMTP_FROM", "")
+	viper.SetDefault("SMS_API_URL", "")
+	viper.SetDefault("SMS_API_KEY", "")
+	viper.SetDefault("SMS_SENDER", "")
+	viper.SetDefault("NOTIFY_WEBHOOK_URL", "")
+	viper.SetDefault("PASSWORD_RESET_TTL_MINS", 30)
+	viper.SetDefault("SCHEDULER_ENABLED", "true")
+	viper.SetDefault("REMINDER_LEAD_MINS", 180)
+	viper.SetDefault("REMINDER_INTERVAL_SECS", 60)
+	viper.SetDefault("REMINDER_BATCH_SIZE", 500)
+	viper.SetDefault("WEBHOOK_POLL_INTERVAL_SECS", 5)
+	viper.SetDefault("WEBHOOK_BATCH_SIZE", 20)
+	viper.SetDefault("WEBHOOK_MAX_ATTEMPTS", 10)
+	viper.SetDefault("WEBHOOK_TIMEOUT_SECS", 10)
+	viper.SetDefault("EVENTS_POLL_INTERVAL_SECS", 1)
+	viper.SetDefault("EVENTS_BATCH_SIZE", 100)
+	viper.SetDefault("EVENTS_MAX_ATTEMPTS", 10)
+	viper.SetDefault("SEAT_FEED_POLL_MILLIS", 500)
+	viper.SetDefault("SEAT_FEED_HEARTBEAT_SECS", 15)
+	viper.SetDefault("SEAT_FEED_RETENTION_HOURS", 24)
+	viper.SetDefault("WAITING_ROOM_ADMIT_INTERVAL_SECS", 5)
+	viper.SetDefault("WAITING_ROOM_TOKEN_HEADER", "X-Queue-Token")
+	viper.SetDefault("RATE_LIMIT_ENABLED", "true")
+	viper.SetDefault("RATE_LIMIT_STORE", "memory")
+	viper.SetDefault("RATE_LIMIT_TRUST_PROXY", "false")
+	viper.SetDefault("RATE_LIMIT_IP_BURST", 100)
+	viper.SetDefault("RATE_LIMIT_IP_PER_MIN", 300)
+	viper.SetDefault("RATE_LIMIT_LOGIN_BURST", 5)
+	viper.SetDefault("RATE_LIMIT_LOGIN_PER_MIN", 10)
+	viper.SetDefault("RATE_LIMIT_BOOKING_BURST", 10)
+	viper.SetDefault("RATE_LIMIT_BOOKING_PER_MIN", 30)
+	viper.SetDefault("RATE_LIMIT_ADMIN_BURST", 30)
+	viper.SetDefault("RATE_LIMIT_ADMIN_PER_MIN", 120)
+	viper.SetDefault("IDEMPOTENCY_KEY_TTL_HOURS", 24)
+	viper.SetDefault("IDEMPOTENCY_LOCK_SECS", 60)
+	viper.SetDefault("SERVER_READ_TIMEOUT_SECS", 15)
+	viper.SetDefault("SERVER_READ_HEADER_TIMEOUT_SECS", 5)
+	viper.SetDefault("SERVER_WRITE_TIMEOUT_SECS", 30)
+	viper.SetDefault("SERVER_IDLE_TIMEOUT_SECS", 120)
+	viper.SetDefault("SERVER_SHUTDOWN_TIMEOUT_SECS", 30)
+	viper.SetDefault("SERVER_DRAIN_DELAY_SECS", 5)
+	viper.SetDefault("TICKET_SIGNING_KEY", "")
 	viper.AddConfigPath("./")
 	viper.AddConfigPath("./..")
 	viper.AddConfigPath("./../..")
@@ -32,8 +114,23 @@ func Load() {
 	appConfig = config{
 		appName:       readEnvString("APP_NAME"),
 		appPort:       readEnvInt("APP_PORT"),
+		appEnv:        readEnvString("APP_ENV"),
 		migrationPath: readEnvString("MIGRATION_PATH"),
 		db:            newDatabaseConfig(),
+		show:          newShowConfig(),
+		pricing:       newPricingConfig(),
+		loyalty:       newLoyaltyConfig(),
+		waitlist:      newWaitlistConfig(),
+		notify:        newNotifyConfig(),
+		scheduler:     newSchedulerConfig(),
+		webhook:       newWebhookConfig(),
+		events:        newEventsConfig(),
+		seatFeed:      newSeatFeedConfig(),
+		waitingRoom:   newWaitingRoomConfig(),
+		rateLimit:     newRateLimitConfig(),
+		idempotency:   newIdempotencyConfig(),
+		server:        newServerConfig(),
+		ticket:        newTicketConfig(),
 	}
 
 }
@@ -46,6 +143,12 @@ func AppPort() int {
 	return appConfig.appPort
 }
 
+// DevMode is set with APP_ENV=dev, for running locally without the secrets
+// a deployment needs.
+func DevMode() bool {
+	return appConfig.appEnv == "dev"
+}
+
 func MigrationPath() string {
 	return appConfig.migrationPath
 }
@@ -0,0 +1,36 @@
+package config
+
+import "time"
+
+type eventsConfig struct {
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+}
+
+// PollInterval is how often the event dispatcher looks for new events.
+func (c eventsConfig) PollInterval() time.Duration {
+	return c.pollInterval
+}
+
+func (c eventsConfig) BatchSize() int {
+	return c.batchSize
+}
+
+// MaxAttempts is how many times an event is handed to failing subscribers
+// before it is given up as Failed.
+func (c eventsConfig) MaxAttempts() int {
+	return c.maxAttempts
+}
+
+func newEventsConfig() eventsConfig {
+	return eventsConfig{
+		pollInterval: time.Duration(readEnvInt("EVENTS_POLL_INTERVAL_SECS")) * time.Second,
+		batchSize:    readEnvInt("EVENTS_BATCH_SIZE"),
+		maxAttempts:  readEnvInt("EVENTS_MAX_ATTEMPTS"),
+	}
+}
+
+func Events() eventsConfig {
+	return appConfig.events
+}
@@ -0,0 +1,30 @@
+package config
+
+import "time"
+
+type idempotencyConfig struct {
+	keyTTL time.Duration
+	lock   time.Duration
+}
+
+// KeyTTL is how long responses are kept to replay for retries.
+func (c idempotencyConfig) KeyTTL() time.Duration {
+	return c.keyTTL
+}
+
+// Lock is how long a request holds its key before a retry may take over,
+// it has to be longer than any request takes.
+func (c idempotencyConfig) Lock() time.Duration {
+	return c.lock
+}
+
+func newIdempotencyConfig() idempotencyConfig {
+	return idempotencyConfig{
+		keyTTL: time.Duration(readEnvInt("IDEMPOTENCY_KEY_TTL_HOURS")) * time.Hour,
+		lock:   time.Duration(readEnvInt("IDEMPOTENCY_LOCK_SECS")) * time.Second,
+	}
+}
+
+func Idempotency() idempotencyConfig {
+	return appConfig.idempotency
+}
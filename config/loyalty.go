@@ -0,0 +1,34 @@
+package config
+
+type loyaltyConfig struct {
+	pointsPerRupee int
+	pointValue     int
+	expiryDays     int
+}
+
+// PointsPerRupee is what customers earn for every rupee they pay, before
+// their tier's multiplier.
+func (c loyaltyConfig) PointsPerRupee() int {
+	return c.pointsPerRupee
+}
+
+// PointValue is what a point is worth when redeemed, in minor units.
+func (c loyaltyConfig) PointValue() int {
+	return c.pointValue
+}
+
+func (c loyaltyConfig) ExpiryDays() int {
+	return c.expiryDays
+}
+
+func newLoyaltyConfig() loyaltyConfig {
+	return loyaltyConfig{
+		pointsPerRupee: readEnvInt("LOYALTY_POINTS_PER_RUPEE"),
+		pointValue:     readEnvInt("LOYALTY_POINT_VALUE"),
+		expiryDays:     readEnvInt("LOYALTY_EXPIRY_DAYS"),
+	}
+}
+
+func Loyalty() loyaltyConfig {
+	return appConfig.loyalty
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+type notifyConfig struct {
+	channels         []string
+	filePath         string
+	pollInterval     time.Duration
+	batchSize        int
+	maxAttempts      int
+	smtpHost         string
+	smtpPort         int
+	smtpUsername     string
+	smtpPassword     string
+	smtpFrom         string
+	smsURL           string
+	smsAPIKey        string
+	smsSender        string
+	webhookURL       string
+	passwordResetTTL time.Duration
+}
+
+// Channels are the names of the channels notifications go out through: log,
+// file, email, sms and webhook.
+func (c notifyConfig) Channels() []string {
+	return c.channels
+}
+
+// FilePath is where the file channel appends notifications.
+func (c notifyConfig) FilePath() string {
+	return c.filePath
+}
+
+// PollInterval is how often the dispatcher looks for pending notifications.
+func (c notifyConfig) PollInterval() time.Duration {
+	return c.pollInterval
+}
+
+func (c notifyConfig) BatchSize() int {
+	return c.batchSize
+}
+
+// MaxAttempts is how many times a notification is tried before it is given
+// up as Failed.
+func (c notifyConfig) MaxAttempts() int {
+	return c.maxAttempts
+}
+
+func (c notifyConfig) SMTPHost() string {
+	return c.smtpHost
+}
+
+func (c notifyConfig) SMTPPort() int {
+	return c.smtpPort
+}
+
+func (c notifyConfig) SMTPUsername() string {
+	return c.smtpUsername
+}
+
+func (c notifyConfig) SMTPPassword() string {
+	return c.smtpPassword
+}
+
+func (c notifyConfig) SMTPFrom() string {
+	return c.smtpFrom
+}
+
+// SMSURL is the SMS provider's send endpoint.
+func (c notifyConfig) SMSURL() string {
+	return c.smsURL
+}
+
+func (c notifyConfig) SMSAPIKey() string {
+	return c.smsAPIKey
+}
+
+func (c notifyConfig) SMSSender() string {
+	return c.smsSender
+}
+
+// WebhookURL receives every notification as JSON.
+func (c notifyConfig) WebhookURL() string {
+	return c.webhookURL
+}
+
+// PasswordResetTTL is how long a password reset token can be used.
+func (c notifyConfig) PasswordResetTTL() time.Duration {
+	return c.passwordResetTTL
+}
+
+func newNotifyConfig() notifyConfig {
+	var channels []string
+	for _, name := range strings.Split(readEnvString("NOTIFY_CHANNELS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			channels = append(channels, name)
+		}
+	}
+
+	return notifyConfig{
+		channels:         channels,
+		filePath:         readEnvString("NOTIFY_FILE_PATH"),
+		pollInterval:     time.Duration(readEnvInt("NOTIFY_POLL_INTERVAL_SECS")) * time.Second,
+		batchSize:        readEnvInt("NOTIFY_BATCH_SIZE"),
+		maxAttempts:      readEnvInt("NOTIFY_MAX_ATTEMPTS"),
+		smtpHost:         readEnvString("SMTP_HOST"),
+		smtpPort:         readEnvInt("SMTP_PORT"),
+		smtpUsername:     readEnvString("SMTP_USERNAME"),
+		smtpPassword:     readEnvString("SMTP_PASSWORD"),
+		smtpFrom:         readEnvString("SMTP_FROM"),
+		smsURL:           readEnvString("SMS_API_URL"),
+		smsAPIKey:        readEnvString("SMS_API_KEY"),
+		smsSender:        readEnvString("SMS_SENDER"),
+		webhookURL:       readEnvString("NOTIFY_WEBHOOK_URL"),
+		passwordResetTTL: time.Duration(readEnvInt("PASSWORD_RESET_TTL_MINS")) * time.Minute,
+	}
+}
+
+func Notify() notifyConfig {
+	return appConfig.notify
+}
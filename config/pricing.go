@@ -0,0 +1,38 @@
+package config
+
+import "time"
+
+type pricingConfig struct {
+	currency        string
+	convenienceFee  int
+	repriceInterval time.Duration
+}
+
+// Currency is the ISO 4217 code amounts are charged in. All amounts are in
+// its minor unit.
+func (c pricingConfig) Currency() string {
+	return c.currency
+}
+
+// ConvenienceFee is charged per ticket on online bookings.
+func (c pricingConfig) ConvenienceFee() int {
+	return c.convenienceFee
+}
+
+// RepriceInterval is how often shows on sale are repriced by their pricing
+// rules between bookings.
+func (c pricingConfig) RepriceInterval() time.Duration {
+	return c.repriceInterval
+}
+
+func newPricingConfig() pricingConfig {
+	return pricingConfig{
+		currency:        readEnvString("CURRENCY"),
+		convenienceFee:  readEnvInt("CONVENIENCE_FEE"),
+		repriceInterval: time.Duration(readEnvInt("PRICING_REPRICE_INTERVAL_SECS")) * time.Second,
+	}
+}
+
+func Pricing() pricingConfig {
+	return appConfig.pricing
+}
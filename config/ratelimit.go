@@ -0,0 +1,85 @@
+package config
+
+type rateLimit struct {
+	burst     int
+	perMinute int
+}
+
+// Burst is how many requests can be made at once.
+func (l rateLimit) Burst() int {
+	return l.burst
+}
+
+// PerMinute is how many requests a minute are allowed after the burst.
+func (l rateLimit) PerMinute() int {
+	return l.perMinute
+}
+
+type rateLimitConfig struct {
+	enabled    bool
+	store      string
+	trustProxy bool
+	ip         rateLimit
+	login      rateLimit
+	booking    rateLimit
+	admin      rateLimit
+}
+
+func (c rateLimitConfig) Enabled() bool {
+	return c.enabled
+}
+
+// Store is where the buckets are kept, memory for a single server or
+// postgres to share them between replicas.
+func (c rateLimitConfig) Store() string {
+	return c.store
+}
+
+// TrustProxy takes the client's address from the last X-Forwarded-For hop,
+// only to be set behind a single proxy that appends to it.
+func (c rateLimitConfig) TrustProxy() bool {
+	return c.trustProxy
+}
+
+// IP limits every request by client address.
+func (c rateLimitConfig) IP() rateLimit {
+	return c.ip
+}
+
+// Login limits logging in, signing up and password resets by client address.
+func (c rateLimitConfig) Login() rateLimit {
+	return c.login
+}
+
+// Booking limits quoting and booking seats by user.
+func (c rateLimitConfig) Booking() rateLimit {
+	return c.booking
+}
+
+// Admin limits the admin routes by user.
+func (c rateLimitConfig) Admin() rateLimit {
+	return c.admin
+}
+
+func readRateLimit(prefix string) rateLimit {
+	return rateLimit{
+		burst:     readEnvInt(prefix + "_BURST"),
+		perMinute: readEnvInt(prefix + "_PER_MIN"),
+	}
+}
+
+func newRateLimitConfig() rateLimitConfig {
+	return rateLimitConfig{
+		enabled:    readEnvString("RATE_LIMIT_ENABLED") == "true",
+		store:      readEnvString("RATE_LIMIT_STORE"),
+		trustProxy: readEnvString("RATE_LIMIT_TRUST_PROXY") == "true",
+		ip:         readRateLimit("RATE_LIMIT_IP"),
+		login:      readRateLimit("RATE_LIMIT_LOGIN"),
+		booking:    readRateLimit("RATE_LIMIT_BOOKING"),
+		admin:      readRateLimit("RATE_LIMIT_ADMIN"),
+	}
+}
+
+func RateLimit() rateLimitConfig {
+	return appConfig.rateLimit
+}
@@ -0,0 +1,43 @@
+package config
+
+import "time"
+
+type schedulerConfig struct {
+	enabled          bool
+	reminderLead     time.Duration
+	reminderInterval time.Duration
+	reminderBatch    int
+}
+
+// Enabled runs the job scheduler inside the API server. Turn it off when it
+// runs as its own process with the scheduler command.
+func (c schedulerConfig) Enabled() bool {
+	return c.enabled
+}
+
+// ReminderLead is how long before a show customers are reminded of it.
+func (c schedulerConfig) ReminderLead() time.Duration {
+	return c.reminderLead
+}
+
+// ReminderInterval is how often the reminder job looks for shows coming up.
+func (c schedulerConfig) ReminderInterval() time.Duration {
+	return c.reminderInterval
+}
+
+func (c schedulerConfig) ReminderBatchSize() int {
+	return c.reminderBatch
+}
+
+func newSchedulerConfig() schedulerConfig {
+	return schedulerConfig{
+		enabled:          readEnvString("SCHEDULER_ENABLED") == "true",
+		reminderLead:     time.Duration(readEnvInt("REMINDER_LEAD_MINS")) * time.Minute,
+		reminderInterval: time.Duration(readEnvInt("REMINDER_INTERVAL_SECS")) * time.Second,
+		reminderBatch:    readEnvInt("REMINDER_BATCH_SIZE"),
+	}
+}
+
+func Scheduler() schedulerConfig {
+	return appConfig.scheduler
+}
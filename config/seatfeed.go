@@ -0,0 +1,36 @@
+package config
+
+import "time"
+
+type seatFeedConfig struct {
+	pollInterval time.Duration
+	heartbeat    time.Duration
+	retention    time.Duration
+}
+
+// PollInterval is how often each server looks for seat changes to push.
+func (c seatFeedConfig) PollInterval() time.Duration {
+	return c.pollInterval
+}
+
+// Heartbeat is how often an idle stream is pinged so proxies keep it open.
+func (c seatFeedConfig) Heartbeat() time.Duration {
+	return c.heartbeat
+}
+
+// Retention is how long seat changes are kept for clients to resume from.
+func (c seatFeedConfig) Retention() time.Duration {
+	return c.retention
+}
+
+func newSeatFeedConfig() seatFeedConfig {
+	return seatFeedConfig{
+		pollInterval: time.Duration(readEnvInt("SEAT_FEED_POLL_MILLIS")) * time.Millisecond,
+		heartbeat:    time.Duration(readEnvInt("SEAT_FEED_HEARTBEAT_SECS")) * time.Second,
+		retention:    time.Duration(readEnvInt("SEAT_FEED_RETENTION_HOURS")) * time.Hour,
+	}
+}
+
+func SeatFeed() seatFeedConfig {
+	return appConfig.seatFeed
+}
@@ -0,0 +1,60 @@
+package config
+
+import "time"
+
+type serverConfig struct {
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	shutdownTimeout   time.Duration
+	drainDelay        time.Duration
+}
+
+// ReadTimeout is how long a client has to send a whole request.
+func (c serverConfig) ReadTimeout() time.Duration {
+	return c.readTimeout
+}
+
+func (c serverConfig) ReadHeaderTimeout() time.Duration {
+	return c.readHeaderTimeout
+}
+
+// WriteTimeout is how long a request has to be answered. Streams are left
+// out of it.
+func (c serverConfig) WriteTimeout() time.Duration {
+	return c.writeTimeout
+}
+
+// IdleTimeout is how long a keep-alive connection waits for the next
+// request.
+func (c serverConfig) IdleTimeout() time.Duration {
+	return c.idleTimeout
+}
+
+// ShutdownTimeout is how long in-flight requests get to finish once the
+// server is told to stop.
+func (c serverConfig) ShutdownTimeout() time.Duration {
+	return c.shutdownTimeout
+}
+
+// DrainDelay is how long the server keeps taking new connections after
+// readiness starts failing, so load balancers stop sending traffic first.
+func (c serverConfig) DrainDelay() time.Duration {
+	return c.drainDelay
+}
+
+func newServerConfig() serverConfig {
+	return serverConfig{
+		readTimeout:       time.Duration(readEnvInt("SERVER_READ_TIMEOUT_SECS")) * time.Second,
+		readHeaderTimeout: time.Duration(readEnvInt("SERVER_READ_HEADER_TIMEOUT_SECS")) * time.Second,
+		writeTimeout:      time.Duration(readEnvInt("SERVER_WRITE_TIMEOUT_SECS")) * time.Second,
+		idleTimeout:       time.Duration(readEnvInt("SERVER_IDLE_TIMEOUT_SECS")) * time.Second,
+		shutdownTimeout:   time.Duration(readEnvInt("SERVER_SHUTDOWN_TIMEOUT_SECS")) * time.Second,
+		drainDelay:        time.Duration(readEnvInt("SERVER_DRAIN_DELAY_SECS")) * time.Second,
+	}
+}
+
+func Server() serverConfig {
+	return appConfig.server
+}
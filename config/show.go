@@ -0,0 +1,59 @@
+package config
+
+type showConfig struct {
+	trailerBufferMins   int
+	cleaningBufferMins  int
+	opensAt             string
+	closesAt            string
+	timeZone            string
+	admissionOpensMins  int
+	admissionClosesMins int
+}
+
+func (c showConfig) TrailerBufferMins() int {
+	return c.trailerBufferMins
+}
+
+func (c showConfig) CleaningBufferMins() int {
+	return c.cleaningBufferMins
+}
+
+func (c showConfig) OpensAt() string {
+	return c.opensAt
+}
+
+func (c showConfig) ClosesAt() string {
+	return c.closesAt
+}
+
+func (c showConfig) TimeZone() string {
+	return c.timeZone
+}
+
+// AdmissionOpensMins is how long before a show starts ushers begin admitting
+// ticket holders.
+func (c showConfig) AdmissionOpensMins() int {
+	return c.admissionOpensMins
+}
+
+// AdmissionClosesMins is how long after a show starts latecomers are still
+// admitted.
+func (c showConfig) AdmissionClosesMins() int {
+	return c.admissionClosesMins
+}
+
+func newShowConfig() showConfig {
+	return showConfig{
+		trailerBufferMins:   readEnvInt("SHOW_TRAILER_BUFFER_MINS"),
+		cleaningBufferMins:  readEnvInt("SHOW_CLEANING_BUFFER_MINS"),
+		opensAt:             readEnvString("MULTIPLEX_OPENS_AT"),
+		closesAt:            readEnvString("MULTIPLEX_CLOSES_AT"),
+		timeZone:            readEnvString("MULTIPLEX_TIME_ZONE"),
+		admissionOpensMins:  readEnvInt("ADMISSION_OPENS_MINS"),
+		admissionClosesMins: readEnvInt("ADMISSION_CLOSES_MINS"),
+	}
+}
+
+func Show() showConfig {
+	return appConfig.show
+}
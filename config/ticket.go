@@ -0,0 +1,22 @@
+package config
+
+type ticketConfig struct {
+	signingKey string
+}
+
+// SigningKey is the base64 Ed25519 seed tickets are signed with. Scanners
+// only get the public key. It may only be left empty in dev mode, where a new
+// key is made on every start.
+func (c ticketConfig) SigningKey() string {
+	return c.signingKey
+}
+
+func newTicketConfig() ticketConfig {
+	return ticketConfig{
+		signingKey: readEnvString("TICKET_SIGNING_KEY"),
+	}
+}
+
+func Ticket() ticketConfig {
+	return appConfig.ticket
+}
@@ -0,0 +1,29 @@
+package config
+
+import "time"
+
+type waitingRoomConfig struct {
+	admitInterval time.Duration
+	tokenHeader   string
+}
+
+// AdmitInterval is how often customers at the front of the queues are let in.
+func (c waitingRoomConfig) AdmitInterval() time.Duration {
+	return c.admitInterval
+}
+
+// TokenHeader is the request header carrying a customer's queue token.
+func (c waitingRoomConfig) TokenHeader() string {
+	return c.tokenHeader
+}
+
+func newWaitingRoomConfig() waitingRoomConfig {
+	return waitingRoomConfig{
+		admitInterval: time.Duration(readEnvInt("WAITING_ROOM_ADMIT_INTERVAL_SECS")) * time.Second,
+		tokenHeader:   readEnvString("WAITING_ROOM_TOKEN_HEADER"),
+	}
+}
+
+func WaitingRoom() waitingRoomConfig {
+	return appConfig.waitingRoom
+}
@@ -0,0 +1,28 @@
+package config
+
+type waitlistConfig struct {
+	holdMins int
+	maxSeats int
+}
+
+// HoldMins is how long seats offered off the waitlist are held for the
+// customer before going to the next in line.
+func (c waitlistConfig) HoldMins() int {
+	return c.holdMins
+}
+
+// MaxSeats is the most seats one customer can wait for.
+func (c waitlistConfig) MaxSeats() int {
+	return c.maxSeats
+}
+
+func newWaitlistConfig() waitlistConfig {
+	return waitlistConfig{
+		holdMins: readEnvInt("WAITLIST_HOLD_MINS"),
+		maxSeats: readEnvInt("WAITLIST_MAX_SEATS"),
+	}
+}
+
+func Waitlist() waitlistConfig {
+	return appConfig.waitlist
+}
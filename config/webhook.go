@@ -0,0 +1,42 @@
+package config
+
+import "time"
+
+type webhookConfig struct {
+	pollInterval time.Duration
+	batchSize    int
+	maxAttempts  int
+	timeout      time.Duration
+}
+
+// PollInterval is how often the webhook sender looks for due deliveries.
+func (c webhookConfig) PollInterval() time.Duration {
+	return c.pollInterval
+}
+
+func (c webhookConfig) BatchSize() int {
+	return c.batchSize
+}
+
+// MaxAttempts is how many times a delivery is tried before it is dead.
+func (c webhookConfig) MaxAttempts() int {
+	return c.maxAttempts
+}
+
+// Timeout is how long a partner's endpoint has to answer.
+func (c webhookConfig) Timeout() time.Duration {
+	return c.timeout
+}
+
+func newWebhookConfig() webhookConfig {
+	return webhookConfig{
+		pollInterval: time.Duration(readEnvInt("WEBHOOK_POLL_INTERVAL_SECS")) * time.Second,
+		batchSize:    readEnvInt("WEBHOOK_BATCH_SIZE"),
+		maxAttempts:  readEnvInt("WEBHOOK_MAX_ATTEMPTS"),
+		timeout:      time.Duration(readEnvInt("WEBHOOK_TIMEOUT_SECS")) * time.Second,
+	}
+}
+
+func Webhook() webhookConfig {
+	return appConfig.webhook
+}
@@ -0,0 +1,765 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	SeatAvailable = "Available"
+	SeatBooked    = "Booked"
+	SeatVoid      = "Void"
+	// held for a customer off the waitlist
+	SeatHeld = "Held"
+
+	ShowScheduled = "Scheduled"
+	ShowCancelled = "Cancelled"
+
+	BookingConfirmed = "Confirmed"
+	BookingCancelled = "Cancelled"
+	// the booking's seats don't exist on the show's new screen and the
+	// customer has to pick new ones or cancel
+	BookingActionRequired = "Action Required"
+
+	RefundPending = "Pending"
+
+	ChannelOnline = "online"
+	ChannelPOS    = "pos"
+
+	PaymentCash     = "cash"
+	PaymentCard     = "card"
+	PaymentCaptured = "Captured"
+
+	// money is kept in minor units of the currency
+	DefaultCurrency  = "INR"
+	DefaultSeatPrice = 30000
+
+	LineTicket   = "ticket"
+	LineDiscount = "discount"
+	LineLoyalty  = "loyalty"
+	LineFee      = "fee"
+	LineFnb      = "fnb"
+	LineTax      = "tax"
+
+	NotificationShowCancelled    = "show_cancelled"
+	NotificationShowRescheduled  = "show_rescheduled"
+	NotificationBookingCancelled = "booking_cancelled"
+)
+
+// liveBookings still hold seats for a show, a cancelled show cancels and
+// refunds them
+var liveBookings = pq.StringArray{BookingConfirmed, BookingActionRequired}
+
+var (
+	ErrShowNotFound         = errors.New("show doesn't exist")
+	ErrShowAlreadyCancelled = errors.New("show is already cancelled")
+)
+
+const (
+	getShowStatus   = `SELECT status FROM shows WHERE show_id=$1 FOR UPDATE`
+	cancelShowQuery = `UPDATE shows SET status=$2, cancelled_at=now(), cancel_reason=$3 WHERE show_id=$1`
+	voidSeatsOfShow = `UPDATE seats SET status=$2, held_for=NULL, held_until=NULL WHERE show_id=$1`
+	// what was refunded already, for food the kitchen cancelled, isn't
+	// refunded again
+	cancelledBookingColumns = `SELECT b.booking_id, COALESCE(b.user_id, 0) AS user_id,
+	b.amount - COALESCE((SELECT sum(r.amount) FROM refunds r WHERE r.booking_id = b.booking_id), 0) AS amount,
+	COALESCE((SELECT p.method FROM payments p WHERE p.booking_id = b.booking_id ORDER BY p.payment_id LIMIT 1), '') AS payment_method,
+	COALESCE(array_agg(s.seat_number ORDER BY s.seat_number) FILTER (WHERE s.seat_id IS NOT NULL), '{}') AS seats
+	FROM bookings b
+	LEFT JOIN booking_seats bs ON bs.booking_id = b.booking_id
+	LEFT JOIN seats s ON s.seat_id = bs.seat_id
+	`
+	getBookingsOfShow = cancelledBookingColumns + `WHERE b.show_id=$1 AND b.status = ANY($2)
+	GROUP BY b.booking_id
+	ORDER BY b.booking_id`
+	getBookingToCancel = cancelledBookingColumns + `WHERE b.booking_id=$1
+	GROUP BY b.booking_id`
+	lockBookingQuery = `SELECT show_id, COALESCE(user_id, 0) AS user_id, status, checked_in_at FROM bookings
+	WHERE booking_id=$1 FOR UPDATE`
+	cancelBookingsOfShow     = `UPDATE bookings SET status=$3, cancelled_at=now() WHERE show_id=$1 AND status = ANY($2)`
+	cancelBookingQuery       = `UPDATE bookings SET status=$2, cancelled_at=now() WHERE booking_id=$1`
+	releaseBookedSeats       = `UPDATE seats SET status=$2 WHERE status=$3 AND seat_id IN (SELECT seat_id FROM booking_seats WHERE booking_id=$1)`
+	queuedFnbOrdersOfShow    = `SELECT order_id FROM fnb_orders WHERE show_id=$1 AND status=$2 ORDER BY order_id FOR UPDATE`
+	queuedFnbOrdersOfBooking = `SELECT order_id FROM fnb_orders WHERE booking_id=$1 AND status=$2 ORDER BY order_id FOR UPDATE`
+	cancelFnbOrdersOfShow    = `UPDATE fnb_orders SET status=$3, updated_at=now() WHERE show_id=$1 AND status <> $2 AND status <> $3`
+	cancelFnbOrderOfBooking  = `UPDATE fnb_orders SET status=$3, updated_at=now() WHERE booking_id=$1 AND status <> $2 AND status <> $3`
+	addRefundQuery           = `INSERT INTO refunds (booking_id, user_id, amount, status, reason, destination, currency)
+	SELECT $1, NULLIF($2, 0), $3, $4, $5, $6, currency FROM bookings WHERE booking_id=$1 returning refund_id`
+	addNotificationQuery = `INSERT INTO notifications (user_id, kind, payload) VALUES ($1, $2, $3) returning notification_id`
+	bookingDetails       = `SELECT b.booking_id, COALESCE(b.user_id, 0) AS user_id, b.status, b.amount, b.discount, b.fee, b.tax, b.currency,
+	b.created_at, b.checked_in_at, sh.show_id, sh.show_date, sh.start_time, sh.end_time, sh.status AS show_status, sc.screen_number,
+	mv.movie_id, mv.title, COALESCE(mv.language, '') AS language, COALESCE(mv.genre, '') AS genre, COALESCE(mv.duration, 0) AS duration,
+	mx.multiplex_id, mx.name AS multiplex, COALESCE(mx.locality, '') AS locality, COALESCE(l.city, '') AS city,
+	COALESCE(l.state, '') AS state, mx.time_zone,
+	COALESCE(array_agg(s.seat_number ORDER BY s.seat_number) FILTER (WHERE s.seat_id IS NOT NULL), '{}') AS seats
+	FROM bookings b
+	JOIN shows sh ON sh.show_id = b.show_id
+	JOIN screens sc ON sc.screen_id = sh.screen_id
+	JOIN movies mv ON mv.movie_id = sh.movie_id
+	JOIN multiplexes mx ON mx.multiplex_id = sh.multiplex_id
+	LEFT JOIN locations l ON l.location_id = mx.location_id
+	LEFT JOIN booking_seats bs ON bs.booking_id = b.booking_id
+	LEFT JOIN seats s ON s.seat_id = bs.seat_id
+	`
+	bookingDetailsGroupBy = `
+	GROUP BY b.booking_id, sh.show_id, sc.screen_id, mv.movie_id, mx.multiplex_id, l.location_id`
+	getBookingsOfUser = bookingDetails + `WHERE b.user_id = $1
+	AND ($2 = '' OR ($2 = 'upcoming' AND sh.end_time >= now()) OR ($2 = 'past' AND sh.end_time < now()))` +
+		bookingDetailsGroupBy + `
+	ORDER BY sh.start_time`
+	getBookingByID     = bookingDetails + `WHERE b.booking_id = $1` + bookingDetailsGroupBy
+	lockShowForBooking = `SELECT status FROM shows WHERE show_id=$1 FOR SHARE`
+	// the seats a booking holds and the ones it moves to, locked in the order
+	// booking locks seats in
+	lockSeatsToReseat = `SELECT seat_id, seat_number, status,
+	EXISTS (SELECT 1 FROM booking_seats bs WHERE bs.seat_id = s.seat_id AND bs.booking_id = $3) AS held
+	FROM seats s
+	WHERE show_id=$1 AND (seat_number = ANY($2) OR seat_id IN (SELECT seat_id FROM booking_seats WHERE booking_id=$3))
+	ORDER BY seat_number
+	FOR UPDATE`
+	removeBookingSeats = `DELETE FROM booking_seats WHERE booking_id=$1`
+	lockSeatsQuery     = `SELECT seat_id, seat_number, price, status, show_id, COALESCE(held_for, 0) AS held_for FROM seats
+	WHERE show_id=$1 AND seat_number = ANY($2)
+	ORDER BY seat_number
+	FOR UPDATE`
+	setSeatsStatus  = `UPDATE seats SET status=$2, held_for=NULL, held_until=NULL WHERE seat_id = ANY($1)`
+	addBookingQuery = `INSERT INTO bookings (status, user_id, show_id, amount, channel, customer_phone, sold_by, coupon_id, discount,
+	fee, tax, currency)
+	VALUES ($1, NULLIF($2, 0), $3, $4, $5, NULLIF($6, ''), NULLIF($7, 0), NULLIF($8, 0), $9, $10, $11, $12) returning booking_id`
+	addLineItemQuery = `INSERT INTO booking_line_items (booking_id, kind, label, quantity, unit_amount, amount)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+	getLineItemsOfBooking = `SELECT kind, label, quantity, unit_amount, amount FROM booking_line_items
+	WHERE booking_id=$1 ORDER BY line_item_id`
+	addBookingSeats = `INSERT INTO booking_seats (booking_id, seat_id) SELECT $1, unnest($2::int[])`
+	addPaymentQuery = `INSERT INTO payments (booking_id, method, amount, status, staff_id, shift_id, currency)
+	VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, 0), $7) returning payment_id`
+	getSeatsOfShow = `SELECT seat_id, seat_number, price, base_price, status, show_id, COALESCE(held_for, 0) AS held_for FROM seats
+	WHERE show_id=$1 ORDER BY seat_number`
+	checkInBookingQuery = `UPDATE bookings SET checked_in_at=now(), checked_in_by=$2
+	WHERE booking_id=$1 AND status=$3 AND checked_in_at IS NULL
+	RETURNING checked_in_at`
+	getAdmissionsOfShow = `SELECT count(DISTINCT b.booking_id) AS bookings,
+	count(bs.seat_id) FILTER (WHERE b.checked_in_at IS NOT NULL) AS admitted_seats,
+	count(DISTINCT b.booking_id) FILTER (WHERE b.checked_in_at IS NOT NULL) AS admitted_bookings,
+	count(bs.seat_id) AS seats
+	FROM bookings b
+	LEFT JOIN booking_seats bs ON bs.booking_id = b.booking_id
+	WHERE b.show_id=$1 AND b.status=$2`
+)
+
+// When filters for GetBookingsOfUser
+const (
+	BookingsUpcoming = "upcoming"
+	BookingsPast     = "past"
+)
+
+var (
+	ErrBookingNotFound  = errors.New("booking doesn't exist")
+	ErrAlreadyCheckedIn = errors.New("booking is already checked in")
+	ErrShowNotBookable  = errors.New("show is not open for booking")
+	ErrSeatNotFound     = errors.New("seat doesn't exist")
+	ErrSeatUnavailable  = errors.New("seat is not available")
+	ErrNotCancellable   = errors.New("booking can't be cancelled")
+	ErrNotReseatable    = errors.New("booking doesn't need new seats")
+)
+
+type NewBooking struct {
+	Show_id        int
+	Seat_numbers   []int64
+	User_id        int // 0 for walk-in customers
+	Customer_phone string
+	Channel        string
+	Sold_by        int
+	Payment_method string // recorded as a captured payment when set
+	Gift_card_code string // when paying by gift card
+	Shift_id       int
+	Fnb            *NewFnbOrder // optional food and drinks with the booking
+	// Price works out the charge for the locked seats. Without it the
+	// customer pays the sum of the seat prices, with no fees or taxes.
+	Price func(seats []Seat) (c Charge, err error)
+}
+
+// Charge is what a booking costs, in minor units of Currency.
+type Charge struct {
+	Amount    int // what the customer pays
+	Discount  int
+	Fee       int
+	Tax       int
+	Fnb_tax   int // the part of Tax charged on the food and drinks
+	Currency  string
+	Coupon_id int
+	Lines     []LineItem
+	// loyalty points spent on and earned by the booking
+	Points_redeemed  int
+	Points_earned    int
+	Points_expire_at time.Time
+}
+
+// LineItem is one line of a booking's itemised charge. Discounts are
+// negative.
+type LineItem struct {
+	Kind        string `db:"kind"`
+	Label       string `db:"label"`
+	Quantity    int    `db:"quantity"`
+	Unit_amount int    `db:"unit_amount"`
+	Amount      int    `db:"amount"`
+}
+
+type BookedSeats struct {
+	Booking_id   int
+	Payment_id   int
+	Fnb_order_id int
+	Charge       Charge
+	Seats        []Seat
+}
+
+type Admissions struct {
+	Bookings          int `db:"bookings"`
+	Seats             int `db:"seats"`
+	Admitted_bookings int `db:"admitted_bookings"`
+	Admitted_seats    int `db:"admitted_seats"`
+}
+
+type BookingDetail struct {
+	Booking_id    int           `db:"booking_id"`
+	User_id       int           `db:"user_id"`
+	Status        string        `db:"status"`
+	Amount        int           `db:"amount"`
+	Discount      int           `db:"discount"`
+	Fee           int           `db:"fee"`
+	Tax           int           `db:"tax"`
+	Currency      string        `db:"currency"`
+	Created_at    time.Time     `db:"created_at"`
+	Checked_in_at *time.Time    `db:"checked_in_at"`
+	Show_id       int           `db:"show_id"`
+	Show_date     time.Time     `db:"show_date"`
+	Start_time    time.Time     `db:"start_time"`
+	End_time      time.Time     `db:"end_time"`
+	Show_status   string        `db:"show_status"`
+	Screen_number int           `db:"screen_number"`
+	Movie_id      int           `db:"movie_id"`
+	Title         string        `db:"title"`
+	Language      string        `db:"language"`
+	Genre         string        `db:"genre"`
+	Duration      int           `db:"duration"`
+	Multiplex_id  int           `db:"multiplex_id"`
+	Multiplex     string        `db:"multiplex"`
+	Locality      string        `db:"locality"`
+	City          string        `db:"city"`
+	State         string        `db:"state"`
+	Time_zone     string        `db:"time_zone"`
+	Seats         pq.Int64Array `db:"seats"`
+}
+
+type CancelledBooking struct {
+	Booking_id      int           `db:"booking_id"`
+	User_id         int           `db:"user_id"`
+	Amount          int           `db:"amount"`
+	Payment_method  string        `db:"payment_method"`
+	Seats           pq.Int64Array `db:"seats"`
+	Refund_id       int           `db:"-"`
+	Refund_status   string        `db:"-"`
+	Refund_to       string        `db:"-"`
+	Notification_id int           `db:"-"`
+	Points_reversed int           `db:"-"`
+	Points_refunded int           `db:"-"`
+}
+
+type ShowCancel struct {
+	Show_id int
+	Reason  string
+	// points spent on a booking come back as a lot expiring then
+	Points_expire_at time.Time
+	// refund customers to their wallet rather than how they paid
+	Refund_to_wallet bool
+}
+
+// BookingCancel is a customer giving up their own booking.
+// BookingReseat is a customer moving a booking flagged by a reschedule onto
+// seats the new screen has.
+type BookingReseat struct {
+	Booking_id   int
+	User_id      int
+	Show_id      int
+	Seat_numbers []int64
+	// seats the booking gives up are held for the waitlist until then
+	Hold_until time.Time
+}
+
+type BookingCancel struct {
+	Booking_id       int
+	User_id          int
+	Reason           string
+	Points_expire_at time.Time
+	Refund_to_wallet bool
+	// released seats are held for the waitlist until then
+	Hold_until time.Time
+}
+
+// CancelShow cancels a show together with everything sold for it: seats are
+// voided, bookings still holding seats are cancelled, every paid booking is
+// refunded, coupon uses and loyalty points are reversed and the customer is
+// queued a notification.
+// Either all of it happens or none of it does.
+func (s *store) CancelShow(ctx context.Context, sc ShowCancel) (cancelled []CancelledBooking, err error) {
+	show_id, reason := sc.Show_id, sc.Reason
+
+	err = WithTimeout(ctx, bulkTimeout, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var status string
+			err := tx.GetContext(ctx, &status, getShowStatus, show_id)
+			if err == sql.ErrNoRows {
+				return ErrShowNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if status == ShowCancelled {
+				return ErrShowAlreadyCancelled
+			}
+
+			if _, err = tx.ExecContext(ctx, cancelShowQuery, show_id, ShowCancelled, reason); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, voidSeatsOfShow, show_id, SeatVoid); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, closeWaitlistOfShow, show_id, activeWaitlist, WaitlistClosed); err != nil {
+				return err
+			}
+
+			if err = tx.SelectContext(ctx, &cancelled, getBookingsOfShow, show_id, liveBookings); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, cancelBookingsOfShow, show_id, liveBookings, BookingCancelled); err != nil {
+				return err
+			}
+			if err = cancelFnbOrders(ctx, tx, queuedFnbOrdersOfShow, cancelFnbOrdersOfShow, show_id); err != nil {
+				return err
+			}
+
+			for i := range cancelled {
+				err = settleCancelledBooking(ctx, tx, &cancelled[i], show_id, reason, sc.Refund_to_wallet, sc.Points_expire_at,
+					NotificationShowCancelled)
+				if err != nil {
+					return err
+				}
+			}
+			return addEvent(ctx, tx, ShowCancelledEvent{Show_id: show_id, Reason: reason, Bookings_cancelled: len(cancelled)})
+		})
+	})
+	return
+}
+
+// CancelBooking cancels a customer's confirmed booking before it is used.
+// The booking is refunded like one of a cancelled show and its seats are
+// offered to the show's waitlist before anyone else can book them.
+func (s *store) CancelBooking(ctx context.Context, bc BookingCancel) (c CancelledBooking, offers []WaitlistOffer, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var b struct {
+				Show_id       int        `db:"show_id"`
+				User_id       int        `db:"user_id"`
+				Status        string     `db:"status"`
+				Checked_in_at *time.Time `db:"checked_in_at"`
+			}
+			err := tx.GetContext(ctx, &b, lockBookingQuery, bc.Booking_id)
+			if err == sql.ErrNoRows || (err == nil && b.User_id != bc.User_id) {
+				return ErrBookingNotFound
+			}
+			if err != nil {
+				return err
+			}
+			// a booking the show's move left without seats can be given up too
+			live := b.Status == BookingConfirmed || b.Status == BookingActionRequired
+			if !live || b.Checked_in_at != nil {
+				return ErrNotCancellable
+			}
+
+			if err = tx.GetContext(ctx, &c, getBookingToCancel, bc.Booking_id); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, cancelBookingQuery, bc.Booking_id, BookingCancelled); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, releaseBookedSeats, bc.Booking_id, SeatAvailable, SeatBooked); err != nil {
+				return err
+			}
+			if err = cancelFnbOrders(ctx, tx, queuedFnbOrdersOfBooking, cancelFnbOrderOfBooking, bc.Booking_id); err != nil {
+				return err
+			}
+			err = settleCancelledBooking(ctx, tx, &c, b.Show_id, bc.Reason, bc.Refund_to_wallet, bc.Points_expire_at,
+				NotificationBookingCancelled)
+			if err != nil {
+				return err
+			}
+
+			offers, err = offerReleasedSeats(ctx, tx, b.Show_id, bc.Hold_until)
+			return err
+		})
+	})
+	return
+}
+
+// ReseatBooking moves a booking that needs action onto the given seats and
+// confirms it again. The customer keeps what they paid, and may keep any of
+// the seats they hold that the new screen still has. Seats given up are
+// offered to the show's waitlist.
+func (s *store) ReseatBooking(ctx context.Context, br BookingReseat) (offers []WaitlistOffer, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var status string
+			err := tx.GetContext(ctx, &status, lockShowForBooking, br.Show_id)
+			if err == sql.ErrNoRows {
+				return ErrShowNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if status != ShowScheduled {
+				return ErrShowNotBookable
+			}
+
+			var b struct {
+				Show_id       int        `db:"show_id"`
+				User_id       int        `db:"user_id"`
+				Status        string     `db:"status"`
+				Checked_in_at *time.Time `db:"checked_in_at"`
+			}
+			err = tx.GetContext(ctx, &b, lockBookingQuery, br.Booking_id)
+			if err == sql.ErrNoRows || (err == nil && (b.User_id != br.User_id || b.Show_id != br.Show_id)) {
+				return ErrBookingNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if b.Status != BookingActionRequired {
+				return ErrNotReseatable
+			}
+
+			var seats []struct {
+				Seat_id     int    `db:"seat_id"`
+				Seat_number int    `db:"seat_number"`
+				Status      string `db:"status"`
+				Held        bool   `db:"held"`
+			}
+			err = tx.SelectContext(ctx, &seats, lockSeatsToReseat, br.Show_id, pq.Int64Array(br.Seat_numbers), br.Booking_id)
+			if err != nil {
+				return err
+			}
+			picked := make(map[int64]bool, len(br.Seat_numbers))
+			for _, n := range br.Seat_numbers {
+				picked[n] = true
+			}
+			seat_ids := make(pq.Int64Array, 0, len(br.Seat_numbers))
+			for _, st := range seats {
+				if !picked[int64(st.Seat_number)] {
+					continue
+				}
+				if st.Status != SeatAvailable && !(st.Held && st.Status == SeatBooked) {
+					return ErrSeatUnavailable
+				}
+				seat_ids = append(seat_ids, int64(st.Seat_id))
+			}
+			if len(seat_ids) != len(br.Seat_numbers) {
+				return ErrSeatNotFound
+			}
+
+			if _, err = tx.ExecContext(ctx, releaseBookedSeats, br.Booking_id, SeatAvailable, SeatBooked); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, removeBookingSeats, br.Booking_id); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, setSeatsStatus, seat_ids, SeatBooked); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, addBookingSeats, br.Booking_id, seat_ids); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, setBookingStatus, br.Booking_id, BookingConfirmed); err != nil {
+				return err
+			}
+
+			offers, err = offerReleasedSeats(ctx, tx, br.Show_id, br.Hold_until)
+			return err
+		})
+	})
+	return
+}
+
+// settleCancelledBooking refunds a cancelled booking, gives back its coupon
+// use, records its cancellation event, reverses its loyalty points and queues
+// the customer a notification of the given kind.
+func settleCancelledBooking(ctx context.Context, tx *sqlx.Tx, c *CancelledBooking, show_id int, reason string, to_wallet bool,
+	points_expire_at time.Time, notification string) (err error) {
+	if err = refundBooking(ctx, tx, c, reason, to_wallet); err != nil {
+		return
+	}
+	if err = releaseCoupon(ctx, tx, c.Booking_id); err != nil {
+		return
+	}
+
+	err = addEvent(ctx, tx, BookingCancelledEvent{
+		Booking_id:    c.Booking_id,
+		Show_id:       show_id,
+		User_id:       c.User_id,
+		Seats:         c.Seats,
+		Reason:        reason,
+		Refund_amount: c.Amount,
+		Refund_to:     c.Refund_to,
+	})
+	if err != nil || c.User_id == 0 {
+		return
+	}
+	c.Points_reversed, c.Points_refunded, err = reverseLoyaltyOfBooking(ctx, tx, c.User_id, c.Booking_id, points_expire_at)
+	if err != nil {
+		return
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"booking_id":      c.Booking_id,
+		"show_id":         show_id,
+		"seats":           c.Seats,
+		"refund_amount":   c.Amount,
+		"refund_to":       c.Refund_to,
+		"points_reversed": c.Points_reversed,
+		"points_refunded": c.Points_refunded,
+		"reason":          reason,
+	})
+	if err != nil {
+		return
+	}
+	return tx.GetContext(ctx, &c.Notification_id, addNotificationQuery, c.User_id, notification, payload)
+}
+
+// refundBooking refunds c.Amount of a booking. Bookings paid from the
+// ledger, or all of them when to_wallet is set, are refunded to the wallet
+// straight away; other refunds are left Pending for the payments side.
+func refundBooking(ctx context.Context, tx *sqlx.Tx, c *CancelledBooking, reason string, to_wallet bool) (err error) {
+	if c.Amount <= 0 {
+		return
+	}
+	c.Refund_status, c.Refund_to = RefundPending, RefundToOriginal
+	paidFromLedger := c.Payment_method == PaymentWallet || c.Payment_method == PaymentGiftCard
+	if c.User_id != 0 && (paidFromLedger || to_wallet) {
+		if err = refundToWallet(ctx, tx, c.User_id, c.Booking_id, c.Amount, reason); err != nil {
+			return
+		}
+		c.Refund_status, c.Refund_to = RefundCompleted, RefundToWallet
+	}
+	return tx.GetContext(ctx, &c.Refund_id, addRefundQuery, c.Booking_id, c.User_id, c.Amount, c.Refund_status, reason, c.Refund_to)
+}
+
+func (s *store) GetBookingsOfUser(ctx context.Context, user_id int, when string) (bookings []BookingDetail, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &bookings, getBookingsOfUser, user_id, when)
+	})
+	return
+}
+
+func (s *store) GetBookingByID(ctx context.Context, booking_id int) (b BookingDetail, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &b, getBookingByID, booking_id)
+	})
+
+	if err == sql.ErrNoRows {
+		return b, ErrBookingNotFound
+	}
+	return
+}
+
+// CheckInBooking marks a confirmed booking as checked in. It only succeeds
+// once per booking; later attempts get ErrAlreadyCheckedIn.
+func (s *store) CheckInBooking(ctx context.Context, booking_id int, staff_id int) (checked_in_at time.Time, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &checked_in_at, checkInBookingQuery, booking_id, staff_id, BookingConfirmed)
+	})
+
+	if err == sql.ErrNoRows {
+		return checked_in_at, ErrAlreadyCheckedIn
+	}
+	return
+}
+
+func (s *store) GetAdmissionsOfShow(ctx context.Context, show_id int) (a Admissions, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &a, getAdmissionsOfShow, show_id, BookingConfirmed)
+	})
+	return
+}
+
+// BookSeats books the given seats of a show in one go. Seats are locked
+// while booking so two customers can't end up with the same seat; if any of
+// them is taken nothing is booked.
+func (s *store) BookSeats(ctx context.Context, nb NewBooking) (booked BookedSeats, err error) {
+
+	err = WithTimeout(ctx, bulkTimeout, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var status string
+			err := tx.GetContext(ctx, &status, lockShowForBooking, nb.Show_id)
+			if err == sql.ErrNoRows {
+				return ErrShowNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if status != ShowScheduled {
+				return ErrShowNotBookable
+			}
+
+			var seats []Seat
+			if err = tx.SelectContext(ctx, &seats, lockSeatsQuery, nb.Show_id, pq.Int64Array(nb.Seat_numbers)); err != nil {
+				return err
+			}
+			if len(seats) != len(nb.Seat_numbers) {
+				return ErrSeatNotFound
+			}
+
+			// seats held off the waitlist can only go to the customer they are
+			// held for
+			offer_id := 0
+			if nb.User_id != 0 {
+				if offer_id, err = claimWaitlistOffer(ctx, tx, nb.Show_id, nb.User_id); err != nil {
+					return err
+				}
+			}
+
+			seat_ids := make(pq.Int64Array, 0, len(seats))
+			charge := Charge{Currency: DefaultCurrency}
+			for _, st := range seats {
+				held := st.Status == SeatHeld && offer_id != 0 && st.Held_for == offer_id
+				if st.Status != SeatAvailable && !held {
+					return ErrSeatUnavailable
+				}
+				seat_ids = append(seat_ids, int64(st.Seat_id))
+				charge.Amount += st.Price
+				charge.Lines = append(charge.Lines, LineItem{LineTicket, "Ticket", 1, st.Price, st.Price})
+			}
+			if nb.Price != nil {
+				if charge, err = nb.Price(seats); err != nil {
+					return err
+				}
+			}
+
+			if _, err = tx.ExecContext(ctx, setSeatsStatus, seat_ids, SeatBooked); err != nil {
+				return err
+			}
+
+			var booking_id int
+			err = tx.GetContext(ctx, &booking_id, addBookingQuery, BookingConfirmed, nb.User_id, nb.Show_id, charge.Amount,
+				nb.Channel, nb.Customer_phone, nb.Sold_by, charge.Coupon_id, charge.Discount, charge.Fee, charge.Tax, charge.Currency)
+			if err != nil {
+				return err
+			}
+			for _, l := range charge.Lines {
+				if _, err = tx.ExecContext(ctx, addLineItemQuery, booking_id, l.Kind, l.Label, l.Quantity, l.Unit_amount, l.Amount); err != nil {
+					return err
+				}
+			}
+			if _, err = tx.ExecContext(ctx, addBookingSeats, booking_id, seat_ids); err != nil {
+				return err
+			}
+			if charge.Coupon_id != 0 {
+				if err = redeemCoupon(ctx, tx, charge.Coupon_id, nb.User_id, booking_id, charge.Discount); err != nil {
+					return err
+				}
+			}
+
+			booked = BookedSeats{
+				Booking_id: booking_id,
+				Charge:     charge,
+				Seats:      seats,
+			}
+			if charge.Points_redeemed > 0 {
+				if err = redeemLoyaltyPoints(ctx, tx, nb.User_id, booking_id, charge.Points_redeemed); err != nil {
+					return err
+				}
+			}
+			if charge.Points_earned > 0 {
+				if err = earnLoyaltyPoints(ctx, tx, nb.User_id, booking_id, charge.Points_earned, charge.Points_expire_at); err != nil {
+					return err
+				}
+			}
+			if offer_id != 0 {
+				// held seats the customer didn't take go back on sale
+				if _, err = tx.ExecContext(ctx, setWaitlistStatus, offer_id, WaitlistClaimed); err != nil {
+					return err
+				}
+				if _, err = tx.ExecContext(ctx, releaseHeldSeats, pq.Int64Array{int64(offer_id)}, SeatAvailable, SeatHeld); err != nil {
+					return err
+				}
+			}
+			if nb.Fnb != nil {
+				if booked.Fnb_order_id, err = addFnbOrder(ctx, tx, booking_id, nb.Show_id, *nb.Fnb, charge.Fnb_tax); err != nil {
+					return err
+				}
+			}
+			err = addEvent(ctx, tx, SeatsBookedEvent{
+				Booking_id:     booking_id,
+				Show_id:        nb.Show_id,
+				User_id:        nb.User_id,
+				Seats:          nb.Seat_numbers,
+				Channel:        nb.Channel,
+				Amount:         charge.Amount,
+				Currency:       charge.Currency,
+				Payment_method: nb.Payment_method,
+			})
+			if err != nil {
+				return err
+			}
+			if nb.User_id != 0 {
+				_, err = queueNotification(ctx, tx, nb.User_id, NotificationBookingConfirmed, map[string]interface{}{
+					"booking_id": booking_id,
+					"show_id":    nb.Show_id,
+					"seats":      nb.Seat_numbers,
+					"amount":     charge.Amount,
+					"currency":   charge.Currency,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			if nb.Payment_method == "" {
+				return nil
+			}
+			if nb.Payment_method == PaymentWallet || nb.Payment_method == PaymentGiftCard {
+				if err = payFromLedger(ctx, tx, nb, booking_id, charge.Amount); err != nil {
+					return err
+				}
+			}
+			return tx.GetContext(ctx, &booked.Payment_id, addPaymentQuery, booking_id, nb.Payment_method, charge.Amount, PaymentCaptured, nb.Sold_by, nb.Shift_id,
+				charge.Currency)
+		})
+	})
+	return
+}
+
+func (s *store) GetSeatsOfShow(ctx context.Context, show_id int) (seats []Seat, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &seats, getSeatsOfShow, show_id)
+	})
+	return
+}
+
+func (s *store) GetLineItemsOfBooking(ctx context.Context, booking_id int) (lines []LineItem, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &lines, getLineItemsOfBooking, booking_id)
+	})
+	return
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattes/migrate"
+)
+
+// testStore connects to the scratch database in TEST_DATABASE_URL and
+// migrates it, tests that need postgres are skipped without one.
+func testStore(t *testing.T) Storer {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL isn't set")
+	}
+
+	m, err := migrate.New("file://../migrations", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Up(); err != nil && err != migrate.ErrNoChange {
+		t.Fatal(err)
+	}
+
+	d, err := sqlx.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return NewStorer(d)
+}
+
+// addTestShow adds a show two days out on a 10 seat screen, along with a
+// 5 seat screen of the same multiplex and a customer to book it.
+func addTestShow(t *testing.T, s Storer) (sh Show, small int, user_id int) {
+	ctx := context.Background()
+	run := time.Now().UnixNano()
+
+	location_id, err := s.AddLocation(ctx, Location{City: "Pune", State: "Maharashtra", Pincode: 411001})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiplex_id, err := s.AddMultiplex(ctx, Multiplexe{Name: fmt.Sprintf("Cineplex %d", run), Contact: "020", Total_screens: 2,
+		Locality: "Camp", Location_id: int(location_id), Opens_at: "00:00", Closes_at: "23:59", Time_zone: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	big, err := s.AddScreen(ctx, Screen{Screen_number: 1, Total_seats: 10, Multiplex_id: int(multiplex_id)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	small_id, err := s.AddScreen(ctx, Screen{Screen_number: 2, Total_seats: 5, Multiplex_id: int(multiplex_id)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	movie_id, err := s.AddMovie(ctx, Movie{Title: fmt.Sprintf("Arrival %d", run), Duration: 120, Release_date: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.CreateUser(ctx, User{Name: "Asha", Email: fmt.Sprintf("asha%d@example.com", run), Password: "x", Role: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+	sh = Show{
+		Show_date:    time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC),
+		Start_time:   start,
+		End_time:     start.Add(2 * time.Hour),
+		Screen_id:    int(big),
+		Movie_id:     int(movie_id),
+		Multiplex_id: int(multiplex_id),
+	}
+	show_id, err := s.AddShow(ctx, sh, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh.Show_id = int(show_id)
+	return sh, int(small_id), int(user)
+}
+
+func TestCancelShowAfterReschedule(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	sh, small, user_id := addTestShow(t, s)
+
+	booked, err := s.BookSeats(ctx, NewBooking{Show_id: sh.Show_id, Seat_numbers: []int64{9, 10}, User_id: user_id, Channel: ChannelOnline})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// seats 9 and 10 aren't on the smaller screen
+	sh.Screen_id = small
+	migrated, err := s.RescheduleShow(ctx, sh, 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated) != 1 || migrated[0].Status != BookingActionRequired {
+		t.Fatalf("migrated = %+v, want the booking to need action", migrated)
+	}
+
+	cancelled, err := s.CancelShow(ctx, ShowCancel{Show_id: sh.Show_id, Reason: "projector fault"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cancelled) != 1 || cancelled[0].Booking_id != booked.Booking_id {
+		t.Fatalf("cancelled = %+v, want booking %v", cancelled, booked.Booking_id)
+	}
+	c := cancelled[0]
+	if c.Amount != booked.Charge.Amount || c.Refund_id == 0 || c.Notification_id == 0 {
+		t.Fatalf("cancelled = %+v, want %v refunded and the customer notified", c, booked.Charge.Amount)
+	}
+
+	d, err := s.GetBookingByID(ctx, booked.Booking_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != BookingCancelled {
+		t.Fatalf("status = %v, want %v", d.Status, BookingCancelled)
+	}
+}
+
+func TestCancelBookingReleasesCoupon(t *testing.T) {
+	s := testStore(t)
+	ctx := context.Background()
+	sh, _, user_id := addTestShow(t, s)
+
+	once := 1
+	code := fmt.Sprintf("ONCE%d", time.Now().UnixNano())
+	coupon_id, err := s.AddCoupon(ctx, Coupon{Code: code, Kind: CouponFlat, Value: 5000, Per_user_limit: &once, Total_limit: &once})
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := func(seat int64) (BookedSeats, error) {
+		return s.BookSeats(ctx, NewBooking{Show_id: sh.Show_id, Seat_numbers: []int64{seat}, User_id: user_id, Channel: ChannelOnline,
+			Price: func(seats []Seat) (c Charge, err error) {
+				return Charge{Amount: seats[0].Price - 5000, Discount: 5000, Currency: DefaultCurrency, Coupon_id: int(coupon_id)}, nil
+			}})
+	}
+
+	booked, err := book(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = book(2); err != ErrCouponExhausted {
+		t.Fatalf("second use: err = %v, want %v", err, ErrCouponExhausted)
+	}
+
+	if _, _, err = s.CancelBooking(ctx, BookingCancel{Booking_id: booked.Booking_id, User_id: user_id, Reason: "plans changed"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.GetCouponByCode(ctx, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used, err := s.CountCouponUses(ctx, int(coupon_id), user_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Redeemed_count != 0 || used != 0 {
+		t.Fatalf("redeemed = %v, used by the customer = %v, want both given back", c.Redeemed_count, used)
+	}
+
+	if _, err = book(2); err != nil {
+		t.Fatalf("use after cancelling: %v", err)
+	}
+}
@@ -6,37 +6,48 @@ import (
 	"log"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
 
 const (
-	CreateUserQuery      = `INSERT INTO USERS(name, password, email, phone_number, role) VALUES ($1, $2, $3, $4, $5 ) returning user_id`
+	CreateUserQuery      = `INSERT INTO USERS(name, password, email, phone_number, role, multiplex_id) VALUES ($1, $2, $3, $4, $5, $6) returning user_id`
 	getUserByEmail       = `SELECT * FROM users WHERE email=$1`
 	AddMovieQuery        = `INSERT INTO MOVIES(title, language, release_date, genre, duration) VALUES ($1, $2, $3, $4, $5) returning movie_id`
 	getMultiplexesByName = `Select * FROM multiplexes WHERE name=$1`
-	AddScreenQuery       = `INSERT INTO SCREENS (screen_number, total_seats, sound_system, screen_dimension, multiplex_id) VALUES ($1, $2, $3, $4, $5) returning screen_id`
+	AddScreenQuery       = `INSERT INTO SCREENS (screen_number, total_seats, sound_system, screen_dimension, multiplex_id, trailer_buffer_mins, cleaning_buffer_mins) VALUES ($1, $2, $3, $4, $5, $6, $7) returning screen_id`
 	AddLocationQuery     = `INSERT INTO LOCATIONS (city, state, pincode) VALUES ($1, $2, $3) returning location_id`
-	AddMultiplexQuery    = `INSERT INTO MULTIPLEXES (name, contact, total_screens, locality, location_id) VALUES ($1, $2, $3, $4, $5) returning multiplex_id`
+	AddMultiplexQuery    = `INSERT INTO MULTIPLEXES (name, contact, total_screens, locality, location_id, opens_at, closes_at, time_zone) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) returning multiplex_id`
 	getLocationIdByCity  = `SELECT location_id from locations WHERE city=$1`
-	getMultiplexeByID    = `Select multiplex_id FROM multiplexes WHERE multiplex_id=$1`
-	AddShowQuery         = `INSERT INTO shows (show_date, start_time, end_time, screen_id, movie_id, multiplex_id)
+	getMultiplexeByID    = `Select multiplex_id, name, contact, total_screens, locality, location_id,
+	to_char(opens_at, 'HH24:MI') AS opens_at, to_char(closes_at, 'HH24:MI') AS closes_at, time_zone
+	FROM multiplexes WHERE multiplex_id=$1`
+	// A screen is occupied from the start of a show until its cleaning buffer
+	// has elapsed, so $7 (the screen's cleaning buffer in minutes) is added to
+	// both the new show and the existing ones before checking for overlap.
+	AddShowQuery = `INSERT INTO shows (show_date, start_time, end_time, screen_id, movie_id, multiplex_id)
 	SELECT $1, $2, $3, $4, $5, $6
 	WHERE NOT EXISTS (
 		SELECT 1 FROM shows
-		WHERE show_date = $1
-		AND screen_id = $4
-		AND (
-			($2 BETWEEN start_time AND end_time)
-			OR ($3 BETWEEN start_time AND end_time)
-			OR (start_time BETWEEN $2 AND $3)
-			OR (end_time BETWEEN $2 AND $3)
-		)
+		WHERE screen_id = $4
+		AND status <> 'Cancelled'
+		AND start_time < $3::timestamptz + make_interval(mins => $7)
+		AND $2::timestamptz < end_time + make_interval(mins => $7)
 	)
 	RETURNING show_id;
 	`
 	getScreenByNumberAndMultiplexID = `Select * From screens WHERE screen_number=$1 and multiplex_id=$2`
-	getMovieByTitle                 = `Select movie_id From MOVIES where title=$1`
-	AddSeatsQuery                   = `INSERT INTO SEATS (seat_number, price, show_id, status) VALUES ($1, $2, $3, $4)`
+	getMovieByTitle                 = `Select movie_id, title, COALESCE(duration, 0) AS duration From MOVIES where title=$1`
+	AddSeatsQuery                   = `INSERT INTO SEATS (seat_number, price, base_price, show_id, status) VALUES ($1, $2, $2, $3, $4)`
+	getShowsStartingBetween         = `SELECT sh.show_id, sh.show_date, sh.start_time, sh.end_time, sh.status, sc.screen_number,
+	mv.title AS movie, mx.multiplex_id, mx.name AS multiplex, mx.time_zone
+	FROM shows sh
+	JOIN screens sc ON sc.screen_id = sh.screen_id
+	JOIN movies mv ON mv.movie_id = sh.movie_id
+	JOIN multiplexes mx ON mx.multiplex_id = sh.multiplex_id
+	WHERE sh.start_time >= $1 AND sh.start_time < $2
+	AND ($3 = 0 OR sh.multiplex_id = $3)
+	ORDER BY sh.start_time`
 )
 
 type User struct {
@@ -46,6 +57,8 @@ type User struct {
 	Password    string `json:"-" db:"password"`
 	PhoneNumber string `json:"phone_number" db:"phone_number"`
 	Role        string `json:"role" db:"role"`
+	// where a staff member works
+	Multiplex_id *int `json:"multiplex_id,omitempty" db:"multiplex_id"`
 }
 
 type Movie struct {
@@ -55,7 +68,7 @@ type Movie struct {
 	Poster       []byte    `json:"poster" db:"poster"`
 	Release_date time.Time `json:"release_date" db:"release_date"`
 	Genre        string    `json:"genre" db:"genre"`
-	Duration     float64   `json:"duration" db:"duration"`
+	Duration     int       `json:"duration" db:"duration"`
 }
 
 type Location struct {
@@ -72,15 +85,20 @@ type Multiplexe struct {
 	Total_screens int    `json:"total_screens" db:"total_screens"`
 	Locality      string `json:"locality" db:"locality"`
 	Location_id   int    `json:"location_id" db:"location_id"`
+	Opens_at      string `json:"opens_at" db:"opens_at"`
+	Closes_at     string `json:"closes_at" db:"closes_at"`
+	Time_zone     string `json:"time_zone" db:"time_zone"`
 }
 
 type Screen struct {
-	Screen_id        int    `json:"screen_id" db:"screen_id"`
-	Screen_number    int    `json:"screen_number" db:"screen_number"`
-	Total_seats      int    `json:"total_seats" db:"total_seats"`
-	Sound_system     string `json:"sound_system" db:"sound_system"`
-	Screen_dimension string `json:"screen_dimension" db:"screen_dimension"`
-	Multiplex_id     int    `json:"multiplex_id" db:"multiplex_id"`
+	Screen_id            int    `json:"screen_id" db:"screen_id"`
+	Screen_number        int    `json:"screen_number" db:"screen_number"`
+	Total_seats          int    `json:"total_seats" db:"total_seats"`
+	Sound_system         string `json:"sound_system" db:"sound_system"`
+	Screen_dimension     string `json:"screen_dimension" db:"screen_dimension"`
+	Multiplex_id         int    `json:"multiplex_id" db:"multiplex_id"`
+	Trailer_buffer_mins  int    `json:"trailer_buffer_mins" db:"trailer_buffer_mins"`
+	Cleaning_buffer_mins int    `json:"cleaning_buffer_mins" db:"cleaning_buffer_mins"`
 }
 
 type Show struct {
@@ -91,48 +109,50 @@ type Show struct {
 	Screen_id    int       `json:"screen_id" db:"screen_id"`
 	Movie_id     int       `json:"movie_id" db:"movie_id"`
 	Multiplex_id int       `json:"multiplex_id" db:"multiplex_id"`
+	Status       string    `json:"status" db:"status"`
+}
+
+type ShowDetail struct {
+	Show_id       int       `json:"show_id" db:"show_id"`
+	Show_date     time.Time `json:"show_date" db:"show_date"`
+	Start_time    time.Time `json:"start_time" db:"start_time"`
+	End_time      time.Time `json:"end_time" db:"end_time"`
+	Status        string    `json:"status" db:"status"`
+	Screen_number int       `json:"screen_number" db:"screen_number"`
+	Movie         string    `json:"movie" db:"movie"`
+	Multiplex_id  int       `json:"multiplex_id" db:"multiplex_id"`
+	Multiplex     string    `json:"multiplex" db:"multiplex"`
+	Time_zone     string    `json:"time_zone" db:"time_zone"`
 }
 
 type Seat struct {
-	Seat_id int    `json:"seat_id" db:"seat_id"`
-	Price   int    `json:"price" db:"price"`
-	Status  string `json:"status" db:"status"`
-	Show_id int    `json:"show_id" db:"show_id"`
+	Seat_id     int    `json:"seat_id" db:"seat_id"`
+	Seat_number int    `json:"seat_number" db:"seat_number"`
+	Price       int    `json:"price" db:"price"`
+	Base_price  int    `json:"-" db:"base_price"` // what pricing rules adjust
+	Status      string `json:"status" db:"status"`
+	Show_id     int    `json:"show_id" db:"show_id"`
+	Held_for    int    `json:"-" db:"held_for"` // waitlist entry the seat is held for
 }
 
 type Booking struct {
-	Booking_id int    `json:"booking_id" db:"booking_id"`
-	Price      int    `json:"price" db:"price"`
-	Status     string `json:"status" db:"status"`
-	User_id    int    `json:"user_id" db:"user_id"`
-	Seat_id    int    `json:"seat_id" db:"seat_id"`
-	Show_id    int    `json:"show_id" db:"show_id"`
+	Booking_id int       `json:"booking_id" db:"booking_id"`
+	Amount     int       `json:"amount" db:"amount"`
+	Status     string    `json:"status" db:"status"`
+	User_id    int       `json:"user_id" db:"user_id"`
+	Show_id    int       `json:"show_id" db:"show_id"`
+	Created_at time.Time `json:"created_at" db:"created_at"`
 }
 
 func (s *store) CreateUser(ctx context.Context, u User) (user_id uint, err error) {
-	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return
-	}
 
-	defer func() {
-		if err != nil {
-			e := tx.Rollback()
-			if e != nil {
-				err = errors.WithStack(e)
-				return
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			if err := tx.GetContext(ctx, &user_id, CreateUserQuery, u.Name, u.Password, u.Email, u.PhoneNumber, u.Role, u.Multiplex_id); err != nil {
+				return err
 			}
-		}
-		tx.Commit()
-	}()
-
-	ctxWithTx := newContext(ctx, tx)
-	err = WithDefaultTimeout(ctxWithTx, func(ctx context.Context) error {
-		if err := s.db.GetContext(ctx, &user_id, CreateUserQuery, u.Name, u.Password, u.Email, u.PhoneNumber, u.Role); err != nil {
-			return err
-		}
-		return nil
-
+			return addEvent(ctx, tx, UserCreatedEvent{User_id: int(user_id), Name: u.Name, Role: u.Role})
+		})
 	})
 	return
 }
@@ -213,7 +233,7 @@ func (s *store) AddScreen(ctx context.Context, sn Screen) (screen_id uint, err e
 
 	ctxWithTx := newContext(ctx, tx)
 	err = WithDefaultTimeout(ctxWithTx, func(ctx context.Context) error {
-		if err := s.db.GetContext(ctx, &screen_id, AddScreenQuery, sn.Screen_number, sn.Total_seats, sn.Sound_system, sn.Screen_dimension, sn.Multiplex_id); err != nil {
+		if err := s.db.GetContext(ctx, &screen_id, AddScreenQuery, sn.Screen_number, sn.Total_seats, sn.Sound_system, sn.Screen_dimension, sn.Multiplex_id, sn.Trailer_buffer_mins, sn.Cleaning_buffer_mins); err != nil {
 			return err
 		}
 		return nil
@@ -274,7 +294,7 @@ func (s *store) AddMultiplex(ctx context.Context, m Multiplexe) (muliplex_id uin
 
 	ctxWithTx := newContext(ctx, tx)
 	err = WithDefaultTimeout(ctxWithTx, func(ctx context.Context) error {
-		if err := s.db.GetContext(ctx, &muliplex_id, AddMultiplexQuery, m.Name, m.Contact, m.Total_screens, m.Locality, m.Location_id); err != nil {
+		if err := s.db.GetContext(ctx, &muliplex_id, AddMultiplexQuery, m.Name, m.Contact, m.Total_screens, m.Locality, m.Location_id, m.Opens_at, m.Closes_at, m.Time_zone); err != nil {
 			return err
 		}
 		return nil
@@ -297,54 +317,42 @@ func (s *store) GetLocationIdByCity(ctx context.Context, city string) (location_
 	return
 }
 
-func (s *store) GetMultiplexeByID(ctx context.Context, id int) (m_id uint, err error) {
+func (s *store) GetMultiplexeByID(ctx context.Context, id int) (m Multiplexe, err error) {
 
 	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
-		err = s.db.GetContext(ctx, &m_id, getMultiplexeByID, id)
+		err = s.db.GetContext(ctx, &m, getMultiplexeByID, id)
 		return err
 	})
 
 	if err == sql.ErrNoRows {
-		return m_id, errors.New("multiplex doesn't exist.")
+		return m, errors.New("multiplex doesn't exist.")
 	}
 	return
 
 }
 
-func (s *store) AddShow(ctx context.Context, sh Show) (show_id uint, err error) {
-
-	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return
-	}
-	log.Println(sh)
+// AddShow adds a show with total_seats seats, unless it overlaps another
+// show on the screen, in which case sql.ErrNoRows is returned.
+func (s *store) AddShow(ctx context.Context, sh Show, cleaning_buffer_mins int, total_seats int) (show_id uint, err error) {
 
-	defer func() {
-		if err != nil {
-			e := tx.Rollback()
-			if e != nil {
-				err = errors.WithStack(e)
-				return
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			err := tx.GetContext(ctx, &show_id, AddShowQuery, sh.Show_date, sh.Start_time, sh.End_time, sh.Screen_id, sh.Movie_id, sh.Multiplex_id, cleaning_buffer_mins)
+			if err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, addSeatRange, show_id, SeatAvailable, 1, total_seats, DefaultSeatPrice); err != nil {
+				return err
 			}
-		}
-		tx.Commit()
-	}()
-	// log.Println(sh.Start_time, sh.End_time)
-
-	ctxWithTx := newContext(ctx, tx)
-	err = WithDefaultTimeout(ctxWithTx, func(ctx context.Context) error {
-		err := s.db.GetContext(ctx, &show_id, AddShowQuery, sh.Show_date, sh.Start_time, sh.End_time, sh.Screen_id, sh.Movie_id, sh.Multiplex_id)
-
-		if err != nil {
-			log.Println("error in add show:", err)
-			return err
-		}
-		return nil
 
+			d, err := getShowDetail(ctx, tx, int(show_id))
+			if err != nil {
+				return err
+			}
+			return addEvent(ctx, tx, ShowAddedEvent{d})
+		})
 	})
-
 	return
-
 }
 
 func (s *store) GetScreenByNumberAndMultiplexID(ctx context.Context, s_no int, m_id int) (sn Screen, err error) {
@@ -361,15 +369,15 @@ func (s *store) GetScreenByNumberAndMultiplexID(ctx context.Context, s_no int, m
 	return
 }
 
-func (s *store) GetMovieByTitle(ctx context.Context, title string) (movie_id uint, err error) {
+func (s *store) GetMovieByTitle(ctx context.Context, title string) (m Movie, err error) {
 
 	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
-		err = s.db.GetContext(ctx, &movie_id, getMovieByTitle, title)
+		err = s.db.GetContext(ctx, &m, getMovieByTitle, title)
 		return err
 	})
 
 	if err == sql.ErrNoRows {
-		return movie_id, errors.New("movie doesn't exist")
+		return m, errors.New("movie doesn't exist")
 	}
 	return
 
@@ -379,9 +387,17 @@ func (s *store) AddSeats(ctx context.Context, num_of_seats int, show_id int) (er
 
 	for i := 0; i < num_of_seats; i++ {
 		err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
-			_, err = s.db.ExecContext(ctx, AddSeatsQuery, i+1, 300, show_id, "Available")
+			_, err = s.db.ExecContext(ctx, AddSeatsQuery, i+1, DefaultSeatPrice, show_id, SeatAvailable)
 			return err
 		})
 	}
 	return
 }
+
+func (s *store) GetShowsStartingBetween(ctx context.Context, from time.Time, to time.Time, multiplex_id int) (shows []ShowDetail, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &shows, getShowsStartingBetween, from, to, multiplex_id)
+	})
+	return
+}
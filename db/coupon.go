@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	CouponPercent = "percent"
+	CouponFlat    = "flat"
+)
+
+var (
+	ErrCouponNotFound  = errors.New("coupon doesn't exist")
+	ErrCouponExists    = errors.New("coupon code already exists")
+	ErrCouponExhausted = errors.New("coupon has been fully redeemed")
+	ErrCouponUserLimit = errors.New("coupon already used the maximum number of times")
+)
+
+const (
+	couponColumns = `coupon_id, code, kind, value, max_discount, min_tickets, movie_ids, multiplex_ids, days_of_week,
+	per_user_limit, total_limit, redeemed_count, valid_from, expires_at, active, created_at`
+	addCouponQuery = `INSERT INTO coupons (code, kind, value, max_discount, min_tickets, movie_ids, multiplex_ids, days_of_week,
+	per_user_limit, total_limit, valid_from, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) returning coupon_id`
+	getCouponByCode    = `SELECT ` + couponColumns + ` FROM coupons WHERE code=$1`
+	getCoupons         = `SELECT ` + couponColumns + ` FROM coupons ORDER BY coupon_id DESC`
+	deactivateCoupon   = `UPDATE coupons SET active=false WHERE coupon_id=$1`
+	countUserCouponUse = `SELECT count(*) FROM coupon_redemptions WHERE coupon_id=$1 AND user_id=$2`
+	// taking the global slot locks the coupon row, which also serialises the
+	// per user check that follows
+	takeCouponSlot = `UPDATE coupons SET redeemed_count = redeemed_count + 1
+	WHERE coupon_id=$1 AND active AND (total_limit IS NULL OR redeemed_count < total_limit)
+	RETURNING per_user_limit`
+	addRedemptionQuery = `INSERT INTO coupon_redemptions (coupon_id, user_id, booking_id, discount) VALUES ($1, NULLIF($2, 0), $3, $4)`
+	// a cancelled booking gives its use of the coupon back, to the customer
+	// and to the global limit
+	releaseRedemptionQuery = `WITH r AS (
+		DELETE FROM coupon_redemptions WHERE booking_id=$1 RETURNING coupon_id
+	)
+	UPDATE coupons c SET redeemed_count = c.redeemed_count - 1
+	FROM r WHERE c.coupon_id = r.coupon_id AND c.redeemed_count > 0`
+)
+
+type Coupon struct {
+	Coupon_id      int           `db:"coupon_id"`
+	Code           string        `db:"code"`
+	Kind           string        `db:"kind"`
+	Value          int           `db:"value"`
+	Max_discount   *int          `db:"max_discount"`
+	Min_tickets    int           `db:"min_tickets"`
+	Movie_ids      pq.Int64Array `db:"movie_ids"`
+	Multiplex_ids  pq.Int64Array `db:"multiplex_ids"`
+	Days_of_week   pq.Int64Array `db:"days_of_week"`
+	Per_user_limit *int          `db:"per_user_limit"`
+	Total_limit    *int          `db:"total_limit"`
+	Redeemed_count int           `db:"redeemed_count"`
+	Valid_from     *time.Time    `db:"valid_from"`
+	Expires_at     *time.Time    `db:"expires_at"`
+	Active         bool          `db:"active"`
+	Created_at     time.Time     `db:"created_at"`
+}
+
+func (s *store) AddCoupon(ctx context.Context, c Coupon) (coupon_id uint, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &coupon_id, addCouponQuery, c.Code, c.Kind, c.Value, c.Max_discount, c.Min_tickets,
+			c.Movie_ids, c.Multiplex_ids, c.Days_of_week, c.Per_user_limit, c.Total_limit, c.Valid_from, c.Expires_at)
+	})
+
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return coupon_id, ErrCouponExists
+	}
+	return
+}
+
+func (s *store) GetCouponByCode(ctx context.Context, code string) (c Coupon, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &c, getCouponByCode, code)
+	})
+
+	if err == sql.ErrNoRows {
+		return c, ErrCouponNotFound
+	}
+	return
+}
+
+func (s *store) GetCoupons(ctx context.Context) (coupons []Coupon, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &coupons, getCoupons)
+	})
+	return
+}
+
+func (s *store) DeactivateCoupon(ctx context.Context, coupon_id int) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, deactivateCoupon, coupon_id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrCouponNotFound
+		}
+		return nil
+	})
+	return
+}
+
+// redeemCoupon records the use of a coupon within the booking transaction,
+// enforcing both the global and the per user limit.
+func redeemCoupon(ctx context.Context, tx *sqlx.Tx, coupon_id int, user_id int, booking_id int, discount int) (err error) {
+	var per_user_limit *int
+	err = tx.GetContext(ctx, &per_user_limit, takeCouponSlot, coupon_id)
+	if err == sql.ErrNoRows {
+		return ErrCouponExhausted
+	}
+	if err != nil {
+		return
+	}
+
+	if per_user_limit != nil && user_id != 0 {
+		var used int
+		if err = tx.GetContext(ctx, &used, countUserCouponUse, coupon_id, user_id); err != nil {
+			return
+		}
+		if used >= *per_user_limit {
+			return ErrCouponUserLimit
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, addRedemptionQuery, coupon_id, user_id, booking_id, discount)
+	return
+}
+
+// releaseCoupon undoes redeemCoupon for a booking being cancelled.
+func releaseCoupon(ctx context.Context, tx *sqlx.Tx, booking_id int) (err error) {
+	_, err = tx.ExecContext(ctx, releaseRedemptionQuery, booking_id)
+	return
+}
+
+func (s *store) CountCouponUses(ctx context.Context, coupon_id int, user_id int) (used int, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &used, countUserCouponUse, coupon_id, user_id)
+	})
+	return
+}
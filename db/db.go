@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 )
 
 type ctxKey int
@@ -12,6 +14,7 @@ type ctxKey int
 const (
 	dbKey          ctxKey = 0
 	defaultTimeout        = 1 * time.Second
+	bulkTimeout           = 10 * time.Second
 )
 
 type Storer interface {
@@ -20,14 +23,114 @@ type Storer interface {
 	AddMovie(ctx context.Context, m Movie) (movie_id uint, err error)
 	AddScreen(ctx context.Context, m Screen) (screen_id uint, err error)
 	GetMultiplexesByName(ctx context.Context, name string) (m Multiplexe, err error)
-	GetMultiplexeByID(ctx context.Context, id int) (m_id uint, err error)
+	GetMultiplexeByID(ctx context.Context, id int) (m Multiplexe, err error)
 	AddMultiplex(ctx context.Context, m Multiplexe) (multiplex_id uint, err error)
 	AddLocation(ctx context.Context, l Location) (location_id uint, err error)
 	GetLocationIdByCity(ctx context.Context, city string) (location_id uint, err error)
-	AddShow(ctx context.Context, s Show) (show_id uint, err error)
+	AddShow(ctx context.Context, s Show, cleaning_buffer_mins int, total_seats int) (show_id uint, err error)
 	GetScreenByNumberAndMultiplexID(ctx context.Context, s_no int, m_id int) (s Screen, err error)
-	GetMovieByTitle(ctx context.Context, title string) (movie_id uint, err error)
+	GetMovieByTitle(ctx context.Context, title string) (m Movie, err error)
 	AddSeats(ctx context.Context, num_of_seats int, show_id int) (err error)
+	GetShowsStartingBetween(ctx context.Context, from time.Time, to time.Time, multiplex_id int) (shows []ShowDetail, err error)
+	CancelShow(ctx context.Context, sc ShowCancel) (cancelled []CancelledBooking, err error)
+	GetShowByID(ctx context.Context, show_id int) (sh Show, err error)
+	GetShowsOnSale(ctx context.Context) (shows []Show, err error)
+	GetScreenByID(ctx context.Context, screen_id int) (sn Screen, err error)
+	GetMovieByID(ctx context.Context, movie_id int) (m Movie, err error)
+	RescheduleShow(ctx context.Context, sh Show, cleaning_buffer_mins int, total_seats int) (migrated []MigratedBooking, err error)
+	UpdateUserProfile(ctx context.Context, user_id int, name string, phone_number string) (err error)
+	UpdateUserPassword(ctx context.Context, user_id int, password string) (err error)
+	SetStaffMultiplex(ctx context.Context, email string, multiplex_id int) (err error)
+	GetBookingsOfUser(ctx context.Context, user_id int, when string) (bookings []BookingDetail, err error)
+	GetBookingByID(ctx context.Context, booking_id int) (b BookingDetail, err error)
+	CheckInBooking(ctx context.Context, booking_id int, staff_id int) (checked_in_at time.Time, err error)
+	GetAdmissionsOfShow(ctx context.Context, show_id int) (a Admissions, err error)
+	BookSeats(ctx context.Context, nb NewBooking) (booked BookedSeats, err error)
+	GetSeatsOfShow(ctx context.Context, show_id int) (seats []Seat, err error)
+	AddCoupon(ctx context.Context, c Coupon) (coupon_id uint, err error)
+	GetCouponByCode(ctx context.Context, code string) (c Coupon, err error)
+	GetCoupons(ctx context.Context) (coupons []Coupon, err error)
+	DeactivateCoupon(ctx context.Context, coupon_id int) (err error)
+	CountCouponUses(ctx context.Context, coupon_id int, user_id int) (used int, err error)
+	GetTaxRates(ctx context.Context) (rates []TaxRate, err error)
+	GetTaxRatesOfMultiplex(ctx context.Context, multiplex_id int) (rates []TaxRate, err error)
+	SetTaxRates(ctx context.Context, state string, rates []TaxRate) (err error)
+	GetLineItemsOfBooking(ctx context.Context, booking_id int) (lines []LineItem, err error)
+	AddPricingRule(ctx context.Context, r PricingRule) (rule_id uint, err error)
+	GetPricingRules(ctx context.Context) (rules []PricingRule, err error)
+	GetPricingRulesOfShow(ctx context.Context, sh Show) (rules []PricingRule, err error)
+	DeactivatePricingRule(ctx context.Context, rule_id int) (err error)
+	GetOccupancyOfShow(ctx context.Context, show_id int) (o Occupancy, err error)
+	RepriceSeats(ctx context.Context, show_id int, r Reprice) (changed int, err error)
+	GetPriceChangesOfShow(ctx context.Context, show_id int) (changes []PriceChange, err error)
+	AddFnbItem(ctx context.Context, it FnbItem, parts []FnbComboItem) (item_id uint, err error)
+	GetFnbMenu(ctx context.Context, multiplex_id int) (items []FnbItem, parts []FnbComboItem, err error)
+	GetFnbItemByID(ctx context.Context, item_id int) (it FnbItem, err error)
+	SetFnbStock(ctx context.Context, item_id int, stock *int) (err error)
+	GetFnbOrdersOfMultiplex(ctx context.Context, multiplex_id int, statuses []string) (orders []FnbOrder, items []FnbOrderItem, err error)
+	GetFnbOrderByID(ctx context.Context, order_id int) (o FnbOrder, err error)
+	SetFnbOrderStatus(ctx context.Context, order_id int, from string, to string) (err error)
+	GetLoyaltyTiers(ctx context.Context) (tiers []LoyaltyTier, err error)
+	GetLoyaltyAccount(ctx context.Context, user_id int) (a LoyaltyAccount, err error)
+	ExpireLoyaltyPoints(ctx context.Context, limit int) (lots int, err error)
+	GetLoyaltyEntries(ctx context.Context, user_id int, limit int) (entries []LoyaltyEntry, err error)
+	CancelBooking(ctx context.Context, bc BookingCancel) (c CancelledBooking, offers []WaitlistOffer, err error)
+	ReseatBooking(ctx context.Context, br BookingReseat) (offers []WaitlistOffer, err error)
+	JoinWaitlist(ctx context.Context, show_id int, user_id int, seats int) (entry_id int, err error)
+	GetWaitlistEntry(ctx context.Context, show_id int, user_id int) (e WaitlistEntry, err error)
+	LeaveWaitlist(ctx context.Context, show_id int, user_id int, hold_until time.Time) (offers []WaitlistOffer, err error)
+	ExpireWaitlistOffers(ctx context.Context, show_id int, hold_until time.Time) (offers []WaitlistOffer, err error)
+	GetShowsWithLapsedOffers(ctx context.Context) (shows []Show, err error)
+	ClaimNotifications(ctx context.Context, limit int, lease time.Duration) (notifications []Notification, err error)
+	RecordNotification(ctx context.Context, r NotificationResult) (err error)
+	AddPasswordReset(ctx context.Context, user_id int, token string, token_hash string, expires_at time.Time) (err error)
+	ResetPassword(ctx context.Context, token_hash string, password string) (err error)
+	AddWebhookSubscription(ctx context.Context, w WebhookSubscription) (subscription_id int, err error)
+	GetWebhookSubscriptions(ctx context.Context) (subscriptions []WebhookSubscription, err error)
+	GetWebhookSubscription(ctx context.Context, subscription_id int) (w WebhookSubscription, err error)
+	DeactivateWebhookSubscription(ctx context.Context, subscription_id int) (err error)
+	QueueWebhookEvent(ctx context.Context, e WebhookEvent) (queued int, err error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (deliveries []WebhookDelivery, err error)
+	RecordWebhookAttempt(ctx context.Context, r WebhookResult) (err error)
+	GetWebhookDeliveries(ctx context.Context, subscription_id int, status string, limit int) (deliveries []WebhookDelivery, err error)
+	RedeliverWebhook(ctx context.Context, delivery_id int) (err error)
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) (events []Event, err error)
+	RecordEvent(ctx context.Context, r EventResult) (err error)
+	QueueEventNotification(ctx context.Context, event_id int64, user_id int, kind string, payload interface{}) (err error)
+	AddAnalyticsFact(ctx context.Context, f AnalyticsFact) (err error)
+	GetLatestSeatChange(ctx context.Context) (change_id int64, err error)
+	GetSeatChanges(ctx context.Context, after int64, limit int) (changes []SeatChange, err error)
+	GetSeatChangesOfShow(ctx context.Context, show_id int, after int64, limit int) (changes []SeatChange, complete bool, err error)
+	PruneSeatChanges(ctx context.Context, before time.Time) (pruned int, err error)
+	OpenWaitingRoom(ctx context.Context, w WaitingRoom) (room_id int, err error)
+	GetWaitingRoom(ctx context.Context, room_id int) (w WaitingRoom, err error)
+	GetActiveWaitingRooms(ctx context.Context) (rooms []WaitingRoom, err error)
+	GetWaitingRoomOfShow(ctx context.Context, show_id int) (w WaitingRoom, err error)
+	CloseWaitingRoom(ctx context.Context, room_id int) (err error)
+	JoinQueue(ctx context.Context, room_id int, user_id int, token string) (q QueueToken, err error)
+	GetQueueToken(ctx context.Context, room_id int, user_id int) (q QueueToken, err error)
+	IsAdmitted(ctx context.Context, room_id int, user_id int, token string) (admitted bool, err error)
+	AdmitFromWaitingRooms(ctx context.Context) (admitted int, err error)
+	TakeRateLimitToken(ctx context.Context, key string, burst int, perSecond float64) (tokens float64, allowed bool, err error)
+	PruneRateLimitBuckets(ctx context.Context, before time.Time) (pruned int, err error)
+	StartIdempotentRequest(ctx context.Context, owner string, key string, hash string, lock time.Duration) (ir IdempotentRequest, started bool, err error)
+	CompleteIdempotentRequest(ctx context.Context, owner string, key string, status_code int, content_type string, body []byte) (err error)
+	ReleaseIdempotentRequest(ctx context.Context, owner string, key string) (err error)
+	PruneIdempotentRequests(ctx context.Context, before time.Time) (pruned int, err error)
+	Ping(ctx context.Context) (err error)
+	GetMigrationVersion(ctx context.Context) (version uint, dirty bool, err error)
+	AcquireJobLease(ctx context.Context, name string, owner string, lease time.Duration) (ok bool, err error)
+	ReleaseJobLease(ctx context.Context, name string, owner string, runErr string, every time.Duration) (err error)
+	QueueShowReminders(ctx context.Context, lead time.Duration, limit int, kind string) (queued int, err error)
+	GetWallet(ctx context.Context, user_id int, limit int) (a LedgerAccount, entries []StatementEntry, err error)
+	IssueGiftCard(ctx context.Context, code string, amount int, expires_at *time.Time, issued_by int) (g GiftCard, err error)
+	VoidGiftCard(ctx context.Context, gift_card_id int, voided_by int) (g GiftCard, err error)
+	GetGiftCards(ctx context.Context) (cards []GiftCard, err error)
+	GetGiftCardByCode(ctx context.Context, code string) (g GiftCard, err error)
+	OpenShift(ctx context.Context, staff_id int, multiplex_id int, opening_float int) (sh Shift, err error)
+	GetOpenShift(ctx context.Context, staff_id int) (sh Shift, err error)
+	CloseShift(ctx context.Context, shift_id int, counted_cash int) (sh Shift, err error)
+	GetDrawerTotals(ctx context.Context, shift_id int) (t DrawerTotals, err error)
 	// DeleteMultiplexByID(ctx context.Context, id int) (err error)
 	// DeleteScreenByID(ctx context.Context, id int) (err error)
 	// DeleteShowByID(ctx context.Context, id int) (err error)
@@ -53,6 +156,27 @@ func NewStorer(d *sqlx.DB) Storer {
 	}
 }
 
+// withTx runs op inside a transaction, rolling it back if op fails.
+func (s *store) withTx(ctx context.Context, op func(ctx context.Context, tx *sqlx.Tx) error) (err error) {
+	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			if e := tx.Rollback(); e != nil {
+				err = errors.WithStack(e)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	err = op(newContext(ctx, tx), tx)
+	return
+}
+
 func newContext(ctx context.Context, tx *sqlx.Tx) context.Context {
 	return context.WithValue(ctx, dbKey, tx)
 }
@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	EventPending   = "Pending"
+	EventProcessed = "Processed"
+	EventFailed    = "Failed"
+)
+
+// Domain event types
+const (
+	EventUserCreated      = "user.created"
+	EventShowAdded        = "show.added"
+	EventShowRescheduled  = "show.rescheduled"
+	EventShowCancelled    = "show.cancelled"
+	EventSeatsBooked      = "seats.booked"
+	EventBookingCancelled = "booking.cancelled"
+)
+
+// DomainEvent is a state change, recorded in the outbox with the change.
+type DomainEvent interface {
+	EventType() string
+}
+
+type UserCreatedEvent struct {
+	User_id int    `json:"user_id"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+}
+
+type ShowAddedEvent struct {
+	ShowDetail
+}
+
+type ShowRescheduledEvent struct {
+	ShowDetail
+	Bookings        int `json:"bookings"`
+	Action_required int `json:"action_required"`
+}
+
+type ShowCancelledEvent struct {
+	Show_id            int    `json:"show_id"`
+	Reason             string `json:"reason"`
+	Bookings_cancelled int    `json:"bookings_cancelled"`
+}
+
+type SeatsBookedEvent struct {
+	Booking_id     int     `json:"booking_id"`
+	Show_id        int     `json:"show_id"`
+	User_id        int     `json:"user_id,omitempty"` // 0 for walk-ins
+	Seats          []int64 `json:"seats"`
+	Channel        string  `json:"channel"`
+	Amount         int     `json:"amount"`
+	Currency       string  `json:"currency"`
+	Payment_method string  `json:"payment_method,omitempty"`
+}
+
+type BookingCancelledEvent struct {
+	Booking_id    int     `json:"booking_id"`
+	Show_id       int     `json:"show_id"`
+	User_id       int     `json:"user_id,omitempty"`
+	Seats         []int64 `json:"seats"`
+	Reason        string  `json:"reason"`
+	Refund_amount int     `json:"refund_amount"`
+	Refund_to     string  `json:"refund_to,omitempty"`
+}
+
+func (UserCreatedEvent) EventType() string      { return EventUserCreated }
+func (ShowAddedEvent) EventType() string        { return EventShowAdded }
+func (ShowRescheduledEvent) EventType() string  { return EventShowRescheduled }
+func (ShowCancelledEvent) EventType() string    { return EventShowCancelled }
+func (SeatsBookedEvent) EventType() string      { return EventSeatsBooked }
+func (BookingCancelledEvent) EventType() string { return EventBookingCancelled }
+
+const (
+	addEventQuery = `INSERT INTO events (type, payload) VALUES ($1, $2)`
+	// a claimed event is leased to one dispatcher until locked_until
+	claimEvents = `UPDATE events e SET locked_until = now() + $2 * interval '1 millisecond'
+	FROM (
+		SELECT event_id FROM events
+		WHERE status=$3 AND next_attempt_at <= now() AND (locked_until IS NULL OR locked_until < now())
+		ORDER BY event_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	) c
+	WHERE e.event_id = c.event_id
+	RETURNING e.event_id, e.type, e.payload, e.attempts, e.handled, e.created_at`
+	recordEvent = `UPDATE events SET status=$2, handled=$3, last_error=NULLIF($4, ''), next_attempt_at=$5,
+	attempts = attempts + 1, locked_until=NULL, processed_at = CASE WHEN $2 = $6 THEN now() END
+	WHERE event_id=$1`
+	getShowDetailByID = `SELECT sh.show_id, sh.show_date, sh.start_time, sh.end_time, sh.status, sc.screen_number,
+	mv.title AS movie, mx.multiplex_id, mx.name AS multiplex, mx.time_zone
+	FROM shows sh
+	JOIN screens sc ON sc.screen_id = sh.screen_id
+	JOIN movies mv ON mv.movie_id = sh.movie_id
+	JOIN multiplexes mx ON mx.multiplex_id = sh.multiplex_id
+	WHERE sh.show_id=$1`
+	addEventNotification = `INSERT INTO notifications (user_id, kind, payload, event_id) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (event_id, kind) DO NOTHING`
+	addAnalyticsFact = `INSERT INTO analytics_facts (event_id, type, user_id, show_id, booking_id, channel, seats, amount, occurred_at)
+	VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), NULLIF($5, 0), NULLIF($6, ''), $7, $8, $9)
+	ON CONFLICT (event_id) DO NOTHING`
+)
+
+// Event is a recorded domain event as the dispatcher sees it.
+type Event struct {
+	Event_id   int64          `db:"event_id"`
+	Type       string         `db:"type"`
+	Payload    []byte         `db:"payload"`
+	Attempts   int            `db:"attempts"`
+	Handled    pq.StringArray `db:"handled"`
+	Created_at time.Time      `db:"created_at"`
+}
+
+// Decode unmarshals the payload into the event's type, like SeatsBookedEvent.
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// EventResult is how handing an event to the subscribers went. Status is
+// Processed, Pending to try again at Next_attempt_at, or Failed.
+type EventResult struct {
+	Event_id        int64
+	Status          string
+	Handled         []string
+	Error           string
+	Next_attempt_at time.Time
+}
+
+// AnalyticsFact is the reporting row of an event.
+type AnalyticsFact struct {
+	Event_id    int64
+	Type        string
+	User_id     int
+	Show_id     int
+	Booking_id  int
+	Channel     string
+	Seats       int
+	Amount      int
+	Occurred_at time.Time
+}
+
+// addEvent records a domain event within the transaction making the change.
+func addEvent(ctx context.Context, tx *sqlx.Tx, e DomainEvent) (err error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, addEventQuery, e.EventType(), b)
+	return
+}
+
+func getShowDetail(ctx context.Context, tx *sqlx.Tx, show_id int) (d ShowDetail, err error) {
+	err = tx.GetContext(ctx, &d, getShowDetailByID, show_id)
+	return
+}
+
+// ClaimEvents leases up to limit pending events to the caller for lease.
+// Events another dispatcher holds are skipped.
+func (s *store) ClaimEvents(ctx context.Context, limit int, lease time.Duration) (events []Event, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &events, claimEvents, limit, lease.Milliseconds(), EventPending)
+	})
+	return
+}
+
+func (s *store) RecordEvent(ctx context.Context, r EventResult) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, recordEvent, r.Event_id, r.Status, pq.StringArray(r.Handled), r.Error, r.Next_attempt_at, EventProcessed)
+		return err
+	})
+	return
+}
+
+// QueueEventNotification queues a notification for an event. Doing it again
+// for the same event and kind is a no-op.
+func (s *store) QueueEventNotification(ctx context.Context, event_id int64, user_id int, kind string, payload interface{}) (err error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, addEventNotification, user_id, kind, b, event_id)
+		return err
+	})
+	return
+}
+
+// AddAnalyticsFact records the fact of an event once.
+func (s *store) AddAnalyticsFact(ctx context.Context, f AnalyticsFact) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, addAnalyticsFact, f.Event_id, f.Type, f.User_id, f.Show_id, f.Booking_id, f.Channel,
+			f.Seats, f.Amount, f.Occurred_at)
+		return err
+	})
+	return
+}
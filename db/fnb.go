@@ -0,0 +1,342 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// How an F&B order reaches the customer
+const (
+	FnbPickup = "pickup"
+	FnbToSeat = "seat"
+)
+
+const (
+	FnbQueued    = "Queued"
+	FnbPreparing = "Preparing"
+	FnbReady     = "Ready"
+	FnbServed    = "Served"
+	FnbCancelled = "Cancelled"
+)
+
+// the refund reason of an order the kitchen cancelled
+const fnbCancelReason = "food order cancelled"
+
+var (
+	ErrFnbItemNotFound   = errors.New("menu item doesn't exist")
+	ErrFnbOutOfStock     = errors.New("menu item is out of stock")
+	ErrFnbOrderNotFound  = errors.New("order doesn't exist")
+	ErrFnbStatusConflict = errors.New("order status was changed meanwhile")
+)
+
+const (
+	addFnbItemQuery = `INSERT INTO fnb_items (multiplex_id, name, description, price, is_combo, stock)
+	VALUES ($1, $2, $3, $4, $5, $6) returning item_id`
+	// parts of a combo have to be sold by the same multiplex
+	addComboItemQuery = `INSERT INTO fnb_combo_items (combo_id, item_id, quantity)
+	SELECT $1, item_id, $3 FROM fnb_items WHERE item_id=$2 AND multiplex_id=$4 AND NOT is_combo`
+	// a combo is available as many times as its scarcest part allows
+	getFnbMenu = `SELECT i.item_id, i.multiplex_id, i.name, i.description, i.price, i.is_combo, i.active, i.created_at,
+	CASE WHEN i.is_combo THEN (
+		SELECT min(p.stock / c.quantity) FROM fnb_combo_items c JOIN fnb_items p ON p.item_id = c.item_id
+		WHERE c.combo_id = i.item_id
+	) ELSE i.stock END AS stock
+	FROM fnb_items i
+	WHERE i.multiplex_id=$1 AND i.active
+	ORDER BY i.is_combo DESC, i.name`
+	getComboItemsOfMultiplex = `SELECT c.combo_id, c.item_id, c.quantity FROM fnb_combo_items c
+	JOIN fnb_items i ON i.item_id = c.combo_id
+	WHERE i.multiplex_id=$1
+	ORDER BY c.combo_id, c.item_id`
+	getFnbItemByID    = `SELECT item_id, multiplex_id, name, description, price, is_combo, stock, active, created_at FROM fnb_items WHERE item_id=$1`
+	setFnbStockQuery  = `UPDATE fnb_items SET stock=$2 WHERE item_id=$1 AND NOT is_combo`
+	getComboParts     = `SELECT combo_id, item_id, quantity FROM fnb_combo_items WHERE combo_id=$1`
+	takeFnbStockQuery = `UPDATE fnb_items SET stock = stock - $2 WHERE item_id=$1 AND active AND (stock IS NULL OR stock >= $2)`
+	addFnbOrderQuery  = `INSERT INTO fnb_orders (booking_id, multiplex_id, show_id, fulfilment, deliver_at, status, amount, tax)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) returning order_id`
+	addFnbOrderItem = `INSERT INTO fnb_order_items (order_id, item_id, name, quantity, unit_price) VALUES ($1, $2, $3, $4, $5)`
+	fnbOrderColumns = `SELECT o.order_id, o.booking_id, o.multiplex_id, o.show_id, o.fulfilment, o.deliver_at, o.status, o.amount,
+	o.tax, o.created_at, sc.screen_number,
+	COALESCE((SELECT array_agg(s.seat_number ORDER BY s.seat_number) FROM booking_seats bs JOIN seats s ON s.seat_id = bs.seat_id
+		WHERE bs.booking_id = o.booking_id), '{}') AS seats
+	FROM fnb_orders o
+	JOIN shows sh ON sh.show_id = o.show_id
+	JOIN screens sc ON sc.screen_id = sh.screen_id
+	`
+	getFnbOrdersOfMultiplex = fnbOrderColumns + `WHERE o.multiplex_id=$1 AND o.status = ANY($2)
+	ORDER BY o.deliver_at, o.order_id`
+	getFnbOrderByID     = fnbOrderColumns + `WHERE o.order_id=$1`
+	getFnbOrderItems    = `SELECT order_id, item_id, name, quantity, unit_price FROM fnb_order_items WHERE order_id = ANY($1) ORDER BY order_id, name`
+	setFnbOrderStatus   = `UPDATE fnb_orders SET status=$3, updated_at=now() WHERE order_id=$1 AND status=$2`
+	getFnbOrderToRefund = `SELECT o.booking_id, COALESCE(b.user_id, 0) AS user_id, o.amount + o.tax AS amount,
+	COALESCE((SELECT p.method FROM payments p WHERE p.booking_id = b.booking_id ORDER BY p.payment_id LIMIT 1), '') AS payment_method
+	FROM fnb_orders o
+	JOIN bookings b ON b.booking_id = o.booking_id
+	WHERE o.order_id=$1`
+	// what cancelled orders took goes back on the shelf, a combo as its parts.
+	// Items are locked in order like addFnbOrder takes them.
+	restockFnbItems = `WITH returned AS (
+		SELECT COALESCE(c.item_id, oi.item_id) AS item_id, sum(oi.quantity * COALESCE(c.quantity, 1)) AS quantity
+		FROM fnb_order_items oi
+		LEFT JOIN fnb_combo_items c ON c.combo_id = oi.item_id
+		WHERE oi.order_id = ANY($1)
+		GROUP BY 1
+	), locked AS (
+		SELECT item_id FROM fnb_items WHERE item_id IN (SELECT item_id FROM returned) ORDER BY item_id FOR UPDATE
+	)
+	UPDATE fnb_items i SET stock = i.stock + r.quantity
+	FROM returned r
+	WHERE i.item_id = r.item_id AND i.stock IS NOT NULL AND i.item_id IN (SELECT item_id FROM locked)`
+)
+
+type FnbItem struct {
+	Item_id      int       `db:"item_id"`
+	Multiplex_id int       `db:"multiplex_id"`
+	Name         string    `db:"name"`
+	Description  string    `db:"description"`
+	Price        int       `db:"price"`
+	Is_combo     bool      `db:"is_combo"`
+	Stock        *int      `db:"stock"` // nil when not tracked
+	Active       bool      `db:"active"`
+	Created_at   time.Time `db:"created_at"`
+}
+
+type FnbComboItem struct {
+	Combo_id int `db:"combo_id"`
+	Item_id  int `db:"item_id"`
+	Quantity int `db:"quantity"`
+}
+
+type NewFnbOrder struct {
+	Multiplex_id int
+	Fulfilment   string
+	Deliver_at   time.Time
+	Items        []FnbOrderItem
+}
+
+type FnbOrderItem struct {
+	Order_id   int    `db:"order_id"`
+	Item_id    int    `db:"item_id"`
+	Name       string `db:"name"`
+	Quantity   int    `db:"quantity"`
+	Unit_price int    `db:"unit_price"`
+}
+
+type FnbOrder struct {
+	Order_id      int           `db:"order_id"`
+	Booking_id    int           `db:"booking_id"`
+	Multiplex_id  int           `db:"multiplex_id"`
+	Show_id       int           `db:"show_id"`
+	Fulfilment    string        `db:"fulfilment"`
+	Deliver_at    time.Time     `db:"deliver_at"`
+	Status        string        `db:"status"`
+	Amount        int           `db:"amount"`
+	Tax           int           `db:"tax"`
+	Created_at    time.Time     `db:"created_at"`
+	Screen_number int           `db:"screen_number"`
+	Seats         pq.Int64Array `db:"seats"`
+}
+
+// AddFnbItem adds an item to a multiplex's menu. A combo is made of the given
+// items, which must be plain items of the same multiplex.
+func (s *store) AddFnbItem(ctx context.Context, it FnbItem, parts []FnbComboItem) (item_id uint, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			err := tx.GetContext(ctx, &item_id, addFnbItemQuery, it.Multiplex_id, it.Name, it.Description, it.Price,
+				len(parts) > 0, it.Stock)
+			if err != nil {
+				return err
+			}
+			for _, p := range parts {
+				res, err := tx.ExecContext(ctx, addComboItemQuery, item_id, p.Item_id, p.Quantity, it.Multiplex_id)
+				if err != nil {
+					return err
+				}
+				if n, _ := res.RowsAffected(); n == 0 {
+					return ErrFnbItemNotFound
+				}
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// GetFnbMenu returns what a multiplex sells. The stock of a combo is how many
+// of it can still be made.
+func (s *store) GetFnbMenu(ctx context.Context, multiplex_id int) (items []FnbItem, parts []FnbComboItem, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		if err := s.db.SelectContext(ctx, &items, getFnbMenu, multiplex_id); err != nil {
+			return err
+		}
+		return s.db.SelectContext(ctx, &parts, getComboItemsOfMultiplex, multiplex_id)
+	})
+	return
+}
+
+func (s *store) GetFnbItemByID(ctx context.Context, item_id int) (it FnbItem, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &it, getFnbItemByID, item_id)
+	})
+
+	if err == sql.ErrNoRows {
+		return it, ErrFnbItemNotFound
+	}
+	return
+}
+
+// SetFnbStock sets how many of an item are left, nil stops tracking it.
+func (s *store) SetFnbStock(ctx context.Context, item_id int, stock *int) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, setFnbStockQuery, item_id, stock)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrFnbItemNotFound
+		}
+		return nil
+	})
+	return
+}
+
+// addFnbOrder takes the stock of an order and records it within the booking
+// transaction, with the tax charged on it. Stock is taken in item order so
+// concurrent orders can't deadlock.
+func addFnbOrder(ctx context.Context, tx *sqlx.Tx, booking_id int, show_id int, o NewFnbOrder, tax int) (order_id int, err error) {
+	needed := map[int]int{}
+	amount := 0
+	for _, it := range o.Items {
+		amount += it.Quantity * it.Unit_price
+
+		var parts []FnbComboItem
+		if err = tx.SelectContext(ctx, &parts, getComboParts, it.Item_id); err != nil {
+			return
+		}
+		if len(parts) == 0 {
+			needed[it.Item_id] += it.Quantity
+		}
+		for _, p := range parts {
+			needed[p.Item_id] += p.Quantity * it.Quantity
+		}
+	}
+
+	ids := make([]int, 0, len(needed))
+	for id := range needed {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		res, err := tx.ExecContext(ctx, takeFnbStockQuery, id, needed[id])
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return 0, ErrFnbOutOfStock
+		}
+	}
+
+	err = tx.GetContext(ctx, &order_id, addFnbOrderQuery, booking_id, o.Multiplex_id, show_id, o.Fulfilment, o.Deliver_at, FnbQueued, amount, tax)
+	if err != nil {
+		return
+	}
+	for _, it := range o.Items {
+		if _, err = tx.ExecContext(ctx, addFnbOrderItem, order_id, it.Item_id, it.Name, it.Quantity, it.Unit_price); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// restockFnbOrders returns the stock taken by orders being cancelled.
+func restockFnbOrders(ctx context.Context, tx *sqlx.Tx, order_ids pq.Int64Array) (err error) {
+	if len(order_ids) == 0 {
+		return
+	}
+	_, err = tx.ExecContext(ctx, restockFnbItems, order_ids)
+	return
+}
+
+// cancelFnbOrders cancels the orders of one booking or show, queued selects
+// the ones the kitchen hasn't started on and cancel cancels all that aren't
+// served. Only the queued ones are restocked, food already made doesn't go
+// back on the shelf.
+func cancelFnbOrders(ctx context.Context, tx *sqlx.Tx, queued string, cancel string, id int) (err error) {
+	var order_ids pq.Int64Array
+	if err = tx.SelectContext(ctx, &order_ids, queued, id, FnbQueued); err != nil {
+		return
+	}
+	if err = restockFnbOrders(ctx, tx, order_ids); err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, cancel, id, FnbServed, FnbCancelled)
+	return
+}
+
+// GetFnbOrdersOfMultiplex is the kitchen's queue, soonest first.
+func (s *store) GetFnbOrdersOfMultiplex(ctx context.Context, multiplex_id int, statuses []string) (orders []FnbOrder, items []FnbOrderItem, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		if err := s.db.SelectContext(ctx, &orders, getFnbOrdersOfMultiplex, multiplex_id, pq.StringArray(statuses)); err != nil {
+			return err
+		}
+		ids := make(pq.Int64Array, 0, len(orders))
+		for _, o := range orders {
+			ids = append(ids, int64(o.Order_id))
+		}
+		return s.db.SelectContext(ctx, &items, getFnbOrderItems, ids)
+	})
+	return
+}
+
+func (s *store) GetFnbOrderByID(ctx context.Context, order_id int) (o FnbOrder, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &o, getFnbOrderByID, order_id)
+	})
+
+	if err == sql.ErrNoRows {
+		return o, ErrFnbOrderNotFound
+	}
+	return
+}
+
+// SetFnbOrderStatus moves an order on from the status it was seen in. A
+// cancelled order gives its stock back and is refunded with its tax like a
+// cancelled booking.
+func (s *store) SetFnbOrderStatus(ctx context.Context, order_id int, from string, to string) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			res, err := tx.ExecContext(ctx, setFnbOrderStatus, order_id, from, to)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return ErrFnbStatusConflict
+			}
+			if to != FnbCancelled || from != FnbQueued {
+				return nil
+			}
+			if err = restockFnbOrders(ctx, tx, pq.Int64Array{int64(order_id)}); err != nil {
+				return err
+			}
+			var c CancelledBooking
+			if err = tx.GetContext(ctx, &c, getFnbOrderToRefund, order_id); err != nil {
+				return err
+			}
+			return refundBooking(ctx, tx, &c, fnbCancelReason, false)
+		})
+	})
+	return
+}
@@ -0,0 +1,23 @@
+package db
+
+import "context"
+
+const getMigrationVersion = `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+func (s *store) Ping(ctx context.Context) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.PingContext(ctx)
+	})
+	return
+}
+
+// GetMigrationVersion returns the migration the database is at, dirty when
+// it failed half way.
+func (s *store) GetMigrationVersion(ctx context.Context) (version uint, dirty bool, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.QueryRowxContext(ctx, getMigrationVersion).Scan(&version, &dirty)
+	})
+	return
+}
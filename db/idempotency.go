@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	IdempotencyInProgress = "InProgress"
+	IdempotencyDone       = "Done"
+)
+
+const (
+	idempotentRequestQuery = `owner, idem_key, request_hash, status, COALESCE(status_code, 0) AS status_code,
+	content_type, COALESCE(response_body, '') AS response_body, locked_until, created_at`
+	// a request still in progress past its lock is taken over by the retry
+	startIdempotentRequest = `INSERT INTO idempotent_requests AS i (owner, idem_key, request_hash, locked_until)
+	VALUES ($1, $2, $3, now() + make_interval(secs => $4))
+	ON CONFLICT (owner, idem_key) DO UPDATE SET locked_until = EXCLUDED.locked_until
+	WHERE i.status = 'InProgress' AND i.locked_until <= now() AND i.request_hash = EXCLUDED.request_hash
+	RETURNING ` + idempotentRequestQuery
+	getIdempotentRequest      = `SELECT ` + idempotentRequestQuery + ` FROM idempotent_requests WHERE owner=$1 AND idem_key=$2`
+	completeIdempotentRequest = `UPDATE idempotent_requests
+	SET status=$3, status_code=$4, content_type=$5, response_body=$6, completed_at=now()
+	WHERE owner=$1 AND idem_key=$2 AND status=$7`
+	releaseIdempotentRequest = `DELETE FROM idempotent_requests WHERE owner=$1 AND idem_key=$2 AND status=$3`
+	pruneIdempotentRequests  = `DELETE FROM idempotent_requests WHERE created_at < $1`
+)
+
+type IdempotentRequest struct {
+	Owner         string    `db:"owner"`
+	Idem_key      string    `db:"idem_key"`
+	Request_hash  string    `db:"request_hash"`
+	Status        string    `db:"status"`
+	Status_code   int       `db:"status_code"`
+	Content_type  string    `db:"content_type"`
+	Response_body []byte    `db:"response_body"`
+	Locked_until  time.Time `db:"locked_until"`
+	Created_at    time.Time `db:"created_at"`
+}
+
+// StartIdempotentRequest claims a key for a request, holding it for lock.
+// When the key was used before, started is false and the request it was
+// used for is returned instead.
+func (s *store) StartIdempotentRequest(ctx context.Context, owner string, key string, hash string, lock time.Duration) (ir IdempotentRequest, started bool, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		err := s.db.GetContext(ctx, &ir, startIdempotentRequest, owner, key, hash, lock.Seconds())
+		if err == nil {
+			started = true
+			return nil
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		return s.db.GetContext(ctx, &ir, getIdempotentRequest, owner, key)
+	})
+	return
+}
+
+// CompleteIdempotentRequest saves the response to replay for the key.
+func (s *store) CompleteIdempotentRequest(ctx context.Context, owner string, key string, status_code int, content_type string, body []byte) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, completeIdempotentRequest, owner, key, IdempotencyDone, status_code, content_type, body, IdempotencyInProgress)
+		return err
+	})
+	return
+}
+
+// ReleaseIdempotentRequest frees a key whose request failed, so it can be
+// retried.
+func (s *store) ReleaseIdempotentRequest(ctx context.Context, owner string, key string) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, releaseIdempotentRequest, owner, key, IdempotencyInProgress)
+		return err
+	})
+	return
+}
+
+// PruneIdempotentRequests deletes keys first used before a time.
+func (s *store) PruneIdempotentRequests(ctx context.Context, before time.Time) (pruned int, err error) {
+
+	err = WithTimeout(ctx, bulkTimeout, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, pruneIdempotentRequests, before)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		pruned = int(n)
+		return err
+	})
+	return
+}
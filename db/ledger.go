@@ -0,0 +1,372 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Ledger account kinds. Issuance, sales and refunds are the house's side of
+// every movement.
+const (
+	AccountWallet   = "wallet"
+	AccountGiftCard = "gift_card"
+	AccountIssuance = "issuance"
+	AccountSales    = "sales"
+	AccountRefunds  = "refunds"
+)
+
+// Ledger transaction kinds
+const (
+	TxnIssue  = "issue"
+	TxnVoid   = "void"
+	TxnRedeem = "redeem"
+	TxnRefund = "refund"
+)
+
+const (
+	PaymentWallet   = "wallet"
+	PaymentGiftCard = "gift_card"
+
+	GiftCardActive = "Active"
+	GiftCardVoid   = "Void"
+
+	RefundCompleted  = "Completed"
+	RefundToOriginal = "original"
+	RefundToWallet   = "wallet"
+)
+
+var (
+	ErrGiftCardNotFound    = errors.New("gift card doesn't exist")
+	ErrGiftCardExists      = errors.New("gift card code already exists")
+	ErrGiftCardUnusable    = errors.New("gift card is void or expired")
+	ErrInsufficientBalance = errors.New("not enough balance")
+	ErrUnbalancedTxn       = errors.New("ledger transaction doesn't balance")
+)
+
+const (
+	getSystemAccount = `SELECT account_id FROM ledger_accounts WHERE kind=$1 AND user_id IS NULL`
+	addWalletAccount = `INSERT INTO ledger_accounts (kind, user_id, currency) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) WHERE kind = 'wallet' DO NOTHING`
+	getWalletAccount = `SELECT account_id, kind, COALESCE(user_id, 0) AS user_id, currency, balance FROM ledger_accounts
+	WHERE kind=$1 AND user_id=$2`
+	addAccountQuery = `INSERT INTO ledger_accounts (kind, currency) VALUES ($1, $2) returning account_id`
+	addTxnQuery     = `INSERT INTO ledger_transactions (kind, booking_id, memo, created_by)
+	VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, 0)) returning txn_id`
+	addEntryQuery = `INSERT INTO ledger_entries (txn_id, account_id, amount) VALUES ($1, $2, $3)`
+	// the balance check is what keeps two spends from overdrawing an account
+	moveBalance = `UPDATE ledger_accounts SET balance = balance + $2
+	WHERE account_id=$1 AND (balance + $2 >= 0 OR kind = ANY($3))`
+	giftCardQuery = `SELECT g.gift_card_id, g.code, g.account_id, g.initial_amount, a.balance, a.currency, g.status, g.expires_at,
+	COALESCE(g.issued_by, 0) AS issued_by, g.voided_at, g.created_at
+	FROM gift_cards g JOIN ledger_accounts a ON a.account_id = g.account_id`
+	addGiftCardQuery = `INSERT INTO gift_cards (code, account_id, initial_amount, expires_at, issued_by)
+	VALUES ($1, $2, $3, $4, NULLIF($5, 0)) returning gift_card_id`
+	getGiftCards        = giftCardQuery + ` ORDER BY g.gift_card_id DESC`
+	getGiftCardByID     = giftCardQuery + ` WHERE g.gift_card_id=$1`
+	getGiftCardByCode   = giftCardQuery + ` WHERE g.code=$1`
+	lockGiftCardByID    = getGiftCardByID + ` FOR UPDATE OF g`
+	lockGiftCardByCode  = getGiftCardByCode + ` FOR UPDATE OF g`
+	voidGiftCardQuery   = `UPDATE gift_cards SET status=$2, voided_at=now() WHERE gift_card_id=$1`
+	getAccountStatement = `SELECT e.entry_id, t.txn_id, t.kind, COALESCE(t.booking_id, 0) AS booking_id, t.memo, e.amount, t.created_at
+	FROM ledger_entries e JOIN ledger_transactions t ON t.txn_id = e.txn_id
+	WHERE e.account_id=$1
+	ORDER BY e.entry_id DESC
+	LIMIT $2`
+)
+
+// houseAccounts may go negative, they mirror what customers hold
+var houseAccounts = pq.StringArray{AccountIssuance, AccountSales, AccountRefunds}
+
+type LedgerAccount struct {
+	Account_id int    `db:"account_id"`
+	Kind       string `db:"kind"`
+	User_id    int    `db:"user_id"`
+	Currency   string `db:"currency"`
+	Balance    int    `db:"balance"`
+}
+
+// Leg is one side of a ledger transaction. Positive amounts add to the
+// account's balance.
+type Leg struct {
+	Account_id int
+	Amount     int
+}
+
+type LedgerTxn struct {
+	Kind       string
+	Booking_id int
+	Memo       string
+	Created_by int
+	Legs       []Leg
+}
+
+type StatementEntry struct {
+	Entry_id   int       `db:"entry_id"`
+	Txn_id     int       `db:"txn_id"`
+	Kind       string    `db:"kind"`
+	Booking_id int       `db:"booking_id"`
+	Memo       string    `db:"memo"`
+	Amount     int       `db:"amount"`
+	Created_at time.Time `db:"created_at"`
+}
+
+type GiftCard struct {
+	Gift_card_id   int        `db:"gift_card_id"`
+	Code           string     `db:"code"`
+	Account_id     int        `db:"account_id"`
+	Initial_amount int        `db:"initial_amount"`
+	Balance        int        `db:"balance"`
+	Currency       string     `db:"currency"`
+	Status         string     `db:"status"`
+	Expires_at     *time.Time `db:"expires_at"`
+	Issued_by      int        `db:"issued_by"`
+	Voided_at      *time.Time `db:"voided_at"`
+	Created_at     time.Time  `db:"created_at"`
+}
+
+// Usable tells if the card can still be spent.
+func (g GiftCard) Usable(now time.Time) bool {
+	return g.Status == GiftCardActive && (g.Expires_at == nil || now.Before(*g.Expires_at))
+}
+
+// postingOrder checks the legs of a transaction balance and returns them in
+// the order their accounts are updated, by account id so concurrent
+// transactions over the same accounts can't deadlock.
+func postingOrder(legs []Leg) (ordered []Leg, err error) {
+	sum := 0
+	for _, l := range legs {
+		sum += l.Amount
+	}
+	if sum != 0 || len(legs) < 2 {
+		return nil, ErrUnbalancedTxn
+	}
+
+	ordered = append([]Leg(nil), legs...)
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].Account_id < ordered[j].Account_id })
+	return
+}
+
+// postTxn records a balanced transaction and moves the balances of its
+// accounts.
+func postTxn(ctx context.Context, tx *sqlx.Tx, t LedgerTxn) (txn_id int, err error) {
+	legs, err := postingOrder(t.Legs)
+	if err != nil {
+		return
+	}
+
+	if err = tx.GetContext(ctx, &txn_id, addTxnQuery, t.Kind, t.Booking_id, t.Memo, t.Created_by); err != nil {
+		return
+	}
+
+	for _, l := range legs {
+		if _, err = tx.ExecContext(ctx, addEntryQuery, txn_id, l.Account_id, l.Amount); err != nil {
+			return
+		}
+		res, err := tx.ExecContext(ctx, moveBalance, l.Account_id, l.Amount, houseAccounts)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return 0, ErrInsufficientBalance
+		}
+	}
+	return
+}
+
+func systemAccount(ctx context.Context, tx *sqlx.Tx, kind string) (account_id int, err error) {
+	err = tx.GetContext(ctx, &account_id, getSystemAccount, kind)
+	return
+}
+
+// walletOf returns the user's wallet, opening it on first use.
+func walletOf(ctx context.Context, tx *sqlx.Tx, user_id int) (a LedgerAccount, err error) {
+	if _, err = tx.ExecContext(ctx, addWalletAccount, AccountWallet, user_id, DefaultCurrency); err != nil {
+		return
+	}
+	err = tx.GetContext(ctx, &a, getWalletAccount, AccountWallet, user_id)
+	return
+}
+
+// GetWallet returns the user's wallet and its latest entries. A user who
+// never had a wallet opened gets an empty one that isn't stored.
+func (s *store) GetWallet(ctx context.Context, user_id int, limit int) (a LedgerAccount, entries []StatementEntry, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		err := s.db.GetContext(ctx, &a, getWalletAccount, AccountWallet, user_id)
+		if err == sql.ErrNoRows {
+			a = LedgerAccount{Kind: AccountWallet, User_id: user_id, Currency: DefaultCurrency}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.db.SelectContext(ctx, &entries, getAccountStatement, a.Account_id, limit)
+	})
+	return
+}
+
+// IssueGiftCard opens an account for a new card and credits it from the
+// issuance account.
+func (s *store) IssueGiftCard(ctx context.Context, code string, amount int, expires_at *time.Time, issued_by int) (g GiftCard, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var account_id, gift_card_id int
+			if err := tx.GetContext(ctx, &account_id, addAccountQuery, AccountGiftCard, DefaultCurrency); err != nil {
+				return err
+			}
+			err := tx.GetContext(ctx, &gift_card_id, addGiftCardQuery, code, account_id, amount, expires_at, issued_by)
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrGiftCardExists
+			}
+			if err != nil {
+				return err
+			}
+
+			issuance, err := systemAccount(ctx, tx, AccountIssuance)
+			if err != nil {
+				return err
+			}
+			_, err = postTxn(ctx, tx, LedgerTxn{
+				Kind:       TxnIssue,
+				Memo:       "gift card " + code,
+				Created_by: issued_by,
+				Legs:       []Leg{{account_id, amount}, {issuance, -amount}},
+			})
+			if err != nil {
+				return err
+			}
+			return tx.GetContext(ctx, &g, getGiftCardByID, gift_card_id)
+		})
+	})
+	return
+}
+
+// VoidGiftCard cancels a card, whatever is left on it goes back to the
+// issuance account.
+func (s *store) VoidGiftCard(ctx context.Context, gift_card_id int, voided_by int) (g GiftCard, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			err := tx.GetContext(ctx, &g, lockGiftCardByID, gift_card_id)
+			if err == sql.ErrNoRows {
+				return ErrGiftCardNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if g.Status == GiftCardVoid {
+				return ErrGiftCardUnusable
+			}
+
+			if g.Balance > 0 {
+				issuance, err := systemAccount(ctx, tx, AccountIssuance)
+				if err != nil {
+					return err
+				}
+				_, err = postTxn(ctx, tx, LedgerTxn{
+					Kind:       TxnVoid,
+					Memo:       "gift card " + g.Code,
+					Created_by: voided_by,
+					Legs:       []Leg{{g.Account_id, -g.Balance}, {issuance, g.Balance}},
+				})
+				if err != nil {
+					return err
+				}
+			}
+			if _, err = tx.ExecContext(ctx, voidGiftCardQuery, gift_card_id, GiftCardVoid); err != nil {
+				return err
+			}
+			return tx.GetContext(ctx, &g, getGiftCardByID, gift_card_id)
+		})
+	})
+	return
+}
+
+func (s *store) GetGiftCards(ctx context.Context) (cards []GiftCard, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &cards, getGiftCards)
+	})
+	return
+}
+
+func (s *store) GetGiftCardByCode(ctx context.Context, code string) (g GiftCard, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &g, getGiftCardByCode, code)
+	})
+
+	if err == sql.ErrNoRows {
+		return g, ErrGiftCardNotFound
+	}
+	return
+}
+
+// payFromLedger settles a booking from the customer's wallet or a gift card
+// within the booking transaction.
+func payFromLedger(ctx context.Context, tx *sqlx.Tx, nb NewBooking, booking_id int, amount int) (err error) {
+	var from int
+	memo := ""
+	switch nb.Payment_method {
+	case PaymentWallet:
+		w, err := walletOf(ctx, tx, nb.User_id)
+		if err != nil {
+			return err
+		}
+		from = w.Account_id
+	case PaymentGiftCard:
+		var g GiftCard
+		err = tx.GetContext(ctx, &g, lockGiftCardByCode, nb.Gift_card_code)
+		if err == sql.ErrNoRows {
+			return ErrGiftCardNotFound
+		}
+		if err != nil {
+			return
+		}
+		if !g.Usable(time.Now()) {
+			return ErrGiftCardUnusable
+		}
+		from = g.Account_id
+		memo = "gift card " + g.Code
+	}
+
+	sales, err := systemAccount(ctx, tx, AccountSales)
+	if err != nil {
+		return
+	}
+	_, err = postTxn(ctx, tx, LedgerTxn{
+		Kind:       TxnRedeem,
+		Booking_id: booking_id,
+		Memo:       memo,
+		Created_by: nb.User_id,
+		Legs:       []Leg{{from, -amount}, {sales, amount}},
+	})
+	return
+}
+
+// refundToWallet credits a cancelled booking's amount to the customer's
+// wallet.
+func refundToWallet(ctx context.Context, tx *sqlx.Tx, user_id int, booking_id int, amount int, reason string) (err error) {
+	w, err := walletOf(ctx, tx, user_id)
+	if err != nil {
+		return
+	}
+	refunds, err := systemAccount(ctx, tx, AccountRefunds)
+	if err != nil {
+		return
+	}
+	_, err = postTxn(ctx, tx, LedgerTxn{
+		Kind:       TxnRefund,
+		Booking_id: booking_id,
+		Memo:       reason,
+		Legs:       []Leg{{w.Account_id, amount}, {refunds, -amount}},
+	})
+	return
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPostingOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		legs  []Leg
+		order []int
+		err   error
+	}{
+		{"two legs", []Leg{{Account_id: 7, Amount: -500}, {Account_id: 3, Amount: 500}}, []int{3, 7}, nil},
+		{"split across accounts", []Leg{{Account_id: 9, Amount: -1000}, {Account_id: 2, Amount: 700}, {Account_id: 5, Amount: 300}},
+			[]int{2, 5, 9}, nil},
+		{"doesn't add up", []Leg{{Account_id: 1, Amount: -500}, {Account_id: 2, Amount: 400}}, nil, ErrUnbalancedTxn},
+		{"single leg", []Leg{{Account_id: 1, Amount: 0}}, nil, ErrUnbalancedTxn},
+		{"no legs", nil, nil, ErrUnbalancedTxn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered, err := postingOrder(tt.legs)
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			var order []int
+			for _, l := range ordered {
+				order = append(order, l.Account_id)
+			}
+			if !reflect.DeepEqual(order, tt.order) {
+				t.Fatalf("order = %v, want %v", order, tt.order)
+			}
+		})
+	}
+
+	// the caller's legs are left as they were
+	legs := []Leg{{Account_id: 2, Amount: 100}, {Account_id: 1, Amount: -100}}
+	postingOrder(legs)
+	if legs[0].Account_id != 2 {
+		t.Fatalf("legs were reordered in place: %v", legs)
+	}
+}
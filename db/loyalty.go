@@ -0,0 +1,203 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Kinds of loyalty ledger entries. Earn and refund entries are lots that
+// redemptions, reversals and expiry draw down.
+const (
+	LoyaltyEarn    = "earn"
+	LoyaltyRedeem  = "redeem"
+	LoyaltyReverse = "reverse"
+	LoyaltyRefund  = "refund"
+	LoyaltyExpire  = "expire"
+)
+
+var ErrInsufficientPoints = errors.New("not enough loyalty points")
+
+const (
+	getLoyaltyTiers = `SELECT tier_id, name, min_points, earn_multiplier_bps, waives_convenience_fee FROM loyalty_tiers ORDER BY min_points`
+	// lots that ran out of time are emptied into one expire entry per user.
+	// The insert runs though only the emptied lots are counted.
+	expireLoyaltyPoints = `WITH lots AS (
+		SELECT entry_id, user_id, remaining FROM loyalty_ledger
+		WHERE remaining > 0 AND expires_at <= now()
+		ORDER BY entry_id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	), emptied AS (
+		UPDATE loyalty_ledger l SET remaining = 0 FROM lots WHERE l.entry_id = lots.entry_id
+		RETURNING lots.user_id, lots.remaining
+	), expired AS (
+		INSERT INTO loyalty_ledger (user_id, kind, points)
+		SELECT user_id, $1, -sum(remaining) FROM emptied GROUP BY user_id
+	)
+	SELECT count(*) FROM emptied`
+	getLoyaltyAccount = `SELECT COALESCE(sum(remaining) FILTER (WHERE expires_at IS NULL OR expires_at > now()), 0) AS balance,
+	COALESCE(sum(points) FILTER (WHERE kind = ANY($2) AND created_at > now() - interval '1 year'), 0) AS earned_last_year,
+	COALESCE(sum(remaining) FILTER (WHERE expires_at > now() AND expires_at <= now() + interval '30 days'), 0) AS expiring_soon
+	FROM loyalty_ledger WHERE user_id=$1`
+	getLoyaltyEntries = `SELECT entry_id, COALESCE(booking_id, 0) AS booking_id, kind, points, remaining, expires_at, created_at
+	FROM loyalty_ledger WHERE user_id=$1
+	ORDER BY created_at DESC, entry_id DESC
+	LIMIT $2`
+	// lots are drawn down soonest to expire first
+	lockLoyaltyLots = `SELECT entry_id, remaining FROM loyalty_ledger
+	WHERE user_id=$1 AND remaining > 0 AND (expires_at IS NULL OR expires_at > now())
+	ORDER BY entry_id = $2 DESC, expires_at NULLS LAST, entry_id
+	FOR UPDATE`
+	drawLoyaltyLot       = `UPDATE loyalty_ledger SET remaining = remaining - $2 WHERE entry_id=$1`
+	addLoyaltyEntryQuery = `INSERT INTO loyalty_ledger (user_id, booking_id, kind, points, remaining, expires_at)
+	VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6) returning entry_id`
+	getLoyaltyOfBooking = `SELECT COALESCE(max(entry_id) FILTER (WHERE kind=$2), 0) AS earn_entry_id,
+	COALESCE(sum(points) FILTER (WHERE kind=$2), 0) AS earned,
+	COALESCE(-sum(points) FILTER (WHERE kind=$3), 0) AS redeemed
+	FROM loyalty_ledger WHERE booking_id=$1`
+)
+
+type LoyaltyTier struct {
+	Tier_id                int    `db:"tier_id"`
+	Name                   string `db:"name"`
+	Min_points             int    `db:"min_points"`
+	Earn_multiplier_bps    int    `db:"earn_multiplier_bps"`
+	Waives_convenience_fee bool   `db:"waives_convenience_fee"`
+}
+
+type LoyaltyAccount struct {
+	Balance          int `db:"balance"`
+	Earned_last_year int `db:"earned_last_year"`
+	Expiring_soon    int `db:"expiring_soon"` // within 30 days
+}
+
+type LoyaltyEntry struct {
+	Entry_id   int        `db:"entry_id"`
+	Booking_id int        `db:"booking_id"`
+	Kind       string     `db:"kind"`
+	Points     int        `db:"points"`
+	Remaining  int        `db:"remaining"`
+	Expires_at *time.Time `db:"expires_at"`
+	Created_at time.Time  `db:"created_at"`
+}
+
+type loyaltyLot struct {
+	Entry_id  int `db:"entry_id"`
+	Remaining int `db:"remaining"`
+}
+
+type bookingLoyalty struct {
+	Earn_entry_id int `db:"earn_entry_id"`
+	Earned        int `db:"earned"`
+	Redeemed      int `db:"redeemed"`
+}
+
+func (s *store) GetLoyaltyTiers(ctx context.Context) (tiers []LoyaltyTier, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &tiers, getLoyaltyTiers)
+	})
+	return
+}
+
+// GetLoyaltyAccount works out what points the user has. Lapsed points don't
+// count whether or not they have been expired yet.
+func (s *store) GetLoyaltyAccount(ctx context.Context, user_id int) (a LoyaltyAccount, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &a, getLoyaltyAccount, user_id, pq.StringArray{LoyaltyEarn, LoyaltyReverse})
+	})
+	return
+}
+
+// ExpireLoyaltyPoints empties up to limit lapsed lots into expire entries
+// and returns how many it emptied.
+func (s *store) ExpireLoyaltyPoints(ctx context.Context, limit int) (lots int, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &lots, expireLoyaltyPoints, LoyaltyExpire, limit)
+	})
+	return
+}
+
+func (s *store) GetLoyaltyEntries(ctx context.Context, user_id int, limit int) (entries []LoyaltyEntry, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &entries, getLoyaltyEntries, user_id, limit)
+	})
+	return
+}
+
+// drawLoyaltyPoints takes up to points from the user's lots, from the given
+// lot first when there is one, and returns how many it took.
+func drawLoyaltyPoints(ctx context.Context, tx *sqlx.Tx, user_id int, points int, first_entry_id int) (taken int, err error) {
+	var lots []loyaltyLot
+	if err = tx.SelectContext(ctx, &lots, lockLoyaltyLots, user_id, first_entry_id); err != nil {
+		return
+	}
+
+	for _, l := range lots {
+		if taken == points {
+			break
+		}
+		draw := l.Remaining
+		if draw > points-taken {
+			draw = points - taken
+		}
+		if _, err = tx.ExecContext(ctx, drawLoyaltyLot, l.Entry_id, draw); err != nil {
+			return
+		}
+		taken += draw
+	}
+	return
+}
+
+// redeemLoyaltyPoints spends points on a booking within its transaction.
+func redeemLoyaltyPoints(ctx context.Context, tx *sqlx.Tx, user_id int, booking_id int, points int) (err error) {
+	taken, err := drawLoyaltyPoints(ctx, tx, user_id, points, 0)
+	if err != nil {
+		return
+	}
+	if taken < points {
+		return ErrInsufficientPoints
+	}
+	_, err = tx.ExecContext(ctx, addLoyaltyEntryQuery, user_id, booking_id, LoyaltyRedeem, -points, 0, nil)
+	return
+}
+
+func earnLoyaltyPoints(ctx context.Context, tx *sqlx.Tx, user_id int, booking_id int, points int, expires_at time.Time) (err error) {
+	_, err = tx.ExecContext(ctx, addLoyaltyEntryQuery, user_id, booking_id, LoyaltyEarn, points, points, expires_at)
+	return
+}
+
+// reverseLoyaltyOfBooking undoes a cancelled booking's points: what it earned
+// is taken back as far as the user still has points, what it spent comes
+// back as a new lot.
+func reverseLoyaltyOfBooking(ctx context.Context, tx *sqlx.Tx, user_id int, booking_id int, refund_expires_at time.Time) (reversed int, refunded int, err error) {
+	var bl bookingLoyalty
+	if err = tx.GetContext(ctx, &bl, getLoyaltyOfBooking, booking_id, LoyaltyEarn, LoyaltyRedeem); err != nil {
+		return
+	}
+
+	if bl.Earned > 0 {
+		if reversed, err = drawLoyaltyPoints(ctx, tx, user_id, bl.Earned, bl.Earn_entry_id); err != nil {
+			return
+		}
+		if reversed > 0 {
+			_, err = tx.ExecContext(ctx, addLoyaltyEntryQuery, user_id, booking_id, LoyaltyReverse, -reversed, 0, nil)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	if bl.Redeemed > 0 {
+		refunded = bl.Redeemed
+		_, err = tx.ExecContext(ctx, addLoyaltyEntryQuery, user_id, booking_id, LoyaltyRefund, refunded, refunded, refund_expires_at)
+	}
+	return
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Coderx44/MovieTicketingPortal/config"
@@ -107,6 +109,29 @@ func getDBDriverInstance(db *sql.DB, driverName string) (driver database.Driver,
 	}
 }
 
+// LatestMigrationVersion is the version of the newest migration in the
+// migration path, the one a migrated database is at.
+func LatestMigrationVersion() (version uint, err error) {
+	files, err := filepath.Glob(filepath.Join(config.MigrationPath(), "*.up.sql"))
+	if err != nil {
+		return
+	}
+
+	for _, f := range files {
+		v, err := strconv.ParseUint(strings.SplitN(filepath.Base(f), "_", 2)[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration file name %v", f)
+		}
+		if uint(v) > version {
+			version = uint(v)
+		}
+	}
+	if version == 0 {
+		err = fmt.Errorf("no migrations found in %v", config.MigrationPath())
+	}
+	return
+}
+
 func GetMigrationPath() string {
 	return fmt.Sprintf("file://%s", config.MigrationPath())
 }
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	NotificationPending = "Pending"
+	NotificationSent    = "Sent"
+	NotificationFailed  = "Failed"
+
+	NotificationBookingConfirmed = "booking_confirmed"
+	NotificationPasswordReset    = "password_reset"
+)
+
+var ErrInvalidResetToken = errors.New("password reset token is invalid or expired")
+
+const (
+	// a claimed notification is leased to one dispatcher until locked_until,
+	// after which another may pick it up again
+	claimNotifications = `WITH claimed AS (
+		UPDATE notifications n SET locked_until = now() + $2 * interval '1 millisecond'
+		FROM (
+			SELECT notification_id FROM notifications
+			WHERE status=$3 AND next_attempt_at <= now() AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY notification_id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		) c
+		WHERE n.notification_id = c.notification_id
+		RETURNING n.notification_id, COALESCE(n.user_id, 0) AS user_id, n.kind, n.payload, n.attempts, n.delivered, n.created_at
+	)
+	SELECT c.*, COALESCE(u.name, '') AS name, COALESCE(u.email, '') AS email, COALESCE(u.phone_number, '') AS phone_number
+	FROM claimed c LEFT JOIN users u ON u.user_id = c.user_id
+	ORDER BY c.notification_id`
+	// reset tokens are no use to keep once they are out
+	recordNotification = `UPDATE notifications SET status=$2, delivered=$3, last_error=NULLIF($4, ''), next_attempt_at=$5,
+	attempts = attempts + 1, locked_until=NULL, sent_at = CASE WHEN $2 = $6 THEN now() END,
+	payload = CASE WHEN $2 = $6 AND kind = $7 THEN payload - 'token' ELSE payload END
+	WHERE notification_id=$1`
+	addPasswordResetQuery = `INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	usePasswordResetQuery = `UPDATE password_resets SET used_at=now()
+	WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+	RETURNING user_id`
+)
+
+// Notification is a queued notification together with who it is for.
+type Notification struct {
+	Notification_id int            `db:"notification_id"`
+	User_id         int            `db:"user_id"`
+	Kind            string         `db:"kind"`
+	Payload         []byte         `db:"payload"`
+	Attempts        int            `db:"attempts"`
+	Delivered       pq.StringArray `db:"delivered"`
+	Created_at      time.Time      `db:"created_at"`
+	Name            string         `db:"name"`
+	Email           string         `db:"email"`
+	Phone_number    string         `db:"phone_number"`
+}
+
+// NotificationResult is how an attempt at sending a notification went.
+// Status is Sent, Pending to try again at Next_attempt_at, or Failed.
+type NotificationResult struct {
+	Notification_id int
+	Status          string
+	Delivered       []string
+	Error           string
+	Next_attempt_at time.Time
+}
+
+// ClaimNotifications leases up to limit notifications that are due to the
+// caller for lease. Rows another dispatcher holds are skipped, so any number
+// of them can run side by side.
+func (s *store) ClaimNotifications(ctx context.Context, limit int, lease time.Duration) (notifications []Notification, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &notifications, claimNotifications, limit, lease.Milliseconds(), NotificationPending)
+	})
+	return
+}
+
+func (s *store) RecordNotification(ctx context.Context, r NotificationResult) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, recordNotification, r.Notification_id, r.Status, pq.StringArray(r.Delivered), r.Error,
+			r.Next_attempt_at, NotificationSent, NotificationPasswordReset)
+		return err
+	})
+	return
+}
+
+// queueNotification adds a notification to the outbox within a transaction.
+func queueNotification(ctx context.Context, tx *sqlx.Tx, user_id int, kind string, payload interface{}) (notification_id int, err error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	err = tx.GetContext(ctx, &notification_id, addNotificationQuery, user_id, kind, b)
+	return
+}
+
+// AddPasswordReset records a reset token by its hash and queues the token
+// to the user.
+func (s *store) AddPasswordReset(ctx context.Context, user_id int, token string, token_hash string, expires_at time.Time) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(ctx, addPasswordResetQuery, user_id, token_hash, expires_at); err != nil {
+				return err
+			}
+			_, err := queueNotification(ctx, tx, user_id, NotificationPasswordReset, map[string]interface{}{
+				"token":      token,
+				"expires_at": expires_at,
+			})
+			return err
+		})
+	})
+	return
+}
+
+// ResetPassword spends a reset token on a new password. A token works once.
+func (s *store) ResetPassword(ctx context.Context, token_hash string, password string) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var user_id int
+			err := tx.GetContext(ctx, &user_id, usePasswordResetQuery, token_hash)
+			if err == sql.ErrNoRows {
+				return ErrInvalidResetToken
+			}
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, updateUserPasswordQuery, user_id, password)
+			return err
+		})
+	})
+	return
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	ShiftOpen   = "Open"
+	ShiftClosed = "Closed"
+)
+
+var (
+	ErrShiftAlreadyOpen = errors.New("staff member already has an open shift")
+	ErrNoOpenShift      = errors.New("staff member has no open shift")
+)
+
+const (
+	openShiftQuery = `INSERT INTO pos_shifts (staff_id, multiplex_id, opening_float, status) VALUES ($1, $2, $3, $4)
+	returning shift_id, staff_id, multiplex_id, opening_float, counted_cash, status, opened_at, closed_at`
+	getOpenShift = `SELECT shift_id, staff_id, multiplex_id, opening_float, counted_cash, status, opened_at, closed_at
+	FROM pos_shifts WHERE staff_id=$1 AND status=$2`
+	closeShiftQuery = `UPDATE pos_shifts SET status=$3, counted_cash=$2, closed_at=now()
+	WHERE shift_id=$1 AND status=$4
+	returning shift_id, staff_id, multiplex_id, opening_float, counted_cash, status, opened_at, closed_at`
+	getDrawerTotals = `SELECT COALESCE(sum(amount) FILTER (WHERE method=$2), 0) AS cash_sales,
+	COALESCE(sum(amount) FILTER (WHERE method=$3), 0) AS card_sales,
+	count(*) AS bookings,
+	COALESCE(sum(tickets), 0) AS tickets
+	FROM (
+		SELECT p.amount, p.method,
+		(SELECT count(*) FROM booking_seats bs WHERE bs.booking_id = p.booking_id) AS tickets
+		FROM payments p
+		WHERE p.shift_id=$1 AND p.status=$4
+	) AS shift_payments`
+)
+
+type Shift struct {
+	Shift_id      int        `db:"shift_id"`
+	Staff_id      int        `db:"staff_id"`
+	Multiplex_id  int        `db:"multiplex_id"`
+	Opening_float int        `db:"opening_float"`
+	Counted_cash  *int       `db:"counted_cash"`
+	Status        string     `db:"status"`
+	Opened_at     time.Time  `db:"opened_at"`
+	Closed_at     *time.Time `db:"closed_at"`
+}
+
+type DrawerTotals struct {
+	Cash_sales int `db:"cash_sales"`
+	Card_sales int `db:"card_sales"`
+	Bookings   int `db:"bookings"`
+	Tickets    int `db:"tickets"`
+}
+
+func (s *store) OpenShift(ctx context.Context, staff_id int, multiplex_id int, opening_float int) (sh Shift, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &sh, openShiftQuery, staff_id, multiplex_id, opening_float, ShiftOpen)
+	})
+
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return sh, ErrShiftAlreadyOpen
+	}
+	return
+}
+
+func (s *store) GetOpenShift(ctx context.Context, staff_id int) (sh Shift, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &sh, getOpenShift, staff_id, ShiftOpen)
+	})
+
+	if err == sql.ErrNoRows {
+		return sh, ErrNoOpenShift
+	}
+	return
+}
+
+func (s *store) CloseShift(ctx context.Context, shift_id int, counted_cash int) (sh Shift, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &sh, closeShiftQuery, shift_id, counted_cash, ShiftClosed, ShiftOpen)
+	})
+
+	if err == sql.ErrNoRows {
+		return sh, ErrNoOpenShift
+	}
+	return
+}
+
+func (s *store) GetDrawerTotals(ctx context.Context, shift_id int) (t DrawerTotals, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &t, getDrawerTotals, shift_id, PaymentCash, PaymentCard, PaymentCaptured)
+	})
+	return
+}
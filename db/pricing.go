@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrPricingRuleNotFound = errors.New("pricing rule doesn't exist")
+
+const (
+	pricingRuleColumns = `rule_id, name, show_id, movie_id, multiplex_id, min_occupancy_pct, starts_within_mins,
+	adjust_bps, floor_price, ceiling_price, active, created_at`
+	addPricingRuleQuery = `INSERT INTO pricing_rules (name, show_id, movie_id, multiplex_id, min_occupancy_pct, starts_within_mins,
+	adjust_bps, floor_price, ceiling_price)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning rule_id`
+	getPricingRules       = `SELECT ` + pricingRuleColumns + ` FROM pricing_rules ORDER BY rule_id DESC`
+	getPricingRulesOfShow = `SELECT ` + pricingRuleColumns + ` FROM pricing_rules
+	WHERE active
+	AND (show_id IS NULL OR show_id=$1)
+	AND (movie_id IS NULL OR movie_id=$2)
+	AND (multiplex_id IS NULL OR multiplex_id=$3)
+	ORDER BY rule_id`
+	deactivatePricingRule = `UPDATE pricing_rules SET active=false WHERE rule_id=$1`
+	getOccupancyOfShow    = `SELECT count(*) FILTER (WHERE status=$2) AS booked,
+	count(*) FILTER (WHERE status<>$3) AS total
+	FROM seats WHERE show_id=$1`
+	// only seats whose price actually moves are locked, so repricing a show
+	// that is already priced right doesn't block bookings
+	repriceSeatsQuery = `WITH target AS (
+		SELECT seat_id,
+		LEAST(GREATEST(round(base_price::bigint * (10000 + $3) / 1000000.0)::int * 100, COALESCE($4, 0)), COALESCE($5, 2147483647)) AS new_price
+		FROM seats WHERE show_id=$1 AND status=$2
+	), changed AS (
+		SELECT s.seat_id, s.price AS old_price, t.new_price FROM target t JOIN seats s ON s.seat_id = t.seat_id
+		WHERE s.status=$2 AND s.price <> t.new_price
+		FOR UPDATE OF s
+	), updated AS (
+		UPDATE seats s SET price = c.new_price FROM changed c
+		WHERE s.seat_id = c.seat_id
+		RETURNING s.seat_id, c.old_price, c.new_price
+	)
+	INSERT INTO seat_price_changes (show_id, seat_id, old_price, new_price, rule_id, occupancy_pct)
+	SELECT $1, seat_id, old_price, new_price, NULLIF($6, 0), $7 FROM updated`
+	getPriceChangesOfShow = `SELECT pc.price_change_id, s.seat_number, pc.old_price, pc.new_price, COALESCE(pc.rule_id, 0) AS rule_id,
+	pc.occupancy_pct, pc.changed_at
+	FROM seat_price_changes pc JOIN seats s ON s.seat_id = pc.seat_id
+	WHERE pc.show_id=$1
+	ORDER BY pc.changed_at, s.seat_number`
+)
+
+type PricingRule struct {
+	Rule_id            int       `db:"rule_id"`
+	Name               string    `db:"name"`
+	Show_id            *int      `db:"show_id"`
+	Movie_id           *int      `db:"movie_id"`
+	Multiplex_id       *int      `db:"multiplex_id"`
+	Min_occupancy_pct  int       `db:"min_occupancy_pct"`
+	Starts_within_mins *int      `db:"starts_within_mins"`
+	Adjust_bps         int       `db:"adjust_bps"` // 1500 raises prices by 15%
+	Floor_price        *int      `db:"floor_price"`
+	Ceiling_price      *int      `db:"ceiling_price"`
+	Active             bool      `db:"active"`
+	Created_at         time.Time `db:"created_at"`
+}
+
+type Occupancy struct {
+	Booked int `db:"booked"`
+	Total  int `db:"total"` // seats that are on sale or sold
+}
+
+// Reprice moves the unsold seats of a show off their base price. A zero
+// Reprice puts them back on their base price.
+type Reprice struct {
+	Rule_id       int
+	Adjust_bps    int
+	Floor_price   *int
+	Ceiling_price *int
+	Occupancy_pct int
+}
+
+type PriceChange struct {
+	Price_change_id int       `db:"price_change_id"`
+	Seat_number     int       `db:"seat_number"`
+	Old_price       int       `db:"old_price"`
+	New_price       int       `db:"new_price"`
+	Rule_id         int       `db:"rule_id"`
+	Occupancy_pct   int       `db:"occupancy_pct"`
+	Changed_at      time.Time `db:"changed_at"`
+}
+
+func (s *store) AddPricingRule(ctx context.Context, r PricingRule) (rule_id uint, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &rule_id, addPricingRuleQuery, r.Name, r.Show_id, r.Movie_id, r.Multiplex_id,
+			r.Min_occupancy_pct, r.Starts_within_mins, r.Adjust_bps, r.Floor_price, r.Ceiling_price)
+	})
+	return
+}
+
+func (s *store) GetPricingRules(ctx context.Context) (rules []PricingRule, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &rules, getPricingRules)
+	})
+	return
+}
+
+// GetPricingRulesOfShow returns the active rules whose scope takes in the show.
+func (s *store) GetPricingRulesOfShow(ctx context.Context, sh Show) (rules []PricingRule, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &rules, getPricingRulesOfShow, sh.Show_id, sh.Movie_id, sh.Multiplex_id)
+	})
+	return
+}
+
+func (s *store) DeactivatePricingRule(ctx context.Context, rule_id int) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, deactivatePricingRule, rule_id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrPricingRuleNotFound
+		}
+		return nil
+	})
+	return
+}
+
+func (s *store) GetOccupancyOfShow(ctx context.Context, show_id int) (o Occupancy, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &o, getOccupancyOfShow, show_id, SeatBooked, SeatVoid)
+	})
+	return
+}
+
+// RepriceSeats sets the price of every unsold seat of a show and records each
+// change, returning how many seats changed price.
+func (s *store) RepriceSeats(ctx context.Context, show_id int, r Reprice) (changed int, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, repriceSeatsQuery, show_id, SeatAvailable, r.Adjust_bps, r.Floor_price, r.Ceiling_price,
+			r.Rule_id, r.Occupancy_pct)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		changed = int(n)
+		return err
+	})
+	return
+}
+
+func (s *store) GetPriceChangesOfShow(ctx context.Context, show_id int) (changes []PriceChange, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &changes, getPriceChangesOfShow, show_id)
+	})
+	return
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// the bucket refills at $3 tokens a second up to $2, then gives one up
+	// if it has it
+	refilledTokens     = `LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8)`
+	takeRateLimitToken = `INSERT INTO rate_limit_buckets AS b (bucket_key, tokens, allowed, updated_at)
+	VALUES ($1, $2::float8 - 1, true, now())
+	ON CONFLICT (bucket_key) DO UPDATE SET
+		tokens = ` + refilledTokens + ` - CASE WHEN ` + refilledTokens + ` >= 1 THEN 1 ELSE 0 END,
+		allowed = ` + refilledTokens + ` >= 1,
+		updated_at = now()
+	RETURNING b.tokens, b.allowed`
+	pruneRateLimitBuckets = `DELETE FROM rate_limit_buckets WHERE updated_at < $1`
+)
+
+// TakeRateLimitToken takes a token from the bucket under key, holding up to
+// burst tokens and refilling at perSecond, and returns the tokens left.
+func (s *store) TakeRateLimitToken(ctx context.Context, key string, burst int, perSecond float64) (tokens float64, allowed bool, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.QueryRowxContext(ctx, takeRateLimitToken, key, burst, perSecond).Scan(&tokens, &allowed)
+	})
+	return
+}
+
+// PruneRateLimitBuckets deletes buckets nobody took a token from since a
+// time; they would be full again by now.
+func (s *store) PruneRateLimitBuckets(ctx context.Context, before time.Time) (pruned int, err error) {
+
+	err = WithTimeout(ctx, bulkTimeout, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, pruneRateLimitBuckets, before)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		pruned = int(n)
+		return err
+	})
+	return
+}
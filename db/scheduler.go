@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	// the lease is only taken over once it ran out, and the job only runs
+	// once it is due
+	acquireJobLease = `INSERT INTO scheduled_jobs (name, locked_by, locked_until, last_started_at)
+	VALUES ($1, $2, now() + $3 * interval '1 millisecond', now())
+	ON CONFLICT (name) DO UPDATE SET locked_by=EXCLUDED.locked_by, locked_until=EXCLUDED.locked_until, last_started_at=now()
+	WHERE (scheduled_jobs.locked_until IS NULL OR scheduled_jobs.locked_until < now()) AND scheduled_jobs.next_run_at <= now()
+	RETURNING name`
+	releaseJobLease = `UPDATE scheduled_jobs SET locked_until=NULL, last_finished_at=now(), last_error=NULLIF($3, ''),
+	next_run_at = now() + $4 * interval '1 millisecond'
+	WHERE name=$1 AND locked_by=$2`
+	// bookings being reminded by another replica are skipped, the update
+	// and the notification go in one statement so a reminder is queued once
+	queueShowReminders = `WITH due AS (
+		SELECT b.booking_id, b.user_id, b.show_id, sh.start_time,
+		COALESCE((SELECT array_agg(s.seat_number ORDER BY s.seat_number) FROM booking_seats bs JOIN seats s ON s.seat_id = bs.seat_id
+			WHERE bs.booking_id = b.booking_id), '{}') AS seats
+		FROM bookings b
+		JOIN shows sh ON sh.show_id = b.show_id
+		WHERE b.status=$1 AND b.user_id IS NOT NULL AND b.reminded_at IS NULL
+		AND sh.status=$2 AND sh.start_time > now() AND sh.start_time <= now() + $3 * interval '1 millisecond'
+		ORDER BY sh.start_time
+		LIMIT $4
+		FOR UPDATE OF b SKIP LOCKED
+	), reminded AS (
+		UPDATE bookings b SET reminded_at=now() FROM due WHERE b.booking_id = due.booking_id
+	)
+	INSERT INTO notifications (user_id, kind, payload)
+	SELECT user_id, $5, jsonb_build_object('booking_id', booking_id, 'show_id', show_id, 'start_time', start_time, 'seats', seats)
+	FROM due`
+)
+
+// AcquireJobLease takes the named job for owner for lease when it is due
+// and nobody else holds it.
+func (s *store) AcquireJobLease(ctx context.Context, name string, owner string, lease time.Duration) (ok bool, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		var got string
+		err := s.db.GetContext(ctx, &got, acquireJobLease, name, owner, lease.Milliseconds())
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		ok = err == nil
+		return err
+	})
+	return
+}
+
+// ReleaseJobLease records how a run went and when the job is due next.
+func (s *store) ReleaseJobLease(ctx context.Context, name string, owner string, runErr string, every time.Duration) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, releaseJobLease, name, owner, runErr, every.Milliseconds())
+		return err
+	})
+	return
+}
+
+// QueueShowReminders queues a reminder for up to limit confirmed bookings of
+// shows starting within lead that haven't had one.
+func (s *store) QueueShowReminders(ctx context.Context, lead time.Duration, limit int, kind string) (queued int, err error) {
+
+	err = WithTimeout(ctx, bulkTimeout, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, queueShowReminders, BookingConfirmed, ShowScheduled, lead.Milliseconds(), limit, kind)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		queued = int(n)
+		return err
+	})
+	return
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	getLatestSeatChange  = `SELECT COALESCE(max(change_id), 0) FROM seat_changes`
+	seatChangeQuery      = `SELECT change_id, show_id, seat_number, status, changed_at FROM seat_changes`
+	getSeatChanges       = seatChangeQuery + ` WHERE change_id > $1 ORDER BY change_id LIMIT $2`
+	getSeatChangesOfShow = seatChangeQuery + ` WHERE show_id=$1 AND change_id > $2 ORDER BY change_id LIMIT $3`
+	// changes after $1 are all still there when nothing newer than it was pruned
+	seatChangesKeptSince = `SELECT COALESCE(min(change_id), 0) <= $1 + 1 FROM seat_changes`
+	pruneSeatChanges     = `DELETE FROM seat_changes WHERE changed_at < $1`
+)
+
+// SeatChange is a seat moving to a new status.
+type SeatChange struct {
+	Change_id   int64     `json:"-" db:"change_id"`
+	Show_id     int       `json:"show_id" db:"show_id"`
+	Seat_number int       `json:"seat_number" db:"seat_number"`
+	Status      string    `json:"status" db:"status"`
+	Changed_at  time.Time `json:"changed_at" db:"changed_at"`
+}
+
+func (s *store) GetLatestSeatChange(ctx context.Context) (change_id int64, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &change_id, getLatestSeatChange)
+	})
+	return
+}
+
+// GetSeatChanges returns up to limit changes of any show after change_id.
+func (s *store) GetSeatChanges(ctx context.Context, after int64, limit int) (changes []SeatChange, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &changes, getSeatChanges, after, limit)
+	})
+	return
+}
+
+// GetSeatChangesOfShow returns the changes of a show after change_id.
+// complete is false when some of them were pruned or there are more than
+// limit, the caller is better off starting over from the seat map then.
+func (s *store) GetSeatChangesOfShow(ctx context.Context, show_id int, after int64, limit int) (changes []SeatChange, complete bool, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		if err := s.db.GetContext(ctx, &complete, seatChangesKeptSince, after); err != nil || !complete {
+			return err
+		}
+		if err := s.db.SelectContext(ctx, &changes, getSeatChangesOfShow, show_id, after, limit+1); err != nil {
+			return err
+		}
+		if len(changes) > limit {
+			changes, complete = nil, false
+		}
+		return nil
+	})
+	return
+}
+
+// PruneSeatChanges deletes changes made before a time.
+func (s *store) PruneSeatChanges(ctx context.Context, before time.Time) (pruned int, err error) {
+
+	err = WithTimeout(ctx, bulkTimeout, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, pruneSeatChanges, before)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		pruned = int(n)
+		return err
+	})
+	return
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var ErrOverlappingShow = errors.New("show overlaps another show on the screen")
+
+const (
+	getShowByID    = `SELECT show_id, show_date, start_time, end_time, screen_id, movie_id, multiplex_id, status FROM shows WHERE show_id=$1`
+	getShowsOnSale = `SELECT show_id, show_date, start_time, end_time, screen_id, movie_id, multiplex_id, status FROM shows
+	WHERE status=$1 AND start_time > now() ORDER BY start_time`
+	getScreenByID = `SELECT * FROM screens WHERE screen_id=$1`
+	getMovieByID  = `SELECT movie_id, title, COALESCE(duration, 0) AS duration FROM movies WHERE movie_id=$1`
+
+	rescheduleShowQuery = `UPDATE shows SET show_date=$2, start_time=$3, end_time=$4, screen_id=$5
+	WHERE show_id=$1
+	AND NOT EXISTS (
+		SELECT 1 FROM shows
+		WHERE screen_id = $5
+		AND show_id <> $1
+		AND status <> 'Cancelled'
+		AND start_time < $4::timestamptz + make_interval(mins => $6)
+		AND $3::timestamptz < end_time + make_interval(mins => $6)
+	)
+	RETURNING show_id`
+	// a moved show is reminded of again at its new time
+	resetShowReminders = `UPDATE bookings SET reminded_at=NULL WHERE show_id=$1 AND reminded_at IS NOT NULL`
+	getMaxSeatNumber   = `SELECT COALESCE(max(seat_number), 0) FROM seats WHERE show_id=$1`
+	addSeatRange       = `INSERT INTO seats (seat_number, price, base_price, show_id, status)
+	SELECT n, $5, $5, $1, $2 FROM generate_series($3::int, $4::int) AS n`
+	// seats a bigger screen adds come at the show's base price, and on sale
+	// at what its unsold seats cost now so they match the pricing rule
+	extendSeatRange = `INSERT INTO seats (seat_number, price, base_price, show_id, status)
+	SELECT n, p.price, p.base_price, $1, $2 FROM generate_series($3::int, $4::int) AS n, (
+		SELECT CASE WHEN status=$2 THEN price ELSE base_price END AS price, base_price FROM seats
+		WHERE show_id=$1
+		ORDER BY status=$2 DESC, seat_number DESC
+		LIMIT 1
+	) p`
+	// seats a live booking still holds, flagged when an earlier move voided
+	// them, go back to it
+	restoreSeats = `UPDATE seats s SET status = CASE WHEN EXISTS (
+		SELECT 1 FROM booking_seats bs JOIN bookings b ON b.booking_id = bs.booking_id
+		WHERE bs.seat_id = s.seat_id AND b.status <> $5
+	) THEN $6 ELSE $2 END
+	WHERE s.show_id=$1 AND s.status=$3 AND s.seat_number <= $4`
+	voidSeatsAbove          = `UPDATE seats SET status=$2 WHERE show_id=$1 AND seat_number > $3`
+	getActiveBookingsOfShow = `SELECT b.booking_id, COALESCE(b.user_id, 0) AS user_id, b.status,
+	COALESCE(array_agg(s.seat_number ORDER BY s.seat_number) FILTER (WHERE s.seat_id IS NOT NULL), '{}') AS seats,
+	COALESCE(bool_or(s.seat_number > $3), false) AS unmapped
+	FROM bookings b
+	LEFT JOIN booking_seats bs ON bs.booking_id = b.booking_id
+	LEFT JOIN seats s ON s.seat_id = bs.seat_id
+	WHERE b.show_id=$1 AND b.status <> $2
+	GROUP BY b.booking_id
+	ORDER BY b.booking_id`
+	setBookingStatus = `UPDATE bookings SET status=$2 WHERE booking_id=$1`
+)
+
+type MigratedBooking struct {
+	Booking_id      int           `db:"booking_id"`
+	User_id         int           `db:"user_id"`
+	Status          string        `db:"status"`
+	Seats           pq.Int64Array `db:"seats"`
+	Unmapped        bool          `db:"unmapped"`
+	Notification_id int           `db:"-"`
+}
+
+// GetShowsOnSale returns the scheduled shows that haven't started yet.
+func (s *store) GetShowsOnSale(ctx context.Context) (shows []Show, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &shows, getShowsOnSale, ShowScheduled)
+	})
+	return
+}
+
+func (s *store) GetShowByID(ctx context.Context, show_id int) (sh Show, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &sh, getShowByID, show_id)
+	})
+
+	if err == sql.ErrNoRows {
+		return sh, ErrShowNotFound
+	}
+	return
+}
+
+func (s *store) GetScreenByID(ctx context.Context, screen_id int) (sn Screen, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &sn, getScreenByID, screen_id)
+	})
+
+	if err == sql.ErrNoRows {
+		return sn, errors.New("screen doesn't exist")
+	}
+	return
+}
+
+func (s *store) GetMovieByID(ctx context.Context, movie_id int) (m Movie, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &m, getMovieByID, movie_id)
+	})
+
+	if err == sql.ErrNoRows {
+		return m, errors.New("movie doesn't exist")
+	}
+	return
+}
+
+// RescheduleShow moves a show to new times and/or a new screen. Seats are
+// identified by their number, so a booking keeps its seats as long as the new
+// screen has that many seats; bookings holding a seat number the new screen
+// doesn't have are flagged for the customer to act on. Every customer with a
+// booking is queued a notification.
+func (s *store) RescheduleShow(ctx context.Context, sh Show, cleaning_buffer_mins int, total_seats int) (migrated []MigratedBooking, err error) {
+
+	err = WithTimeout(ctx, bulkTimeout, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var status string
+			err := tx.GetContext(ctx, &status, getShowStatus, sh.Show_id)
+			if err == sql.ErrNoRows {
+				return ErrShowNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if status == ShowCancelled {
+				return ErrShowAlreadyCancelled
+			}
+
+			var id int
+			err = tx.GetContext(ctx, &id, rescheduleShowQuery, sh.Show_id, sh.Show_date, sh.Start_time, sh.End_time, sh.Screen_id, cleaning_buffer_mins)
+			if err == sql.ErrNoRows {
+				return ErrOverlappingShow
+			}
+			if err != nil {
+				return err
+			}
+
+			if _, err = tx.ExecContext(ctx, resetShowReminders, sh.Show_id); err != nil {
+				return err
+			}
+
+			var max_seat int
+			if err = tx.GetContext(ctx, &max_seat, getMaxSeatNumber, sh.Show_id); err != nil {
+				return err
+			}
+			if total_seats > max_seat {
+				if _, err = tx.ExecContext(ctx, extendSeatRange, sh.Show_id, SeatAvailable, max_seat+1, total_seats); err != nil {
+					return err
+				}
+			}
+			if _, err = tx.ExecContext(ctx, restoreSeats, sh.Show_id, SeatAvailable, SeatVoid, total_seats, BookingCancelled, SeatBooked); err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, voidSeatsAbove, sh.Show_id, SeatVoid, total_seats); err != nil {
+				return err
+			}
+
+			if err = tx.SelectContext(ctx, &migrated, getActiveBookingsOfShow, sh.Show_id, BookingCancelled, total_seats); err != nil {
+				return err
+			}
+
+			for i := range migrated {
+				m := &migrated[i]
+				// a booking flagged by an earlier move can fit again
+				status := m.Status
+				if m.Unmapped && m.Status == BookingConfirmed {
+					status = BookingActionRequired
+				} else if !m.Unmapped && m.Status == BookingActionRequired {
+					status = BookingConfirmed
+				}
+				if status != m.Status {
+					if _, err = tx.ExecContext(ctx, setBookingStatus, m.Booking_id, status); err != nil {
+						return err
+					}
+					m.Status = status
+				}
+
+				if m.User_id == 0 {
+					continue
+				}
+				payload, err := json.Marshal(map[string]interface{}{
+					"booking_id":      m.Booking_id,
+					"show_id":         sh.Show_id,
+					"seats":           m.Seats,
+					"start_time":      sh.Start_time,
+					"action_required": m.Unmapped,
+				})
+				if err != nil {
+					return err
+				}
+				err = tx.GetContext(ctx, &m.Notification_id, addNotificationQuery, m.User_id, NotificationShowRescheduled, payload)
+				if err != nil {
+					return err
+				}
+			}
+
+			d, err := getShowDetail(ctx, tx, sh.Show_id)
+			if err != nil {
+				return err
+			}
+			ev := ShowRescheduledEvent{ShowDetail: d, Bookings: len(migrated)}
+			for _, m := range migrated {
+				if m.Unmapped {
+					ev.Action_required++
+				}
+			}
+			return addEvent(ctx, tx, ev)
+		})
+	})
+	return
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// What a tax rate is charged on
+const (
+	TaxOnTickets = "tickets"
+	TaxOnFees    = "fees"
+	TaxOnFnb     = "fnb"
+)
+
+const (
+	getTaxRates            = `SELECT tax_rate_id, state, name, rate_bps, applies_to FROM tax_rates ORDER BY state, applies_to, name`
+	getTaxRatesOfMultiplex = `SELECT t.tax_rate_id, t.state, t.name, t.rate_bps, t.applies_to
+	FROM multiplexes mx
+	JOIN locations l ON l.location_id = mx.location_id
+	JOIN tax_rates t ON t.state = l.state
+	WHERE mx.multiplex_id=$1
+	ORDER BY t.applies_to, t.name`
+	deleteTaxRatesOfState = `DELETE FROM tax_rates WHERE state=$1`
+	addTaxRateQuery       = `INSERT INTO tax_rates (state, name, rate_bps, applies_to) VALUES ($1, $2, $3, $4)`
+)
+
+type TaxRate struct {
+	Tax_rate_id int    `db:"tax_rate_id"`
+	State       string `db:"state"`
+	Name        string `db:"name"`
+	Rate_bps    int    `db:"rate_bps"` // 900 is 9%
+	Applies_to  string `db:"applies_to"`
+}
+
+func (s *store) GetTaxRates(ctx context.Context) (rates []TaxRate, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &rates, getTaxRates)
+	})
+	return
+}
+
+// GetTaxRatesOfMultiplex returns the rates of the state the multiplex is in.
+func (s *store) GetTaxRatesOfMultiplex(ctx context.Context, multiplex_id int) (rates []TaxRate, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &rates, getTaxRatesOfMultiplex, multiplex_id)
+	})
+	return
+}
+
+// SetTaxRates replaces every rate of a state with the given ones.
+func (s *store) SetTaxRates(ctx context.Context, state string, rates []TaxRate) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(ctx, deleteTaxRatesOfState, state); err != nil {
+				return err
+			}
+			for _, r := range rates {
+				if _, err := tx.ExecContext(ctx, addTaxRateQuery, state, r.Name, r.Rate_bps, r.Applies_to); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+var ErrStaffNotFound = errors.New("staff member doesn't exist")
+
+const (
+	updateUserProfileQuery  = `UPDATE users SET name=$2, phone_number=$3 WHERE user_id=$1`
+	updateUserPasswordQuery = `UPDATE users SET password=$2 WHERE user_id=$1`
+	setStaffMultiplexQuery  = `UPDATE users SET multiplex_id=$2 WHERE email=$1 AND role='staff'`
+)
+
+func (s *store) UpdateUserProfile(ctx context.Context, user_id int, name string, phone_number string) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, updateUserProfileQuery, user_id, name, phone_number)
+		return err
+	})
+	return
+}
+
+// SetStaffMultiplex moves a staff member to another multiplex.
+func (s *store) SetStaffMultiplex(ctx context.Context, email string, multiplex_id int) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, setStaffMultiplexQuery, email, multiplex_id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrStaffNotFound
+		}
+		return nil
+	})
+	return
+}
+
+func (s *store) UpdateUserPassword(ctx context.Context, user_id int, password string) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, updateUserPasswordQuery, user_id, password)
+		return err
+	})
+	return
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	QueueWaiting  = "Waiting"
+	QueueAdmitted = "Admitted"
+	QueueExpired  = "Expired"
+	QueueClosed   = "Closed"
+)
+
+var (
+	ErrWaitingRoomExists   = errors.New("a waiting room is already open for the show or movie")
+	ErrWaitingRoomNotFound = errors.New("waiting room doesn't exist or is closed")
+	ErrNoWaitingRoom       = errors.New("show has no waiting room open")
+	ErrNotQueued           = errors.New("not in the queue of the waiting room")
+)
+
+const (
+	waitingRoomQuery = `SELECT w.room_id, COALESCE(w.show_id, 0) AS show_id, COALESCE(w.movie_id, 0) AS movie_id,
+	w.admit_per_minute, w.admission_mins, w.active, w.created_at,
+	(SELECT count(*) FROM queue_tokens q WHERE q.room_id = w.room_id AND q.status = 'Waiting') AS waiting,
+	(SELECT count(*) FROM queue_tokens q WHERE q.room_id = w.room_id AND q.status = 'Admitted' AND q.expires_at > now()) AS admitted
+	FROM waiting_rooms w`
+	addWaitingRoomQuery = `INSERT INTO waiting_rooms (show_id, movie_id, admit_per_minute, admission_mins, created_by)
+	VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4, NULLIF($5, 0)) returning room_id`
+	getWaitingRoomByID    = waitingRoomQuery + ` WHERE w.room_id=$1`
+	getActiveWaitingRooms = waitingRoomQuery + ` WHERE w.active ORDER BY w.room_id`
+	// a room for the show itself wins over one for its movie
+	getWaitingRoomOfShow = waitingRoomQuery + ` JOIN shows sh ON sh.show_id = w.show_id OR sh.movie_id = w.movie_id
+	WHERE sh.show_id=$1 AND w.active
+	ORDER BY w.show_id IS NULL
+	LIMIT 1`
+	closeWaitingRoomQuery = `UPDATE waiting_rooms SET active=false, closed_at=now() WHERE room_id=$1 AND active`
+	closeQueueOfRoom      = `UPDATE queue_tokens SET status=$2 WHERE room_id=$1 AND status=$3`
+	queueTokenQuery       = `SELECT q.token_id, q.room_id, q.user_id, q.token, q.status, q.joined_at, q.admitted_at, q.expires_at,
+	CASE WHEN q.status = 'Waiting' THEN
+		(SELECT count(*) FROM queue_tokens o WHERE o.room_id = q.room_id AND o.status = 'Waiting' AND o.token_id < q.token_id) + 1
+	ELSE 0 END AS position
+	FROM queue_tokens q`
+	getQueueTokenOfUser = queueTokenQuery + ` WHERE q.room_id=$1 AND q.user_id=$2 AND q.status IN ('Waiting', 'Admitted')`
+	// an admission that ran out sends the customer to the back of the queue
+	expireAdmissionOfUser = `UPDATE queue_tokens SET status=$3 WHERE room_id=$1 AND user_id=$2 AND status=$4 AND expires_at <= now()`
+	addQueueToken         = `INSERT INTO queue_tokens (room_id, user_id, token) VALUES ($1, $2, $3)
+	ON CONFLICT (room_id, user_id) WHERE status IN ('Waiting', 'Admitted') DO NOTHING`
+	isAdmitted = `SELECT EXISTS (SELECT 1 FROM queue_tokens
+	WHERE room_id=$1 AND user_id=$2 AND token=$3 AND status=$4 AND expires_at > now())`
+	lockRoomsToAdmit = `SELECT room_id, admit_per_minute, admission_mins, EXTRACT(EPOCH FROM now() - last_admitted_at) AS elapsed
+	FROM waiting_rooms WHERE active
+	FOR UPDATE SKIP LOCKED`
+	admitFromQueue = `UPDATE queue_tokens SET status=$3, admitted_at=now(), expires_at = now() + make_interval(mins => $4)
+	WHERE token_id IN (
+		SELECT token_id FROM queue_tokens WHERE room_id=$1 AND status=$5
+		ORDER BY token_id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	)`
+	// admissions not used for want of anyone waiting aren't saved up
+	setLastAdmitted = `UPDATE waiting_rooms SET last_admitted_at = CASE WHEN $3::boolean THEN now()
+	ELSE last_admitted_at + $2::float8 * interval '1 millisecond' END
+	WHERE room_id=$1`
+)
+
+type WaitingRoom struct {
+	Room_id          int       `db:"room_id"`
+	Show_id          int       `db:"show_id"`
+	Movie_id         int       `db:"movie_id"`
+	Admit_per_minute int       `db:"admit_per_minute"`
+	Admission_mins   int       `db:"admission_mins"`
+	Active           bool      `db:"active"`
+	Created_at       time.Time `db:"created_at"`
+	Waiting          int       `db:"waiting"`
+	Admitted         int       `db:"admitted"`
+	Created_by       int       `db:"-"`
+}
+
+type QueueToken struct {
+	Token_id    int64      `db:"token_id"`
+	Room_id     int        `db:"room_id"`
+	User_id     int        `db:"user_id"`
+	Token       string     `db:"token"`
+	Status      string     `db:"status"`
+	Joined_at   time.Time  `db:"joined_at"`
+	Admitted_at *time.Time `db:"admitted_at"`
+	Expires_at  *time.Time `db:"expires_at"`
+	Position    int        `db:"position"` // while waiting, 1 is next in line
+}
+
+func (s *store) OpenWaitingRoom(ctx context.Context, w WaitingRoom) (room_id int, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &room_id, addWaitingRoomQuery, w.Show_id, w.Movie_id, w.Admit_per_minute, w.Admission_mins, w.Created_by)
+	})
+
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return room_id, ErrWaitingRoomExists
+	}
+	return
+}
+
+func (s *store) GetWaitingRoom(ctx context.Context, room_id int) (w WaitingRoom, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &w, getWaitingRoomByID, room_id)
+	})
+
+	if err == sql.ErrNoRows {
+		return w, ErrWaitingRoomNotFound
+	}
+	return
+}
+
+func (s *store) GetActiveWaitingRooms(ctx context.Context) (rooms []WaitingRoom, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &rooms, getActiveWaitingRooms)
+	})
+	return
+}
+
+// GetWaitingRoomOfShow returns the open waiting room a show's customers go
+// through, that of the show or else that of its movie.
+func (s *store) GetWaitingRoomOfShow(ctx context.Context, show_id int) (w WaitingRoom, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &w, getWaitingRoomOfShow, show_id)
+	})
+
+	if err == sql.ErrNoRows {
+		return w, ErrNoWaitingRoom
+	}
+	return
+}
+
+// CloseWaitingRoom lets everyone through again; whoever was still waiting
+// is taken out of the queue.
+func (s *store) CloseWaitingRoom(ctx context.Context, room_id int) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			res, err := tx.ExecContext(ctx, closeWaitingRoomQuery, room_id)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrWaitingRoomNotFound
+			}
+			_, err = tx.ExecContext(ctx, closeQueueOfRoom, room_id, QueueClosed, QueueWaiting)
+			return err
+		})
+	})
+	return
+}
+
+// JoinQueue puts the customer at the back of a room's queue with the given
+// token, unless they are already in it, and returns their place.
+func (s *store) JoinQueue(ctx context.Context, room_id int, user_id int, token string) (q QueueToken, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, expireAdmissionOfUser, room_id, user_id, QueueExpired, QueueAdmitted)
+			if err != nil {
+				return err
+			}
+			if _, err = tx.ExecContext(ctx, addQueueToken, room_id, user_id, token); err != nil {
+				return err
+			}
+			return tx.GetContext(ctx, &q, getQueueTokenOfUser, room_id, user_id)
+		})
+	})
+	return
+}
+
+func (s *store) GetQueueToken(ctx context.Context, room_id int, user_id int) (q QueueToken, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &q, getQueueTokenOfUser, room_id, user_id)
+	})
+
+	if err == sql.ErrNoRows {
+		return q, ErrNotQueued
+	}
+	return
+}
+
+// IsAdmitted tells whether token admits the customer to a room right now.
+func (s *store) IsAdmitted(ctx context.Context, room_id int, user_id int, token string) (admitted bool, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &admitted, isAdmitted, room_id, user_id, token, QueueAdmitted)
+	})
+	return
+}
+
+// AdmitFromWaitingRooms lets the customers at the front of every open queue
+// in, as many as each room's rate allows since it last did. Rooms another
+// server is admitting from are skipped.
+func (s *store) AdmitFromWaitingRooms(ctx context.Context) (admitted int, err error) {
+
+	err = WithTimeout(ctx, bulkTimeout, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var rooms []struct {
+				Room_id          int     `db:"room_id"`
+				Admit_per_minute int     `db:"admit_per_minute"`
+				Admission_mins   int     `db:"admission_mins"`
+				Elapsed          float64 `db:"elapsed"`
+			}
+			if err := tx.SelectContext(ctx, &rooms, lockRoomsToAdmit); err != nil {
+				return err
+			}
+
+			for _, r := range rooms {
+				owed := int(r.Elapsed * float64(r.Admit_per_minute) / 60)
+				if owed == 0 {
+					continue
+				}
+				res, err := tx.ExecContext(ctx, admitFromQueue, r.Room_id, owed, QueueAdmitted, r.Admission_mins, QueueWaiting)
+				if err != nil {
+					return err
+				}
+				n, err := res.RowsAffected()
+				if err != nil {
+					return err
+				}
+				admitted += int(n)
+
+				// the fraction of an admission not yet owed carries over
+				spent := time.Duration(owed) * time.Minute / time.Duration(r.Admit_per_minute)
+				if _, err = tx.ExecContext(ctx, setLastAdmitted, r.Room_id, spent.Milliseconds(), int(n) < owed); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return
+}
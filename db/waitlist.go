@@ -0,0 +1,294 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	WaitlistWaiting = "Waiting"
+	WaitlistOffered = "Offered"
+	WaitlistClaimed = "Claimed"
+	WaitlistExpired = "Expired"
+	WaitlistLeft    = "Left"
+	// the show was cancelled
+	WaitlistClosed = "Closed"
+
+	NotificationWaitlistOffer = "waitlist_offer"
+)
+
+var (
+	ErrShowNotSoldOut    = errors.New("show still has seats available")
+	ErrAlreadyWaitlisted = errors.New("already on the waitlist of the show")
+	ErrNotWaitlisted     = errors.New("not on the waitlist of the show")
+)
+
+var activeWaitlist = pq.StringArray{WaitlistWaiting, WaitlistOffered}
+
+const (
+	countAvailableSeats = `SELECT count(*) FROM seats WHERE show_id=$1 AND status=$2`
+	anyoneWaiting       = `SELECT EXISTS (SELECT 1 FROM waitlist WHERE show_id=$1 AND status=$2)`
+	addWaitlistQuery    = `INSERT INTO waitlist (show_id, user_id, seats) VALUES ($1, $2, $3) returning entry_id`
+	// position counts the people still waiting up to and including the entry
+	getWaitlistEntry = `SELECT w.entry_id, w.show_id, w.user_id, w.seats, w.status, w.offer_expires_at, w.created_at,
+	CASE WHEN w.status = $3 THEN (
+		SELECT count(*) FROM waitlist o WHERE o.show_id = w.show_id AND o.status = $3 AND o.entry_id <= w.entry_id
+	) ELSE 0 END AS position,
+	COALESCE((SELECT array_agg(s.seat_number ORDER BY s.seat_number) FROM seats s
+		WHERE s.held_for = w.entry_id AND s.status = $4), '{}') AS held_seats
+	FROM waitlist w
+	WHERE w.show_id=$1 AND w.user_id=$2 AND w.status = ANY($5)`
+	lockWaitlistOfUser = `SELECT entry_id, status FROM waitlist WHERE show_id=$1 AND user_id=$2 AND status = ANY($3) FOR UPDATE`
+	lockOfferOfUser    = `SELECT entry_id FROM waitlist
+	WHERE show_id=$1 AND user_id=$2 AND status=$3 AND offer_expires_at > now()
+	FOR UPDATE`
+	setWaitlistStatus  = `UPDATE waitlist SET status=$2 WHERE entry_id=$1`
+	lockAvailableSeats = `SELECT seat_id, seat_number, price, status, show_id FROM seats
+	WHERE show_id=$1 AND status=$2
+	ORDER BY seat_number
+	FOR UPDATE`
+	lockWaitingEntries = `SELECT entry_id, show_id, user_id, seats, status FROM waitlist
+	WHERE show_id=$1 AND status=$2
+	ORDER BY entry_id
+	FOR UPDATE`
+	holdSeatsQuery  = `UPDATE seats SET status=$2, held_for=$3, held_until=$4 WHERE seat_id = ANY($1)`
+	offerEntryQuery = `UPDATE waitlist SET status=$2, offered_at=now(), offer_expires_at=$3 WHERE entry_id=$1`
+	// seats are locked before the waitlist entries they are held for, the
+	// same order booking locks them in
+	lockLapsedHeldSeats = `SELECT s.seat_id FROM seats s
+	JOIN waitlist w ON w.entry_id = s.held_for
+	WHERE s.show_id=$1 AND s.status=$2 AND w.status=$3 AND w.offer_expires_at <= now()
+	ORDER BY s.seat_number
+	FOR UPDATE OF s`
+	lockHeldSeatsOfUser = `SELECT s.seat_id FROM seats s
+	JOIN waitlist w ON w.entry_id = s.held_for
+	WHERE s.show_id=$1 AND s.status=$2 AND w.user_id=$3 AND w.status=$4
+	ORDER BY s.seat_number
+	FOR UPDATE OF s`
+	expireOffersOfShow = `UPDATE waitlist SET status=$3
+	WHERE show_id=$1 AND status=$2 AND offer_expires_at <= now()
+	RETURNING entry_id`
+	releaseHeldSeats         = `UPDATE seats SET status=$2, held_for=NULL, held_until=NULL WHERE held_for = ANY($1) AND status=$3`
+	closeWaitlistOfShow      = `UPDATE waitlist SET status=$3 WHERE show_id=$1 AND status = ANY($2)`
+	getShowsWithLapsedOffers = `SELECT show_id, show_date, start_time, end_time, screen_id, movie_id, multiplex_id, status FROM shows
+	WHERE status=$1 AND start_time > now()
+	AND show_id IN (SELECT show_id FROM waitlist WHERE status=$2 AND offer_expires_at <= now())
+	ORDER BY start_time`
+)
+
+type WaitlistEntry struct {
+	Entry_id         int           `db:"entry_id"`
+	Show_id          int           `db:"show_id"`
+	User_id          int           `db:"user_id"`
+	Seats            int           `db:"seats"`
+	Status           string        `db:"status"`
+	Offer_expires_at *time.Time    `db:"offer_expires_at"`
+	Created_at       time.Time     `db:"created_at"`
+	Position         int           `db:"position"` // 0 once offered
+	Held_seats       pq.Int64Array `db:"held_seats"`
+}
+
+// WaitlistOffer is a hold placed for the next customer in line.
+type WaitlistOffer struct {
+	Entry_id        int
+	User_id         int
+	Seats           []int64
+	Expires_at      time.Time
+	Notification_id int
+}
+
+// JoinWaitlist queues a customer for seats of a show nobody can book right
+// now.
+func (s *store) JoinWaitlist(ctx context.Context, show_id int, user_id int, seats int) (entry_id int, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var status string
+			err := tx.GetContext(ctx, &status, lockShowForBooking, show_id)
+			if err == sql.ErrNoRows {
+				return ErrShowNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if status != ShowScheduled {
+				return ErrShowNotBookable
+			}
+
+			var available int
+			if err = tx.GetContext(ctx, &available, countAvailableSeats, show_id, SeatAvailable); err != nil {
+				return err
+			}
+			if available > 0 {
+				return ErrShowNotSoldOut
+			}
+
+			err = tx.GetContext(ctx, &entry_id, addWaitlistQuery, show_id, user_id, seats)
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrAlreadyWaitlisted
+			}
+			return err
+		})
+	})
+	return
+}
+
+// GetWaitlistEntry returns where a customer is on a show's waitlist, and the
+// seats held for them once they have an offer.
+func (s *store) GetWaitlistEntry(ctx context.Context, show_id int, user_id int) (e WaitlistEntry, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &e, getWaitlistEntry, show_id, user_id, WaitlistWaiting, SeatHeld, activeWaitlist)
+	})
+
+	if err == sql.ErrNoRows {
+		return e, ErrNotWaitlisted
+	}
+	return
+}
+
+// LeaveWaitlist takes a customer off a show's waitlist. Seats held for them
+// go to whoever is next, held until hold_until.
+func (s *store) LeaveWaitlist(ctx context.Context, show_id int, user_id int, hold_until time.Time) (offers []WaitlistOffer, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var held pq.Int64Array
+			if err := tx.SelectContext(ctx, &held, lockHeldSeatsOfUser, show_id, SeatHeld, user_id, WaitlistOffered); err != nil {
+				return err
+			}
+
+			var e WaitlistEntry
+			err := tx.GetContext(ctx, &e, lockWaitlistOfUser, show_id, user_id, activeWaitlist)
+			if err == sql.ErrNoRows {
+				return ErrNotWaitlisted
+			}
+			if err != nil {
+				return err
+			}
+
+			if _, err = tx.ExecContext(ctx, setWaitlistStatus, e.Entry_id, WaitlistLeft); err != nil {
+				return err
+			}
+			if e.Status != WaitlistOffered {
+				return nil
+			}
+			if _, err = tx.ExecContext(ctx, releaseHeldSeats, pq.Int64Array{int64(e.Entry_id)}, SeatAvailable, SeatHeld); err != nil {
+				return err
+			}
+			offers, err = offerReleasedSeats(ctx, tx, show_id, hold_until)
+			return err
+		})
+	})
+	return
+}
+
+// ExpireWaitlistOffers releases the seats of offers nobody claimed in time
+// and offers whatever is free to the next in line, held until hold_until.
+func (s *store) ExpireWaitlistOffers(ctx context.Context, show_id int, hold_until time.Time) (offers []WaitlistOffer, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			var held pq.Int64Array
+			if err := tx.SelectContext(ctx, &held, lockLapsedHeldSeats, show_id, SeatHeld, WaitlistOffered); err != nil {
+				return err
+			}
+
+			var expired pq.Int64Array
+			if err := tx.SelectContext(ctx, &expired, expireOffersOfShow, show_id, WaitlistOffered, WaitlistExpired); err != nil {
+				return err
+			}
+			if len(expired) > 0 {
+				if _, err := tx.ExecContext(ctx, releaseHeldSeats, expired, SeatAvailable, SeatHeld); err != nil {
+					return err
+				}
+			}
+			var err error
+			offers, err = offerReleasedSeats(ctx, tx, show_id, hold_until)
+			return err
+		})
+	})
+	return
+}
+
+// GetShowsWithLapsedOffers returns the shows on sale that have waitlist
+// offers nobody claimed in time.
+func (s *store) GetShowsWithLapsedOffers(ctx context.Context) (shows []Show, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &shows, getShowsWithLapsedOffers, ShowScheduled, WaitlistOffered)
+	})
+	return
+}
+
+// offerReleasedSeats holds a show's free seats for the customers waiting for
+// it, first come first served, and queues each of them a notification. It
+// stops at the first customer who wants more seats than are left so nobody
+// is skipped over. Seats are locked before the waitlist, the same order
+// booking locks them in.
+func offerReleasedSeats(ctx context.Context, tx *sqlx.Tx, show_id int, hold_until time.Time) (offers []WaitlistOffer, err error) {
+	// most shows have nobody waiting, don't lock their seats for nothing
+	var waiters bool
+	if err = tx.GetContext(ctx, &waiters, anyoneWaiting, show_id, WaitlistWaiting); err != nil || !waiters {
+		return
+	}
+
+	var free []Seat
+	if err = tx.SelectContext(ctx, &free, lockAvailableSeats, show_id, SeatAvailable); err != nil || len(free) == 0 {
+		return
+	}
+	var waiting []WaitlistEntry
+	if err = tx.SelectContext(ctx, &waiting, lockWaitingEntries, show_id, WaitlistWaiting); err != nil {
+		return
+	}
+
+	for _, e := range waiting {
+		if e.Seats > len(free) {
+			break
+		}
+		o := WaitlistOffer{Entry_id: e.Entry_id, User_id: e.User_id, Expires_at: hold_until}
+		seat_ids := make(pq.Int64Array, 0, e.Seats)
+		for _, st := range free[:e.Seats] {
+			seat_ids = append(seat_ids, int64(st.Seat_id))
+			o.Seats = append(o.Seats, int64(st.Seat_number))
+		}
+		free = free[e.Seats:]
+
+		if _, err = tx.ExecContext(ctx, holdSeatsQuery, seat_ids, SeatHeld, e.Entry_id, hold_until); err != nil {
+			return
+		}
+		if _, err = tx.ExecContext(ctx, offerEntryQuery, e.Entry_id, WaitlistOffered, hold_until); err != nil {
+			return
+		}
+
+		payload, err := json.Marshal(map[string]interface{}{
+			"show_id":    show_id,
+			"seats":      o.Seats,
+			"expires_at": hold_until,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = tx.GetContext(ctx, &o.Notification_id, addNotificationQuery, e.User_id, NotificationWaitlistOffer, payload); err != nil {
+			return nil, err
+		}
+		offers = append(offers, o)
+	}
+	return
+}
+
+// claimWaitlistOffer returns the customer's live offer on a show, 0 when
+// they don't have one.
+func claimWaitlistOffer(ctx context.Context, tx *sqlx.Tx, show_id int, user_id int) (entry_id int, err error) {
+	err = tx.GetContext(ctx, &entry_id, lockOfferOfUser, show_id, user_id, WaitlistOffered)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return
+}
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	WebhookPending   = "Pending"
+	WebhookDelivered = "Delivered"
+	WebhookDead      = "Dead"
+
+	// subscribes to every event
+	WebhookAllEvents = "*"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook subscription doesn't exist")
+	ErrDeliveryNotFound = errors.New("webhook delivery doesn't exist")
+	ErrNotDeadLetter    = errors.New("webhook delivery isn't dead")
+)
+
+const (
+	webhookSubscriptionQuery = `SELECT subscription_id, partner, url, secret, events, active, created_at FROM webhook_subscriptions`
+	addWebhookSubscription   = `INSERT INTO webhook_subscriptions (partner, url, secret, events) VALUES ($1, $2, $3, $4)
+	returning subscription_id`
+	getWebhookSubscriptions       = webhookSubscriptionQuery + ` ORDER BY subscription_id DESC`
+	getWebhookSubscriptionByID    = webhookSubscriptionQuery + ` WHERE subscription_id=$1`
+	deactivateWebhookSubscription = `UPDATE webhook_subscriptions SET active=false WHERE subscription_id=$1`
+	queueWebhookEvent             = `INSERT INTO webhook_deliveries (subscription_id, event_id, event, payload)
+	SELECT subscription_id, $1, $2, $3 FROM webhook_subscriptions
+	WHERE active AND ($2 = ANY(events) OR $4 = ANY(events))
+	ON CONFLICT (subscription_id, event_id) DO NOTHING`
+	// deliveries of deactivated subscriptions are left where they are
+	claimWebhookDeliveries = `WITH claimed AS (
+		UPDATE webhook_deliveries d SET locked_until = now() + $2 * interval '1 millisecond'
+		FROM (
+			SELECT d.delivery_id FROM webhook_deliveries d
+			JOIN webhook_subscriptions w ON w.subscription_id = d.subscription_id
+			WHERE d.status=$3 AND d.next_attempt_at <= now() AND (d.locked_until IS NULL OR d.locked_until < now()) AND w.active
+			ORDER BY d.delivery_id
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		) c
+		WHERE d.delivery_id = c.delivery_id
+		RETURNING d.*
+	)
+	SELECT c.delivery_id, c.subscription_id, c.event_id, c.event, c.payload, c.status, c.attempts, c.next_attempt_at,
+	COALESCE(c.last_error, '') AS last_error, c.delivered_at, c.created_at, w.url, w.secret
+	FROM claimed c JOIN webhook_subscriptions w ON w.subscription_id = c.subscription_id
+	ORDER BY c.delivery_id`
+	addWebhookAttempt = `INSERT INTO webhook_attempts (delivery_id, status_code, error, duration_ms)
+	VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4)`
+	recordWebhookDelivery = `UPDATE webhook_deliveries SET status=$2, last_error=NULLIF($3, ''), next_attempt_at=$4,
+	attempts = attempts + 1, locked_until=NULL, delivered_at = CASE WHEN $2 = $5 THEN now() END
+	WHERE delivery_id=$1`
+	getWebhookDeliveries = `SELECT delivery_id, subscription_id, event_id, event, payload, status, attempts, next_attempt_at,
+	COALESCE(last_error, '') AS last_error, delivered_at, created_at, '' AS url, '' AS secret
+	FROM webhook_deliveries
+	WHERE subscription_id=$1 AND ($2 = '' OR status=$2)
+	ORDER BY delivery_id DESC
+	LIMIT $3`
+	getWebhookAttempts = `SELECT attempt_id, delivery_id, COALESCE(status_code, 0) AS status_code, COALESCE(error, '') AS error,
+	duration_ms, attempted_at
+	FROM webhook_attempts WHERE delivery_id = ANY($1)
+	ORDER BY attempt_id`
+	redeliverWebhook = `UPDATE webhook_deliveries SET status=$2, attempts=0, next_attempt_at=now(), last_error=NULL
+	WHERE delivery_id=$1 AND status=$3`
+	webhookDeliveryExists = `SELECT EXISTS (SELECT 1 FROM webhook_deliveries WHERE delivery_id=$1)`
+)
+
+type WebhookSubscription struct {
+	Subscription_id int            `db:"subscription_id"`
+	Partner         string         `db:"partner"`
+	Url             string         `db:"url"`
+	Secret          string         `db:"secret"`
+	Events          pq.StringArray `db:"events"`
+	Active          bool           `db:"active"`
+	Created_at      time.Time      `db:"created_at"`
+}
+
+// WebhookEvent is an event to push to every subscription that wants it.
+// Payload is the JSON body partners receive.
+type WebhookEvent struct {
+	Event_id string
+	Event    string
+	Payload  []byte
+}
+
+// WebhookDelivery is an event on its way to one subscription. Url and Secret
+// are only filled in for claimed deliveries, Attempts only when listed.
+type WebhookDelivery struct {
+	Delivery_id     int        `db:"delivery_id"`
+	Subscription_id int        `db:"subscription_id"`
+	Event_id        string     `db:"event_id"`
+	Event           string     `db:"event"`
+	Payload         []byte     `db:"payload"`
+	Status          string     `db:"status"`
+	Attempts        int        `db:"attempts"`
+	Next_attempt_at time.Time  `db:"next_attempt_at"`
+	Last_error      string     `db:"last_error"`
+	Delivered_at    *time.Time `db:"delivered_at"`
+	Created_at      time.Time  `db:"created_at"`
+	Url             string     `db:"url"`
+	Secret          string     `db:"secret"`
+
+	Log []WebhookAttempt `db:"-"`
+}
+
+type WebhookAttempt struct {
+	Attempt_id   int       `db:"attempt_id"`
+	Delivery_id  int       `db:"delivery_id"`
+	Status_code  int       `db:"status_code"`
+	Error        string    `db:"error"`
+	Duration_ms  int       `db:"duration_ms"`
+	Attempted_at time.Time `db:"attempted_at"`
+}
+
+// WebhookResult is how an attempt at a delivery went. Status is Delivered,
+// Pending to try again at Next_attempt_at, or Dead.
+type WebhookResult struct {
+	Delivery_id     int
+	Status          string
+	Status_code     int
+	Error           string
+	Duration        time.Duration
+	Next_attempt_at time.Time
+}
+
+func (s *store) AddWebhookSubscription(ctx context.Context, w WebhookSubscription) (subscription_id int, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.GetContext(ctx, &subscription_id, addWebhookSubscription, w.Partner, w.Url, w.Secret, w.Events)
+	})
+	return
+}
+
+func (s *store) GetWebhookSubscriptions(ctx context.Context) (subscriptions []WebhookSubscription, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &subscriptions, getWebhookSubscriptions)
+	})
+	return
+}
+
+func (s *store) GetWebhookSubscription(ctx context.Context, subscription_id int) (w WebhookSubscription, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		err := s.db.GetContext(ctx, &w, getWebhookSubscriptionByID, subscription_id)
+		if err == sql.ErrNoRows {
+			return ErrWebhookNotFound
+		}
+		return err
+	})
+	return
+}
+
+func (s *store) DeactivateWebhookSubscription(ctx context.Context, subscription_id int) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, deactivateWebhookSubscription, subscription_id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err == nil && n == 0 {
+			return ErrWebhookNotFound
+		}
+		return err
+	})
+	return
+}
+
+// QueueWebhookEvent queues a delivery of the event to every active
+// subscription that wants it. Queueing the same event twice is a no-op.
+func (s *store) QueueWebhookEvent(ctx context.Context, e WebhookEvent) (queued int, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, queueWebhookEvent, e.Event_id, e.Event, e.Payload, WebhookAllEvents)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		queued = int(n)
+		return err
+	})
+	return
+}
+
+// ClaimWebhookDeliveries leases up to limit due deliveries to the caller for
+// lease, skipping those another sender holds.
+func (s *store) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (deliveries []WebhookDelivery, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.db.SelectContext(ctx, &deliveries, claimWebhookDeliveries, limit, lease.Milliseconds(), WebhookPending)
+	})
+	return
+}
+
+// RecordWebhookAttempt logs an attempt and moves the delivery on.
+func (s *store) RecordWebhookAttempt(ctx context.Context, r WebhookResult) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		return s.withTx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, addWebhookAttempt, r.Delivery_id, r.Status_code, r.Error, r.Duration.Milliseconds())
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, recordWebhookDelivery, r.Delivery_id, r.Status, r.Error, r.Next_attempt_at, WebhookDelivered)
+			return err
+		})
+	})
+	return
+}
+
+// GetWebhookDeliveries returns the latest deliveries of a subscription, with
+// a given status unless status is empty, and every attempt at each.
+func (s *store) GetWebhookDeliveries(ctx context.Context, subscription_id int, status string, limit int) (deliveries []WebhookDelivery, err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		err := s.db.SelectContext(ctx, &deliveries, getWebhookDeliveries, subscription_id, status, limit)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		ids := make([]int64, len(deliveries))
+		byID := make(map[int]*WebhookDelivery, len(deliveries))
+		for i := range deliveries {
+			ids[i] = int64(deliveries[i].Delivery_id)
+			byID[deliveries[i].Delivery_id] = &deliveries[i]
+		}
+
+		var attempts []WebhookAttempt
+		if err = s.db.SelectContext(ctx, &attempts, getWebhookAttempts, pq.Int64Array(ids)); err != nil {
+			return err
+		}
+		for _, a := range attempts {
+			d := byID[a.Delivery_id]
+			d.Log = append(d.Log, a)
+		}
+		return nil
+	})
+	return
+}
+
+// RedeliverWebhook puts a dead delivery back in the queue with a fresh set
+// of attempts.
+func (s *store) RedeliverWebhook(ctx context.Context, delivery_id int) (err error) {
+
+	err = WithDefaultTimeout(ctx, func(ctx context.Context) error {
+		res, err := s.db.ExecContext(ctx, redeliverWebhook, delivery_id, WebhookPending, WebhookDead)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil || n > 0 {
+			return err
+		}
+
+		var exists bool
+		if err = s.db.GetContext(ctx, &exists, webhookDeliveryExists, delivery_id); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrDeliveryNotFound
+		}
+		return ErrNotDeadLetter
+	})
+	return
+}
@@ -0,0 +1,65 @@
+package events
+
+import (
+	"context"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+const SubscriberAnalytics = "analytics"
+
+// Analytics keeps a reporting row per event in analytics_facts.
+type Analytics struct {
+	store db.Storer
+}
+
+func NewAnalytics(s db.Storer) *Analytics {
+	return &Analytics{store: s}
+}
+
+func (a *Analytics) Name() string {
+	return SubscriberAnalytics
+}
+
+func (a *Analytics) Handle(ctx context.Context, e db.Event) (err error) {
+	f := db.AnalyticsFact{Event_id: e.Event_id, Type: e.Type, Occurred_at: e.Created_at}
+
+	switch e.Type {
+	case db.EventUserCreated:
+		var ev db.UserCreatedEvent
+		if err = e.Decode(&ev); err != nil {
+			return
+		}
+		f.User_id = ev.User_id
+	case db.EventShowAdded, db.EventShowRescheduled:
+		var ev db.ShowAddedEvent
+		if err = e.Decode(&ev); err != nil {
+			return
+		}
+		f.Show_id = ev.Show_id
+	case db.EventShowCancelled:
+		var ev db.ShowCancelledEvent
+		if err = e.Decode(&ev); err != nil {
+			return
+		}
+		f.Show_id = ev.Show_id
+	case db.EventSeatsBooked:
+		var ev db.SeatsBookedEvent
+		if err = e.Decode(&ev); err != nil {
+			return
+		}
+		f.User_id, f.Show_id, f.Booking_id, f.Channel = ev.User_id, ev.Show_id, ev.Booking_id, ev.Channel
+		f.Seats, f.Amount = len(ev.Seats), ev.Amount
+	case db.EventBookingCancelled:
+		var ev db.BookingCancelledEvent
+		if err = e.Decode(&ev); err != nil {
+			return
+		}
+		// cancellations count against what was sold
+		f.User_id, f.Show_id, f.Booking_id = ev.User_id, ev.Show_id, ev.Booking_id
+		f.Seats, f.Amount = -len(ev.Seats), -ev.Refund_amount
+	default:
+		return
+	}
+	return a.store.AddAnalyticsFact(ctx, f)
+}
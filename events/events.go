@@ -0,0 +1,113 @@
+// Package events hands the domain events recorded in the outbox to the
+// subscribers interested in them. Delivery is at least once: a subscriber
+// may see an event again after a crash or a failure of another subscriber,
+// so handlers must be idempotent, usually by keying what they write on the
+// event id.
+package events
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/Coderx44/MovieTicketingPortal/outbox"
+	"go.uber.org/zap"
+)
+
+var backoff = outbox.Backoff{Min: 5 * time.Second, Max: 1 * time.Hour}
+
+// Subscriber handles events. Name identifies it in the outbox, so it must
+// not change once events have been handled under it.
+type Subscriber interface {
+	Name() string
+	Handle(ctx context.Context, e db.Event) error
+}
+
+// Dispatcher hands every event to every subscriber. It is safe to run one per
+// replica, each claims its own batch.
+type Dispatcher struct {
+	*outbox.Poller
+	store       db.Storer
+	subscribers []Subscriber
+	logger      *zap.SugaredLogger
+	batchSize   int
+	maxAttempts int
+}
+
+func NewDispatcher(s db.Storer, l *zap.SugaredLogger, subscribers ...Subscriber) *Dispatcher {
+	c := config.Events()
+	d := &Dispatcher{
+		store:       s,
+		subscribers: subscribers,
+		logger:      l,
+		batchSize:   c.BatchSize(),
+		maxAttempts: c.MaxAttempts(),
+	}
+	d.Poller = outbox.NewPoller("events", l, c.PollInterval(), c.BatchSize(), d.DispatchPending)
+	return d
+}
+
+// DispatchPending hands one batch of events to the subscribers and returns
+// how many it claimed.
+func (d *Dispatcher) DispatchPending(ctx context.Context) (n int, err error) {
+	events, err := d.store.ClaimEvents(ctx, d.batchSize, outbox.Lease)
+	if err != nil {
+		return
+	}
+
+	for _, e := range events {
+		r := d.dispatch(ctx, e)
+		// subscribers cut short by shutdown haven't failed, the event is
+		// handed out again once its lease runs out
+		if r.Status != db.EventProcessed && ctx.Err() != nil {
+			continue
+		}
+		if err := d.store.RecordEvent(context.Background(), r); err != nil {
+			d.logger.Errorf("Err: Recording event %v: %v", e.Event_id, err.Error())
+		}
+	}
+	return len(events), nil
+}
+
+// dispatch hands an event to the subscribers that haven't handled it yet.
+func (d *Dispatcher) dispatch(ctx context.Context, e db.Event) (r db.EventResult) {
+	r = db.EventResult{
+		Event_id:        e.Event_id,
+		Handled:         e.Handled,
+		Next_attempt_at: time.Now(),
+	}
+
+	done := make(map[string]bool, len(e.Handled))
+	for _, name := range e.Handled {
+		done[name] = true
+	}
+
+	var failures []string
+	for _, s := range d.subscribers {
+		if done[s.Name()] {
+			continue
+		}
+		if err := s.Handle(ctx, e); err != nil {
+			failures = append(failures, s.Name()+": "+err.Error())
+			continue
+		}
+		r.Handled = append(r.Handled, s.Name())
+	}
+
+	switch {
+	case len(failures) == 0:
+		r.Status = db.EventProcessed
+	case e.Attempts+1 >= d.maxAttempts:
+		r.Status = db.EventFailed
+	default:
+		r.Status = db.EventPending
+		r.Next_attempt_at = time.Now().Add(backoff.After(e.Attempts))
+	}
+	r.Error = strings.Join(failures, "; ")
+	if r.Error != "" {
+		d.logger.Errorf("Err: Handling event %v (%v): %v", e.Event_id, e.Type, r.Error)
+	}
+	return
+}
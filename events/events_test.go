@@ -0,0 +1,63 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"go.uber.org/zap"
+)
+
+type subscriber struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (s *subscriber) Name() string {
+	return s.name
+}
+
+func (s *subscriber) Handle(ctx context.Context, e db.Event) error {
+	s.calls++
+	return s.err
+}
+
+func TestDispatch(t *testing.T) {
+	ok := &subscriber{name: "ok"}
+	done := &subscriber{name: "done"}
+	broken := &subscriber{name: "broken", err: errors.New("down")}
+	d := &Dispatcher{
+		subscribers: []Subscriber{ok, done, broken},
+		logger:      zap.NewNop().Sugar(),
+		maxAttempts: 3,
+	}
+
+	r := d.dispatch(context.Background(), db.Event{Event_id: 1, Handled: []string{"done"}})
+	if done.calls != 0 {
+		t.Fatalf("subscriber that handled the event was called again")
+	}
+	if r.Status != db.EventPending || !r.Next_attempt_at.After(time.Now()) {
+		t.Fatalf("status = %v at %v, want Pending later", r.Status, r.Next_attempt_at)
+	}
+	if len(r.Handled) != 2 || r.Handled[0] != "done" || r.Handled[1] != "ok" {
+		t.Fatalf("handled = %v, want [done ok]", r.Handled)
+	}
+	if r.Error != "broken: down" {
+		t.Fatalf("error = %q", r.Error)
+	}
+
+	// the last attempt gives up
+	r = d.dispatch(context.Background(), db.Event{Event_id: 1, Attempts: 2, Handled: []string{"done", "ok"}})
+	if r.Status != db.EventFailed {
+		t.Fatalf("status = %v, want Failed", r.Status)
+	}
+
+	broken.err = nil
+	r = d.dispatch(context.Background(), db.Event{Event_id: 1, Attempts: 2, Handled: []string{"done", "ok"}})
+	if r.Status != db.EventProcessed || r.Error != "" {
+		t.Fatalf("status = %v, error = %q, want Processed", r.Status, r.Error)
+	}
+}
@@ -0,0 +1,24 @@
+package health
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Beat records when a background worker last went round its loop.
+type Beat struct {
+	last int64
+}
+
+func (b *Beat) Mark() {
+	atomic.StoreInt64(&b.last, time.Now().UnixNano())
+}
+
+// Last is the zero time until the worker first marks its beat.
+func (b *Beat) Last() time.Time {
+	n := atomic.LoadInt64(&b.last)
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,146 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+const (
+	checkTimeout = 2 * time.Second
+	// how much longer than three rounds a worker may go quiet, a slow batch
+	// of deliveries or a long job holds up its loop
+	workerGrace = 5 * time.Minute
+)
+
+// Worker is a background loop that marks a beat every round.
+type Worker interface {
+	LastBeat() time.Time
+	Interval() time.Duration
+}
+
+// Checker tells whether this server can take traffic.
+type Checker struct {
+	store     db.Storer
+	migration uint
+	names     []string
+	workers   map[string]Worker
+	draining  int32
+}
+
+// NewChecker returns a checker expecting the database to be migrated up to
+// the newest migration in the migration path.
+func NewChecker(s db.Storer) (*Checker, error) {
+	latest, err := db.LatestMigrationVersion()
+	if err != nil {
+		return nil, err
+	}
+	return &Checker{store: s, migration: latest, workers: make(map[string]Worker)}, nil
+}
+
+// Watch adds a worker running on this server to the checks.
+func (c *Checker) Watch(name string, w Worker) {
+	c.names = append(c.names, name)
+	c.workers[name] = w
+}
+
+// Drain fails readiness from now on, so no new traffic is sent while the
+// server shuts down.
+func (c *Checker) Drain() {
+	atomic.StoreInt32(&c.draining, 1)
+}
+
+type Readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"` // "ok" or what is wrong
+}
+
+func (c *Checker) Check(ctx context.Context) (r Readiness) {
+	r.Checks = make(map[string]string, len(c.names)+2)
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	r.Checks["database"] = status(c.store.Ping(ctx))
+	r.Checks["migrations"] = status(c.checkMigrations(ctx))
+	now := time.Now()
+	for _, name := range c.names {
+		r.Checks[name] = status(checkWorker(c.workers[name], now))
+	}
+
+	if atomic.LoadInt32(&c.draining) == 1 {
+		r.Checks["server"] = "shutting down"
+	}
+
+	r.Ready = true
+	for _, s := range r.Checks {
+		if s != "ok" {
+			r.Ready = false
+		}
+	}
+	return
+}
+
+func status(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+// checkMigrations passes a database migrated past this server's migrations
+// too, a newer server may have run them during a rolling deploy.
+func (c *Checker) checkMigrations(ctx context.Context) error {
+	version, dirty, err := c.store.GetMigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %v failed half way", version)
+	}
+	if version < c.migration {
+		return fmt.Errorf("at migration %v, %v is pending", version, c.migration)
+	}
+	return nil
+}
+
+func checkWorker(w Worker, now time.Time) error {
+	last := w.LastBeat()
+	if last.IsZero() {
+		return errors.New("not started")
+	}
+	if quiet := now.Sub(last); quiet > 3*w.Interval()+workerGrace {
+		return fmt.Errorf("stalled for %v", quiet.Round(time.Second))
+	}
+	return nil
+}
+
+// Live answers as long as the server is up, it checks nothing else.
+func Live() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+}
+
+// Ready answers 503 while the server shouldn't be sent traffic.
+func Ready(c *Checker) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := c.Check(r.Context())
+
+		respBytes, _ := json.Marshal(res)
+		w.Header().Add("Content-Type", "application/json")
+		if res.Ready {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(respBytes)
+	})
+}
@@ -0,0 +1,94 @@
+package health
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+// migrationStore is a reachable database at a fixed migration.
+type migrationStore struct {
+	db.Storer
+	version uint
+	dirty   bool
+}
+
+func (s *migrationStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *migrationStore) GetMigrationVersion(ctx context.Context) (uint, bool, error) {
+	return s.version, s.dirty, nil
+}
+
+// worker beats on a fixed interval.
+type worker struct {
+	last     time.Time
+	interval time.Duration
+}
+
+func (w worker) LastBeat() time.Time     { return w.last }
+func (w worker) Interval() time.Duration { return w.interval }
+
+func TestCheckWorker(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		w    worker
+		ok   bool
+	}{
+		{"not started", worker{interval: time.Minute}, false},
+		{"beating", worker{last: now.Add(-time.Minute), interval: time.Minute}, true},
+		{"slow round", worker{last: now.Add(-3*time.Minute - workerGrace), interval: time.Minute}, true},
+		{"stalled", worker{last: now.Add(-3*time.Minute - workerGrace - time.Second), interval: time.Minute}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkWorker(tt.w, now); (err == nil) != tt.ok {
+				t.Fatalf("checkWorker = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCheckMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		version uint
+		dirty   bool
+		ok      bool
+	}{
+		{"current", 12, false, true},
+		{"dirty", 12, true, false},
+		{"behind", 11, false, false},
+		// a newer server ran its migrations during a rolling deploy
+		{"ahead", 13, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Checker{store: &migrationStore{version: tt.version, dirty: tt.dirty}, migration: 12}
+			if err := c.checkMigrations(context.Background()); (err == nil) != tt.ok {
+				t.Fatalf("checkMigrations = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	c := &Checker{store: &migrationStore{version: 12}, migration: 12, workers: make(map[string]Worker)}
+	c.Watch("events", worker{last: time.Now(), interval: time.Second})
+
+	if r := c.Check(context.Background()); !r.Ready {
+		t.Fatalf("checks = %v, want ready", r.Checks)
+	}
+
+	c.Drain()
+	r := c.Check(context.Background())
+	if r.Ready || r.Checks["server"] != "shutting down" {
+		t.Fatalf("draining: ready = %v, checks = %v", r.Ready, r.Checks)
+	}
+}
@@ -0,0 +1,141 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+	maxKeyLength   = 255
+)
+
+// Keys makes the requests it wraps safe to retry: the first response to a
+// request sent with an Idempotency-Key is saved and replayed to retries with
+// the same key, per user. Requests nobody is logged in for aren't: their
+// keys would share one namespace, and their bodies may carry credentials.
+type Keys struct {
+	store  db.Storer
+	logger *zap.SugaredLogger
+	user   func(r *http.Request) string
+}
+
+// NewKeys returns Keys saving responses in s. user returns the user a
+// request is made by, "" when nobody is logged in.
+func NewKeys(s db.Storer, l *zap.SugaredLogger, user func(r *http.Request) string) *Keys {
+	return &Keys{store: s, logger: l, user: user}
+}
+
+// recorder keeps a copy of the response as it is written.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// requestHash tells a retry from a different request sent with the same key.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Idempotent replays the saved response when the key was used before for
+// the same request, and refuses a different request or one still running
+// under it. Requests without the header, or without a user, are let through
+// as they are.
+func (k *Keys) Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderKey)
+		owner := k.user(r)
+		if key == "" || owner == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: Idempotency-Key can be at most 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Err: Failed to read the request"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := requestHash(r, body)
+		ir, started, err := k.store.StartIdempotentRequest(r.Context(), owner, key, hash, config.Idempotency().Lock())
+		if err != nil {
+			k.logger.Errorf("Err: Starting idempotent request %v: %v", key, err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Failed to check the Idempotency-Key"))
+			return
+		}
+
+		if !started {
+			switch {
+			case ir.Request_hash != hash:
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write([]byte("Err: Idempotency-Key was already used for a different request"))
+			case ir.Status == db.IdempotencyInProgress:
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte("Err: A request with this Idempotency-Key is still in progress"))
+			default:
+				if ir.Content_type != "" {
+					w.Header().Add("Content-Type", ir.Content_type)
+				}
+				w.Header().Add(HeaderReplayed, "true")
+				w.WriteHeader(ir.Status_code)
+				w.Write(ir.Response_body)
+			}
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// the outcome is saved even if the client went away, that's when it
+		// retries
+		ctx := context.Background()
+		if rec.status >= http.StatusInternalServerError {
+			// the request failed, a retry gets to run it again
+			err = k.store.ReleaseIdempotentRequest(ctx, owner, key)
+		} else {
+			err = k.store.CompleteIdempotentRequest(ctx, owner, key, rec.status, w.Header().Get("Content-Type"), rec.body.Bytes())
+		}
+		if err != nil {
+			k.logger.Errorf("Err: Saving idempotent request %v: %v", key, err.Error())
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"go.uber.org/zap"
+)
+
+// keyStore keeps idempotent requests in memory.
+type keyStore struct {
+	db.Storer
+	requests map[string]db.IdempotentRequest
+}
+
+func (s *keyStore) StartIdempotentRequest(ctx context.Context, owner string, key string, hash string, lock time.Duration) (db.IdempotentRequest, bool, error) {
+	if ir, ok := s.requests[owner+key]; ok {
+		return ir, false, nil
+	}
+	s.requests[owner+key] = db.IdempotentRequest{Owner: owner, Idem_key: key, Request_hash: hash, Status: db.IdempotencyInProgress}
+	return db.IdempotentRequest{}, true, nil
+}
+
+func (s *keyStore) CompleteIdempotentRequest(ctx context.Context, owner string, key string, status_code int, content_type string, body []byte) error {
+	ir := s.requests[owner+key]
+	ir.Status, ir.Status_code, ir.Content_type, ir.Response_body = db.IdempotencyDone, status_code, content_type, body
+	s.requests[owner+key] = ir
+	return nil
+}
+
+func (s *keyStore) ReleaseIdempotentRequest(ctx context.Context, owner string, key string) error {
+	delete(s.requests, owner+key)
+	return nil
+}
+
+func TestIdempotent(t *testing.T) {
+	store := &keyStore{requests: map[string]db.IdempotentRequest{}}
+	k := NewKeys(store, zap.NewNop().Sugar(), func(r *http.Request) string { return "asha@example.com" })
+
+	calls := 0
+	status := http.StatusCreated
+	h := k.Idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"booking_id":1}`))
+	})
+	send := func(key string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/shows/7/bookings", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(HeaderKey, key)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	// a server error frees the key for the retry
+	status = http.StatusInternalServerError
+	if w := send("k1", `{"seats":[1]}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("code = %v", w.Code)
+	}
+	status = http.StatusCreated
+	if w := send("k1", `{"seats":[1]}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("retry after failure: code = %v, calls = %v", w.Code, calls)
+	}
+
+	w := send("k1", `{"seats":[1]}`)
+	if calls != 2 || w.Code != http.StatusCreated || w.Header().Get(HeaderReplayed) != "true" || w.Body.String() != `{"booking_id":1}` {
+		t.Fatalf("replay: calls = %v, code = %v, headers = %v, body = %q", calls, w.Code, w.Header(), w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("content type = %q", w.Header().Get("Content-Type"))
+	}
+
+	if w := send("k1", `{"seats":[2]}`); w.Code != http.StatusUnprocessableEntity || calls != 2 {
+		t.Fatalf("different request: code = %v, calls = %v", w.Code, calls)
+	}
+
+	// another attempt is still running under k2
+	r := httptest.NewRequest(http.MethodPost, "/shows/7/bookings", strings.NewReader(`{"seats":[3]}`))
+	store.requests["asha@example.comk2"] = db.IdempotentRequest{Request_hash: requestHash(r, []byte(`{"seats":[3]}`)), Status: db.IdempotencyInProgress}
+	if w := send("k2", `{"seats":[3]}`); w.Code != http.StatusConflict {
+		t.Fatalf("in progress: code = %v", w.Code)
+	}
+
+	send("", `{"seats":[1]}`)
+	if calls != 3 {
+		t.Fatalf("without a key: calls = %v, want the request run", calls)
+	}
+}
+
+func TestIdempotentWithoutUser(t *testing.T) {
+	store := &keyStore{requests: map[string]db.IdempotentRequest{}}
+	k := NewKeys(store, zap.NewNop().Sugar(), func(r *http.Request) string { return "" })
+
+	calls := 0
+	h := k.Idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+	})
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/create/user", strings.NewReader(`{"password":"secret"}`))
+		r.Header.Set(HeaderKey, "k1")
+		h(httptest.NewRecorder(), r)
+	}
+
+	// nobody's key is saved, nor a hash of their password
+	if calls != 2 || len(store.requests) != 0 {
+		t.Fatalf("calls = %v, saved = %v, want both requests run and nothing saved", calls, len(store.requests))
+	}
+}
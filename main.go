@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	_ "time/tzdata"
 
 	"github.com/Coderx44/MovieTicketingPortal/app"
 	"github.com/Coderx44/MovieTicketingPortal/config"
@@ -28,8 +29,15 @@ func main() {
 		{
 			Name:  "start",
 			Usage: "start server",
-			Action: func(c *cli.Context) {
-				service.StartApiServer()
+			Action: func(c *cli.Context) error {
+				return service.StartApiServer()
+			},
+		},
+		{
+			Name:  "scheduler",
+			Usage: "run background jobs, notifications and webhooks without the api",
+			Action: func(c *cli.Context) error {
+				return service.StartScheduler()
 			},
 		},
 		{
@@ -0,0 +1,12 @@
+ALTER TABLE shows ALTER COLUMN start_time TYPE time USING start_time::time;
+ALTER TABLE shows ALTER COLUMN end_time TYPE time USING end_time::time;
+
+ALTER TABLE multiplexes
+    DROP COLUMN IF EXISTS opens_at,
+    DROP COLUMN IF EXISTS closes_at;
+
+ALTER TABLE screens
+    DROP COLUMN IF EXISTS trailer_buffer_mins,
+    DROP COLUMN IF EXISTS cleaning_buffer_mins;
+
+ALTER TABLE movies ALTER COLUMN duration TYPE text USING duration::text;
@@ -0,0 +1,15 @@
+ALTER TABLE movies ALTER COLUMN duration TYPE int USING NULLIF(trim(duration), '')::numeric::int;
+
+ALTER TABLE screens
+    ADD COLUMN trailer_buffer_mins int NOT NULL DEFAULT 15,
+    ADD COLUMN cleaning_buffer_mins int NOT NULL DEFAULT 15;
+
+ALTER TABLE multiplexes
+    ADD COLUMN opens_at time NOT NULL DEFAULT '09:00',
+    ADD COLUMN closes_at time NOT NULL DEFAULT '01:00';
+
+/* end_time is converted first so that start_time is still a bare time when
+   deciding whether the show ran past midnight */
+ALTER TABLE shows ALTER COLUMN end_time TYPE timestamp
+    USING show_date + end_time + CASE WHEN end_time < start_time THEN interval '1 day' ELSE interval '0' END;
+ALTER TABLE shows ALTER COLUMN start_time TYPE timestamp USING show_date + start_time;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS shows_start_time_idx;
+
+ALTER TABLE shows ALTER COLUMN start_time TYPE timestamp USING start_time AT TIME ZONE 'Asia/Kolkata';
+ALTER TABLE shows ALTER COLUMN end_time TYPE timestamp USING end_time AT TIME ZONE 'Asia/Kolkata';
+
+ALTER TABLE multiplexes DROP COLUMN IF EXISTS time_zone;
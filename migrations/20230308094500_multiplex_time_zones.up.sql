@@ -0,0 +1,7 @@
+ALTER TABLE multiplexes ADD COLUMN time_zone text NOT NULL DEFAULT 'Asia/Kolkata';
+
+/* every multiplex so far is in India, so the naive timestamps are IST */
+ALTER TABLE shows ALTER COLUMN start_time TYPE timestamptz USING start_time AT TIME ZONE 'Asia/Kolkata';
+ALTER TABLE shows ALTER COLUMN end_time TYPE timestamptz USING end_time AT TIME ZONE 'Asia/Kolkata';
+
+CREATE INDEX IF NOT EXISTS shows_start_time_idx ON shows (start_time);
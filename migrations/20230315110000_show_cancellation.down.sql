@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS refunds;
+
+DROP INDEX IF EXISTS bookings_show_id_idx;
+
+ALTER TABLE bookings ADD COLUMN seat_id int REFERENCES seats (seat_id);
+UPDATE bookings b SET seat_id = (SELECT min(bs.seat_id) FROM booking_seats bs WHERE bs.booking_id = b.booking_id);
+ALTER TABLE bookings
+    DROP COLUMN IF EXISTS amount,
+    DROP COLUMN IF EXISTS created_at;
+
+DROP TABLE IF EXISTS booking_seats;
+
+ALTER TABLE shows
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS cancelled_at,
+    DROP COLUMN IF EXISTS cancel_reason;
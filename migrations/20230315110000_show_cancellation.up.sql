@@ -0,0 +1,44 @@
+ALTER TABLE shows
+    ADD COLUMN status text NOT NULL DEFAULT 'Scheduled',
+    ADD COLUMN cancelled_at timestamptz,
+    ADD COLUMN cancel_reason text;
+
+/* a booking can hold several seats of the same show */
+CREATE TABLE IF NOT EXISTS booking_seats(
+    booking_id int REFERENCES bookings (booking_id),
+    seat_id int REFERENCES seats (seat_id),
+    PRIMARY KEY (booking_id, seat_id)
+);
+
+ALTER TABLE bookings
+    ADD COLUMN amount int NOT NULL DEFAULT 0,
+    ADD COLUMN created_at timestamptz NOT NULL DEFAULT now();
+
+INSERT INTO booking_seats (booking_id, seat_id)
+SELECT booking_id, seat_id FROM bookings WHERE seat_id IS NOT NULL;
+
+UPDATE bookings b SET amount = s.price FROM seats s WHERE s.seat_id = b.seat_id;
+
+ALTER TABLE bookings DROP COLUMN seat_id;
+
+CREATE INDEX IF NOT EXISTS bookings_show_id_idx ON bookings (show_id);
+
+/* refunds are settled by the payments side, which picks up Pending rows */
+CREATE TABLE IF NOT EXISTS refunds(
+    refund_id SERIAL PRIMARY KEY,
+    booking_id int REFERENCES bookings (booking_id),
+    user_id int REFERENCES users (user_id),
+    amount int NOT NULL,
+    status text NOT NULL DEFAULT 'Pending',
+    reason text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS notifications(
+    notification_id SERIAL PRIMARY KEY,
+    user_id int REFERENCES users (user_id),
+    kind text NOT NULL,
+    payload jsonb NOT NULL DEFAULT '{}',
+    status text NOT NULL DEFAULT 'Pending',
+    created_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,3 @@
+ALTER TABLE bookings
+    DROP COLUMN IF EXISTS checked_in_at,
+    DROP COLUMN IF EXISTS checked_in_by;
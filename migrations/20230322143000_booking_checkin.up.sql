@@ -0,0 +1,3 @@
+ALTER TABLE bookings
+    ADD COLUMN checked_in_at timestamptz,
+    ADD COLUMN checked_in_by int REFERENCES users (user_id);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS pos_shifts;
+
+ALTER TABLE bookings
+    DROP COLUMN IF EXISTS channel,
+    DROP COLUMN IF EXISTS customer_phone,
+    DROP COLUMN IF EXISTS sold_by;
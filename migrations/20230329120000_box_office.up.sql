@@ -0,0 +1,31 @@
+ALTER TABLE bookings
+    ADD COLUMN channel text NOT NULL DEFAULT 'online',
+    ADD COLUMN customer_phone text,
+    ADD COLUMN sold_by int REFERENCES users (user_id);
+
+CREATE TABLE IF NOT EXISTS pos_shifts(
+    shift_id SERIAL PRIMARY KEY,
+    staff_id int NOT NULL REFERENCES users (user_id),
+    multiplex_id int NOT NULL REFERENCES multiplexes (multiplex_id),
+    opening_float int NOT NULL DEFAULT 0,
+    counted_cash int,
+    status text NOT NULL DEFAULT 'Open',
+    opened_at timestamptz NOT NULL DEFAULT now(),
+    closed_at timestamptz
+);
+
+/* a staff member works one drawer at a time */
+CREATE UNIQUE INDEX IF NOT EXISTS pos_shifts_open_idx ON pos_shifts (staff_id) WHERE status = 'Open';
+
+CREATE TABLE IF NOT EXISTS payments(
+    payment_id SERIAL PRIMARY KEY,
+    booking_id int NOT NULL REFERENCES bookings (booking_id),
+    method text NOT NULL,
+    amount int NOT NULL,
+    status text NOT NULL DEFAULT 'Captured',
+    staff_id int REFERENCES users (user_id),
+    shift_id int REFERENCES pos_shifts (shift_id),
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS payments_shift_id_idx ON payments (shift_id);
@@ -0,0 +1,6 @@
+ALTER TABLE bookings
+    DROP COLUMN IF EXISTS coupon_id,
+    DROP COLUMN IF EXISTS discount;
+
+DROP TABLE IF EXISTS coupon_redemptions;
+DROP TABLE IF EXISTS coupons;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS coupons(
+    coupon_id SERIAL PRIMARY KEY,
+    code citext UNIQUE NOT NULL,
+    kind text NOT NULL,
+    value int NOT NULL,
+    max_discount int,
+    min_tickets int NOT NULL DEFAULT 1,
+    movie_ids int[],
+    multiplex_ids int[],
+    days_of_week int[],
+    per_user_limit int,
+    total_limit int,
+    redeemed_count int NOT NULL DEFAULT 0,
+    valid_from timestamptz,
+    expires_at timestamptz,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS coupon_redemptions(
+    redemption_id SERIAL PRIMARY KEY,
+    coupon_id int NOT NULL REFERENCES coupons (coupon_id),
+    user_id int REFERENCES users (user_id),
+    booking_id int NOT NULL REFERENCES bookings (booking_id),
+    discount int NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS coupon_redemptions_user_idx ON coupon_redemptions (coupon_id, user_id);
+
+ALTER TABLE bookings
+    ADD COLUMN coupon_id int REFERENCES coupons (coupon_id),
+    ADD COLUMN discount int NOT NULL DEFAULT 0;
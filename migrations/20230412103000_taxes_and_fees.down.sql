@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS booking_line_items;
+DROP TABLE IF EXISTS tax_rates;
+
+ALTER TABLE refunds DROP COLUMN IF EXISTS currency;
+ALTER TABLE payments DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE bookings
+    DROP COLUMN IF EXISTS tax,
+    DROP COLUMN IF EXISTS fee,
+    DROP COLUMN IF EXISTS currency;
+
+UPDATE coupon_redemptions SET discount = discount / 100;
+UPDATE coupons SET max_discount = max_discount / 100;
+UPDATE coupons SET value = value / 100 WHERE kind = 'flat';
+UPDATE pos_shifts SET opening_float = opening_float / 100, counted_cash = counted_cash / 100;
+UPDATE payments SET amount = amount / 100;
+UPDATE refunds SET amount = amount / 100;
+UPDATE bookings SET amount = amount / 100, discount = discount / 100;
+UPDATE seats SET price = price / 100;
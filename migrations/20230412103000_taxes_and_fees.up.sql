@@ -0,0 +1,48 @@
+/* money is kept in minor units (paise) from here on */
+UPDATE seats SET price = price * 100;
+UPDATE bookings SET amount = amount * 100, discount = discount * 100;
+UPDATE refunds SET amount = amount * 100;
+UPDATE payments SET amount = amount * 100;
+UPDATE pos_shifts SET opening_float = opening_float * 100, counted_cash = counted_cash * 100;
+UPDATE coupons SET value = value * 100 WHERE kind = 'flat';
+UPDATE coupons SET max_discount = max_discount * 100;
+UPDATE coupon_redemptions SET discount = discount * 100;
+
+ALTER TABLE bookings
+    ADD COLUMN currency text NOT NULL DEFAULT 'INR',
+    ADD COLUMN fee int NOT NULL DEFAULT 0,
+    ADD COLUMN tax int NOT NULL DEFAULT 0;
+
+ALTER TABLE payments ADD COLUMN currency text NOT NULL DEFAULT 'INR';
+ALTER TABLE refunds ADD COLUMN currency text NOT NULL DEFAULT 'INR';
+
+/* GST style components, e.g. CGST and SGST, charged on tickets or on fees */
+CREATE TABLE IF NOT EXISTS tax_rates(
+    tax_rate_id SERIAL PRIMARY KEY,
+    state citext NOT NULL,
+    name text NOT NULL,
+    rate_bps int NOT NULL,
+    applies_to text NOT NULL,
+    UNIQUE (state, name, applies_to)
+);
+
+/* the itemised charge of a booking as it was priced, used for invoices */
+CREATE TABLE IF NOT EXISTS booking_line_items(
+    line_item_id SERIAL PRIMARY KEY,
+    booking_id int NOT NULL REFERENCES bookings (booking_id),
+    kind text NOT NULL,
+    label text NOT NULL,
+    quantity int NOT NULL DEFAULT 1,
+    unit_amount int NOT NULL,
+    amount int NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS booking_line_items_booking_id_idx ON booking_line_items (booking_id);
+
+INSERT INTO booking_line_items (booking_id, kind, label, quantity, unit_amount, amount)
+SELECT bs.booking_id, 'ticket', 'Ticket', count(*), s.price, count(*) * s.price
+FROM booking_seats bs JOIN seats s ON s.seat_id = bs.seat_id
+GROUP BY bs.booking_id, s.price;
+
+INSERT INTO booking_line_items (booking_id, kind, label, quantity, unit_amount, amount)
+SELECT booking_id, 'discount', 'Discount', 1, -discount, -discount FROM bookings WHERE discount > 0;
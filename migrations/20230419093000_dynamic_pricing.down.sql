@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS seat_price_changes;
+DROP TABLE IF EXISTS pricing_rules;
+
+UPDATE seats SET price = base_price;
+ALTER TABLE seats DROP COLUMN IF EXISTS base_price;
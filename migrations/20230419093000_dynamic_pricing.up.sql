@@ -0,0 +1,33 @@
+/* dynamic prices move around the price a seat was put on sale at */
+ALTER TABLE seats ADD COLUMN base_price int;
+UPDATE seats SET base_price = price;
+ALTER TABLE seats ALTER COLUMN base_price SET NOT NULL;
+
+/* a rule applies to every show it matches, a null scope matches all */
+CREATE TABLE IF NOT EXISTS pricing_rules(
+    rule_id SERIAL PRIMARY KEY,
+    name text NOT NULL,
+    show_id int REFERENCES shows (show_id),
+    movie_id int REFERENCES movies (movie_id),
+    multiplex_id int REFERENCES multiplexes (multiplex_id),
+    min_occupancy_pct int NOT NULL DEFAULT 0,
+    starts_within_mins int,
+    adjust_bps int NOT NULL,
+    floor_price int,
+    ceiling_price int,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS seat_price_changes(
+    price_change_id SERIAL PRIMARY KEY,
+    show_id int NOT NULL REFERENCES shows (show_id),
+    seat_id int NOT NULL REFERENCES seats (seat_id),
+    old_price int NOT NULL,
+    new_price int NOT NULL,
+    rule_id int REFERENCES pricing_rules (rule_id),
+    occupancy_pct int NOT NULL,
+    changed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS seat_price_changes_show_id_idx ON seat_price_changes (show_id, changed_at);
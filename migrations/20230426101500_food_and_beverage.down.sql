@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS fnb_order_items;
+DROP TABLE IF EXISTS fnb_orders;
+DROP TABLE IF EXISTS fnb_combo_items;
+DROP TABLE IF EXISTS fnb_items;
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS fnb_items(
+    item_id SERIAL PRIMARY KEY,
+    multiplex_id int NOT NULL REFERENCES multiplexes (multiplex_id),
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    price int NOT NULL,
+    is_combo boolean NOT NULL DEFAULT false,
+    /* null is not tracked, combos take stock from their items */
+    stock int,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS fnb_items_multiplex_id_idx ON fnb_items (multiplex_id);
+
+CREATE TABLE IF NOT EXISTS fnb_combo_items(
+    combo_id int REFERENCES fnb_items (item_id),
+    item_id int REFERENCES fnb_items (item_id),
+    quantity int NOT NULL DEFAULT 1,
+    PRIMARY KEY (combo_id, item_id)
+);
+
+CREATE TABLE IF NOT EXISTS fnb_orders(
+    order_id SERIAL PRIMARY KEY,
+    booking_id int NOT NULL REFERENCES bookings (booking_id),
+    multiplex_id int NOT NULL REFERENCES multiplexes (multiplex_id),
+    show_id int NOT NULL REFERENCES shows (show_id),
+    fulfilment text NOT NULL,
+    deliver_at timestamptz NOT NULL,
+    status text NOT NULL DEFAULT 'Queued',
+    amount int NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS fnb_orders_queue_idx ON fnb_orders (multiplex_id, status, deliver_at);
+
+CREATE TABLE IF NOT EXISTS fnb_order_items(
+    order_id int REFERENCES fnb_orders (order_id),
+    item_id int REFERENCES fnb_items (item_id),
+    name text NOT NULL,
+    quantity int NOT NULL,
+    unit_price int NOT NULL,
+    PRIMARY KEY (order_id, item_id)
+);
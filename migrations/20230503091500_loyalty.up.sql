@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS loyalty_tiers(
+    tier_id SERIAL PRIMARY KEY,
+    name text UNIQUE NOT NULL,
+    /* points earned over the last year needed to be in the tier */
+    min_points int NOT NULL,
+    earn_multiplier_bps int NOT NULL DEFAULT 10000,
+    waives_convenience_fee boolean NOT NULL DEFAULT false
+);
+
+INSERT INTO loyalty_tiers (name, min_points, earn_multiplier_bps, waives_convenience_fee) VALUES
+    ('Blue', 0, 10000, false),
+    ('Silver', 2000, 12500, false),
+    ('Gold', 6000, 15000, false),
+    ('Platinum', 15000, 20000, true);
+
+/* earn and refund entries are lots that redemptions and expiry draw down
+   oldest first, remaining is what is left of a lot */
+CREATE TABLE IF NOT EXISTS loyalty_ledger(
+    entry_id SERIAL PRIMARY KEY,
+    user_id int NOT NULL REFERENCES users (user_id),
+    booking_id int REFERENCES bookings (booking_id),
+    kind text NOT NULL,
+    points int NOT NULL,
+    remaining int NOT NULL DEFAULT 0,
+    expires_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS loyalty_ledger_user_idx ON loyalty_ledger (user_id, created_at);
+CREATE INDEX IF NOT EXISTS loyalty_ledger_lots_idx ON loyalty_ledger (user_id, expires_at) WHERE remaining > 0;
@@ -0,0 +1,6 @@
+ALTER TABLE refunds DROP COLUMN IF EXISTS destination;
+
+DROP TABLE IF EXISTS gift_cards;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_transactions;
+DROP TABLE IF EXISTS ledger_accounts;
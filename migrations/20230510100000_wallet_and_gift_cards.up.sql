@@ -0,0 +1,49 @@
+/* every balance lives in an account; money only moves between accounts
+   through transactions whose entries add up to zero */
+CREATE TABLE IF NOT EXISTS ledger_accounts(
+    account_id SERIAL PRIMARY KEY,
+    kind text NOT NULL,
+    user_id int REFERENCES users (user_id),
+    currency text NOT NULL DEFAULT 'INR',
+    /* kept in step with the entries, customer accounts can't go below zero */
+    balance int NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CHECK (balance >= 0 OR kind IN ('issuance', 'sales', 'refunds'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_accounts_wallet_idx ON ledger_accounts (user_id) WHERE kind = 'wallet';
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_accounts_system_idx ON ledger_accounts (kind) WHERE kind IN ('issuance', 'sales', 'refunds');
+
+INSERT INTO ledger_accounts (kind) VALUES ('issuance'), ('sales'), ('refunds');
+
+CREATE TABLE IF NOT EXISTS ledger_transactions(
+    txn_id SERIAL PRIMARY KEY,
+    kind text NOT NULL,
+    booking_id int REFERENCES bookings (booking_id),
+    memo text NOT NULL DEFAULT '',
+    created_by int REFERENCES users (user_id),
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries(
+    entry_id SERIAL PRIMARY KEY,
+    txn_id int NOT NULL REFERENCES ledger_transactions (txn_id),
+    account_id int NOT NULL REFERENCES ledger_accounts (account_id),
+    amount int NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_account_idx ON ledger_entries (account_id, entry_id);
+
+CREATE TABLE IF NOT EXISTS gift_cards(
+    gift_card_id SERIAL PRIMARY KEY,
+    code citext UNIQUE NOT NULL,
+    account_id int NOT NULL REFERENCES ledger_accounts (account_id),
+    initial_amount int NOT NULL,
+    status text NOT NULL DEFAULT 'Active',
+    expires_at timestamptz,
+    issued_by int REFERENCES users (user_id),
+    voided_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+ALTER TABLE refunds ADD COLUMN destination text NOT NULL DEFAULT 'original';
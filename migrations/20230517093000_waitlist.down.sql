@@ -0,0 +1,7 @@
+ALTER TABLE bookings DROP COLUMN IF EXISTS cancelled_at;
+
+UPDATE seats SET status = 'Available' WHERE status = 'Held';
+ALTER TABLE seats DROP COLUMN IF EXISTS held_until;
+ALTER TABLE seats DROP COLUMN IF EXISTS held_for;
+
+DROP TABLE IF EXISTS waitlist;
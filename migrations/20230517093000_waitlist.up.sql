@@ -0,0 +1,20 @@
+/* customers queue for a sold-out show; released seats are held for whoever
+   is next until they claim them or the offer runs out */
+CREATE TABLE IF NOT EXISTS waitlist(
+    entry_id SERIAL PRIMARY KEY,
+    show_id int NOT NULL REFERENCES shows (show_id),
+    user_id int NOT NULL REFERENCES users (user_id),
+    seats int NOT NULL CHECK (seats > 0),
+    status text NOT NULL DEFAULT 'Waiting',
+    offered_at timestamptz,
+    offer_expires_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS waitlist_active_idx ON waitlist (show_id, user_id) WHERE status IN ('Waiting', 'Offered');
+CREATE INDEX IF NOT EXISTS waitlist_queue_idx ON waitlist (show_id, entry_id) WHERE status = 'Waiting';
+
+ALTER TABLE seats ADD COLUMN held_for int REFERENCES waitlist (entry_id);
+ALTER TABLE seats ADD COLUMN held_until timestamptz;
+
+ALTER TABLE bookings ADD COLUMN cancelled_at timestamptz;
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS password_resets;
+
+DROP INDEX IF EXISTS notifications_pending_idx;
+ALTER TABLE notifications DROP COLUMN IF EXISTS sent_at;
+ALTER TABLE notifications DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE notifications DROP COLUMN IF EXISTS next_attempt_at;
+ALTER TABLE notifications DROP COLUMN IF EXISTS last_error;
+ALTER TABLE notifications DROP COLUMN IF EXISTS delivered;
+ALTER TABLE notifications DROP COLUMN IF EXISTS attempts;
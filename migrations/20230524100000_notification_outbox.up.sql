@@ -0,0 +1,22 @@
+/* notifications doubles as the outbox: rows are queued in the same
+   transaction as the change they announce and a dispatcher sends them.
+   delivered lists the channels that already have a row, so a retry doesn't
+   send through them again */
+ALTER TABLE notifications ADD COLUMN attempts int NOT NULL DEFAULT 0;
+ALTER TABLE notifications ADD COLUMN delivered text[] NOT NULL DEFAULT '{}';
+ALTER TABLE notifications ADD COLUMN last_error text;
+ALTER TABLE notifications ADD COLUMN next_attempt_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE notifications ADD COLUMN locked_until timestamptz;
+ALTER TABLE notifications ADD COLUMN sent_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS notifications_pending_idx ON notifications (next_attempt_at) WHERE status = 'Pending';
+
+CREATE TABLE IF NOT EXISTS password_resets(
+    reset_id SERIAL PRIMARY KEY,
+    user_id int NOT NULL REFERENCES users (user_id),
+    /* only a hash of the token is kept */
+    token_hash text UNIQUE NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
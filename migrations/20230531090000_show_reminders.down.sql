@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS scheduled_jobs;
+
+ALTER TABLE bookings DROP COLUMN IF EXISTS reminded_at;
@@ -0,0 +1,14 @@
+/* set when the reminder is queued, so each booking gets one */
+ALTER TABLE bookings ADD COLUMN reminded_at timestamptz;
+
+/* one row per background job; a replica runs a job only while it holds the
+   lease, and not before next_run_at */
+CREATE TABLE IF NOT EXISTS scheduled_jobs(
+    name text PRIMARY KEY,
+    locked_by text,
+    locked_until timestamptz,
+    next_run_at timestamptz NOT NULL DEFAULT now(),
+    last_started_at timestamptz,
+    last_finished_at timestamptz,
+    last_error text
+);
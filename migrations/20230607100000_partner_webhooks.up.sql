@@ -0,0 +1,42 @@
+/* a partner's endpoint and the events it wants, the secret signs every
+   payload sent to it */
+CREATE TABLE IF NOT EXISTS webhook_subscriptions(
+    subscription_id SERIAL PRIMARY KEY,
+    partner text NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text[] NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+/* one row per event per subscription; Dead rows are the dead letters,
+   kept until someone redelivers them */
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    delivery_id SERIAL PRIMARY KEY,
+    subscription_id int NOT NULL REFERENCES webhook_subscriptions (subscription_id),
+    event_id text NOT NULL,
+    event text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'Pending',
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    locked_until timestamptz,
+    last_error text,
+    delivered_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'Pending';
+
+CREATE TABLE IF NOT EXISTS webhook_attempts(
+    attempt_id SERIAL PRIMARY KEY,
+    delivery_id int NOT NULL REFERENCES webhook_deliveries (delivery_id),
+    status_code int,
+    error text,
+    duration_ms int NOT NULL,
+    attempted_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_attempts_delivery_idx ON webhook_attempts (delivery_id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS analytics_facts;
+
+DROP INDEX IF EXISTS notifications_event_idx;
+ALTER TABLE notifications DROP COLUMN IF EXISTS event_id;
+
+DROP TABLE IF EXISTS events;
@@ -0,0 +1,39 @@
+/* the outbox: every state change writes its event here in the same
+   transaction, the dispatcher hands it to each subscriber until all of them
+   have handled it */
+CREATE TABLE IF NOT EXISTS events(
+    event_id BIGSERIAL PRIMARY KEY,
+    type text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'Pending',
+    /* subscribers that handled the event */
+    handled text[] NOT NULL DEFAULT '{}',
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    locked_until timestamptz,
+    last_error text,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    processed_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS events_pending_idx ON events (next_attempt_at) WHERE status = 'Pending';
+
+/* lets a subscriber queue a notification for an event more than once
+   without the customer getting it twice */
+ALTER TABLE notifications ADD COLUMN event_id bigint REFERENCES events (event_id);
+CREATE UNIQUE INDEX IF NOT EXISTS notifications_event_idx ON notifications (event_id, kind);
+
+/* one row per event, for reporting */
+CREATE TABLE IF NOT EXISTS analytics_facts(
+    event_id bigint PRIMARY KEY REFERENCES events (event_id),
+    type text NOT NULL,
+    user_id int,
+    show_id int,
+    booking_id int,
+    channel text,
+    seats int NOT NULL DEFAULT 0,
+    amount int NOT NULL DEFAULT 0,
+    occurred_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS analytics_facts_type_idx ON analytics_facts (type, occurred_at);
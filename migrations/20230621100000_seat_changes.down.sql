@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS seats_status_changed ON seats;
+DROP FUNCTION IF EXISTS record_seat_change();
+DROP TABLE IF EXISTS seat_changes;
@@ -0,0 +1,25 @@
+/* every change of a seat's status, in commit order per transaction, for
+   streaming seat maps to clients; the ids let a client resume where it left
+   off. Kept by a trigger so no code path that moves seats can miss it. */
+CREATE TABLE IF NOT EXISTS seat_changes(
+    change_id BIGSERIAL PRIMARY KEY,
+    show_id int NOT NULL,
+    seat_number int NOT NULL,
+    status text NOT NULL,
+    changed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS seat_changes_show_idx ON seat_changes (show_id, change_id);
+CREATE INDEX IF NOT EXISTS seat_changes_changed_at_idx ON seat_changes (changed_at);
+
+CREATE OR REPLACE FUNCTION record_seat_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.status IS DISTINCT FROM OLD.status THEN
+        INSERT INTO seat_changes (show_id, seat_number, status) VALUES (NEW.show_id, NEW.seat_number, NEW.status);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER seats_status_changed AFTER INSERT OR UPDATE OF status ON seats
+    FOR EACH ROW EXECUTE FUNCTION record_seat_change();
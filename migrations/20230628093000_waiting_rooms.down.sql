@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS queue_tokens;
+DROP TABLE IF EXISTS waiting_rooms;
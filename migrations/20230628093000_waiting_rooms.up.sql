@@ -0,0 +1,35 @@
+/* an admin opens a waiting room for a show or for every show of a movie;
+   while it is active customers book only once admitted from its queue */
+CREATE TABLE IF NOT EXISTS waiting_rooms(
+    room_id SERIAL PRIMARY KEY,
+    show_id int REFERENCES shows (show_id),
+    movie_id int REFERENCES movies (movie_id),
+    admit_per_minute int NOT NULL CHECK (admit_per_minute > 0),
+    /* how long an admitted customer has to book */
+    admission_mins int NOT NULL CHECK (admission_mins > 0),
+    active boolean NOT NULL DEFAULT true,
+    /* admissions are owed from here at admit_per_minute */
+    last_admitted_at timestamptz NOT NULL DEFAULT now(),
+    created_by int REFERENCES users (user_id),
+    created_at timestamptz NOT NULL DEFAULT now(),
+    closed_at timestamptz,
+    CHECK ((show_id IS NULL) <> (movie_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS waiting_rooms_show_idx ON waiting_rooms (show_id) WHERE active;
+CREATE UNIQUE INDEX IF NOT EXISTS waiting_rooms_movie_idx ON waiting_rooms (movie_id) WHERE active;
+
+CREATE TABLE IF NOT EXISTS queue_tokens(
+    token_id BIGSERIAL PRIMARY KEY,
+    room_id int NOT NULL REFERENCES waiting_rooms (room_id),
+    user_id int NOT NULL REFERENCES users (user_id),
+    token text NOT NULL UNIQUE,
+    status text NOT NULL DEFAULT 'Waiting',
+    joined_at timestamptz NOT NULL DEFAULT now(),
+    admitted_at timestamptz,
+    expires_at timestamptz
+);
+
+/* one place in the queue per customer */
+CREATE UNIQUE INDEX IF NOT EXISTS queue_tokens_user_idx ON queue_tokens (room_id, user_id) WHERE status IN ('Waiting', 'Admitted');
+CREATE INDEX IF NOT EXISTS queue_tokens_waiting_idx ON queue_tokens (room_id, token_id) WHERE status = 'Waiting';
@@ -0,0 +1,10 @@
+/* token buckets shared by every replica when RATE_LIMIT_STORE is postgres */
+CREATE TABLE IF NOT EXISTS rate_limit_buckets(
+    bucket_key text PRIMARY KEY,
+    tokens double precision NOT NULL,
+    /* whether the last request took a token */
+    allowed boolean NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_updated_idx ON rate_limit_buckets (updated_at);
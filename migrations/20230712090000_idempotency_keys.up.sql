@@ -0,0 +1,19 @@
+/* the first response to a request sent with an Idempotency-Key, replayed
+   when the request is retried */
+CREATE TABLE IF NOT EXISTS idempotent_requests(
+    /* the user's email, empty for requests made before logging in */
+    owner text NOT NULL,
+    idem_key text NOT NULL,
+    request_hash text NOT NULL,
+    status text NOT NULL DEFAULT 'InProgress',
+    status_code int,
+    content_type text NOT NULL DEFAULT '',
+    response_body bytea,
+    /* a retry can take over a request whose server died once this passes */
+    locked_until timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    completed_at timestamptz,
+    PRIMARY KEY (owner, idem_key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotent_requests_created_idx ON idempotent_requests (created_at);
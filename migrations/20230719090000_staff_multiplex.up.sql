@@ -0,0 +1,2 @@
+/* the multiplex a staff member works at, staff only act for it */
+ALTER TABLE users ADD COLUMN IF NOT EXISTS multiplex_id int REFERENCES multiplexes (multiplex_id);
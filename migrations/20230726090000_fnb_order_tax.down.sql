@@ -0,0 +1 @@
+ALTER TABLE fnb_orders DROP COLUMN IF EXISTS tax;
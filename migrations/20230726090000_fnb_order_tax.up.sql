@@ -0,0 +1,3 @@
+/* the tax charged on an order, refunded with it when the kitchen cancels it.
+   Orders placed before this refund without their tax. */
+ALTER TABLE fnb_orders ADD COLUMN IF NOT EXISTS tax int NOT NULL DEFAULT 0;
@@ -0,0 +1,228 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const sendTimeout = 10 * time.Second
+
+// LogChannel only logs what it would send, for development.
+type LogChannel struct {
+	logger *zap.SugaredLogger
+}
+
+func NewLogChannel(l *zap.SugaredLogger) *LogChannel {
+	return &LogChannel{logger: l}
+}
+
+func (c *LogChannel) Name() string {
+	return ChannelLog
+}
+
+func (c *LogChannel) Send(ctx context.Context, m Message) error {
+	c.logger.Infof("Notification %v (%v) to %v <%v>: %v", m.Notification_id, m.Kind, m.To.Name, m.To.Email, m.Subject)
+	return nil
+}
+
+// FileChannel appends every message to a file as a line of JSON, for
+// development without a mail server.
+type FileChannel struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileChannel(path string) *FileChannel {
+	return &FileChannel{path: path}
+}
+
+func (c *FileChannel) Name() string {
+	return ChannelFile
+}
+
+func (c *FileChannel) Send(ctx context.Context, m Message) (err error) {
+	line, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return
+}
+
+// EmailChannel sends mail through an SMTP server, upgrading to TLS when the
+// server offers it.
+type EmailChannel struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func NewEmailChannel(host string, port int, username string, password string, from string) *EmailChannel {
+	return &EmailChannel{host: host, port: port, username: username, password: password, from: from}
+}
+
+func (c *EmailChannel) Name() string {
+	return ChannelEmail
+}
+
+func (c *EmailChannel) Send(ctx context.Context, m Message) (err error) {
+	if m.To.Email == "" {
+		return ErrNoAddress
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", c.host, c.port))
+	if err != nil {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(nil); err != nil {
+			return
+		}
+	}
+	if c.username != "" {
+		if err = client.Auth(smtp.PlainAuth("", c.username, c.password, c.host)); err != nil {
+			return
+		}
+	}
+	if err = client.Mail(c.from); err != nil {
+		return
+	}
+	if err = client.Rcpt(m.To.Email); err != nil {
+		return
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return
+	}
+	if _, err = w.Write(c.mail(m)); err != nil {
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	return client.Quit()
+}
+
+func (c *EmailChannel) mail(m Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", c.from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To.Email)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// SMSChannel posts the short text of a message to an SMS provider's HTTP
+// API.
+type SMSChannel struct {
+	url    string
+	apiKey string
+	sender string
+	client *http.Client
+}
+
+func NewSMSChannel(url string, apiKey string, sender string) *SMSChannel {
+	return &SMSChannel{url: url, apiKey: apiKey, sender: sender, client: &http.Client{Timeout: sendTimeout}}
+}
+
+func (c *SMSChannel) Name() string {
+	return ChannelSMS
+}
+
+func (c *SMSChannel) Send(ctx context.Context, m Message) error {
+	if m.To.Phone == "" {
+		return ErrNoAddress
+	}
+	return postJSON(ctx, c.client, c.url, c.apiKey, map[string]string{
+		"from":    c.sender,
+		"to":      m.To.Phone,
+		"message": m.Short,
+	})
+}
+
+// WebhookChannel posts the whole message as JSON, for an external service
+// to deliver.
+type WebhookChannel struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookChannel(url string) *WebhookChannel {
+	return &WebhookChannel{url: url, client: &http.Client{Timeout: sendTimeout}}
+}
+
+func (c *WebhookChannel) Name() string {
+	return ChannelWebhook
+}
+
+func (c *WebhookChannel) Send(ctx context.Context, m Message) error {
+	return postJSON(ctx, c.client, c.url, "", m)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, bearer string, v interface{}) (err error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	return
+}
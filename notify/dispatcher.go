@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/Coderx44/MovieTicketingPortal/outbox"
+	"go.uber.org/zap"
+)
+
+var backoff = outbox.Backoff{Min: 30 * time.Second, Max: 1 * time.Hour}
+
+// Dispatcher sends the notifications in the outbox through every channel.
+// It is safe to run one per replica, each claims its own batch.
+type Dispatcher struct {
+	*outbox.Poller
+	store       db.Storer
+	channels    []Channel
+	logger      *zap.SugaredLogger
+	batchSize   int
+	maxAttempts int
+}
+
+func NewDispatcher(s db.Storer, channels []Channel, l *zap.SugaredLogger) *Dispatcher {
+	c := config.Notify()
+	d := &Dispatcher{
+		store:       s,
+		channels:    channels,
+		logger:      l,
+		batchSize:   c.BatchSize(),
+		maxAttempts: c.MaxAttempts(),
+	}
+	d.Poller = outbox.NewPoller("notifications", l, c.PollInterval(), c.BatchSize(), d.DispatchPending)
+	return d
+}
+
+// DispatchPending sends one batch of due notifications and returns how many
+// it claimed.
+func (d *Dispatcher) DispatchPending(ctx context.Context) (n int, err error) {
+	pending, err := d.store.ClaimNotifications(ctx, d.batchSize, outbox.Lease)
+	if err != nil {
+		return
+	}
+
+	for _, p := range pending {
+		r := d.deliver(ctx, p)
+		// record with a fresh context so a shutdown doesn't leave sent
+		// notifications looking unsent
+		if err := d.store.RecordNotification(context.Background(), r); err != nil {
+			d.logger.Errorf("Err: Recording notification %v: %v", p.Notification_id, err.Error())
+		}
+	}
+	return len(pending), nil
+}
+
+// deliver sends a notification through the channels that don't have it yet.
+func (d *Dispatcher) deliver(ctx context.Context, p db.Notification) (r db.NotificationResult) {
+	r = db.NotificationResult{
+		Notification_id: p.Notification_id,
+		Delivered:       p.Delivered,
+		Next_attempt_at: time.Now(),
+	}
+
+	data := templateData{Name: p.Name}
+	if err := json.Unmarshal(p.Payload, &data.Payload); err != nil {
+		d.logger.Errorf("Err: Reading notification %v: %v", p.Notification_id, err.Error())
+		r.Status, r.Error = db.NotificationFailed, err.Error()
+		return
+	}
+	booking, err := d.bookingOf(ctx, data.Payload)
+	if err != nil {
+		// unlike a broken template, the database may be back next attempt
+		d.logger.Errorf("Err: Looking up booking of notification %v: %v", p.Notification_id, err.Error())
+		r.Error = err.Error()
+		d.retry(&r, p.Attempts)
+		return
+	}
+	data.Booking = booking
+
+	m, err := render(p, data)
+	if err != nil {
+		// templates don't fix themselves, no point retrying
+		d.logger.Errorf("Err: Rendering notification %v: %v", p.Notification_id, err.Error())
+		r.Status, r.Error = db.NotificationFailed, err.Error()
+		return
+	}
+
+	done := make(map[string]bool, len(p.Delivered))
+	for _, name := range p.Delivered {
+		done[name] = true
+	}
+
+	var failures []string
+	for _, c := range d.channels {
+		if done[c.Name()] {
+			continue
+		}
+		err := c.Send(ctx, m)
+		if err == ErrNoAddress {
+			d.logger.Infof("Notification %v can't go by %v to user %v", p.Notification_id, c.Name(), p.User_id)
+		} else if err != nil {
+			failures = append(failures, c.Name()+": "+err.Error())
+			continue
+		}
+		r.Delivered = append(r.Delivered, c.Name())
+	}
+
+	if len(failures) == 0 {
+		r.Status = db.NotificationSent
+		return
+	}
+	r.Error = strings.Join(failures, "; ")
+	d.logger.Errorf("Err: Sending notification %v: %v", p.Notification_id, r.Error)
+	d.retry(&r, p.Attempts)
+	return
+}
+
+// retry schedules another attempt, or gives up once the notification has had
+// all of its attempts.
+func (d *Dispatcher) retry(r *db.NotificationResult, attempts int) {
+	if attempts+1 >= d.maxAttempts {
+		r.Status = db.NotificationFailed
+		return
+	}
+	r.Status = db.NotificationPending
+	r.Next_attempt_at = time.Now().Add(backoff.After(attempts))
+}
+
+// bookingOf looks up the booking a payload names. A booking that is gone
+// only leaves its details out of the message.
+func (d *Dispatcher) bookingOf(ctx context.Context, payload map[string]interface{}) (b *db.BookingDetail, err error) {
+	id, ok := payload["booking_id"].(float64)
+	if !ok {
+		return
+	}
+	detail, err := d.store.GetBookingByID(ctx, int(id))
+	if err == db.ErrBookingNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	return &detail, nil
+}
+
+func render(p db.Notification, data templateData) (m Message, err error) {
+	m = Message{
+		Notification_id: p.Notification_id,
+		Kind:            p.Kind,
+		To: Recipient{
+			User_id: p.User_id,
+			Name:    p.Name,
+			Email:   p.Email,
+			Phone:   p.Phone_number,
+		},
+		Payload: data.Payload,
+	}
+	m.Subject, m.Body, m.Short, err = Render(p.Kind, data)
+	return
+}
@@ -0,0 +1,81 @@
+// Package notify delivers the notifications queued in the outbox to
+// customers through one or more channels.
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ErrNoAddress is returned by a channel that has no way of reaching the
+// recipient, like SMS to a user without a phone number. The dispatcher
+// doesn't retry it.
+var ErrNoAddress = errors.New("recipient can't be reached through the channel")
+
+// Channel names as used in NOTIFY_CHANNELS
+const (
+	ChannelLog     = "log"
+	ChannelFile    = "file"
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebhook = "webhook"
+)
+
+type Recipient struct {
+	User_id int    `json:"user_id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+}
+
+// Message is a rendered notification. Body is the full text for email,
+// Short fits in an SMS.
+type Message struct {
+	Notification_id int                    `json:"notification_id"`
+	Kind            string                 `json:"kind"`
+	To              Recipient              `json:"to"`
+	Subject         string                 `json:"subject"`
+	Body            string                 `json:"body"`
+	Short           string                 `json:"short"`
+	Payload         map[string]interface{} `json:"payload"`
+}
+
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, m Message) error
+}
+
+// NewChannels builds the channels named in the configuration.
+func NewChannels(l *zap.SugaredLogger) (channels []Channel, err error) {
+	c := config.Notify()
+	for _, name := range c.Channels() {
+		switch name {
+		case ChannelLog:
+			channels = append(channels, NewLogChannel(l))
+		case ChannelFile:
+			channels = append(channels, NewFileChannel(c.FilePath()))
+		case ChannelEmail:
+			if c.SMTPHost() == "" || c.SMTPFrom() == "" {
+				return nil, errors.New("email channel needs SMTP_HOST and SMTP_FROM")
+			}
+			channels = append(channels, NewEmailChannel(c.SMTPHost(), c.SMTPPort(), c.SMTPUsername(), c.SMTPPassword(), c.SMTPFrom()))
+		case ChannelSMS:
+			if c.SMSURL() == "" {
+				return nil, errors.New("sms channel needs SMS_API_URL")
+			}
+			channels = append(channels, NewSMSChannel(c.SMSURL(), c.SMSAPIKey(), c.SMSSender()))
+		case ChannelWebhook:
+			if c.WebhookURL() == "" {
+				return nil, errors.New("webhook channel needs NOTIFY_WEBHOOK_URL")
+			}
+			channels = append(channels, NewWebhookChannel(c.WebhookURL()))
+		default:
+			return nil, fmt.Errorf("unknown notification channel %q", name)
+		}
+	}
+	return
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+const SubscriberName = "notifications"
+
+// NotificationWelcome greets customers who sign up.
+const NotificationWelcome = "welcome"
+
+// Subscriber queues the notifications that follow from domain events. The
+// notifications of bookings and shows are queued with the change itself,
+// this covers the rest.
+type Subscriber struct {
+	store db.Storer
+}
+
+func NewSubscriber(s db.Storer) *Subscriber {
+	return &Subscriber{store: s}
+}
+
+func (s *Subscriber) Name() string {
+	return SubscriberName
+}
+
+func (s *Subscriber) Handle(ctx context.Context, e db.Event) (err error) {
+	if e.Type != db.EventUserCreated {
+		return
+	}
+
+	var ev db.UserCreatedEvent
+	if err = e.Decode(&ev); err != nil {
+		return
+	}
+	// staff and admin accounts are made for people, not by them
+	if ev.Role == "admin" || ev.Role == "staff" {
+		return
+	}
+	return s.store.QueueEventNotification(ctx, e.Event_id, ev.User_id, NotificationWelcome, map[string]interface{}{
+		"user_id": ev.User_id,
+	})
+}
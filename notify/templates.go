@@ -0,0 +1,203 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/pkg/errors"
+)
+
+var ErrUnknownKind = errors.New("no template for the notification kind")
+
+// NotificationShowReminder is queued by the reminder job before a show.
+const NotificationShowReminder = "show_reminder"
+
+// templateData is what templates are rendered with. Booking is set when the
+// payload names one.
+type templateData struct {
+	Name    string
+	Payload map[string]interface{}
+	Booking *db.BookingDetail
+}
+
+type messageTemplate struct {
+	subject string
+	body    string
+	short   string
+}
+
+// templates by notification kind
+var templates = map[string]messageTemplate{
+	db.NotificationBookingConfirmed: {
+		subject: `Booking {{.Payload.booking_id}} confirmed`,
+		body: `Hi {{.Name}},
+
+Your booking {{.Payload.booking_id}} is confirmed{{with .Booking}} for {{.Title}} at {{.Multiplex}}, screen {{.Screen_number}}, on {{showTime .}}{{end}}.
+
+Seats: {{seats .Payload.seats}}
+Paid: {{money .Payload.amount .Payload.currency}}
+
+Enjoy the show!`,
+		short: `Booking {{.Payload.booking_id}} confirmed{{with .Booking}}: {{.Title}}, {{showTime .}}{{end}}, seats {{seats .Payload.seats}}.`,
+	},
+	db.NotificationBookingCancelled: {
+		subject: `Booking {{.Payload.booking_id}} cancelled`,
+		body: `Hi {{.Name}},
+
+Your booking {{.Payload.booking_id}}{{with .Booking}} for {{.Title}} on {{showTime .}}{{end}} has been cancelled.
+{{template "refund" .}}`,
+		short: `Booking {{.Payload.booking_id}} cancelled. {{template "refundShort" .}}`,
+	},
+	db.NotificationShowCancelled: {
+		subject: `Your show has been cancelled`,
+		body: `Hi {{.Name}},
+
+We're sorry, {{with .Booking}}{{.Title}} on {{showTime .}} at {{.Multiplex}}{{else}}your show{{end}} has been cancelled: {{.Payload.reason}}.
+Your booking {{.Payload.booking_id}} is cancelled.
+{{template "refund" .}}`,
+		short: `Sorry, your show{{with .Booking}} {{.Title}}, {{showTime .}}{{end}} is cancelled. {{template "refundShort" .}}`,
+	},
+	db.NotificationShowRescheduled: {
+		subject: `Your show has moved`,
+		body: `Hi {{.Name}},
+
+{{with .Booking}}{{.Title}} at {{.Multiplex}} now starts at {{showTime .}} on screen {{.Screen_number}}{{else}}Your show now starts at {{when .Payload.start_time}}{{end}}.
+{{if .Payload.action_required}}Your seats {{seats .Payload.seats}} aren't on the new screen, please pick new seats or cancel booking {{.Payload.booking_id}}.{{else}}Your seats {{seats .Payload.seats}} stay the same.{{end}}`,
+		short: `Your show{{with .Booking}} {{.Title}}{{end}} has moved to {{when .Payload.start_time}}.{{if .Payload.action_required}} Please pick new seats.{{end}}`,
+	},
+	db.NotificationWaitlistOffer: {
+		subject: `Seats are waiting for you`,
+		body: `Hi {{.Name}},
+
+Seats {{seats .Payload.seats}} of show {{.Payload.show_id}} came free and are held for you until {{when .Payload.expires_at}}.
+Book them before then, after that they go to the next person on the waitlist.`,
+		short: `Seats {{seats .Payload.seats}} of show {{.Payload.show_id}} are held for you until {{when .Payload.expires_at}}. Book now!`,
+	},
+	NotificationShowReminder: {
+		subject: `Your show starts soon`,
+		body: `Hi {{.Name}},
+
+A reminder that {{with .Booking}}{{.Title}} starts at {{showTime .}} at {{.Multiplex}}, screen {{.Screen_number}}{{else}}your show starts at {{when .Payload.start_time}}{{end}}.
+Seats: {{seats .Payload.seats}}
+
+Please arrive a little early for admission.`,
+		short: `Reminder: {{with .Booking}}{{.Title}} at {{showTime .}}, screen {{.Screen_number}}{{else}}your show at {{when .Payload.start_time}}{{end}}, seats {{seats .Payload.seats}}.`,
+	},
+	NotificationWelcome: {
+		subject: `Welcome aboard`,
+		body: `Hi {{.Name}},
+
+Thanks for signing up. You can now book seats, order food and drinks with your tickets and earn loyalty points on every booking.
+
+See you at the movies!`,
+		short: `Welcome aboard, {{.Name}}! Your account is ready.`,
+	},
+	db.NotificationPasswordReset: {
+		subject: `Reset your password`,
+		body: `Hi {{.Name}},
+
+Use this code to reset your password: {{.Payload.token}}
+It works once and until {{when .Payload.expires_at}}. If you didn't ask to reset your password you can ignore this message.`,
+		short: `Your password reset code is {{.Payload.token}}, valid until {{when .Payload.expires_at}}.`,
+	},
+}
+
+const partials = `{{define "refund"}}{{if .Payload.refund_amount}}{{money .Payload.refund_amount ""}} will be refunded {{if eq (print .Payload.refund_to) "wallet"}}to your wallet{{else}}to how you paid{{end}}.{{end}}{{if .Payload.points_refunded}}
+{{.Payload.points_refunded}} loyalty points are back in your account.{{end}}{{end}}` +
+	`{{define "refundShort"}}{{if .Payload.refund_amount}}Refund of {{money .Payload.refund_amount ""}} {{if eq (print .Payload.refund_to) "wallet"}}to your wallet{{else}}initiated{{end}}.{{end}}{{end}}`
+
+var funcs = template.FuncMap{
+	"money":    money,
+	"seats":    seats,
+	"when":     when,
+	"showTime": showTime,
+}
+
+// compiled holds the subject, body and short templates of every kind.
+var compiled = map[string][3]*template.Template{}
+
+func init() {
+	for kind, t := range templates {
+		var ts [3]*template.Template
+		for i, text := range []string{t.subject, t.body, t.short} {
+			ts[i] = template.Must(template.Must(template.New(kind).Funcs(funcs).Parse(partials)).Parse(text))
+		}
+		compiled[kind] = ts
+	}
+}
+
+// Render fills in the templates of a notification's kind.
+func Render(kind string, data templateData) (subject string, body string, short string, err error) {
+	ts, ok := compiled[kind]
+	if !ok {
+		err = ErrUnknownKind
+		return
+	}
+
+	out := make([]string, len(ts))
+	for i, t := range ts {
+		var b bytes.Buffer
+		if err = t.Execute(&b, data); err != nil {
+			return
+		}
+		out[i] = strings.TrimSpace(b.String())
+	}
+	return out[0], out[1], out[2], nil
+}
+
+// money formats an amount in minor units, payload numbers come back from
+// JSON as float64.
+func money(amount interface{}, currency interface{}) string {
+	var minor int64
+	switch v := amount.(type) {
+	case float64:
+		minor = int64(v)
+	case int:
+		minor = int64(v)
+	case int64:
+		minor = v
+	}
+	cur, _ := currency.(string)
+	if cur == "" {
+		cur = config.Pricing().Currency()
+	}
+	return fmt.Sprintf("%s %d.%02d", cur, minor/100, minor%100)
+}
+
+func seats(v interface{}) string {
+	list, _ := v.([]interface{})
+	parts := make([]string, 0, len(list))
+	for _, s := range list {
+		parts = append(parts, fmt.Sprint(s))
+	}
+	return strings.Join(parts, ", ")
+}
+
+const humanTime = "Mon 2 Jan 2006, 3:04 PM"
+
+// when formats a payload time in the default multiplex time zone.
+func when(v interface{}) string {
+	s, _ := v.(string)
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	if loc, err := time.LoadLocation(config.Show().TimeZone()); err == nil {
+		t = t.In(loc)
+	}
+	return t.Format(humanTime)
+}
+
+// showTime is when a booked show starts, in the time zone of its multiplex.
+func showTime(b *db.BookingDetail) string {
+	t := b.Start_time
+	if loc, err := time.LoadLocation(b.Time_zone); err == nil {
+		t = t.In(loc)
+	}
+	return t.Format(humanTime)
+}
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+func TestRender(t *testing.T) {
+	// payloads go through JSON in the outbox, numbers come back as float64
+	var payload map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"booking_id": 42,
+		"show_id": 7,
+		"seats": [3, 4],
+		"amount": 45050,
+		"currency": "INR",
+		"refund_amount": 45050,
+		"refund_to": "wallet",
+		"reason": "projector fault",
+		"start_time": "2023-05-20T14:30:00Z",
+		"expires_at": "2023-05-20T12:00:00Z",
+		"token": "123456"
+	}`), &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	booking := &db.BookingDetail{
+		Title:         "Arrival",
+		Multiplex:     "Cineplex",
+		Screen_number: 2,
+		Start_time:    time.Date(2023, 5, 20, 14, 30, 0, 0, time.UTC),
+		Time_zone:     "Asia/Kolkata",
+	}
+
+	for kind := range templates {
+		for _, b := range []*db.BookingDetail{nil, booking} {
+			subject, body, short, err := Render(kind, templateData{Name: "Asha", Payload: payload, Booking: b})
+			if err != nil {
+				t.Fatalf("%v: %v", kind, err)
+			}
+			if subject == "" || body == "" || short == "" {
+				t.Fatalf("%v: empty message %q %q %q", kind, subject, body, short)
+			}
+			if strings.Contains(body+short, "<no value>") {
+				t.Fatalf("%v: missing value in %q %q", kind, body, short)
+			}
+		}
+	}
+
+	_, body, _, _ := Render(db.NotificationBookingConfirmed, templateData{Name: "Asha", Payload: payload, Booking: booking})
+	for _, want := range []string{"Arrival", "Sat 20 May 2023, 8:00 PM", "Seats: 3, 4", "INR 450.50"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("body %q doesn't have %q", body, want)
+		}
+	}
+
+	if _, _, _, err := Render("no_such_kind", templateData{}); err != ErrUnknownKind {
+		t.Fatalf("err = %v, want %v", err, ErrUnknownKind)
+	}
+}
@@ -0,0 +1,93 @@
+// Package outbox runs the loops that drain the outbox tables. Every round a
+// dispatcher claims a batch of due rows, leased to it so other replicas skip
+// them, and goes again straight away while there is a backlog. Rows that
+// fail are tried again later, backing off after every attempt.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/health"
+	"go.uber.org/zap"
+)
+
+// Lease is how long a dispatcher has to handle what it claimed before
+// another may take it over.
+const Lease = 2 * time.Minute
+
+// Poller calls dispatch every interval until ctx is done. dispatch handles
+// one batch and returns how many rows it claimed.
+type Poller struct {
+	name      string
+	dispatch  func(ctx context.Context) (int, error)
+	logger    *zap.SugaredLogger
+	interval  time.Duration
+	batchSize int
+	beat      health.Beat
+}
+
+// NewPoller returns a Poller; name is what it dispatches, for the logs.
+func NewPoller(name string, l *zap.SugaredLogger, interval time.Duration, batchSize int, dispatch func(ctx context.Context) (int, error)) *Poller {
+	return &Poller{
+		name:      name,
+		dispatch:  dispatch,
+		logger:    l,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run dispatches batches until ctx is done.
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		// keep going while there is a backlog
+		for {
+			p.beat.Mark()
+			n, err := p.dispatch(ctx)
+			if err != nil {
+				p.logger.Errorf("Err: Dispatching %v: %v", p.name, err.Error())
+			}
+			if err != nil || n < p.batchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LastBeat is when the poller last looked for work, for readiness.
+func (p *Poller) LastBeat() time.Time {
+	return p.beat.Last()
+}
+
+func (p *Poller) Interval() time.Duration {
+	return p.interval
+}
+
+// Backoff is how long to wait after a failed attempt, doubling from Min
+// after every attempt up to Max.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// After returns the wait after the given number of failed attempts.
+func (b Backoff) After(attempts int) time.Duration {
+	wait := b.Min
+	for i := 0; i < attempts && wait < b.Max; i++ {
+		wait *= 2
+	}
+	if wait > b.Max {
+		wait = b.Max
+	}
+	return wait
+}
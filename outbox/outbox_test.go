@@ -0,0 +1,68 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Min: 30 * time.Second, Max: time.Hour}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, b.Min},
+		{1, 2 * b.Min},
+		{3, 8 * b.Min},
+		{20, b.Max},
+	}
+
+	for _, tt := range tests {
+		if got := b.After(tt.attempts); got != tt.want {
+			t.Fatalf("After(%v) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestPollerRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches []int
+		err     error
+		calls   int
+	}{
+		// full batches are followed straight away by another
+		{"backlog", []int{10, 10, 3}, nil, 3},
+		{"empty", []int{0}, nil, 1},
+		{"failure waits for the next round", []int{10, 10}, errors.New("down"), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			calls := 0
+			p := NewPoller("rows", zap.NewNop().Sugar(), time.Hour, 10, func(ctx context.Context) (int, error) {
+				n := tt.batches[calls]
+				calls++
+				if calls == len(tt.batches) || tt.err != nil {
+					// the next round is an hour away
+					cancel()
+				}
+				return n, tt.err
+			})
+
+			before := time.Now()
+			p.Run(ctx)
+			if calls != tt.calls {
+				t.Fatalf("calls = %v, want %v", calls, tt.calls)
+			}
+			if p.LastBeat().Before(before) {
+				t.Fatalf("last beat = %v, want after %v", p.LastBeat(), before)
+			}
+		})
+	}
+}
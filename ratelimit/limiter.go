@@ -0,0 +1,153 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"go.uber.org/zap"
+)
+
+// Groups of routes limited apart from each other.
+const (
+	GroupIP      = "ip"
+	GroupLogin   = "login"
+	GroupBooking = "booking"
+	GroupAdmin   = "admin"
+)
+
+const (
+	HeaderLimit     = "X-RateLimit-Limit"
+	HeaderRemaining = "X-RateLimit-Remaining"
+	HeaderReset     = "X-RateLimit-Reset"
+)
+
+// Limiter throttles clients with a token bucket per group and client. A
+// client is the logged in user where there is one, its address otherwise.
+type Limiter struct {
+	store      Store
+	logger     *zap.SugaredLogger
+	user       func(r *http.Request) string
+	enabled    bool
+	trustProxy bool
+	limits     map[string]Limit
+}
+
+func limitOf(l interface {
+	Burst() int
+	PerMinute() int
+}) Limit {
+	return Limit{Burst: l.Burst(), PerMinute: l.PerMinute()}
+}
+
+// NewLimiter returns a limiter keeping its buckets in s. user returns the
+// user a request is made by, "" when nobody is logged in.
+func NewLimiter(s Store, l *zap.SugaredLogger, user func(r *http.Request) string) *Limiter {
+	c := config.RateLimit()
+	return &Limiter{
+		store:      s,
+		logger:     l,
+		user:       user,
+		enabled:    c.Enabled(),
+		trustProxy: c.TrustProxy(),
+		limits: map[string]Limit{
+			GroupIP:      limitOf(c.IP()),
+			GroupLogin:   limitOf(c.Login()),
+			GroupBooking: limitOf(c.Booking()),
+			GroupAdmin:   limitOf(c.Admin()),
+		},
+	}
+}
+
+// PerIP limits every request by client address, it goes on the router.
+func (lm *Limiter) PerIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lm.allow(w, r, GroupIP, "ip:"+lm.clientIP(r)) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Login limits the routes for logging in and signing up.
+func (lm *Limiter) Login(next http.HandlerFunc) http.HandlerFunc {
+	return lm.Group(GroupLogin, next)
+}
+
+// Booking limits quoting and booking seats.
+func (lm *Limiter) Booking(next http.HandlerFunc) http.HandlerFunc {
+	return lm.Group(GroupBooking, next)
+}
+
+// Admin limits the admin routes.
+func (lm *Limiter) Admin(next http.HandlerFunc) http.HandlerFunc {
+	return lm.Group(GroupAdmin, next)
+}
+
+// Group limits a route by the group's limit. It goes inside the JWT
+// validation so the user is known.
+func (lm *Limiter) Group(group string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := "ip:" + lm.clientIP(r)
+		if u := lm.user(r); u != "" {
+			client = "user:" + u
+		}
+		if lm.allow(w, r, group, client) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allow takes a token for the client from the group's bucket and sets the
+// rate limit headers, replying 429 when there was none. Requests go through
+// when the store fails, rather than the limiter taking the API down.
+func (lm *Limiter) allow(w http.ResponseWriter, r *http.Request, group string, client string) bool {
+	if !lm.enabled {
+		return true
+	}
+	l := lm.limits[group]
+
+	res, err := lm.store.Take(r.Context(), group+":"+client, l)
+	if err != nil {
+		lm.logger.Errorf("Err: Taking rate limit token of %v for %v: %v", client, group, err.Error())
+		return true
+	}
+
+	w.Header().Set(HeaderLimit, strconv.Itoa(l.Burst))
+	w.Header().Set(HeaderRemaining, strconv.Itoa(res.Remaining))
+	w.Header().Set(HeaderReset, seconds(res.Reset))
+	if res.Allowed {
+		return true
+	}
+
+	w.Header().Set("Retry-After", seconds(res.RetryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte("Err: Too many requests, retry after " + seconds(res.RetryAfter) + " seconds"))
+	return false
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// clientIP is the address the request came from, or behind a trusted proxy
+// the address the proxy added to X-Forwarded-For. Addresses before it are
+// whatever the client sent and can't be trusted.
+func (lm *Limiter) clientIP(r *http.Request) string {
+	if lm.trustProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(fwd[len(fwd)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		forwarded  []string
+		ip         string
+	}{
+		{"direct", false, nil, "10.0.0.9"},
+		{"forwarded but not trusted", false, []string{"203.0.113.7"}, "10.0.0.9"},
+		{"behind the proxy", true, []string{"203.0.113.7"}, "203.0.113.7"},
+		{"client sent its own", true, []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"client sent its own header", true, []string{"1.2.3.4", "203.0.113.7"}, "203.0.113.7"},
+		{"trusted without header", true, nil, "10.0.0.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.9:51234"
+			for _, f := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			lm := &Limiter{trustProxy: tt.trustProxy}
+			if ip := lm.clientIP(r); ip != tt.ip {
+				t.Fatalf("clientIP = %v, want %v", ip, tt.ip)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	s := NewMemoryStore()
+	l := Limit{Burst: 2, PerMinute: 60}
+
+	for i, want := range []bool{true, true, false} {
+		res, err := s.Take(context.Background(), "login:ip:10.0.0.9", l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != want {
+			t.Fatalf("take %v: allowed = %v, want %v", i, res.Allowed, want)
+		}
+	}
+
+	res, _ := s.Take(context.Background(), "login:ip:10.0.0.9", l)
+	if res.Remaining != 0 || res.RetryAfter <= 0 {
+		t.Fatalf("remaining = %v, retry after %v, want none left and a wait", res.Remaining, res.RetryAfter)
+	}
+
+	// other clients have their own bucket
+	if res, _ := s.Take(context.Background(), "login:ip:10.0.0.10", l); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("other client: %+v", res)
+	}
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+// Limit is a token bucket holding Burst tokens, refilled at PerMinute.
+type Limit struct {
+	Burst     int
+	PerMinute int
+}
+
+func (l Limit) perSecond() float64 {
+	return float64(l.PerMinute) / 60
+}
+
+// after is how long the bucket takes to refill from tokens up to want.
+func (l Limit) after(tokens float64, want float64) time.Duration {
+	if tokens >= want || l.PerMinute <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil((want - tokens) / l.perSecond() * float64(time.Second)))
+}
+
+// Result is what taking a token from a bucket left it at.
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration // until the next token, when not allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+func newResult(l Limit, tokens float64, allowed bool) Result {
+	r := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     l.after(tokens, float64(l.Burst)),
+	}
+	if !allowed {
+		r.RetryAfter = l.after(tokens, 1)
+	}
+	return r
+}
+
+// Store keeps the buckets. The memory store is enough for a single server;
+// replicas have to share theirs to limit clients across them.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+// NewStore returns the store named by RATE_LIMIT_STORE.
+func NewStore(name string, s db.Storer) (Store, error) {
+	switch name {
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		return NewPostgresStore(s), nil
+	}
+	return nil, fmt.Errorf("unknown rate limit store %q", name)
+}
+
+type bucket struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+}
+
+func (b *bucket) refill(now time.Time) float64 {
+	return math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.perSecond())
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// sweepEvery is how often the memory store forgets buckets that refilled.
+const sweepEvery = time.Minute
+
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+func (m *memoryStore) Take(ctx context.Context, key string, l Limit) (Result, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) >= sweepEvery {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.limit = l
+	b.tokens = b.refill(now)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newResult(l, b.tokens, allowed), nil
+}
+
+// sweep drops buckets that have refilled, a fresh one is the same.
+func (m *memoryStore) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if b.refill(now) >= float64(b.limit.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+type postgresStore struct {
+	store db.Storer
+}
+
+// NewPostgresStore keeps the buckets in the database so every replica
+// draws from the same ones.
+func NewPostgresStore(s db.Storer) Store {
+	return &postgresStore{store: s}
+}
+
+func (p *postgresStore) Take(ctx context.Context, key string, l Limit) (Result, error) {
+	tokens, allowed, err := p.store.TakeRateLimitToken(ctx, key, l.Burst, l.perSecond())
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(l, tokens, allowed), nil
+}
@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/booking"
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/Coderx44/MovieTicketingPortal/notify"
+	"go.uber.org/zap"
+)
+
+const (
+	JobShowReminders      = "show_reminders"
+	JobPruneSeatChanges   = "prune_seat_changes"
+	JobAdmitWaitingRooms  = "admit_waiting_rooms"
+	JobPruneRateLimits    = "prune_rate_limits"
+	JobPruneIdempotency   = "prune_idempotency_keys"
+	JobRepriceShows       = "reprice_shows"
+	JobExpireLoyalty      = "expire_loyalty_points"
+	JobSweepWaitlists     = "sweep_waitlists"
+	sweepWaitlistsEvery   = time.Minute
+	expireLoyaltyEvery    = time.Hour
+	expireLoyaltyBatch    = 500
+	pruneRateLimitsEvery  = 10 * time.Minute
+	rateLimitIdle         = time.Hour
+	pruneSeatChangesEvery = time.Hour
+)
+
+// ShowReminders queues a reminder for every confirmed booking of a show
+// starting within the reminder lead. Each booking is reminded once, the
+// notify dispatcher does the sending.
+func ShowReminders(s db.Storer, l *zap.SugaredLogger) Job {
+	c := config.Scheduler()
+	return Job{
+		Name:     JobShowReminders,
+		Interval: c.ReminderInterval(),
+		Run: func(ctx context.Context) error {
+			for {
+				n, err := s.QueueShowReminders(ctx, c.ReminderLead(), c.ReminderBatchSize(), notify.NotificationShowReminder)
+				if err != nil {
+					return err
+				}
+				if n > 0 {
+					l.Infof("Queued %v show reminders", n)
+				}
+				if n < c.ReminderBatchSize() || ctx.Err() != nil {
+					return nil
+				}
+			}
+		},
+	}
+}
+
+// PruneSeatChanges deletes seat changes too old for a seat map stream to
+// resume from.
+func PruneSeatChanges(s db.Storer, l *zap.SugaredLogger) Job {
+	return Job{
+		Name:     JobPruneSeatChanges,
+		Interval: pruneSeatChangesEvery,
+		Run: func(ctx context.Context) error {
+			n, err := s.PruneSeatChanges(ctx, time.Now().Add(-config.SeatFeed().Retention()))
+			if err == nil && n > 0 {
+				l.Infof("Pruned %v seat changes", n)
+			}
+			return err
+		},
+	}
+}
+
+// AdmitWaitingRooms lets the customers at the front of each open waiting
+// room's queue in, at the rate the room was opened with.
+func AdmitWaitingRooms(s db.Storer, l *zap.SugaredLogger) Job {
+	return Job{
+		Name:     JobAdmitWaitingRooms,
+		Interval: config.WaitingRoom().AdmitInterval(),
+		Run: func(ctx context.Context) error {
+			n, err := s.AdmitFromWaitingRooms(ctx)
+			if err == nil && n > 0 {
+				l.Infof("Admitted %v customers from waiting rooms", n)
+			}
+			return err
+		},
+	}
+}
+
+// PruneRateLimits deletes rate limit buckets that have been idle long enough
+// to be full again. Only the postgres store keeps any.
+func PruneRateLimits(s db.Storer, l *zap.SugaredLogger) Job {
+	return Job{
+		Name:     JobPruneRateLimits,
+		Interval: pruneRateLimitsEvery,
+		Run: func(ctx context.Context) error {
+			n, err := s.PruneRateLimitBuckets(ctx, time.Now().Add(-rateLimitIdle))
+			if err == nil && n > 0 {
+				l.Infof("Pruned %v rate limit buckets", n)
+			}
+			return err
+		},
+	}
+}
+
+// PruneIdempotencyKeys deletes the responses saved for idempotency keys
+// once retries of them are no longer expected.
+func PruneIdempotencyKeys(s db.Storer, l *zap.SugaredLogger) Job {
+	return Job{
+		Name:     JobPruneIdempotency,
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			n, err := s.PruneIdempotentRequests(ctx, time.Now().Add(-config.Idempotency().KeyTTL()))
+			if err == nil && n > 0 {
+				l.Infof("Pruned %v idempotency keys", n)
+			}
+			return err
+		},
+	}
+}
+
+// RepriceShows keeps the prices of shows on sale in line with their pricing
+// rules as they fill up and near their start.
+func RepriceShows(b booking.Service) Job {
+	return Job{
+		Name:     JobRepriceShows,
+		Interval: config.Pricing().RepriceInterval(),
+		Run:      b.RepriceShows,
+	}
+}
+
+// ExpireLoyaltyPoints writes off points whose lots have lapsed, so the
+// ledger shows where they went.
+func ExpireLoyaltyPoints(s db.Storer, l *zap.SugaredLogger) Job {
+	return Job{
+		Name:     JobExpireLoyalty,
+		Interval: expireLoyaltyEvery,
+		Run: func(ctx context.Context) error {
+			for {
+				n, err := s.ExpireLoyaltyPoints(ctx, expireLoyaltyBatch)
+				if err != nil {
+					return err
+				}
+				if n > 0 {
+					l.Infof("Expired %v loyalty point lots", n)
+				}
+				if n < expireLoyaltyBatch || ctx.Err() != nil {
+					return nil
+				}
+			}
+		},
+	}
+}
+
+// SweepWaitlists offers the seats of waitlist offers nobody claimed in time
+// to the next in line, so they don't wait on someone opening the show.
+func SweepWaitlists(b booking.Service) Job {
+	return Job{
+		Name:     JobSweepWaitlists,
+		Interval: sweepWaitlistsEvery,
+		Run:      b.SweepWaitlists,
+	}
+}
+
+// Jobs are all the jobs the scheduler runs.
+func Jobs(s db.Storer, l *zap.SugaredLogger, b booking.Service) []Job {
+	return []Job{
+		ShowReminders(s, l),
+		PruneSeatChanges(s, l),
+		AdmitWaitingRooms(s, l),
+		PruneRateLimits(s, l),
+		PruneIdempotencyKeys(s, l),
+		RepriceShows(b),
+		ExpireLoyaltyPoints(s, l),
+		SweepWaitlists(b),
+	}
+}
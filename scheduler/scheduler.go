@@ -0,0 +1,133 @@
+// Package scheduler runs periodic background jobs. Every replica may run a
+// scheduler, a lease in the scheduled_jobs table lets only one of them run a
+// job at a time.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/Coderx44/MovieTicketingPortal/health"
+	"go.uber.org/zap"
+)
+
+// a run that takes longer than this loses its lease to another replica
+const defaultTimeout = 5 * time.Minute
+
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Timeout  time.Duration
+	Run      func(ctx context.Context) error
+}
+
+type Scheduler struct {
+	store  db.Storer
+	logger *zap.SugaredLogger
+	owner  string
+	jobs   []Job
+	beat   health.Beat
+}
+
+func New(s db.Storer, l *zap.SugaredLogger, jobs ...Job) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		store:  s,
+		logger: l,
+		owner:  fmt.Sprintf("%s-%d", host, os.Getpid()),
+		jobs:   jobs,
+	}
+}
+
+// Run runs every job on its interval until ctx is done, then waits for runs
+// in progress.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func(j Job) {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j Job) {
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.beat.Mark()
+		s.RunOnce(ctx, j)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LastBeat is when any of the jobs was last due, for readiness.
+func (s *Scheduler) LastBeat() time.Time {
+	return s.beat.Last()
+}
+
+// Interval is that of the most frequent job.
+func (s *Scheduler) Interval() (every time.Duration) {
+	for _, j := range s.jobs {
+		if every == 0 || j.Interval < every {
+			every = j.Interval
+		}
+	}
+	return
+}
+
+// RunOnce runs a job if it is due and no other replica is running it.
+func (s *Scheduler) RunOnce(ctx context.Context, j Job) {
+	timeout := j.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	ok, err := s.store.AcquireJobLease(ctx, j.Name, s.owner, timeout)
+	if err != nil {
+		s.logger.Errorf("Err: Acquiring lease of job %v: %v", j.Name, err.Error())
+		return
+	}
+	if !ok {
+		return
+	}
+
+	runErr := s.run(ctx, j, timeout)
+
+	var msg string
+	if runErr != nil {
+		msg = runErr.Error()
+		s.logger.Errorf("Err: Running job %v: %v", j.Name, msg)
+	}
+
+	// release with a fresh context so a shutdown doesn't leave the lease
+	// held until it runs out
+	if err := s.store.ReleaseJobLease(context.Background(), j.Name, s.owner, msg, j.Interval); err != nil {
+		s.logger.Errorf("Err: Releasing lease of job %v: %v", j.Name, err.Error())
+	}
+}
+
+// run runs a job within its timeout. A job that panics fails the run rather
+// than taking the replica down.
+func (s *Scheduler) run(ctx context.Context, j Job, timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.Run(ctx)
+}
@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"go.uber.org/zap"
+)
+
+// leaseStore hands out every lease and remembers how the last run went.
+type leaseStore struct {
+	db.Storer
+	released bool
+	runErr   string
+}
+
+func (s *leaseStore) AcquireJobLease(ctx context.Context, name string, owner string, lease time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (s *leaseStore) ReleaseJobLease(ctx context.Context, name string, owner string, runErr string, every time.Duration) error {
+	s.released, s.runErr = true, runErr
+	return nil
+}
+
+func TestRunOnceRecoversPanics(t *testing.T) {
+	store := &leaseStore{}
+	s := New(store, zap.NewNop().Sugar())
+
+	s.RunOnce(context.Background(), Job{
+		Name:     "boom",
+		Interval: time.Minute,
+		Run:      func(ctx context.Context) error { panic("boom") },
+	})
+	if !store.released || store.runErr != "panic: boom" {
+		t.Fatalf("released = %v, runErr = %q, want the lease released with the panic", store.released, store.runErr)
+	}
+
+	s.RunOnce(context.Background(), Job{
+		Name:     "fine",
+		Interval: time.Minute,
+		Run:      func(ctx context.Context) error { return nil },
+	})
+	if store.runErr != "" {
+		t.Fatalf("runErr = %q, want none", store.runErr)
+	}
+}
@@ -0,0 +1,141 @@
+package seatfeed
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/booking"
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// how many changes a reconnecting client is sent before it gets a fresh
+	// seat map instead
+	maxReplay = 500
+	// how long a client waits before reconnecting, in milliseconds
+	retryMillis = 3000
+)
+
+type snapshot struct {
+	Show_id int                    `json:"show_id"`
+	Seats   []booking.SeatMapEntry `json:"seats"`
+}
+
+// Stream sends the seat map of a show as a "snapshot" event and then every
+// change to a seat as a "seat" event, with comments as heartbeats. Event ids
+// are change ids: a client reconnecting with Last-Event-ID gets the changes
+// it missed, or a new snapshot when there are too many or they are gone.
+func Stream(h *Hub, s booking.Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		show_id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid show id"))
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Err: Internal Server Error - Streaming isn't supported"))
+			return
+		}
+
+		last := r.Header.Get("Last-Event-ID")
+		if last == "" {
+			// for clients that can't set headers
+			last = r.URL.Query().Get("last_event_id")
+		}
+
+		// subscribe before reading what was missed so nothing falls in between
+		sub := h.Subscribe(show_id)
+		defer h.Unsubscribe(sub)
+
+		var replay []db.SeatChange
+		resumed := false
+		if after, err := strconv.ParseInt(last, 10, 64); err == nil && after >= 0 {
+			if _, err = h.store.GetShowByID(r.Context(), show_id); err == nil {
+				replay, resumed, err = h.store.GetSeatChangesOfShow(r.Context(), show_id, after, maxReplay)
+			}
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+
+		var snap []byte
+		var snapID int64
+		if !resumed {
+			// the snapshot may already have changes made after snapID, sending
+			// those again does no harm
+			if snapID, err = h.store.GetLatestSeatChange(r.Context()); err != nil {
+				writeError(w, err)
+				return
+			}
+			seats, err := s.GetSeatMap(r.Context(), show_id)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			snap, _ = json.Marshal(snapshot{Show_id: show_id, Seats: seats})
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprintf(w, "retry: %d\n\n", retryMillis)
+		if snap != nil {
+			fmt.Fprintf(w, "id: %d\nevent: snapshot\ndata: %s\n\n", snapID, snap)
+		}
+		sent := make(map[int64]bool, len(replay))
+		for _, c := range replay {
+			writeChange(w, c)
+			sent[c.Change_id] = true
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(config.SeatFeed().Heartbeat())
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case c, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if sent[c.Change_id] {
+					continue
+				}
+				writeChange(w, c)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			flusher.Flush()
+		}
+	})
+}
+
+func writeChange(w http.ResponseWriter, c db.SeatChange) {
+	data, _ := json.Marshal(c)
+	fmt.Fprintf(w, "id: %d\nevent: seat\ndata: %s\n\n", c.Change_id, data)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if err == db.ErrShowNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Err: " + err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte("Err: Internal Server Error - Failed to stream seats"))
+}
@@ -0,0 +1,212 @@
+// Package seatfeed streams seat status changes of a show to clients over
+// server-sent events. Every server tails the seat_changes table on its own,
+// so a client gets the same changes whichever replica it is connected to
+// and can resume on any of them.
+package seatfeed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/Coderx44/MovieTicketingPortal/health"
+	"go.uber.org/zap"
+)
+
+const (
+	pollBatch = 1000
+	// changes are numbered when made but seen when committed, so a missing
+	// number is waited for this long before it is taken for a rollback
+	gapTimeout = 10 * time.Second
+	// changes a subscriber can fall behind by before it is dropped
+	subscriberBuffer = 256
+)
+
+// Subscription receives the changes of one show. C is closed when the
+// subscriber falls too far behind.
+type Subscription struct {
+	Show_id int
+	C       <-chan db.SeatChange
+	c       chan db.SeatChange
+}
+
+type Hub struct {
+	store    db.Storer
+	logger   *zap.SugaredLogger
+	interval time.Duration
+	beat     health.Beat
+
+	mu     sync.Mutex
+	subs   map[int]map[*Subscription]bool
+	closed bool
+
+	// every change up to cursor has been fanned out, seen are the ones above
+	// it and when they were first seen
+	cursor int64
+	seen   map[int64]time.Time
+}
+
+func NewHub(s db.Storer, l *zap.SugaredLogger) *Hub {
+	return &Hub{
+		store:    s,
+		logger:   l,
+		interval: config.SeatFeed().PollInterval(),
+		subs:     map[int]map[*Subscription]bool{},
+		seen:     map[int64]time.Time{},
+	}
+}
+
+func (h *Hub) Subscribe(show_id int) *Subscription {
+	c := make(chan db.SeatChange, subscriberBuffer)
+	sub := &Subscription{Show_id: show_id, C: c, c: c}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c)
+		return sub
+	}
+	if h.subs[show_id] == nil {
+		h.subs[show_id] = map[*Subscription]bool{}
+	}
+	h.subs[show_id][sub] = true
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// Close ends every stream, and any opened after, so a shutting down server
+// isn't held up by them. Clients reconnect to another server and resume.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// remove drops a subscription, h.mu must be held.
+func (h *Hub) remove(sub *Subscription) {
+	subs := h.subs[sub.Show_id]
+	if !subs[sub] {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, sub.Show_id)
+	}
+	close(sub.c)
+}
+
+// Run tails seat changes until ctx is done. Only changes made after it
+// starts are fanned out.
+func (h *Hub) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	started := false
+	for {
+		h.beat.Mark()
+		if !started {
+			cursor, err := h.store.GetLatestSeatChange(ctx)
+			if err != nil {
+				h.logger.Errorf("Err: Starting seat feed: %v", err.Error())
+			} else {
+				h.cursor, started = cursor, true
+			}
+		}
+
+		for started {
+			n, err := h.poll(ctx)
+			if err != nil {
+				h.logger.Errorf("Err: Polling seat changes: %v", err.Error())
+			}
+			if err != nil || n < pollBatch || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LastBeat is when the hub last polled for seat changes, for readiness.
+func (h *Hub) LastBeat() time.Time {
+	return h.beat.Last()
+}
+
+func (h *Hub) Interval() time.Duration {
+	return h.interval
+}
+
+// poll fans out the changes committed since the last poll and returns how
+// many of them it hadn't seen before. Changes seen above a gap are read again
+// until the gap is filled, they don't count.
+func (h *Hub) poll(ctx context.Context) (n int, err error) {
+	changes, err := h.store.GetSeatChanges(ctx, h.cursor, pollBatch)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, c := range changes {
+		if _, ok := h.seen[c.Change_id]; ok {
+			continue
+		}
+		h.seen[c.Change_id] = now
+		n++
+		for sub := range h.subs[c.Show_id] {
+			select {
+			case sub.c <- c:
+			default:
+				// a client that can't keep up reconnects and resumes
+				h.remove(sub)
+			}
+		}
+	}
+	h.advance(now)
+	return
+}
+
+// advance moves the cursor past every change seen in order and past gaps
+// that are too old to still be filled.
+func (h *Hub) advance(now time.Time) {
+	for len(h.seen) > 0 {
+		next := h.cursor + 1
+		if _, ok := h.seen[next]; ok {
+			delete(h.seen, next)
+			h.cursor = next
+			continue
+		}
+
+		lowest, oldest := int64(0), now
+		for id, t := range h.seen {
+			if lowest == 0 || id < lowest {
+				lowest = id
+			}
+			if t.Before(oldest) {
+				oldest = t
+			}
+		}
+		if now.Sub(oldest) < gapTimeout {
+			return
+		}
+		h.cursor = lowest - 1
+	}
+}
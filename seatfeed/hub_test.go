@@ -0,0 +1,80 @@
+package seatfeed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"go.uber.org/zap"
+)
+
+// changeStore serves the committed changes after a change id.
+type changeStore struct {
+	db.Storer
+	changes []db.SeatChange
+}
+
+func (s *changeStore) GetSeatChanges(ctx context.Context, after int64, limit int) (changes []db.SeatChange, err error) {
+	for _, c := range s.changes {
+		if c.Change_id > after && len(changes) < limit {
+			changes = append(changes, c)
+		}
+	}
+	return
+}
+
+func TestPoll(t *testing.T) {
+	store := &changeStore{}
+	h := &Hub{
+		store:  store,
+		logger: zap.NewNop().Sugar(),
+		subs:   map[int]map[*Subscription]bool{},
+		seen:   map[int64]time.Time{},
+	}
+	sub := h.Subscribe(7)
+	other := h.Subscribe(8)
+
+	// 2 isn't committed yet
+	store.changes = []db.SeatChange{{Change_id: 1, Show_id: 7}, {Change_id: 3, Show_id: 7}}
+	if n, err := h.poll(context.Background()); err != nil || n != 2 {
+		t.Fatalf("poll = %v, %v, want 2 new", n, err)
+	}
+	if h.cursor != 1 {
+		t.Fatalf("cursor = %v, want 1, short of the gap", h.cursor)
+	}
+	if len(sub.C) != 2 || len(other.C) != 0 {
+		t.Fatalf("show 7 got %v changes, show 8 got %v, want 2 and 0", len(sub.C), len(other.C))
+	}
+
+	// reading 3 again isn't anything new
+	if n, _ := h.poll(context.Background()); n != 0 {
+		t.Fatalf("poll = %v, want nothing new", n)
+	}
+
+	// once 2 commits the cursor moves past all of them
+	store.changes = []db.SeatChange{{Change_id: 1, Show_id: 7}, {Change_id: 2, Show_id: 8}, {Change_id: 3, Show_id: 7}}
+	if n, _ := h.poll(context.Background()); n != 1 {
+		t.Fatalf("poll = %v, want 1 new", n)
+	}
+	if h.cursor != 3 || len(h.seen) != 0 {
+		t.Fatalf("cursor = %v with %v seen, want 3 with none", h.cursor, len(h.seen))
+	}
+	if len(other.C) != 1 {
+		t.Fatalf("show 8 got %v changes, want 1", len(other.C))
+	}
+}
+
+func TestAdvanceSkipsOldGaps(t *testing.T) {
+	now := time.Now()
+	h := &Hub{cursor: 4, seen: map[int64]time.Time{
+		6: now.Add(-gapTimeout),
+		7: now,
+	}}
+
+	// 5 was rolled back, the changes after it aren't held up for good
+	h.advance(now)
+	if h.cursor != 7 || len(h.seen) != 0 {
+		t.Fatalf("cursor = %v with %v seen, want 7 with none", h.cursor, len(h.seen))
+	}
+}
@@ -3,11 +3,28 @@ package service
 import (
 	"github.com/Coderx44/MovieTicketingPortal/app"
 	"github.com/Coderx44/MovieTicketingPortal/booking"
+	"github.com/Coderx44/MovieTicketingPortal/config"
 	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/Coderx44/MovieTicketingPortal/events"
+	"github.com/Coderx44/MovieTicketingPortal/health"
+	"github.com/Coderx44/MovieTicketingPortal/idempotency"
+	"github.com/Coderx44/MovieTicketingPortal/notify"
+	"github.com/Coderx44/MovieTicketingPortal/ratelimit"
+	"github.com/Coderx44/MovieTicketingPortal/scheduler"
+	"github.com/Coderx44/MovieTicketingPortal/seatfeed"
+	"github.com/Coderx44/MovieTicketingPortal/webhook"
 )
 
 type dependencies struct {
 	BookingService booking.Service
+	Dispatcher     *notify.Dispatcher
+	Scheduler      *scheduler.Scheduler
+	Webhooks       *webhook.Dispatcher
+	Events         *events.Dispatcher
+	SeatFeed       *seatfeed.Hub
+	RateLimiter    *ratelimit.Limiter
+	Idempotency    *idempotency.Keys
+	Health         *health.Checker
 }
 
 func initDependencies() (dependencies, error) {
@@ -18,7 +35,41 @@ func initDependencies() (dependencies, error) {
 
 	bookingService := booking.NewBookingService(dbStore, logger)
 
+	channels, err := notify.NewChannels(logger)
+	if err != nil {
+		return dependencies{}, err
+	}
+
+	limits, err := ratelimit.NewStore(config.RateLimit().Store(), dbStore)
+	if err != nil {
+		return dependencies{}, err
+	}
+
+	if err = booking.LoadTicketKey(logger); err != nil {
+		return dependencies{}, err
+	}
+
+	checker, err := health.NewChecker(dbStore)
+	if err != nil {
+		return dependencies{}, err
+	}
+
+	// every domain event goes to each of these, at least once
+	eventDispatcher := events.NewDispatcher(dbStore, logger,
+		notify.NewSubscriber(dbStore),
+		events.NewAnalytics(dbStore),
+		webhook.NewSubscriber(dbStore),
+	)
+
 	return dependencies{
 		BookingService: bookingService,
+		Dispatcher:     notify.NewDispatcher(dbStore, channels, logger),
+		Webhooks:       webhook.NewDispatcher(dbStore, logger),
+		Events:         eventDispatcher,
+		SeatFeed:       seatfeed.NewHub(dbStore, logger),
+		RateLimiter:    ratelimit.NewLimiter(limits, logger, booking.RequestUser),
+		Idempotency:    idempotency.NewKeys(dbStore, logger, booking.RequestUser),
+		Health:         checker,
+		Scheduler:      scheduler.New(dbStore, logger, scheduler.Jobs(dbStore, logger, bookingService)...),
 	}, nil
 }
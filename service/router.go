@@ -6,22 +6,116 @@ import (
 
 	"github.com/Coderx44/MovieTicketingPortal/booking"
 	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/health"
+	"github.com/Coderx44/MovieTicketingPortal/seatfeed"
 	"github.com/gorilla/mux"
 )
 
+// streams are answered for as long as the client listens
+const routeSeatStream = "seat_stream"
+
+// writeTimeout gives every request but streams SERVER_WRITE_TIMEOUT_SECS to
+// be answered. It stands in for the server's WriteTimeout, which would cut
+// streams off too.
+func writeTimeout(next http.Handler) http.Handler {
+	if config.Server().WriteTimeout() <= 0 {
+		return next
+	}
+	timed := http.TimeoutHandler(next, config.Server().WriteTimeout(), "Err: Request timed out")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil && route.GetName() == routeSeatStream {
+			next.ServeHTTP(w, r)
+			return
+		}
+		timed.ServeHTTP(w, r)
+	})
+}
+
+// withProbes answers /healthz and /readyz ahead of the router, probes aren't
+// rate limited and never wait on the limiter's store.
+func withProbes(dep dependencies, router http.Handler) http.Handler {
+	probes := http.NewServeMux()
+	probes.HandleFunc("/healthz", health.Live())
+	probes.HandleFunc("/readyz", health.Ready(dep.Health))
+	probes.Handle("/", router)
+	return probes
+}
+
 func initRouter(dep dependencies) (router *mux.Router) {
 	v1 := fmt.Sprintf("application/vnd.%s.v1", config.AppName())
 	_ = v1
 	router = mux.NewRouter()
-	router.Use()
-	router.HandleFunc("/pi/{id}", booking.ValidateJWT(booking.PingHandler)).Methods(http.MethodGet)
-	router.HandleFunc("/create/user", booking.CreateNewUser(dep.BookingService)).Methods(http.MethodPost)
-	router.HandleFunc("/create/admin", booking.CreateNewUser(dep.BookingService)).Methods(http.MethodPost)
-	router.HandleFunc("/login", booking.Login(dep.BookingService)).Methods(http.MethodPost)
-	router.HandleFunc("/movie/add", booking.ValidateJWT(booking.AddMovie(dep.BookingService))).Methods(http.MethodPost)
-	router.HandleFunc("/multiplex", booking.ValidateJWT(booking.AddMultiplex(dep.BookingService))).Methods(http.MethodPost)
-	router.HandleFunc("/multiplex/{id}/screen", booking.ValidateJWT(booking.AddScreen(dep.BookingService))).Methods(http.MethodPost)
-	router.HandleFunc("/multiplex/{id}/show", booking.ValidateJWT(booking.AddShow(dep.BookingService))).Methods(http.MethodPost)
+	lim := dep.RateLimiter
+	router.Use(lim.PerIP, writeTimeout)
+	idem := dep.Idempotency
+	router.HandleFunc("/pi/{id}", booking.ValidateJWT(lim.Admin(booking.PingHandler))).Methods(http.MethodGet)
+	router.HandleFunc("/create/user", lim.Login(booking.CreateNewUser(dep.BookingService))).Methods(http.MethodPost)
+	router.HandleFunc("/create/admin", lim.Login(booking.CreateNewUser(dep.BookingService))).Methods(http.MethodPost)
+	router.HandleFunc("/create/staff", booking.ValidateJWT(lim.Admin(booking.CreateNewUser(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/staff/multiplex", booking.ValidateJWT(lim.Admin(booking.AssignStaff(dep.BookingService)))).Methods(http.MethodPut)
+	router.HandleFunc("/login", lim.Login(booking.Login(dep.BookingService))).Methods(http.MethodPost)
+	router.HandleFunc("/password/forgot", lim.Login(booking.RequestPasswordReset(dep.BookingService))).Methods(http.MethodPost)
+	router.HandleFunc("/password/reset", lim.Login(booking.ResetPassword(dep.BookingService))).Methods(http.MethodPost)
+	router.HandleFunc("/movie/add", booking.ValidateJWT(lim.Admin(booking.AddMovie(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/multiplex", booking.ValidateJWT(lim.Admin(booking.AddMultiplex(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/multiplex/{id}/screen", booking.ValidateJWT(lim.Admin(booking.AddScreen(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/multiplex/{id}/show", booking.ValidateJWT(lim.Admin(idem.Idempotent(booking.AddShow(dep.BookingService))))).Methods(http.MethodPost)
+	router.HandleFunc("/multiplex/{id}/fnb", booking.ValidateJWT(lim.Admin(booking.AddFnbItem(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/multiplex/{id}/fnb", booking.GetFnbMenu(dep.BookingService)).Methods(http.MethodGet)
+	router.HandleFunc("/multiplex/{id}/fnb/orders", booking.ValidateStaffJWT(booking.GetKitchenQueue(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/fnb/items/{id}/stock", booking.ValidateStaffJWT(booking.SetFnbStock(dep.BookingService))).Methods(http.MethodPut)
+	router.HandleFunc("/fnb/orders/{id}/status", booking.ValidateStaffJWT(booking.UpdateFnbOrder(dep.BookingService))).Methods(http.MethodPost)
+	router.HandleFunc("/shows", booking.ListShows(dep.BookingService)).Methods(http.MethodGet)
+	router.HandleFunc("/shows/{id}/cancel", booking.ValidateJWT(lim.Admin(booking.CancelShow(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/shows/{id}/reschedule", booking.ValidateJWT(lim.Admin(booking.RescheduleShow(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/me", booking.ValidateUserJWT(booking.GetProfile(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/me", booking.ValidateUserJWT(booking.UpdateProfile(dep.BookingService))).Methods(http.MethodPut)
+	router.HandleFunc("/me/password", booking.ValidateUserJWT(booking.ChangePassword(dep.BookingService))).Methods(http.MethodPut)
+	router.HandleFunc("/me/bookings", booking.ValidateUserJWT(booking.ListMyBookings(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/me/bookings/{id}/ticket", booking.ValidateUserJWT(booking.DownloadTicket(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/me/bookings/{id}/cancel", booking.ValidateUserJWT(lim.Booking(booking.CancelBooking(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/me/bookings/{id}/seats", booking.ValidateUserJWT(lim.Booking(booking.ReseatBooking(dep.BookingService)))).Methods(http.MethodPut)
+	router.HandleFunc("/me/bookings/{id}/invoice", booking.ValidateUserJWT(booking.GetInvoice(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/me/loyalty", booking.ValidateUserJWT(booking.GetLoyaltyStatement(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/me/wallet", booking.ValidateUserJWT(booking.GetWallet(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/tickets/public-key", booking.GetTicketPublicKey()).Methods(http.MethodGet)
+	router.HandleFunc("/checkin", booking.ValidateStaffJWT(booking.CheckInTicket(dep.BookingService))).Methods(http.MethodPost)
+	router.HandleFunc("/shows/{id}/seats", booking.GetSeatMap(dep.BookingService)).Methods(http.MethodGet)
+	router.HandleFunc("/shows/{id}/seats/stream", seatfeed.Stream(dep.SeatFeed, dep.BookingService)).Methods(http.MethodGet).Name(routeSeatStream)
+	router.HandleFunc("/shows/{id}/quote", booking.ValidateUserJWT(lim.Booking(booking.WaitingRoom(dep.BookingService, booking.QuoteBooking(dep.BookingService))))).Methods(http.MethodPost)
+	router.HandleFunc("/shows/{id}/bookings", booking.ValidateUserJWT(lim.Booking(booking.WaitingRoom(dep.BookingService, idem.Idempotent(booking.BookShow(dep.BookingService)))))).Methods(http.MethodPost)
+	router.HandleFunc("/shows/{id}/queue", booking.ValidateUserJWT(lim.Booking(booking.JoinQueue(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/shows/{id}/queue", booking.ValidateUserJWT(booking.GetQueueStatus(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/shows/{id}/waitlist", booking.ValidateUserJWT(lim.Booking(booking.JoinWaitlist(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/shows/{id}/waitlist", booking.ValidateUserJWT(booking.GetWaitlistStatus(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/shows/{id}/waitlist", booking.ValidateUserJWT(booking.LeaveWaitlist(dep.BookingService))).Methods(http.MethodDelete)
+	router.HandleFunc("/coupons", booking.ValidateJWT(lim.Admin(booking.AddCoupon(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/coupons", booking.ValidateJWT(lim.Admin(booking.ListCoupons(dep.BookingService)))).Methods(http.MethodGet)
+	router.HandleFunc("/coupons/{id}/deactivate", booking.ValidateJWT(lim.Admin(booking.DeactivateCoupon(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/gift-cards", booking.ValidateJWT(lim.Admin(idem.Idempotent(booking.IssueGiftCard(dep.BookingService))))).Methods(http.MethodPost)
+	router.HandleFunc("/gift-cards", booking.ValidateJWT(lim.Admin(booking.ListGiftCards(dep.BookingService)))).Methods(http.MethodGet)
+	router.HandleFunc("/gift-cards/{id}/void", booking.ValidateJWT(lim.Admin(booking.VoidGiftCard(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/gift-cards/{code}", booking.ValidateUserJWT(booking.GetGiftCardBalance(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks", booking.ValidateJWT(lim.Admin(booking.AddWebhook(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/webhooks", booking.ValidateJWT(lim.Admin(booking.ListWebhooks(dep.BookingService)))).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/{id}/deactivate", booking.ValidateJWT(lim.Admin(booking.DeactivateWebhook(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/webhooks/{id}/deliveries", booking.ValidateJWT(lim.Admin(booking.ListWebhookDeliveries(dep.BookingService)))).Methods(http.MethodGet)
+	router.HandleFunc("/webhook-deliveries/{id}/redeliver", booking.ValidateJWT(lim.Admin(booking.RedeliverWebhook(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/waiting-rooms", booking.ValidateJWT(lim.Admin(booking.OpenWaitingRoom(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/waiting-rooms", booking.ValidateJWT(lim.Admin(booking.ListWaitingRooms(dep.BookingService)))).Methods(http.MethodGet)
+	router.HandleFunc("/waiting-rooms/{id}/close", booking.ValidateJWT(lim.Admin(booking.CloseWaitingRoom(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/pricing-rules", booking.ValidateJWT(lim.Admin(booking.AddPricingRule(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/pricing-rules", booking.ValidateJWT(lim.Admin(booking.ListPricingRules(dep.BookingService)))).Methods(http.MethodGet)
+	router.HandleFunc("/pricing-rules/{id}/deactivate", booking.ValidateJWT(lim.Admin(booking.DeactivatePricingRule(dep.BookingService)))).Methods(http.MethodPost)
+	router.HandleFunc("/shows/{id}/price-history", booking.ValidateJWT(lim.Admin(booking.GetPriceHistory(dep.BookingService)))).Methods(http.MethodGet)
+	router.HandleFunc("/taxes", booking.ValidateJWT(lim.Admin(booking.ListTaxRates(dep.BookingService)))).Methods(http.MethodGet)
+	router.HandleFunc("/taxes/{state}", booking.ValidateJWT(lim.Admin(booking.SetTaxRates(dep.BookingService)))).Methods(http.MethodPut)
+	router.HandleFunc("/shows/{id}/admissions", booking.ValidateStaffJWT(booking.GetAdmissions(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/pos/shifts", booking.ValidateStaffJWT(booking.OpenShift(dep.BookingService))).Methods(http.MethodPost)
+	router.HandleFunc("/pos/shifts/current", booking.ValidateStaffJWT(booking.CurrentShift(dep.BookingService))).Methods(http.MethodGet)
+	router.HandleFunc("/pos/shifts/current/close", booking.ValidateStaffJWT(booking.CloseShift(dep.BookingService))).Methods(http.MethodPost)
+	router.HandleFunc("/pos/shows/{id}/bookings", booking.ValidateStaffJWT(lim.Booking(idem.Idempotent(booking.PosBook(dep.BookingService))))).Methods(http.MethodPost)
+	router.HandleFunc("/pos/bookings/{id}/ticket", booking.ValidateStaffJWT(booking.PrintPosTicket(dep.BookingService))).Methods(http.MethodGet)
 
 	return
 }
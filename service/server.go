@@ -1,26 +1,140 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/Coderx44/MovieTicketingPortal/app"
 	"github.com/Coderx44/MovieTicketingPortal/config"
 	"github.com/urfave/negroni"
 )
 
-func StartApiServer() {
+// workers runs background loops until their context is done.
+type workers struct {
+	wg sync.WaitGroup
+}
+
+func (ws *workers) start(ctx context.Context, run func(ctx context.Context)) {
+	ws.wg.Add(1)
+	go func() {
+		defer ws.wg.Done()
+		run(ctx)
+	}()
+}
+
+// StartApiServer serves the API until SIGTERM or an interrupt. It then fails
+// readiness for the drain delay, stops accepting connections, lets in-flight
+// requests finish, stops the background workers and closes the database.
+func StartApiServer() error {
 	port := config.AppPort()
-	server := negroni.Classic()
+	n := negroni.Classic()
 
 	dependencies, err := initDependencies()
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// workers get their own context, they outlive the signal until requests
+	// have drained
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var ws workers
+	ws.start(workerCtx, dependencies.Events.Run)
+	ws.start(workerCtx, dependencies.Dispatcher.Run)
+	ws.start(workerCtx, dependencies.Webhooks.Run)
+	ws.start(workerCtx, dependencies.SeatFeed.Run)
+	dependencies.Health.Watch("events", dependencies.Events)
+	dependencies.Health.Watch("notifications", dependencies.Dispatcher)
+	dependencies.Health.Watch("webhooks", dependencies.Webhooks)
+	dependencies.Health.Watch("seat_feed", dependencies.SeatFeed)
+	if config.Scheduler().Enabled() {
+		ws.start(workerCtx, dependencies.Scheduler.Run)
+		dependencies.Health.Watch("scheduler", dependencies.Scheduler)
 	}
 
 	router := initRouter(dependencies)
-	server.UseHandler(router)
+	n.UseHandler(withProbes(dependencies, router))
+
+	c := config.Server()
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%s", strconv.Itoa(port)),
+		Handler:           n,
+		ReadTimeout:       c.ReadTimeout(),
+		ReadHeaderTimeout: c.ReadHeaderTimeout(),
+		// left to the router, which keeps it off streams
+		WriteTimeout: 0,
+		IdleTimeout:  c.IdleTimeout(),
+	}
+	// streams would hold the shutdown up until it times out
+	server.RegisterOnShutdown(dependencies.SeatFeed.Close)
+
+	logger := app.GetLogger()
+	served := make(chan error, 1)
+	go func() {
+		logger.Infof("Listening on %v", server.Addr)
+		served <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-served:
+		stopWorkers()
+		ws.wg.Wait()
+		return err
+	case <-ctx.Done():
+		// a second signal kills the server outright
+		stop()
+	}
+
+	dependencies.Health.Drain()
+	logger.Infof("Shutting down, taking new requests for %v while readiness fails", c.DrainDelay())
+	time.Sleep(c.DrainDelay())
+
+	logger.Infof("Draining requests for up to %v", c.ShutdownTimeout())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout())
+	defer cancel()
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		logger.Errorf("Err: Draining requests: %v", err.Error())
+		server.Close()
+	}
+
+	stopWorkers()
+	ws.wg.Wait()
+	logger.Infof("Background workers stopped")
+
+	app.Close()
+	return nil
+}
+
+// StartScheduler runs the background jobs and the event, notification and
+// webhook dispatchers on their own, until interrupted. It returns once they
+// have all stopped.
+func StartScheduler() error {
+	dependencies, err := initDependencies()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	addr := fmt.Sprintf(":%s", strconv.Itoa(port))
-	server.Run(addr)
+	var ws workers
+	ws.start(ctx, dependencies.Events.Run)
+	ws.start(ctx, dependencies.Dispatcher.Run)
+	ws.start(ctx, dependencies.Webhooks.Run)
+	ws.start(ctx, dependencies.Scheduler.Run)
+	ws.wg.Wait()
 
+	app.Close()
+	return nil
 }
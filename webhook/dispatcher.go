@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/config"
+	"github.com/Coderx44/MovieTicketingPortal/db"
+	"github.com/Coderx44/MovieTicketingPortal/outbox"
+	"go.uber.org/zap"
+)
+
+// how much of a failed response is kept in the delivery log
+const maxErrorBody = 512
+
+var backoff = outbox.Backoff{Min: 30 * time.Second, Max: 6 * time.Hour}
+
+// Dispatcher sends queued deliveries to partners. Like the notification
+// dispatcher it is safe to run one per replica.
+type Dispatcher struct {
+	*outbox.Poller
+	store       db.Storer
+	logger      *zap.SugaredLogger
+	client      *http.Client
+	batchSize   int
+	maxAttempts int
+	lease       time.Duration
+}
+
+func NewDispatcher(s db.Storer, l *zap.SugaredLogger) *Dispatcher {
+	c := config.Webhook()
+	d := &Dispatcher{
+		store:       s,
+		logger:      l,
+		client:      &http.Client{Timeout: c.Timeout()},
+		batchSize:   c.BatchSize(),
+		maxAttempts: c.MaxAttempts(),
+		// every delivery of a batch may run into the timeout
+		lease: time.Duration(c.BatchSize()+1) * c.Timeout(),
+	}
+	d.Poller = outbox.NewPoller("webhooks", l, c.PollInterval(), c.BatchSize(), d.DispatchPending)
+	return d
+}
+
+// DispatchPending sends one batch of due deliveries and returns how many it
+// claimed.
+func (d *Dispatcher) DispatchPending(ctx context.Context) (n int, err error) {
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, d.batchSize, d.lease)
+	if err != nil {
+		return
+	}
+
+	for _, w := range deliveries {
+		r := d.deliver(ctx, w)
+		// a delivery cut short by shutdown isn't the partner's failure, it
+		// goes out again once its lease runs out
+		if r.Status != db.WebhookDelivered && ctx.Err() != nil {
+			continue
+		}
+		if err := d.store.RecordWebhookAttempt(context.Background(), r); err != nil {
+			d.logger.Errorf("Err: Recording webhook delivery %v: %v", w.Delivery_id, err.Error())
+		}
+	}
+	return len(deliveries), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, w db.WebhookDelivery) (r db.WebhookResult) {
+	r = db.WebhookResult{
+		Delivery_id:     w.Delivery_id,
+		Next_attempt_at: time.Now(),
+	}
+
+	start := time.Now()
+	r.Status_code, r.Error = d.post(ctx, w)
+	r.Duration = time.Since(start)
+
+	switch {
+	case r.Error == "":
+		r.Status = db.WebhookDelivered
+	case w.Attempts+1 >= d.maxAttempts:
+		r.Status = db.WebhookDead
+		d.logger.Errorf("Err: Webhook delivery %v to %v is dead: %v", w.Delivery_id, w.Url, r.Error)
+	default:
+		r.Status = db.WebhookPending
+		r.Next_attempt_at = time.Now().Add(backoff.After(w.Attempts))
+	}
+	return
+}
+
+// post sends a delivery and returns the status code it got, if any, and why
+// it failed.
+func (d *Dispatcher) post(ctx context.Context, w db.WebhookDelivery) (code int, failure string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Url, bytes.NewReader(w.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, w.Event)
+	req.Header.Set(HeaderEventID, w.Event_id)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(w.Delivery_id))
+	req.Header.Set(HeaderSignature, Sign(w.Secret, time.Now(), w.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp.StatusCode, strings.TrimSpace(fmt.Sprintf("%s: %s", resp.Status, body))
+	}
+	return resp.StatusCode, ""
+}
@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1","type":"booking.created"}`)
+	sent := time.Unix(1684500000, 0)
+	header := Sign("s3cret", sent, body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		ok     bool
+	}{
+		{"as sent", "s3cret", header, body, sent.Add(time.Minute), true},
+		{"wrong secret", "other", header, body, sent, false},
+		{"tampered body", "s3cret", header, []byte(`{"id":"evt_2","type":"booking.created"}`), sent, false},
+		{"replayed too late", "s3cret", header, body, sent.Add(10 * time.Minute), false},
+		{"from the future", "s3cret", header, body, sent.Add(-10 * time.Minute), false},
+		{"no signature", "s3cret", "t=1684500000", body, sent, false},
+		{"garbage", "s3cret", "v1", body, sent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now); ok != tt.ok {
+				t.Fatalf("Verify(%q) = %v, want %v", tt.header, ok, tt.ok)
+			}
+		})
+	}
+}
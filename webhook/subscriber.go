@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/Coderx44/MovieTicketingPortal/db"
+)
+
+const SubscriberName = "webhooks"
+
+// Events partners can subscribe to
+const (
+	EventBookingCreated   = "booking.created"
+	EventBookingCancelled = "booking.cancelled"
+	EventShowCreated      = "show.created"
+	EventShowUpdated      = "show.updated"
+	EventShowCancelled    = "show.cancelled"
+)
+
+// partnerEvents maps domain events to the events partners see.
+var partnerEvents = map[string]string{
+	db.EventSeatsBooked:      EventBookingCreated,
+	db.EventBookingCancelled: EventBookingCancelled,
+	db.EventShowAdded:        EventShowCreated,
+	db.EventShowRescheduled:  EventShowUpdated,
+	db.EventShowCancelled:    EventShowCancelled,
+}
+
+// KnownEvent tells whether partners can subscribe to event.
+func KnownEvent(event string) bool {
+	if event == db.WebhookAllEvents {
+		return true
+	}
+	for _, e := range partnerEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// envelope is the body every webhook is sent with.
+type envelope struct {
+	Id         string      `json:"id"`
+	Type       string      `json:"type"`
+	Created_at string      `json:"created_at"`
+	Data       interface{} `json:"data"`
+}
+
+type bookingData struct {
+	Booking_id int     `json:"booking_id"`
+	Show_id    int     `json:"show_id"`
+	Seats      []int64 `json:"seats"`
+	Channel    string  `json:"channel"`
+	Amount     int     `json:"amount"`
+	Currency   string  `json:"currency"`
+}
+
+type cancellationData struct {
+	Booking_id    int     `json:"booking_id"`
+	Show_id       int     `json:"show_id"`
+	Seats         []int64 `json:"seats"`
+	Reason        string  `json:"reason"`
+	Refund_amount int     `json:"refund_amount"`
+}
+
+type showData struct {
+	Show_id      int    `json:"show_id"`
+	Status       string `json:"status"`
+	Show_date    string `json:"show_date"`
+	Start_time   string `json:"start_time"`
+	End_time     string `json:"end_time"`
+	Time_zone    string `json:"time_zone"`
+	Movie        string `json:"movie"`
+	Screen       int    `json:"screen"`
+	Multiplex_id int    `json:"multiplex_id"`
+	Multiplex    string `json:"multiplex"`
+}
+
+type showCancelledData struct {
+	Show_id            int    `json:"show_id"`
+	Reason             string `json:"reason"`
+	Bookings_cancelled int    `json:"bookings_cancelled"`
+}
+
+// Subscriber queues a delivery of every domain event partners care about to
+// the subscriptions that want it. Partner event ids come from the outbox, so
+// handling an event twice queues nothing new.
+type Subscriber struct {
+	store db.Storer
+}
+
+func NewSubscriber(s db.Storer) *Subscriber {
+	return &Subscriber{store: s}
+}
+
+func (s *Subscriber) Name() string {
+	return SubscriberName
+}
+
+func (s *Subscriber) Handle(ctx context.Context, e db.Event) (err error) {
+	event, ok := partnerEvents[e.Type]
+	if !ok {
+		return
+	}
+
+	data, err := partnerData(e)
+	if err != nil {
+		return
+	}
+
+	id := "evt_" + strconv.FormatInt(e.Event_id, 10)
+	payload, err := json.Marshal(envelope{
+		Id:         id,
+		Type:       event,
+		Created_at: e.Created_at.UTC().Format(time.RFC3339),
+		Data:       data,
+	})
+	if err != nil {
+		return
+	}
+
+	_, err = s.store.QueueWebhookEvent(ctx, db.WebhookEvent{Event_id: id, Event: event, Payload: payload})
+	return
+}
+
+func partnerData(e db.Event) (data interface{}, err error) {
+	switch e.Type {
+	case db.EventSeatsBooked:
+		var ev db.SeatsBookedEvent
+		err = e.Decode(&ev)
+		data = bookingData{ev.Booking_id, ev.Show_id, ev.Seats, ev.Channel, ev.Amount, ev.Currency}
+	case db.EventBookingCancelled:
+		var ev db.BookingCancelledEvent
+		err = e.Decode(&ev)
+		data = cancellationData{ev.Booking_id, ev.Show_id, ev.Seats, ev.Reason, ev.Refund_amount}
+	case db.EventShowAdded, db.EventShowRescheduled:
+		var ev db.ShowAddedEvent
+		err = e.Decode(&ev)
+		data = newShowData(ev.ShowDetail)
+	case db.EventShowCancelled:
+		var ev db.ShowCancelledEvent
+		err = e.Decode(&ev)
+		data = showCancelledData{ev.Show_id, ev.Reason, ev.Bookings_cancelled}
+	}
+	return
+}
+
+// newShowData gives show times in the time zone of the multiplex.
+func newShowData(d db.ShowDetail) showData {
+	loc, err := time.LoadLocation(d.Time_zone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return showData{
+		Show_id:      d.Show_id,
+		Status:       d.Status,
+		Show_date:    d.Show_date.Format("2006-01-02"),
+		Start_time:   d.Start_time.In(loc).Format(time.RFC3339),
+		End_time:     d.End_time.In(loc).Format(time.RFC3339),
+		Time_zone:    d.Time_zone,
+		Movie:        d.Movie,
+		Screen:       d.Screen_number,
+		Multiplex_id: d.Multiplex_id,
+		Multiplex:    d.Multiplex,
+	}
+}